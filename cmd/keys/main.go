@@ -0,0 +1,205 @@
+// Command keys manages the keys session tokens are signed with. A rotation
+// publishes a new key first, activates it once verifiers had time to fetch
+// the JWKS, and retires the old key once the tokens it signed expired:
+//
+//	keys list
+//	keys generate -alg EdDSA
+//	keys activate <kid>
+//	keys retire <kid>
+//
+// keys rotate generates and activates a key in one step.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/keyring"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: keys list | generate [-alg EdDSA|RS256] | rotate [-alg EdDSA|RS256] | activate <kid> | retire <kid>")
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("Warning: Failed to load environment variables", err)
+	}
+
+	cfg := config.LoadConfig()
+
+	db, err := sql.Open("postgres", cfg.PostgresURI)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		log.Fatalf("Database is unreachable: %v", err)
+	}
+
+	r := repository.NewSigningKeyRepository(db)
+	ctx := context.Background()
+
+	cmd, args := flag.Arg(0), flag.Args()[1:]
+	switch cmd {
+	case "list":
+		err = list(ctx, r)
+	case "generate", "rotate":
+		flags := flag.NewFlagSet(cmd, flag.ExitOnError)
+		alg := flags.String("alg", keyring.EdDSA, "signing algorithm, EdDSA or RS256")
+		flags.Parse(args)
+		err = generate(ctx, cfg, r, *alg, cmd == "rotate")
+	case "activate":
+		err = withKID(args, func(kid string) error { return activate(ctx, r, kid) })
+	case "retire":
+		err = withKID(args, func(kid string) error { return retire(ctx, r, kid) })
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatalf("%s failed: %v", cmd, err)
+	}
+}
+
+func withKID(args []string, f func(kid string) error) error {
+	if len(args) != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	return f(args[0])
+}
+
+func list(ctx context.Context, r repository.SigningKeyRepository) error {
+	keys, err := r.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	signer := signingKey(keys)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KID\tALGORITHM\tSTATUS\tCREATED\tACTIVATED\tRETIRED")
+	for _, k := range keys {
+		status := "published"
+		switch {
+		case k.RetiredAt != nil:
+			status = "retired"
+		case k == signer:
+			status = "signing"
+		case k.ActivatedAt != nil:
+			status = "verifying"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", k.KID, k.Algorithm, status, formatTime(&k.CreatedAt), formatTime(k.ActivatedAt), formatTime(k.RetiredAt))
+	}
+	return w.Flush()
+}
+
+func generate(ctx context.Context, cfg *config.Config, r repository.SigningKeyRepository, alg string, activate bool) error {
+	key, err := keyring.Generate(alg, cfg.KeyEncryptionKey)
+	if err != nil {
+		return err
+	}
+
+	if activate {
+		now := time.Now()
+		key.ActivatedAt = &now
+	}
+
+	if err := r.Create(ctx, key); err != nil {
+		return err
+	}
+
+	if activate {
+		fmt.Printf("Generated %s key %s, it signs new tokens from now on\n", key.Algorithm, key.KID)
+	} else {
+		fmt.Printf("Generated %s key %s, activate it once verifiers have fetched the JWKS\n", key.Algorithm, key.KID)
+	}
+	return nil
+}
+
+func activate(ctx context.Context, r repository.SigningKeyRepository, kid string) error {
+	activated, err := r.Activate(ctx, kid)
+	if err != nil {
+		return err
+	}
+
+	if !activated {
+		return fmt.Errorf("no key %s that isn't retired", kid)
+	}
+
+	fmt.Printf("Key %s signs new tokens from now on\n", kid)
+	return nil
+}
+
+// retire refuses to retire the last activated key, which would leave the
+// server unable to sign sessions.
+func retire(ctx context.Context, r repository.SigningKeyRepository, kid string) error {
+	keys, err := r.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	var remaining []*models.SigningKey
+	for _, k := range keys {
+		if k.KID != kid {
+			remaining = append(remaining, k)
+		}
+	}
+	if len(remaining) == len(keys) {
+		return fmt.Errorf("no key %s", kid)
+	}
+	if signingKey(remaining) == nil {
+		return errors.New("it is the last activated key, activate another key first")
+	}
+
+	retired, err := r.Retire(ctx, kid)
+	if err != nil {
+		return err
+	}
+
+	if !retired {
+		return fmt.Errorf("key %s is already retired", kid)
+	}
+
+	fmt.Printf("Key %s is retired, tokens it signed are no longer accepted\n", kid)
+	return nil
+}
+
+// signingKey returns the key the server signs with: the most recently
+// activated one that isn't retired.
+func signingKey(keys []*models.SigningKey) *models.SigningKey {
+	var signer *models.SigningKey
+	for _, k := range keys {
+		if k.RetiredAt == nil && k.ActivatedAt != nil && (signer == nil || k.ActivatedAt.After(*signer.ActivatedAt)) {
+			signer = k
+		}
+	}
+	return signer
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format(time.DateTime)
+}
@@ -0,0 +1,140 @@
+// Command reconcile compares a payment provider's sales export to the
+// recorded payment events and credit grants, and reports the sales whose
+// webhooks were lost or failed. With -apply it processes those sales again;
+// without it nothing is written.
+//
+//	reconcile -provider gumroad -file sales.csv
+//	reconcile -provider stripe -file payments.json -apply
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/payment"
+	"github.com/maheshrc27/postflow/internal/repository"
+	"github.com/maheshrc27/postflow/internal/service"
+)
+
+func main() {
+	provider := flag.String("provider", "", "payment provider the export is from (gumroad or stripe)")
+	file := flag.String("file", "", "sales export to reconcile, - for stdin")
+	format := flag.String("format", "", "export format, csv or json (default: from the file extension)")
+	apply := flag.Bool("apply", false, "process missing and failed sales again instead of only reporting them")
+	flag.Parse()
+
+	if *provider == "" || *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(*file), ".")
+	}
+
+	sales, err := readSales(*provider, *format, *file)
+	if err != nil {
+		log.Fatalf("Failed to read export: %v", err)
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("Warning: Failed to load environment variables", err)
+	}
+
+	cfg := config.LoadConfig()
+
+	db, err := sql.Open("postgres", cfg.PostgresURI)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		log.Fatalf("Database is unreachable: %v", err)
+	}
+
+	userRepo := repository.NewUserRepository(db)
+	creditsRepo := repository.NewCreditsRepository(db)
+	paymentEventRepo := repository.NewPaymentEventRepository(db)
+	productRepo := repository.NewProductRepository(db)
+
+	paymentProviders := payment.Providers{}
+	paymentProviders.Register(payment.NewGumroad(cfg.PaymentWebhookSecret))
+	if cfg.Stripe.SecretKey != "" {
+		paymentProviders.Register(payment.NewStripe(cfg.Stripe.SecretKey, cfg.Stripe.WebhookSecret, cfg.Stripe.APIURL))
+	}
+
+	referralService := service.NewReferralService(*cfg, repository.NewReferralRepository(db))
+	subscriptionService := service.NewSubscriptionService(repository.NewSubscriptionRepository(db), productRepo, creditsRepo, paymentProviders)
+	orderService := service.NewOrderService(cfg.Invoice, userRepo, repository.NewOrderRepository(db))
+	couponService := service.NewCouponService(cfg.Credits, repository.NewCouponRepository(db))
+	pricingService := service.NewPricingService(repository.NewPriceListRepository(db), nil)
+	paymentService := service.NewPaymentService(*cfg, userRepo, creditsRepo, paymentEventRepo, productRepo, subscriptionService, couponService, referralService, orderService, pricingService, paymentProviders)
+	reconcileService := service.NewReconcileService(creditsRepo, paymentEventRepo, paymentService)
+
+	report, err := reconcileService.Reconcile(context.Background(), sales, *apply)
+	if err != nil {
+		log.Fatalf("Failed to reconcile: %v", err)
+	}
+
+	if !printReport(report, *apply) {
+		os.Exit(1)
+	}
+}
+
+func readSales(provider, format, file string) ([]*payment.Event, error) {
+	if file == "-" {
+		return payment.ReadExport(provider, format, os.Stdin)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return payment.ReadExport(provider, format, f)
+}
+
+// printReport writes the mismatches as a table and reports whether every
+// sale matches now.
+func printReport(report *models.ReconcileReport, apply bool) bool {
+	unresolved := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if len(report.Mismatches) > 0 {
+		fmt.Fprintln(w, "SALE\tEMAIL\tPROBLEM\tDETAIL\tRESULT")
+	}
+	for _, m := range report.Mismatches {
+		result := "not applied"
+		switch {
+		case m.Applied:
+			result = "applied"
+		case m.Error != "":
+			result = "error: " + m.Error
+		}
+		if !m.Applied {
+			unresolved++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.SaleID, m.Email, m.Problem, m.Detail, result)
+	}
+	w.Flush()
+
+	mode := "dry run"
+	if apply {
+		mode = "applied"
+	}
+	fmt.Printf("\n%d sales checked, %d mismatched, %d unresolved (%s)\n", report.Checked, len(report.Mismatches), unresolved, mode)
+
+	return unresolved == 0
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
@@ -17,8 +18,15 @@ import (
 	config "github.com/maheshrc27/postflow/configs"
 	"github.com/maheshrc27/postflow/internal/api/handlers"
 	"github.com/maheshrc27/postflow/internal/api/middleware"
+	"github.com/maheshrc27/postflow/internal/geoip"
+	"github.com/maheshrc27/postflow/internal/identity"
+	"github.com/maheshrc27/postflow/internal/keyring"
+	"github.com/maheshrc27/postflow/internal/mailer"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/payment"
 	"github.com/maheshrc27/postflow/internal/repository"
 	"github.com/maheshrc27/postflow/internal/service"
+	"github.com/maheshrc27/postflow/internal/worker"
 )
 
 func main() {
@@ -39,9 +47,15 @@ func main() {
 	}
 
 	app := fiber.New(fiber.Config{
-		ReadTimeout:  10 * time.Minute,
-		WriteTimeout: 10 * time.Minute,
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 30 * time.Second,
 		BodyLimit:    100 * 1024 * 1024, // 100 MB
+		// Behind a reverse proxy, rate limits and geoip pricing need the
+		// client's address rather than the proxy's.
+		ProxyHeader:             cfg.ProxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.TrustedProxies,
+		EnableIPValidation:      true,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			log.Printf("Error: %v", err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
@@ -60,33 +74,194 @@ func main() {
 	userRepo := repository.NewUserRepository(db)
 	mediaAssetRepo := repository.NewMediaAssetRepository(db)
 	creditsRepo := repository.NewCreditsRepository(db)
+	videoJobRepo := repository.NewVideoJobRepository(db)
+	paymentEventRepo := repository.NewPaymentEventRepository(db)
+	productRepo := repository.NewProductRepository(db)
+	subscriptionRepo := repository.NewSubscriptionRepository(db)
+	couponRepo := repository.NewCouponRepository(db)
+	referralRepo := repository.NewReferralRepository(db)
+	creditTransferRepo := repository.NewCreditTransferRepository(db)
+	orderRepo := repository.NewOrderRepository(db)
+	priceListRepo := repository.NewPriceListRepository(db)
+	emailClaimRepo := repository.NewEmailClaimRepository(db)
+	identityRepo := repository.NewIdentityRepository(db)
+	loginLinkRepo := repository.NewLoginLinkRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	signingKeyRepo := repository.NewSigningKeyRepository(db)
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
+	twoFactorRepo := repository.NewTwoFactorRepository(db)
 
-	authService := service.NewAuthService(*cfg, userRepo, creditsRepo)
+	keys := keyring.New(signingKeyRepo, cfg.KeyEncryptionKey)
+	if err := keys.Load(context.Background()); err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+	if !keys.CanSign(context.Background()) {
+		log.Println("Warning: No signing key is activated, generating one. Manage keys with cmd/keys")
+		if err := generateSigningKey(context.Background(), cfg, signingKeyRepo, keys); err != nil {
+			log.Fatalf("Failed to generate signing key: %v", err)
+		}
+	}
+
+	var geo *geoip.DB
+	if cfg.GeoIPDatabase != "" {
+		if geo, err = geoip.Open(cfg.GeoIPDatabase); err != nil {
+			log.Printf("Warning: Failed to load GeoIP database: %v", err)
+		}
+	}
+
+	var mail mailer.Mailer = mailer.NewMemory()
+	if cfg.SMTP.Host != "" {
+		if mail, err = mailer.NewSMTP(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.From); err != nil {
+			log.Fatalf("Failed to configure mailer: %v", err)
+		}
+	} else {
+		log.Println("Warning: SMTP_HOST is not set, emails are only logged")
+	}
+
+	loginProviders := identity.Registry{}
+	for _, p := range cfg.LoginProviders {
+		if p.Name == identity.ProviderGitHub {
+			loginProviders.Register(identity.NewGitHub(p.ClientID, p.ClientSecret, p.RedirectURI, nil))
+			continue
+		}
+		loginProviders.Register(identity.NewOIDC(identity.OIDCConfig{
+			Name:         p.Name,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURI,
+		}, nil))
+	}
+
+	referralService := service.NewReferralService(*cfg, referralRepo)
+	authService := service.NewAuthService(*cfg, userRepo, creditsRepo, identityRepo, loginLinkRepo, referralService, mail, loginProviders)
 	userService := service.NewUserService(userRepo)
+	sessionService := service.NewSessionService(*cfg, sessionRepo, keys)
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo)
+	twoFactorService := service.NewTwoFactorService(*cfg, userRepo, twoFactorRepo, sessionRepo)
+	emailClaimService := service.NewEmailClaimService(*cfg, userRepo, emailClaimRepo, identityRepo, mail)
 	creditsService := service.NewCreditsService(creditsRepo)
-	videoService := service.NewVideoService(creditsRepo, mediaAssetRepo, *cfg)
-	paymentService := service.NewPaymentService(*cfg, userRepo, creditsRepo)
+	creditTransferService := service.NewCreditTransferService(cfg.Transfers, userRepo, creditTransferRepo)
+	entitlementService := service.NewEntitlementService(subscriptionRepo, productRepo, creditsRepo)
+	videoService := service.NewVideoService(userRepo, creditsRepo, mediaAssetRepo, videoJobRepo, entitlementService, *cfg)
+	paymentProviders := payment.Providers{}
+	paymentProviders.Register(payment.NewGumroad(cfg.PaymentWebhookSecret))
+	if cfg.Stripe.SecretKey != "" {
+		paymentProviders.Register(payment.NewStripe(cfg.Stripe.SecretKey, cfg.Stripe.WebhookSecret, cfg.Stripe.APIURL))
+	}
+
+	subscriptionService := service.NewSubscriptionService(subscriptionRepo, productRepo, creditsRepo, paymentProviders)
+	orderService := service.NewOrderService(cfg.Invoice, userRepo, orderRepo)
+	couponService := service.NewCouponService(cfg.Credits, couponRepo)
+	pricingService := service.NewPricingService(priceListRepo, geo)
+	paymentService := service.NewPaymentService(*cfg, userRepo, creditsRepo, paymentEventRepo, productRepo, subscriptionService, couponService, referralService, orderService, pricingService, paymentProviders)
 
-	auth := handlers.NewAuthHandler(*cfg, authService)
+	auth := handlers.NewAuthHandler(*cfg, authService, sessionService, twoFactorService)
 	app.Get("/login", auth.Login)
 	app.Get("/login/callback", auth.LoginCallbackHandler)
+	app.Post("/login/email", auth.EmailLogin)
+	app.Get("/login/email/verify", auth.VerifyEmailLogin)
+	app.Post("/login/2fa", auth.TwoFactorLogin)
+	app.Get("/login/:provider", auth.Login)
+	app.Get("/login/:provider/callback", auth.LoginCallbackHandler)
+	app.Post("/auth/refresh", auth.Refresh)
 
-	payment := handlers.NewPaymentHandler(paymentService)
-	app.Post("/payment/webhook", payment.PaymentWebhook)
+	jwks := handlers.NewKeysHandler(keys)
+	app.Get("/.well-known/jwks.json", jwks.JWKS)
+
+	payments := handlers.NewPaymentHandler(paymentService)
+	app.Post("/payment/webhook", payments.PaymentWebhook)
+	app.Post("/payment/webhook/:provider", payments.PaymentWebhook)
+	app.Get("/pricing", payments.GetPricing)
+
+	requireAuth := func(scopes ...string) fiber.Handler {
+		return middleware.AuthMiddleware(cfg, sessionService, keys, apiKeyService, scopes...)
+	}
 
 	api := app.Group("/api")
-	api.Use(middleware.AuthMiddleware(cfg))
+
+	// Routes API keys can call, with the scopes they need. They must be
+	// registered before the middleware of the other routes, which only
+	// accepts session cookies.
+	credits := handlers.NewCreditsHandler(creditsService)
+	api.Get("/credits", requireAuth(models.ScopeCreditsRead), credits.GetCredits)
+	api.Get("/credits/history", requireAuth(models.ScopeCreditsRead), credits.GetHistory)
+
+	video := handlers.NewVideoHandler(videoService)
+	api.Get("/videos", requireAuth(models.ScopeVideosRead), video.GetVideos)
+	api.Post("/generate", requireAuth(models.ScopeVideosGenerate), video.CreateVideo)
+	api.Get("/jobs/:id", requireAuth(models.ScopeVideosRead), video.GetJob)
+
+	api.Use(requireAuth())
+	// Sensitive actions need a recent two-factor code on the session.
+	requireTwoFactor := middleware.TwoFactorMiddleware(twoFactorService)
+
+	sessions := handlers.NewSessionHandler(sessionService, *cfg)
+	api.Post("/logout", sessions.Logout)
+	api.Post("/logout-all", sessions.LogoutAll)
+	api.Get("/sessions", sessions.ListSessions)
+	api.Post("/sessions/:id/revoke", sessions.RevokeSession)
 
 	user := handlers.NewUserHandler(userService, *cfg)
 	api.Get("/user/info", user.GetUserInfo)
-	api.Post("/user/delete", user.DeleteAccount)
+	api.Post("/user/delete", requireTwoFactor, user.DeleteAccount)
+	api.Put("/user/billing", user.UpdateBilling)
 
-	credits := handlers.NewCreditsHandler(creditsService)
-	api.Get("/credits", credits.GetCredits)
+	emails := handlers.NewEmailClaimHandler(emailClaimService)
+	api.Get("/user/emails", emails.ListEmails)
+	api.Post("/user/emails", emails.ClaimEmail)
+	api.Post("/user/emails/confirm", emails.ConfirmEmail)
 
-	video := handlers.NewVideoHandler(videoService)
-	api.Get("/videos", video.GetVideos)
-	api.Post("/generate", video.CreateVideo)
+	api.Post("/checkout", payments.CreateCheckout)
+
+	invoices := handlers.NewInvoiceHandler(orderService)
+	api.Get("/invoices", invoices.ListInvoices)
+	api.Get("/invoices/:id.pdf", invoices.GetInvoicePDF)
+
+	coupons := handlers.NewCouponHandler(couponService)
+	api.Post("/credits/redeem", coupons.Redeem)
+
+	transfers := handlers.NewCreditTransferHandler(creditTransferService)
+	api.Post("/credits/transfer", requireTwoFactor, transfers.Transfer)
+	api.Get("/gifts", transfers.ListGifts)
+	api.Post("/gifts", requireTwoFactor, transfers.CreateGift)
+	api.Post("/gifts/redeem", transfers.RedeemGift)
+
+	referrals := handlers.NewReferralHandler(referralService)
+	api.Get("/referrals", referrals.GetReferrals)
+
+	subscription := handlers.NewSubscriptionHandler(subscriptionService)
+	api.Get("/subscription", subscription.GetSubscription)
+	api.Post("/subscription/cancel", subscription.CancelSubscription)
+
+	entitlements := handlers.NewEntitlementHandler(entitlementService)
+	api.Get("/entitlements", entitlements.GetEntitlements)
+
+	apiKeys := handlers.NewAPIKeyHandler(apiKeyService)
+	api.Get("/api-keys", apiKeys.ListAPIKeys)
+	api.Post("/api-keys", requireTwoFactor, apiKeys.CreateAPIKey)
+	api.Post("/api-keys/:id/revoke", apiKeys.RevokeAPIKey)
+
+	twoFactor := handlers.NewTwoFactorHandler(twoFactorService)
+	api.Get("/2fa", twoFactor.GetStatus)
+	api.Post("/2fa/setup", twoFactor.Setup)
+	api.Post("/2fa/enable", twoFactor.Enable)
+	api.Post("/2fa/verify", twoFactor.Verify)
+	api.Post("/2fa/disable", requireTwoFactor, twoFactor.Disable)
+	api.Post("/2fa/recovery-codes", requireTwoFactor, twoFactor.RegenerateRecoveryCodes)
+
+	admin := api.Group("/admin", middleware.AdminMiddleware(cfg, userRepo))
+	admin.Post("/coupons", coupons.CreateCoupon)
+	admin.Get("/coupons", coupons.ListCoupons)
+
+	videoWorkers := worker.NewVideoWorkerPool(videoJobRepo, videoService, cfg.VideoWorkers, cfg.FlaskTimeout)
+	videoWorkers.Start(context.Background())
+
+	subscriptionScheduler := worker.NewSubscriptionScheduler(subscriptionService)
+	subscriptionScheduler.Start(context.Background())
+
+	creditExpirySweeper := worker.NewCreditExpirySweeper(creditsService)
+	creditExpirySweeper.Start(context.Background())
 
 	go func() {
 		if err := app.Listen(":3000"); err != nil {
@@ -95,7 +270,24 @@ func main() {
 	}()
 	log.Println("Server is running on http://localhost:3000")
 
-	gracefulShutdown(app, db)
+	gracefulShutdown(app, db, videoWorkers, subscriptionScheduler, creditExpirySweeper)
+}
+
+// generateSigningKey activates a new EdDSA key, for servers started before
+// any key was created.
+func generateSigningKey(ctx context.Context, cfg *config.Config, r repository.SigningKeyRepository, keys *keyring.Keyring) error {
+	key, err := keyring.Generate(keyring.EdDSA, cfg.KeyEncryptionKey)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	key.ActivatedAt = &now
+	if err := r.Create(ctx, key); err != nil {
+		return err
+	}
+
+	return keys.Load(ctx)
 }
 
 func closeDB(db *sql.DB) {
@@ -107,7 +299,7 @@ func closeDB(db *sql.DB) {
 	fmt.Fprintln(os.Stdout, "Done")
 }
 
-func gracefulShutdown(app *fiber.App, db *sql.DB) {
+func gracefulShutdown(app *fiber.App, db *sql.DB, workers ...interface{ Stop() }) {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
@@ -118,6 +310,11 @@ func gracefulShutdown(app *fiber.App, db *sql.DB) {
 		log.Fatalf("Failed to shut down server: %v", err)
 	}
 
+	log.Println("Waiting for background workers...")
+	for _, w := range workers {
+		w.Stop()
+	}
+
 	closeDB(db)
 	log.Println("Server shutdown complete.")
 }
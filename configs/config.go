@@ -1,6 +1,11 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type R2 struct {
 	AccountID  string
@@ -9,42 +14,304 @@ type R2 struct {
 	BucketName string
 }
 
+// LoginProvider is an identity provider users can sign in with. Providers
+// other than github are OpenID Connect issuers, configured through
+// discovery.
+type LoginProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+}
+
+// SMTP is the server transactional email goes through. Without a host, mail
+// is kept in memory and only logged.
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+type Stripe struct {
+	SecretKey     string
+	WebhookSecret string
+	APIURL        string
+}
+
+// Referral configures the credits granted when a referred user makes their
+// first purchase. MaxPerReferrer caps how many referrals one user is
+// rewarded for.
+type Referral struct {
+	ReferrerCredits int64
+	RefereeCredits  int64
+	MaxPerReferrer  int
+}
+
+// Credits configures promotional credits. PromoExpiryDays of zero keeps
+// promotional credits forever; purchased credits never expire.
+type Credits struct {
+	SignupBonus     int64
+	PromoExpiryDays int
+}
+
+// Transfers limits moving credits between accounts. DailyLimit counts
+// transfers and gift codes a user creates in 24 hours.
+type Transfers struct {
+	DailyLimit int
+	MaxAmount  int64
+}
+
+// Invoice holds the seller details printed on invoices.
+type Invoice struct {
+	SellerName    string
+	SellerAddress string
+	SellerVATID   string
+	SellerEmail   string
+	// SellerCountry is the ISO country code the seller is established in.
+	SellerCountry string
+}
+
+// Sessions configures how long sign-ins last. Access tokens are short-lived
+// and renewed with a refresh token, which rotates on every use. A session
+// ends once its refresh token goes unused for RefreshTokenTTL.
+type Sessions struct {
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// RefreshWindow is how close to expiry an access token is renewed on
+	// the next API request.
+	RefreshWindow time.Duration
+	// ReuseGrace is how long a rotated refresh token is still accepted, for
+	// requests that raced to refresh. Later reuse revokes the session.
+	ReuseGrace        time.Duration
+	RefreshCookieName string
+}
+
+// TwoFactor configures two-factor authentication with authenticator apps.
+type TwoFactor struct {
+	// Issuer names accounts in authenticator apps.
+	Issuer string
+	// ChallengePath is the frontend page logins of users with two-factor
+	// authentication are sent to for their code.
+	ChallengePath string
+	// StepUpTTL is how long after entering a code sensitive actions are
+	// allowed on a session.
+	StepUpTTL time.Duration
+}
+
 type Config struct {
-	GoogleClientID     string
-	GoogleClientSecret string
-	GoogleRedirectURI  string
-	PostgresURI        string
-	DatabaseName       string
-	FrontendURL        string
-	FlaskURL           string
-	R2                 R2
-	SecretKey          string
-	CookieName         string
+	PostgresURI  string
+	DatabaseName string
+	FrontendURL  string
+	FlaskURL     string
+	R2           R2
+	SecretKey    string
+	CookieName   string
+	VideoWorkers int
+	FlaskTimeout time.Duration
+	// PaymentWebhookSecret authenticates Gumroad webhooks. It is either
+	// passed as the "secret" query parameter of the ping URL or used as the
+	// HMAC-SHA256 key of the X-Webhook-Signature header.
+	PaymentWebhookSecret string
+	Stripe               Stripe
+	// RefundPolicy decides what happens when a refunded or disputed pack was
+	// already spent: "negative" leaves the balance below zero until it is
+	// paid back, "lock" additionally locks the account for support review.
+	RefundPolicy string
+	// AdminEmails may use the /api/admin endpoints.
+	AdminEmails []string
+	Referral    Referral
+	Credits     Credits
+	Transfers   Transfers
+	Invoice     Invoice
+	// GeoIPDatabase is a CSV of "CIDR,country" lines used to pick the price
+	// list of visitors who don't choose a country. Empty disables lookups.
+	GeoIPDatabase string
+	SMTP          SMTP
+	// ReturnToOrigins are the origins login may redirect back to through
+	// return_to, besides FrontendURL.
+	ReturnToOrigins []string
+	// BackendURL is where this server is reached from browsers. Login
+	// callbacks are under it.
+	BackendURL string
+	// ProxyHeader carries the client address on requests forwarded by one of
+	// TrustedProxies, which may be addresses or CIDR ranges. It should be a
+	// header the proxy overwrites, such as X-Real-IP, since the first address
+	// of the header is used. Requests from anywhere else are attributed to
+	// the address they come from.
+	ProxyHeader    string
+	TrustedProxies []string
+	LoginProviders []LoginProvider
+	Sessions       Sessions
+	// KeyEncryptionKey encrypts the private keys session tokens are signed
+	// with, and TOTP secrets. It defaults to SecretKey.
+	KeyEncryptionKey string
+	TwoFactor        TwoFactor
 }
 
 func LoadConfig() *Config {
+	backendURL := getEnv("BACKEND_URL", "http://localhost:3000")
+	secretKey := getEnv("SECRET_KEY", "")
+
 	return &Config{
-		GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
-		GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
-		GoogleRedirectURI:  getEnv("GOOGLE_REDIRECT_URI", ""),
-		PostgresURI:        getEnv("POSTGRES_URI", ""),
-		DatabaseName:       getEnv("DATABASE_NAME", ""),
-		FrontendURL:        getEnv("FRONTEND_URL", "http://localhost:5173"),
-		FlaskURL:           getEnv("FLASK_URL", "http://localhost:5000"),
+		PostgresURI:  getEnv("POSTGRES_URI", ""),
+		DatabaseName: getEnv("DATABASE_NAME", ""),
+		FrontendURL:  getEnv("FRONTEND_URL", "http://localhost:5173"),
+		FlaskURL:     getEnv("FLASK_URL", "http://localhost:5000"),
 		R2: R2{
 			AccountID:  getEnv("R2_ACCOUNT_ID", ""),
 			AccessKey:  getEnv("R2_ACCESS_KEY", ""),
 			SecretKey:  getEnv("R2_SECRET_KEY", ""),
 			BucketName: getEnv("R2_BUCKET_NAME", ""),
 		},
-		SecretKey:  getEnv("SECRET_KEY", ""),
-		CookieName: getEnv("COOKIE_NAME", ""),
+		SecretKey:    secretKey,
+		CookieName:   getEnv("COOKIE_NAME", ""),
+		VideoWorkers: getEnvInt("VIDEO_WORKERS", 4),
+		FlaskTimeout: getEnvDuration("FLASK_TIMEOUT", 10*time.Minute),
+
+		PaymentWebhookSecret: getEnv("PAYMENT_WEBHOOK_SECRET", ""),
+		Stripe: Stripe{
+			SecretKey:     getEnv("STRIPE_SECRET_KEY", ""),
+			WebhookSecret: getEnv("STRIPE_WEBHOOK_SECRET", ""),
+			APIURL:        getEnv("STRIPE_API_URL", "https://api.stripe.com"),
+		},
+		RefundPolicy: getEnv("REFUND_POLICY", "negative"),
+		AdminEmails:  getEnvList("ADMIN_EMAILS"),
+		Referral: Referral{
+			ReferrerCredits: int64(getEnvInt("REFERRAL_REFERRER_CREDITS", 5)),
+			RefereeCredits:  int64(getEnvInt("REFERRAL_REFEREE_CREDITS", 5)),
+			MaxPerReferrer:  getEnvInt("REFERRAL_MAX_PER_REFERRER", 50),
+		},
+		Credits: Credits{
+			SignupBonus:     int64(getEnvInt("SIGNUP_BONUS_CREDITS", 1)),
+			PromoExpiryDays: getEnvInt("PROMO_CREDIT_EXPIRY_DAYS", 90),
+		},
+		Transfers: Transfers{
+			DailyLimit: getEnvInt("TRANSFER_DAILY_LIMIT", 5),
+			MaxAmount:  int64(getEnvInt("TRANSFER_MAX_AMOUNT", 1000)),
+		},
+		Invoice: Invoice{
+			SellerName:    getEnv("INVOICE_SELLER_NAME", "Postflow"),
+			SellerAddress: getEnv("INVOICE_SELLER_ADDRESS", ""),
+			SellerVATID:   getEnv("INVOICE_SELLER_VAT_ID", ""),
+			SellerEmail:   getEnv("INVOICE_SELLER_EMAIL", ""),
+			SellerCountry: getEnv("INVOICE_SELLER_COUNTRY", ""),
+		},
+		GeoIPDatabase: getEnv("GEOIP_DB", ""),
+		SMTP: SMTP{
+			Host:     getEnv("SMTP_HOST", ""),
+			Port:     getEnvInt("SMTP_PORT", 587),
+			Username: getEnv("SMTP_USERNAME", ""),
+			Password: getEnv("SMTP_PASSWORD", ""),
+			From:     getEnv("MAIL_FROM", "Postflow <no-reply@localhost>"),
+		},
+		ReturnToOrigins: getEnvList("RETURN_TO_ORIGINS"),
+		BackendURL:      backendURL,
+		ProxyHeader:     getEnv("PROXY_HEADER", "X-Real-IP"),
+		TrustedProxies:  getEnvListDefault("TRUSTED_PROXIES", []string{"127.0.0.1", "::1"}),
+		LoginProviders:  loadLoginProviders(backendURL),
+		Sessions: Sessions{
+			AccessTokenTTL:    getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+			RefreshTokenTTL:   getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+			RefreshWindow:     getEnvDuration("ACCESS_TOKEN_REFRESH_WINDOW", 5*time.Minute),
+			ReuseGrace:        getEnvDuration("REFRESH_TOKEN_REUSE_GRACE", 30*time.Second),
+			RefreshCookieName: getEnv("REFRESH_COOKIE_NAME", "refresh_token"),
+		},
+		KeyEncryptionKey: getEnv("KEY_ENCRYPTION_KEY", secretKey),
+		TwoFactor: TwoFactor{
+			Issuer:        getEnv("TWO_FACTOR_ISSUER", "Postflow"),
+			ChallengePath: getEnv("TWO_FACTOR_CHALLENGE_PATH", "/login/2fa"),
+			StepUpTTL:     getEnvDuration("TWO_FACTOR_STEP_UP_TTL", 10*time.Minute),
+		},
 	}
 }
 
+// loadLoginProviders returns the providers that have a client ID set:
+// Google, GitHub and Microsoft, plus the OIDC issuers named in
+// OIDC_PROVIDERS, each configured through OIDC_<NAME>_ISSUER,
+// OIDC_<NAME>_CLIENT_ID and OIDC_<NAME>_CLIENT_SECRET.
+func loadLoginProviders(backendURL string) []LoginProvider {
+	callback := func(name string) string {
+		return strings.TrimSuffix(backendURL, "/") + "/login/" + name + "/callback"
+	}
+
+	var providers []LoginProvider
+	if clientID := getEnv("GOOGLE_CLIENT_ID", ""); clientID != "" {
+		providers = append(providers, LoginProvider{
+			Name:         "google",
+			Issuer:       "https://accounts.google.com",
+			ClientID:     clientID,
+			ClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
+			RedirectURI:  getEnv("GOOGLE_REDIRECT_URI", callback("google")),
+		})
+	}
+	if clientID := getEnv("GITHUB_CLIENT_ID", ""); clientID != "" {
+		providers = append(providers, LoginProvider{
+			Name:         "github",
+			ClientID:     clientID,
+			ClientSecret: getEnv("GITHUB_CLIENT_SECRET", ""),
+			RedirectURI:  callback("github"),
+		})
+	}
+	if clientID := getEnv("MICROSOFT_CLIENT_ID", ""); clientID != "" {
+		providers = append(providers, LoginProvider{
+			Name:         "microsoft",
+			Issuer:       "https://login.microsoftonline.com/" + getEnv("MICROSOFT_TENANT", "common") + "/v2.0",
+			ClientID:     clientID,
+			ClientSecret: getEnv("MICROSOFT_CLIENT_SECRET", ""),
+			RedirectURI:  callback("microsoft"),
+		})
+	}
+	for _, name := range getEnvList("OIDC_PROVIDERS") {
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		providers = append(providers, LoginProvider{
+			Name:         name,
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURI:  callback(name),
+		})
+	}
+	return providers
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+// getEnvList splits a comma-separated variable, dropping empty entries.
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func getEnvListDefault(key string, defaultValue []string) []string {
+	if values := getEnvList(key); values != nil {
+		return values
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maheshrc27/postflow/internal/service"
+)
+
+type APIKeyHandler struct {
+	s service.APIKeyService
+}
+
+func NewAPIKeyHandler(service service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{s: service}
+}
+
+// ListAPIKeys returns the user's API keys, without their secrets.
+func (h *APIKeyHandler) ListAPIKeys(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	keys, err := h.s.List(c.Context(), userId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Unable to get API keys",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"api_keys": keys,
+	})
+}
+
+// CreateAPIKey makes an API key. Its secret is only returned here.
+func (h *APIKeyHandler) CreateAPIKey(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	var req struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to parse request",
+		})
+	}
+
+	key, secret, err := h.s.Create(c.Context(), userId, req.Name, req.Scopes)
+	if err != nil {
+		return apiKeyErrorResponse(c, err, "Unable to create API key")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"api_key": key,
+		"secret":  secret,
+	})
+}
+
+func (h *APIKeyHandler) RevokeAPIKey(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return apiKeyErrorResponse(c, service.ErrAPIKeyNotFound, "")
+	}
+
+	if err := h.s.Revoke(c.Context(), userId, int64(id)); err != nil {
+		return apiKeyErrorResponse(c, err, "Unable to revoke API key")
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func apiKeyErrorResponse(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidAPIKeyName), errors.Is(err, service.ErrInvalidScope):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, service.ErrAPIKeyLimit):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, service.ErrAPIKeyNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": fallback,
+	})
+}
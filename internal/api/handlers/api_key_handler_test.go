@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maheshrc27/postflow/internal/identity/identitytest"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+type fakeAPIKeyRepository struct {
+	repository.APIKeyRepository
+	keys []*models.APIKey
+}
+
+func newFakeAPIKeyRepository() *fakeAPIKeyRepository {
+	return &fakeAPIKeyRepository{}
+}
+
+func (r *fakeAPIKeyRepository) Create(ctx context.Context, k *models.APIKey) error {
+	k.ID = int64(len(r.keys) + 1)
+	k.CreatedAt = time.Now()
+	r.keys = append(r.keys, k)
+	return nil
+}
+
+func (r *fakeAPIKeyRepository) GetByHash(ctx context.Context, keyHash string) (*models.APIKey, bool, error) {
+	for _, k := range r.keys {
+		if k.KeyHash == keyHash && k.RevokedAt == nil {
+			return k, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (r *fakeAPIKeyRepository) ListActive(ctx context.Context, userID int64) ([]*models.APIKey, error) {
+	var keys []*models.APIKey
+	for _, k := range r.keys {
+		if k.UserID == userID && k.RevokedAt == nil {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (r *fakeAPIKeyRepository) Revoke(ctx context.Context, userID, id int64) (bool, error) {
+	for _, k := range r.keys {
+		if k.ID == id && k.UserID == userID && k.RevokedAt == nil {
+			now := time.Now()
+			k.RevokedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeAPIKeyRepository) RecordUse(ctx context.Context, id int64, ip string) error {
+	k := r.keys[id-1]
+	now := time.Now()
+	k.UsageCount++
+	k.LastUsedAt = &now
+	k.LastUsedIP = ip
+	return nil
+}
+
+// whoami stands in for the routes API keys can call.
+func whoami(c *fiber.Ctx) error {
+	return c.SendString(strconv.FormatInt(GetUserID(c), 10))
+}
+
+func (lt *loginTest) withAPIKey(t *testing.T, method, target, secret string) *http.Response {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+secret)
+
+	resp, err := lt.app.Test(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, target, err)
+	}
+	return resp
+}
+
+func (lt *loginTest) createAPIKey(t *testing.T, cookies []*http.Cookie, name string, scopes ...string) (*http.Response, string) {
+	t.Helper()
+
+	body, _ := json.Marshal(map[string]any{"name": name, "scopes": scopes})
+	req := httptest.NewRequest(http.MethodPost, "/api/api-keys", bytes.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+
+	resp, err := lt.app.Test(req)
+	if err != nil {
+		t.Fatalf("POST /api/api-keys: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusCreated {
+		return resp, ""
+	}
+
+	var created struct {
+		Secret string `json:"secret"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("decoding API key: %v", err)
+	}
+	return resp, created.Secret
+}
+
+func TestAPIKeyCallsScopedRoutes(t *testing.T) {
+	lt := newLoginTest(t)
+	cookies := lt.signIn(t, testUser)
+
+	resp, secret := lt.createAPIKey(t, cookies, "CI", models.ScopeCreditsRead)
+	if resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("create status = %d, want %d", resp.StatusCode, fiber.StatusCreated)
+	}
+
+	key := lt.apiKeys.keys[0]
+	if key.KeyHash == secret || key.Prefix != secret[:len(key.Prefix)] {
+		t.Errorf("stored key = %+v, want the hash and prefix of %q", key, secret)
+	}
+
+	resp = lt.withAPIKey(t, http.MethodGet, "/api/whoami", secret)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+	if key.UsageCount != 1 || key.LastUsedAt == nil {
+		t.Errorf("usage = %d, last used %v, want one recorded use", key.UsageCount, key.LastUsedAt)
+	}
+
+	if resp := lt.withAPIKey(t, http.MethodPost, "/api/whoami", secret); resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("status without scope = %d, want %d", resp.StatusCode, fiber.StatusForbidden)
+	}
+	if key.UsageCount != 1 {
+		t.Errorf("usage = %d, want rejected requests not counted", key.UsageCount)
+	}
+
+	// Cookies are accepted on the same routes.
+	if resp := lt.api(t, http.MethodPost, "/api/whoami", cookies...); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("status with cookies = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+}
+
+func TestAPIKeyRejectedOnUnscopedRoutes(t *testing.T) {
+	lt := newLoginTest(t)
+	cookies := lt.signIn(t, testUser)
+	_, secret := lt.createAPIKey(t, cookies, "CI", models.APIKeyScopes...)
+
+	for _, target := range []string{"/api/sessions", "/api/api-keys"} {
+		if resp := lt.withAPIKey(t, http.MethodGet, target, secret); resp.StatusCode != fiber.StatusForbidden {
+			t.Errorf("GET %s status = %d, want %d", target, resp.StatusCode, fiber.StatusForbidden)
+		}
+	}
+}
+
+func TestRevokedAPIKeyIsRejected(t *testing.T) {
+	lt := newLoginTest(t)
+	cookies := lt.signIn(t, testUser)
+	_, secret := lt.createAPIKey(t, cookies, "CI", models.ScopeCreditsRead)
+
+	if resp := lt.api(t, http.MethodPost, "/api/api-keys/1/revoke", cookies...); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("revoke status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	if resp := lt.withAPIKey(t, http.MethodGet, "/api/whoami", secret); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("revoked key status = %d, want %d", resp.StatusCode, fiber.StatusUnauthorized)
+	}
+	if resp := lt.withAPIKey(t, http.MethodGet, "/api/whoami", "pf_forged"); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("forged key status = %d, want %d", resp.StatusCode, fiber.StatusUnauthorized)
+	}
+
+	resp := lt.api(t, http.MethodGet, "/api/api-keys", cookies...)
+	var body struct {
+		APIKeys []*models.APIKey `json:"api_keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding API keys: %v", err)
+	}
+	if len(body.APIKeys) != 0 {
+		t.Errorf("API keys = %+v, want none", body.APIKeys)
+	}
+}
+
+func TestRevokeAPIKeyOfAnotherUser(t *testing.T) {
+	lt := newLoginTest(t)
+	ada := lt.signIn(t, testUser)
+	grace := lt.signIn(t, identitytest.User{Subject: "43", Email: "grace@example.com", EmailVerified: true})
+	_, secret := lt.createAPIKey(t, ada, "CI", models.ScopeCreditsRead)
+
+	if resp := lt.api(t, http.MethodPost, "/api/api-keys/1/revoke", grace...); resp.StatusCode != fiber.StatusNotFound {
+		t.Fatalf("revoke status = %d, want %d", resp.StatusCode, fiber.StatusNotFound)
+	}
+	if resp := lt.withAPIKey(t, http.MethodGet, "/api/whoami", secret); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+}
+
+func TestCreateAPIKeyValidation(t *testing.T) {
+	lt := newLoginTest(t)
+	cookies := lt.signIn(t, testUser)
+
+	tests := []struct {
+		name   string
+		scopes []string
+	}{
+		{name: "", scopes: []string{models.ScopeCreditsRead}},
+		{name: "CI"},
+		{name: "CI", scopes: []string{"admin"}},
+	}
+	for _, tt := range tests {
+		if resp, _ := lt.createAPIKey(t, cookies, tt.name, tt.scopes...); resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("create %q with %v status = %d, want %d", tt.name, tt.scopes, resp.StatusCode, fiber.StatusBadRequest)
+		}
+	}
+}
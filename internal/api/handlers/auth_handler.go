@@ -1,66 +1,409 @@
 package handlers
 
 import (
-	"fmt"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log/slog"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/api/middleware"
+	"github.com/maheshrc27/postflow/internal/models"
 	"github.com/maheshrc27/postflow/internal/service"
+	"github.com/maheshrc27/postflow/internal/transfer"
 	"github.com/maheshrc27/postflow/pkg/utils"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// referralCookie carries a referral code from /login to the callback.
+	referralCookie = "referral_code"
+	// loginStateCookie carries the signed state, PKCE verifier and return_to
+	// of a login attempt from /login to the callback.
+	loginStateCookie = "login_state"
+	loginStateTTL    = 10 * time.Minute
+	// twoFactorCookie carries a login that passed its first step to the
+	// two-factor code.
+	twoFactorCookie = "two_factor"
+	twoFactorTTL    = 5 * time.Minute
+	// defaultLoginProvider serves /login and /login/callback, which predate
+	// other providers.
+	defaultLoginProvider = "google"
 )
 
 type AuthHandler struct {
-	s   service.AuthService
-	cfg config.Config
+	s         service.AuthService
+	sessions  service.SessionService
+	twoFactor service.TwoFactorService
+	cfg       config.Config
 }
 
-func NewAuthHandler(cfg config.Config, service service.AuthService) *AuthHandler {
-	return &AuthHandler{s: service, cfg: cfg}
+func NewAuthHandler(cfg config.Config, service service.AuthService, sessions service.SessionService, twoFactor service.TwoFactorService) *AuthHandler {
+	return &AuthHandler{s: service, sessions: sessions, twoFactor: twoFactor, cfg: cfg}
 }
 
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
-	authURL := "https://accounts.google.com/o/oauth2/v2/auth"
-	params := url.Values{}
-	params.Add("client_id", h.cfg.GoogleClientID)
-	params.Add("redirect_uri", h.cfg.GoogleRedirectURI)
-	params.Add("response_type", "code")
-	params.Add("scope", "https://www.googleapis.com/auth/userinfo.profile https://www.googleapis.com/auth/userinfo.email")
-	params.Add("state", "secureRandomState")
-	params.Add("access_type", "offline")
-
-	fullURL := fmt.Sprintf("%s?%s", authURL, params.Encode())
-	return c.Redirect(fullURL)
+	provider := c.Params("provider", defaultLoginProvider)
+
+	if ref := c.Query("ref"); ref != "" {
+		c.Cookie(&fiber.Cookie{
+			Name:     referralCookie,
+			Value:    ref,
+			HTTPOnly: true,
+			Secure:   true,
+			SameSite: fiber.CookieSameSiteLaxMode,
+			Path:     "/login",
+			MaxAge:   int(time.Hour.Seconds()),
+		})
+	}
+
+	returnTo, ok := h.resolveReturnTo(c.Query("return_to"))
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "return_to is not allowed",
+		})
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	claims := &transfer.LoginStateClaims{
+		Provider: provider,
+		State:    state,
+		Verifier: oauth2.GenerateVerifier(),
+		Nonce:    nonce,
+		ReturnTo: returnTo,
+	}
+
+	authURL, err := h.s.AuthURL(c.Context(), provider, claims.State, claims.Verifier, claims.Nonce)
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownLoginProvider) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "something went wrong",
+		})
+	}
+
+	loginState, err := utils.GenerateLoginState(h.cfg.SecretKey, claims, loginStateTTL)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "something went wrong",
+		})
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     loginStateCookie,
+		Value:    loginState,
+		HTTPOnly: true,
+		Secure:   true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+		Path:     "/login",
+		MaxAge:   int(loginStateTTL.Seconds()),
+	})
+
+	return c.Redirect(authURL)
 }
 
 func (h *AuthHandler) LoginCallbackHandler(c *fiber.Ctx) error {
+	provider := c.Params("provider", defaultLoginProvider)
 	code := c.Query("code")
 
-	err, userID := h.s.LoginCallback(c.Context(), code)
+	// The state cookie is single use, whatever the outcome.
+	loginState := c.Cookies(loginStateCookie)
+	c.Cookie(&fiber.Cookie{
+		Name:   loginStateCookie,
+		Value:  "",
+		Path:   "/login",
+		MaxAge: -1,
+	})
+
+	claims, err := utils.ValidateLoginState(h.cfg.SecretKey, loginState)
+	if err != nil || claims.Provider != provider ||
+		subtle.ConstantTimeCompare([]byte(claims.State), []byte(c.Query("state"))) != 1 {
+		slog.Info("login state mismatch", "ip", c.IP())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "login expired or was started elsewhere, please try again",
+		})
+	}
+
+	referralCode := c.Cookies(referralCookie)
+	if referralCode != "" {
+		c.Cookie(&fiber.Cookie{
+			Name:   referralCookie,
+			Value:  "",
+			Path:   "/login",
+			MaxAge: -1,
+		})
+	}
+
+	err, userID := h.s.LoginCallback(c.Context(), provider, code, claims.Verifier, claims.Nonce, referralCode)
 	if err != nil {
+		if errors.Is(err, service.ErrEmailNotVerified) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "something went wrong",
 		})
 	}
 
-	token, err := utils.GenerateToken(h.cfg.SecretKey, fmt.Sprintf("%d", userID), 24*time.Hour)
-	if err != nil {
+	if err := h.completeLogin(c, userID, claims.ReturnTo); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "something went wrong",
+		})
+	}
+
+	return nil
+}
+
+// EmailLogin mails a login link to the address in the body.
+func (h *AuthHandler) EmailLogin(c *fiber.Ctx) error {
+	var req struct {
+		Email    string `json:"email"`
+		ReturnTo string `json:"return_to"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to parse request",
+		})
+	}
+
+	returnTo, ok := h.resolveReturnTo(req.ReturnTo)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "return_to is not allowed",
+		})
+	}
+
+	if err := h.s.SendLoginLink(c.Context(), req.Email, c.IP(), returnTo); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidEmail):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		case errors.Is(err, service.ErrLoginLinkLimit):
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Unable to send login link",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Login link sent",
+	})
+}
+
+// VerifyEmailLogin signs in with the login link the user opened.
+func (h *AuthHandler) VerifyEmailLogin(c *fiber.Ctx) error {
+	referralCode := c.Cookies(referralCookie)
+	if referralCode != "" {
+		c.Cookie(&fiber.Cookie{
+			Name:   referralCookie,
+			Value:  "",
+			Path:   "/login",
+			MaxAge: -1,
+		})
+	}
+
+	userID, returnTo, err := h.s.UseLoginLink(c.Context(), c.Query("token"), referralCode)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidLoginLink) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "something went wrong",
 		})
 	}
 
+	if err := h.completeLogin(c, userID, returnTo); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "something went wrong",
+		})
+	}
+
+	return nil
+}
+
+// TwoFactorLogin finishes a login with the user's two-factor code, or one of
+// their recovery codes. The response names where to continue.
+func (h *AuthHandler) TwoFactorLogin(c *fiber.Ctx) error {
+	claims, err := utils.ValidateTwoFactorChallenge(h.cfg.SecretKey, c.Cookies(twoFactorCookie))
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "login expired, please sign in again",
+		})
+	}
+
+	code, ok := parseTwoFactorCode(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to parse request",
+		})
+	}
+
+	if err := h.twoFactor.Verify(c.Context(), claims.UserID, code); err != nil {
+		return twoFactorErrorResponse(c, err, "something went wrong")
+	}
+
 	c.Cookie(&fiber.Cookie{
-		Name:     h.cfg.CookieName,
-		Value:    token,
-		HTTPOnly: true,
-		Secure:   true,
-		Domain:   ".postflow.org",
-		SameSite: fiber.CookieSameSiteNoneMode,
-		Path:     "/",
-		Expires:  time.Now().Add(24 * time.Hour),
+		Name:   twoFactorCookie,
+		Value:  "",
+		Path:   "/login",
+		MaxAge: -1,
+	})
+
+	session, err := h.setSession(c, claims.UserID)
+	if err == nil {
+		err = h.twoFactor.MarkSession(c.Context(), session.ID)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "something went wrong",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"return_to": claims.ReturnTo,
+	})
+}
+
+// Refresh renews the session cookies with the refresh cookie.
+func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
+	tokens, err := h.sessions.Refresh(c.Context(), c.Cookies(h.cfg.Sessions.RefreshCookieName), c.IP())
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+			middleware.ClearSessionCookies(c, &h.cfg)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Unable to refresh session",
+		})
+	}
+
+	middleware.SetSessionCookies(c, &h.cfg, tokens)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"access_expires_at":  tokens.AccessExpiresAt,
+		"session_expires_at": tokens.Session.ExpiresAt,
 	})
+}
+
+// completeLogin signs the user in and redirects to returnTo. Users with
+// two-factor authentication are sent to enter their code first, and only
+// signed in by TwoFactorLogin.
+func (h *AuthHandler) completeLogin(c *fiber.Ctx, userID int64, returnTo string) error {
+	enabled, err := h.twoFactor.Enabled(c.Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	if enabled {
+		challenge, err := utils.GenerateTwoFactorChallenge(h.cfg.SecretKey, &transfer.TwoFactorClaims{
+			UserID:   userID,
+			ReturnTo: returnTo,
+		}, twoFactorTTL)
+		if err != nil {
+			return err
+		}
+
+		c.Cookie(&fiber.Cookie{
+			Name:     twoFactorCookie,
+			Value:    challenge,
+			HTTPOnly: true,
+			Secure:   true,
+			SameSite: fiber.CookieSameSiteLaxMode,
+			Path:     "/login",
+			MaxAge:   int(twoFactorTTL.Seconds()),
+		})
+
+		return c.Redirect(strings.TrimSuffix(h.cfg.FrontendURL, "/")+h.cfg.TwoFactor.ChallengePath, fiber.StatusTemporaryRedirect)
+	}
+
+	if _, err := h.setSession(c, userID); err != nil {
+		return err
+	}
+
+	return c.Redirect(returnTo, fiber.StatusTemporaryRedirect)
+}
+
+// setSession starts a session on the user's device and sets the cookies that
+// sign them in to the API.
+func (h *AuthHandler) setSession(c *fiber.Ctx, userID int64) (*models.Session, error) {
+	tokens, err := h.sessions.Create(c.Context(), userID, c.Get(fiber.HeaderUserAgent), c.IP())
+	if err != nil {
+		return nil, err
+	}
+
+	middleware.SetSessionCookies(c, &h.cfg, tokens)
+	return tokens.Session, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// resolveReturnTo turns the return_to of a login into the URL to redirect to
+// afterwards. Paths are taken relative to the frontend; absolute URLs must
+// be on the frontend or one of the configured return-to origins.
+func (h *AuthHandler) resolveReturnTo(returnTo string) (string, bool) {
+	frontend := strings.TrimSuffix(h.cfg.FrontendURL, "/")
+	if returnTo == "" {
+		return frontend, true
+	}
+
+	if strings.ContainsAny(returnTo, "\\\r\n") {
+		return "", false
+	}
+
+	u, err := url.Parse(returnTo)
+	if err != nil {
+		return "", false
+	}
+
+	if u.Scheme == "" && u.Host == "" {
+		if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") {
+			return "", false
+		}
+		return frontend + returnTo, true
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" || u.User != nil {
+		return "", false
+	}
+
+	origin := strings.ToLower(u.Scheme + "://" + u.Host)
+	for _, allowed := range append([]string{frontend}, h.cfg.ReturnToOrigins...) {
+		if origin == strings.ToLower(strings.TrimSuffix(allowed, "/")) {
+			return returnTo, true
+		}
+	}
 
-	return c.Redirect(h.cfg.FrontendURL, fiber.StatusTemporaryRedirect)
+	slog.Info("return_to origin is not allowed", "origin", origin)
+	return "", false
 }
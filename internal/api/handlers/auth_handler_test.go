@@ -0,0 +1,675 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/api/middleware"
+	"github.com/maheshrc27/postflow/internal/identity"
+	"github.com/maheshrc27/postflow/internal/identity/identitytest"
+	"github.com/maheshrc27/postflow/internal/keyring"
+	"github.com/maheshrc27/postflow/internal/mailer"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+	"github.com/maheshrc27/postflow/internal/service"
+	"github.com/maheshrc27/postflow/internal/transfer"
+	"github.com/maheshrc27/postflow/pkg/utils"
+)
+
+const (
+	testLoginProvider = "acme"
+	testFrontendURL   = "https://app.example.com"
+)
+
+type fakeIdentityRepository struct {
+	repository.IdentityRepository
+	identities []*models.UserIdentity
+}
+
+func (r *fakeIdentityRepository) GetByProviderSubject(ctx context.Context, provider, subject string) (*models.UserIdentity, bool, error) {
+	for _, i := range r.identities {
+		if i.Provider == provider && i.Subject == subject {
+			return i, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (r *fakeIdentityRepository) Create(ctx context.Context, i *models.UserIdentity) error {
+	if _, ok, _ := r.GetByProviderSubject(ctx, i.Provider, i.Subject); ok {
+		return repository.ErrIdentityLinked
+	}
+	i.ID = int64(len(r.identities) + 1)
+	r.identities = append(r.identities, i)
+	return nil
+}
+
+func (r *fakeIdentityRepository) Touch(ctx context.Context, id int64, email string) error {
+	return nil
+}
+
+type fakeLoginLinkRepository struct {
+	repository.LoginLinkRepository
+	links []*models.LoginLink
+}
+
+func (r *fakeLoginLinkRepository) Create(ctx context.Context, l *models.LoginLink) error {
+	l.ID = int64(len(r.links) + 1)
+	l.CreatedAt = time.Now()
+	r.links = append(r.links, l)
+	return nil
+}
+
+func (r *fakeLoginLinkRepository) CountSince(ctx context.Context, email, ip string, since time.Time) (int, int, error) {
+	var byEmail, byIP int
+	for _, l := range r.links {
+		if l.CreatedAt.After(since) {
+			if strings.EqualFold(l.Email, email) {
+				byEmail++
+			}
+			if l.IP == ip {
+				byIP++
+			}
+		}
+	}
+	return byEmail, byIP, nil
+}
+
+func (r *fakeLoginLinkRepository) Use(ctx context.Context, tokenHash string) (*models.LoginLink, bool, error) {
+	for _, l := range r.links {
+		if l.TokenHash == tokenHash && l.UsedAt == nil && l.ExpiresAt.After(time.Now()) {
+			now := time.Now()
+			l.UsedAt = &now
+			return l, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// fakeKeyStore holds signing keys in memory.
+type fakeKeyStore []*models.SigningKey
+
+func (s fakeKeyStore) List(ctx context.Context) ([]*models.SigningKey, error) {
+	return s, nil
+}
+
+type loginTest struct {
+	app        *fiber.App
+	issuer     *identitytest.Server
+	store      *fakeStore
+	identities *fakeIdentityRepository
+	links      *fakeLoginLinkRepository
+	sessions   *fakeSessionRepository
+	apiKeys    *fakeAPIKeyRepository
+	twoFactor  *fakeTwoFactorRepository
+	mail       *mailer.Memory
+	keys       *keyring.Keyring
+}
+
+func newLoginTest(t *testing.T, opts ...func(*config.Config)) *loginTest {
+	t.Helper()
+
+	issuer := identitytest.NewServer(t)
+	providers := identity.Registry{}
+	providers.Register(identity.NewOIDC(identity.OIDCConfig{
+		Name:         testLoginProvider,
+		Issuer:       issuer.Issuer(),
+		ClientID:     identitytest.ClientID,
+		ClientSecret: identitytest.ClientSecret,
+		RedirectURL:  "https://api.example.com/login/" + testLoginProvider + "/callback",
+	}, issuer.Client()))
+
+	cfg := config.Config{
+		SecretKey:        "test-secret-key",
+		KeyEncryptionKey: "test-key-encryption-key",
+		BackendURL:       "https://api.example.com",
+		CookieName:       "token",
+		FrontendURL:      testFrontendURL,
+		TwoFactor: config.TwoFactor{
+			Issuer:        "Postflow",
+			ChallengePath: "/login/2fa",
+			StepUpTTL:     10 * time.Minute,
+		},
+		Credits: config.Credits{SignupBonus: testSignupBonus},
+		Sessions: config.Sessions{
+			AccessTokenTTL:    15 * time.Minute,
+			RefreshTokenTTL:   24 * time.Hour,
+			RefreshWindow:     5 * time.Minute,
+			ReuseGrace:        time.Minute,
+			RefreshCookieName: "refresh_token",
+		},
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	lt := &loginTest{
+		issuer:     issuer,
+		store:      newFakeStore(),
+		identities: &fakeIdentityRepository{},
+		links:      &fakeLoginLinkRepository{},
+		sessions:   newFakeSessionRepository(),
+		apiKeys:    newFakeAPIKeyRepository(),
+		twoFactor:  newFakeTwoFactorRepository(),
+		mail:       mailer.NewMemory(),
+	}
+	authService := service.NewAuthService(cfg,
+		&fakeUserRepository{s: lt.store},
+		&fakeCreditsRepository{s: lt.store},
+		lt.identities,
+		lt.links,
+		service.NewReferralService(config.Config{}, fakeReferralRepository{}),
+		lt.mail,
+		providers,
+	)
+
+	key, err := keyring.Generate(keyring.EdDSA, cfg.KeyEncryptionKey)
+	if err != nil {
+		t.Fatalf("generating signing key: %v", err)
+	}
+	activatedAt := time.Now()
+	key.ActivatedAt = &activatedAt
+	lt.keys = keyring.New(fakeKeyStore{key}, cfg.KeyEncryptionKey)
+
+	sessionService := service.NewSessionService(cfg, lt.sessions, lt.keys)
+
+	twoFactorService := service.NewTwoFactorService(cfg, &fakeUserRepository{s: lt.store}, lt.twoFactor, lt.sessions)
+
+	auth := NewAuthHandler(cfg, authService, sessionService, twoFactorService)
+	lt.app = fiber.New()
+	lt.app.Post("/login/email", auth.EmailLogin)
+	lt.app.Get("/login/email/verify", auth.VerifyEmailLogin)
+	lt.app.Post("/login/2fa", auth.TwoFactorLogin)
+	lt.app.Get("/login/:provider", auth.Login)
+	lt.app.Get("/login/:provider/callback", auth.LoginCallbackHandler)
+
+	lt.app.Post("/auth/refresh", auth.Refresh)
+	lt.app.Get("/.well-known/jwks.json", NewKeysHandler(lt.keys).JWKS)
+
+	apiKeyService := service.NewAPIKeyService(lt.apiKeys)
+	requireAuth := func(scopes ...string) fiber.Handler {
+		return middleware.AuthMiddleware(&cfg, sessionService, lt.keys, apiKeyService, scopes...)
+	}
+
+	api := lt.app.Group("/api")
+	api.Get("/whoami", requireAuth(models.ScopeCreditsRead), whoami)
+	api.Post("/whoami", requireAuth(models.ScopeCreditsRead, models.ScopeVideosGenerate), whoami)
+
+	api.Use(requireAuth())
+	sessions := NewSessionHandler(sessionService, cfg)
+	api.Post("/logout", sessions.Logout)
+	api.Post("/logout-all", sessions.LogoutAll)
+	api.Get("/sessions", sessions.ListSessions)
+	api.Post("/sessions/:id/revoke", sessions.RevokeSession)
+
+	apiKeys := NewAPIKeyHandler(apiKeyService)
+	api.Get("/api-keys", apiKeys.ListAPIKeys)
+	api.Post("/api-keys", apiKeys.CreateAPIKey)
+	api.Post("/api-keys/:id/revoke", apiKeys.RevokeAPIKey)
+
+	twoFactor := NewTwoFactorHandler(twoFactorService)
+	api.Get("/2fa", twoFactor.GetStatus)
+	api.Post("/2fa/setup", twoFactor.Setup)
+	api.Post("/2fa/enable", twoFactor.Enable)
+	api.Post("/2fa/verify", twoFactor.Verify)
+	api.Post("/2fa/disable", middleware.TwoFactorMiddleware(twoFactorService), twoFactor.Disable)
+	api.Post("/sensitive", middleware.TwoFactorMiddleware(twoFactorService), whoami)
+	return lt
+}
+
+func (lt *loginTest) do(t *testing.T, target string, cookies []*http.Cookie) *http.Response {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+
+	resp, err := lt.app.Test(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", target, err)
+	}
+	return resp
+}
+
+// login starts a login, lets user consent at the fake issuer and follows the
+// redirect back to the callback.
+func (lt *loginTest) login(t *testing.T, user identitytest.User) *http.Response {
+	t.Helper()
+
+	resp := lt.do(t, "/login/"+testLoginProvider, nil)
+	if resp.StatusCode != fiber.StatusFound {
+		t.Fatalf("login status = %d, want %d", resp.StatusCode, fiber.StatusFound)
+	}
+
+	callback, err := url.Parse(lt.issuer.Authorize(t, resp.Header.Get("Location"), user))
+	if err != nil {
+		t.Fatalf("parsing callback URL: %v", err)
+	}
+
+	return lt.do(t, callback.RequestURI(), resp.Cookies())
+}
+
+// requestLoginLink posts to /login/email and returns the link mailed to
+// email, if any.
+func (lt *loginTest) requestLoginLink(t *testing.T, email string) (int, string) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/login/email", strings.NewReader(`{"email":"`+email+`","return_to":"/videos"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := lt.app.Test(req)
+	if err != nil {
+		t.Fatalf("POST /login/email: %v", err)
+	}
+
+	// Links are mailed to the lowercased address.
+	msg := lt.mail.Last(strings.ToLower(email))
+	if msg == nil {
+		return resp.StatusCode, ""
+	}
+	return resp.StatusCode, loginLinkPattern.FindString(msg.Body)
+}
+
+var loginLinkPattern = regexp.MustCompile(`https://api\.example\.com/login/email/verify\?token=\S+`)
+
+func sessionCookie(resp *http.Response) *http.Cookie {
+	for _, c := range resp.Cookies() {
+		if c.Name == "token" && c.Value != "" {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestLoginCreatesUserAndIdentity(t *testing.T) {
+	lt := newLoginTest(t)
+	user := identitytest.User{Subject: "42", Email: "ada@example.com", EmailVerified: true, Name: "Ada"}
+
+	resp := lt.login(t, user)
+	if resp.StatusCode != fiber.StatusTemporaryRedirect {
+		t.Fatalf("callback status = %d, want %d", resp.StatusCode, fiber.StatusTemporaryRedirect)
+	}
+	if got := resp.Header.Get("Location"); got != testFrontendURL {
+		t.Errorf("redirect = %q, want %q", got, testFrontendURL)
+	}
+	if sessionCookie(resp) == nil {
+		t.Error("no session cookie set")
+	}
+
+	created, ok := lt.store.users[user.Email]
+	if !ok {
+		t.Fatalf("no user created for %s", user.Email)
+	}
+	if created.Name != user.Name {
+		t.Errorf("name = %q, want %q", created.Name, user.Name)
+	}
+	if got := lt.store.balances[created.ID]; got != testSignupBonus {
+		t.Errorf("balance = %d, want %d", got, testSignupBonus)
+	}
+	if len(lt.identities.identities) != 1 || lt.identities.identities[0].UserID != created.ID {
+		t.Fatalf("identities = %+v, want one for user %d", lt.identities.identities, created.ID)
+	}
+
+	// Signing in again, even after the email changed, finds the same user.
+	user.Email = "ada@example.org"
+	if resp := lt.login(t, user); resp.StatusCode != fiber.StatusTemporaryRedirect {
+		t.Fatalf("second callback status = %d, want %d", resp.StatusCode, fiber.StatusTemporaryRedirect)
+	}
+	if len(lt.store.users) != 1 || len(lt.identities.identities) != 1 {
+		t.Errorf("second login created %d users and %d identities, want 1 and 1", len(lt.store.users), len(lt.identities.identities))
+	}
+}
+
+func TestLoginLinksVerifiedEmailToExistingUser(t *testing.T) {
+	lt := newLoginTest(t)
+	lt.store.users["ada@example.com"] = &models.User{ID: 7, Email: "ada@example.com", GoogleID: "g-1"}
+
+	resp := lt.login(t, identitytest.User{Subject: "42", Email: "ada@example.com", EmailVerified: true})
+	if resp.StatusCode != fiber.StatusTemporaryRedirect {
+		t.Fatalf("callback status = %d, want %d", resp.StatusCode, fiber.StatusTemporaryRedirect)
+	}
+
+	if len(lt.identities.identities) != 1 || lt.identities.identities[0].UserID != 7 {
+		t.Fatalf("identities = %+v, want one for user 7", lt.identities.identities)
+	}
+}
+
+func TestLoginRejectsUnverifiedEmail(t *testing.T) {
+	lt := newLoginTest(t)
+	lt.store.users["ada@example.com"] = &models.User{ID: 7, Email: "ada@example.com", GoogleID: "g-1"}
+
+	resp := lt.login(t, identitytest.User{Subject: "42", Email: "ada@example.com"})
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Fatalf("callback status = %d, want %d", resp.StatusCode, fiber.StatusForbidden)
+	}
+	if sessionCookie(resp) != nil {
+		t.Error("session cookie set for unverified email")
+	}
+	if len(lt.identities.identities) != 0 {
+		t.Errorf("identities = %+v, want none", lt.identities.identities)
+	}
+}
+
+func TestLoginCallbackRejectsForeignState(t *testing.T) {
+	lt := newLoginTest(t)
+
+	// The attacker's login state cookie doesn't match the victim's callback.
+	attacker := lt.do(t, "/login/"+testLoginProvider, nil)
+	victim := lt.do(t, "/login/"+testLoginProvider, nil)
+	callback, err := url.Parse(lt.issuer.Authorize(t, victim.Header.Get("Location"), identitytest.User{Subject: "42", Email: "ada@example.com", EmailVerified: true}))
+	if err != nil {
+		t.Fatalf("parsing callback URL: %v", err)
+	}
+
+	resp := lt.do(t, callback.RequestURI(), attacker.Cookies())
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Fatalf("callback status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+	}
+	if len(lt.store.users) != 0 {
+		t.Errorf("users = %d, want 0", len(lt.store.users))
+	}
+}
+
+// startLogin starts a login and lets user consent at the fake issuer. It
+// returns the callback to follow and the login state cookie.
+func (lt *loginTest) startLogin(t *testing.T, user identitytest.User) (string, *http.Cookie) {
+	t.Helper()
+
+	resp := lt.do(t, "/login/"+testLoginProvider, nil)
+	callback, err := url.Parse(lt.issuer.Authorize(t, resp.Header.Get("Location"), user))
+	if err != nil {
+		t.Fatalf("parsing callback URL: %v", err)
+	}
+	for _, c := range resp.Cookies() {
+		if c.Name == loginStateCookie {
+			return callback.RequestURI(), c
+		}
+	}
+	t.Fatal("no login state cookie set")
+	return "", nil
+}
+
+func TestLoginCallbackRejectsBadState(t *testing.T) {
+	user := identitytest.User{Subject: "42", Email: "ada@example.com", EmailVerified: true}
+
+	tests := []struct {
+		name   string
+		modify func(t *testing.T, state string) string
+	}{
+		{"signed with another key", func(t *testing.T, state string) string {
+			claims, err := utils.ValidateLoginState("test-secret-key", state)
+			if err != nil {
+				t.Fatalf("ValidateLoginState: %v", err)
+			}
+			signed, err := utils.GenerateLoginState("another-secret-key", claims, loginStateTTL)
+			if err != nil {
+				t.Fatalf("GenerateLoginState: %v", err)
+			}
+			return signed
+		}},
+		{"altered payload", func(t *testing.T, state string) string {
+			claims, err := utils.ValidateLoginState("test-secret-key", state)
+			if err != nil {
+				t.Fatalf("ValidateLoginState: %v", err)
+			}
+			claims.ReturnTo = "https://evil.example.com"
+			signed, err := utils.GenerateLoginState("test-secret-key", claims, loginStateTTL)
+			if err != nil {
+				t.Fatalf("GenerateLoginState: %v", err)
+			}
+			// The altered claims keep the original signature.
+			forged, original := strings.Split(signed, "."), strings.Split(state, ".")
+			return forged[0] + "." + forged[1] + "." + original[2]
+		}},
+		{"expired", func(t *testing.T, state string) string {
+			claims, err := utils.ValidateLoginState("test-secret-key", state)
+			if err != nil {
+				t.Fatalf("ValidateLoginState: %v", err)
+			}
+			signed, err := utils.GenerateLoginState("test-secret-key", claims, -time.Minute)
+			if err != nil {
+				t.Fatalf("GenerateLoginState: %v", err)
+			}
+			return signed
+		}},
+		{"missing", func(t *testing.T, state string) string {
+			return ""
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lt := newLoginTest(t)
+			callback, state := lt.startLogin(t, user)
+			state.Value = tt.modify(t, state.Value)
+
+			resp := lt.do(t, callback, []*http.Cookie{state})
+			if resp.StatusCode != fiber.StatusBadRequest {
+				t.Fatalf("callback status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+			}
+			if sessionCookie(resp) != nil || len(lt.store.users) != 0 {
+				t.Error("login with a bad state signed in")
+			}
+		})
+	}
+}
+
+func TestLoginCallbackRejectsWrongVerifier(t *testing.T) {
+	lt := newLoginTest(t)
+	callback, state := lt.startLogin(t, identitytest.User{Subject: "42", Email: "ada@example.com", EmailVerified: true})
+
+	// A validly signed state carrying another login's PKCE verifier doesn't
+	// redeem the code.
+	claims, err := utils.ValidateLoginState("test-secret-key", state.Value)
+	if err != nil {
+		t.Fatalf("ValidateLoginState: %v", err)
+	}
+	forged := &transfer.LoginStateClaims{
+		Provider: claims.Provider,
+		State:    claims.State,
+		Verifier: claims.Verifier + "x",
+		Nonce:    claims.Nonce,
+		ReturnTo: claims.ReturnTo,
+	}
+	if state.Value, err = utils.GenerateLoginState("test-secret-key", forged, loginStateTTL); err != nil {
+		t.Fatalf("GenerateLoginState: %v", err)
+	}
+
+	resp := lt.do(t, callback, []*http.Cookie{state})
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Fatalf("callback status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+	}
+	if sessionCookie(resp) != nil || len(lt.store.users) != 0 {
+		t.Error("login with a wrong verifier signed in")
+	}
+}
+
+func TestResolveReturnTo(t *testing.T) {
+	h := &AuthHandler{cfg: config.Config{
+		FrontendURL:     testFrontendURL + "/",
+		ReturnToOrigins: []string{"https://Admin.example.com"},
+	}}
+
+	tests := []struct {
+		returnTo string
+		want     string
+		ok       bool
+	}{
+		{"", testFrontendURL, true},
+		{"/videos?tab=1", testFrontendURL + "/videos?tab=1", true},
+		{testFrontendURL + "/billing", testFrontendURL + "/billing", true},
+		{"https://admin.example.com/users", "https://admin.example.com/users", true},
+		{"https://evil.example.com/", "", false},
+		{"https://app.example.com.evil.com/", "", false},
+		{"http://app.example.com/", "", false},
+		{"//evil.example.com/", "", false},
+		{"/\\evil.example.com", "", false},
+		{"videos", "", false},
+		{"javascript:alert(1)", "", false},
+		{"https://user@app.example.com/", "", false},
+		{"/videos\r\nLocation: https://evil.example.com", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := h.resolveReturnTo(tt.returnTo)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("resolveReturnTo(%q) = %q, %v, want %q, %v", tt.returnTo, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestLoginRejectsForeignReturnTo(t *testing.T) {
+	lt := newLoginTest(t)
+
+	resp := lt.do(t, "/login/"+testLoginProvider+"?return_to="+url.QueryEscape("https://evil.example.com/"), nil)
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+	}
+	if len(resp.Cookies()) != 0 {
+		t.Error("login with a foreign return_to set cookies")
+	}
+}
+
+func TestLoginUnknownProvider(t *testing.T) {
+	lt := newLoginTest(t)
+
+	if resp := lt.do(t, "/login/nope", nil); resp.StatusCode != fiber.StatusNotFound {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, fiber.StatusNotFound)
+	}
+}
+
+func TestEmailLoginLinkSignsInOnce(t *testing.T) {
+	lt := newLoginTest(t)
+
+	status, link := lt.requestLoginLink(t, "ada@example.com")
+	if status != fiber.StatusAccepted {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusAccepted)
+	}
+	if link == "" {
+		t.Fatal("no login link mailed")
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("parsing login link: %v", err)
+	}
+
+	resp := lt.do(t, u.RequestURI(), nil)
+	if resp.StatusCode != fiber.StatusTemporaryRedirect {
+		t.Fatalf("verify status = %d, want %d", resp.StatusCode, fiber.StatusTemporaryRedirect)
+	}
+	if got, want := resp.Header.Get("Location"), testFrontendURL+"/videos"; got != want {
+		t.Errorf("redirect = %q, want %q", got, want)
+	}
+	if sessionCookie(resp) == nil {
+		t.Error("no session cookie set")
+	}
+	if _, ok := lt.store.users["ada@example.com"]; !ok {
+		t.Error("no user created")
+	}
+
+	resp = lt.do(t, u.RequestURI(), nil)
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Fatalf("second verify status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+	}
+	if sessionCookie(resp) != nil {
+		t.Error("used link set a session cookie")
+	}
+}
+
+func TestEmailLoginSignsInToExistingUser(t *testing.T) {
+	lt := newLoginTest(t)
+	lt.store.users["ada@example.com"] = &models.User{ID: 7, Email: "ada@example.com", GoogleID: "g-1"}
+
+	_, link := lt.requestLoginLink(t, "ada@example.com")
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("parsing login link: %v", err)
+	}
+
+	if resp := lt.do(t, u.RequestURI(), nil); resp.StatusCode != fiber.StatusTemporaryRedirect {
+		t.Fatalf("verify status = %d, want %d", resp.StatusCode, fiber.StatusTemporaryRedirect)
+	}
+
+	if len(lt.store.users) != 1 {
+		t.Errorf("users = %d, want 1", len(lt.store.users))
+	}
+	if len(lt.identities.identities) != 1 || lt.identities.identities[0].UserID != 7 {
+		t.Fatalf("identities = %+v, want one for user 7", lt.identities.identities)
+	}
+}
+
+func TestEmailLoginIgnoresCase(t *testing.T) {
+	lt := newLoginTest(t)
+	lt.store.users["ada@example.com"] = &models.User{ID: 7, Email: "ada@example.com", GoogleID: "g-1"}
+
+	_, link := lt.requestLoginLink(t, "Ada@Example.COM")
+	if link == "" {
+		t.Fatal("no login link mailed to the lowercased address")
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("parsing login link: %v", err)
+	}
+
+	if resp := lt.do(t, u.RequestURI(), nil); resp.StatusCode != fiber.StatusTemporaryRedirect {
+		t.Fatalf("verify status = %d, want %d", resp.StatusCode, fiber.StatusTemporaryRedirect)
+	}
+	if len(lt.store.users) != 1 {
+		t.Errorf("users = %d, want 1", len(lt.store.users))
+	}
+	if len(lt.identities.identities) != 1 || lt.identities.identities[0].UserID != 7 {
+		t.Fatalf("identities = %+v, want one for user 7", lt.identities.identities)
+	}
+}
+
+func TestEmailLoginIsThrottled(t *testing.T) {
+	lt := newLoginTest(t)
+
+	for i := 0; i < 5; i++ {
+		if status, _ := lt.requestLoginLink(t, "ada@example.com"); status != fiber.StatusAccepted {
+			t.Fatalf("request %d status = %d, want %d", i+1, status, fiber.StatusAccepted)
+		}
+	}
+
+	if status, _ := lt.requestLoginLink(t, "ada@example.com"); status != fiber.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusTooManyRequests)
+	}
+	if status, _ := lt.requestLoginLink(t, "ADA@Example.com"); status != fiber.StatusTooManyRequests {
+		t.Fatalf("case variant status = %d, want %d", status, fiber.StatusTooManyRequests)
+	}
+
+	// Other addresses from the same client are throttled separately, up to
+	// the limit per IP.
+	if status, _ := lt.requestLoginLink(t, "grace@example.com"); status != fiber.StatusAccepted {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusAccepted)
+	}
+	for i := 0; i < 20; i++ {
+		lt.requestLoginLink(t, "user"+strconv.Itoa(i)+"@example.com")
+	}
+	if status, _ := lt.requestLoginLink(t, "linus@example.com"); status != fiber.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusTooManyRequests)
+	}
+}
+
+func TestEmailLoginRejectsBadInput(t *testing.T) {
+	lt := newLoginTest(t)
+
+	if status, _ := lt.requestLoginLink(t, "not an email"); status != fiber.StatusBadRequest {
+		t.Errorf("invalid email status = %d, want %d", status, fiber.StatusBadRequest)
+	}
+
+	if resp := lt.do(t, "/login/email/verify?token=forged", nil); resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("forged token status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+	}
+}
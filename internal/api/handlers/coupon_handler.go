@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maheshrc27/postflow/internal/service"
+	"github.com/maheshrc27/postflow/internal/transfer"
+)
+
+type CouponHandler struct {
+	s service.CouponService
+}
+
+func NewCouponHandler(service service.CouponService) *CouponHandler {
+	return &CouponHandler{s: service}
+}
+
+func (h *CouponHandler) Redeem(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to parse request",
+		})
+	}
+
+	t, err := h.s.Redeem(c.Context(), userId, req.Code)
+	if err != nil {
+		if status, message, ok := couponError(err); ok {
+			return c.Status(status).JSON(fiber.Map{
+				"error": message,
+			})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to redeem coupon",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"credits": t.Amount,
+		"balance": t.BalanceAfter,
+	})
+}
+
+func (h *CouponHandler) CreateCoupon(c *fiber.Ctx) error {
+	var req transfer.CouponCreate
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to parse request",
+		})
+	}
+
+	coupon := req.Coupon()
+	if err := h.s.Create(c.Context(), coupon); err != nil {
+		if errors.Is(err, service.ErrInvalidCoupon) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Unable to create coupon",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(coupon)
+}
+
+func (h *CouponHandler) ListCoupons(c *fiber.Ctx) error {
+	coupons, err := h.s.List(c.Context(), c.Query("campaign"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Unable to list coupons",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"coupons": coupons,
+	})
+}
+
+// couponError maps coupon errors to the status and message shown to users.
+func couponError(err error) (int, string, bool) {
+	switch {
+	case errors.Is(err, service.ErrCouponNotFound):
+		return fiber.StatusNotFound, "Coupon not found", true
+	case errors.Is(err, service.ErrCouponUnavailable):
+		return fiber.StatusGone, "Coupon is expired or fully redeemed", true
+	case errors.Is(err, service.ErrCouponRedeemed):
+		return fiber.StatusConflict, "Coupon already redeemed", true
+	case errors.Is(err, service.ErrCouponNotApplicable):
+		return fiber.StatusBadRequest, err.Error(), true
+	}
+	return 0, "", false
+}
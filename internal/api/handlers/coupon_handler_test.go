@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/service"
+)
+
+// fakeCouponService records the coupon the handler asks it to create.
+type fakeCouponService struct {
+	service.CouponService
+	created *models.Coupon
+}
+
+func (s *fakeCouponService) Create(ctx context.Context, coupon *models.Coupon) error {
+	s.created = coupon
+	coupon.ID = 12
+	coupon.CreatedAt = time.Now()
+	return nil
+}
+
+func postCoupon(t *testing.T, app *fiber.App, body string) *http.Response {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/coupons", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("sending request: %v", err)
+	}
+	return resp
+}
+
+func TestCreateCouponIgnoresServerFields(t *testing.T) {
+	coupons := &fakeCouponService{}
+	app := fiber.New()
+	app.Post("/admin/coupons", NewCouponHandler(coupons).CreateCoupon)
+
+	body := `{"id":99,"code":"LAUNCH","credits":5,"max_redemptions":100,"redemptions":100,"campaign":"launch","created_at":"2020-01-01T00:00:00Z"}`
+	resp := postCoupon(t, app, body)
+	if resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, fiber.StatusCreated)
+	}
+
+	got := coupons.created
+	if got == nil {
+		t.Fatal("no coupon created")
+	}
+	if got.Code != "LAUNCH" || got.Credits != 5 || got.MaxRedemptions != 100 || got.Campaign != "launch" {
+		t.Errorf("created coupon = %+v, want the admin-settable fields from the request", got)
+	}
+
+	var created models.Coupon
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if created.ID != 12 || created.Redemptions != 0 || created.CreatedAt.Year() == 2020 {
+		t.Errorf("response = %+v, want the ID, redemptions and creation time set by the server", created)
+	}
+}
+
+func TestCreateCouponRejectsInvalid(t *testing.T) {
+	app := fiber.New()
+	app.Post("/admin/coupons", NewCouponHandler(service.NewCouponService(config.Credits{}, nil)).CreateCoupon)
+
+	resp := postCoupon(t, app, `{"code":"BOTH","credits":5,"discount_percent":10}`)
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+	}
+
+	resp = postCoupon(t, app, `{"code":`)
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("malformed body: status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+	}
+}
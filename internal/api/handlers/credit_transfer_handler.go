@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maheshrc27/postflow/internal/service"
+)
+
+type CreditTransferHandler struct {
+	t service.CreditTransferService
+}
+
+func NewCreditTransferHandler(service service.CreditTransferService) *CreditTransferHandler {
+	return &CreditTransferHandler{t: service}
+}
+
+func (h *CreditTransferHandler) Transfer(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	var req struct {
+		Email  string `json:"email"`
+		Amount int64  `json:"amount"`
+		Note   string `json:"note"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to parse request",
+		})
+	}
+
+	transfer, err := h.t.Transfer(c.Context(), userId, req.Email, req.Amount, req.Note)
+	if err != nil {
+		return transferErrorResponse(c, err, "Unable to transfer credits")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(transfer)
+}
+
+func (h *CreditTransferHandler) CreateGift(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	var req struct {
+		Amount int64  `json:"amount"`
+		Note   string `json:"note"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to parse request",
+		})
+	}
+
+	gift, err := h.t.CreateGift(c.Context(), userId, req.Amount, req.Note)
+	if err != nil {
+		return transferErrorResponse(c, err, "Unable to create gift code")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(gift)
+}
+
+func (h *CreditTransferHandler) RedeemGift(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to parse request",
+		})
+	}
+
+	gift, err := h.t.RedeemGift(c.Context(), userId, req.Code)
+	if err != nil {
+		return transferErrorResponse(c, err, "Unable to redeem gift code")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"credits": gift.Amount,
+	})
+}
+
+func (h *CreditTransferHandler) ListGifts(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	gifts, err := h.t.ListGifts(c.Context(), userId)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to get gift codes",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"gifts": gifts,
+	})
+}
+
+func transferErrorResponse(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidAmount), errors.Is(err, service.ErrSelfTransfer):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, service.ErrRecipientNotFound), errors.Is(err, service.ErrGiftNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, service.ErrInsufficientCredits):
+		return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
+			"error": "Not enough credits",
+		})
+	case errors.Is(err, service.ErrTransferLimit):
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, service.ErrAccountLocked):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Account is locked, please contact support",
+		})
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error": fallback,
+	})
+}
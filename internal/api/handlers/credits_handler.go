@@ -23,7 +23,32 @@ func (h *CreditsHandler) GetCredits(c *fiber.Ctx) error {
 		})
 	}
 
+	expiring, err := h.c.GetExpiring(c.Context(), userId)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to get expiring credits",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"credits":   credits.Credits,
+		"available": credits.Available(),
+		"reserved":  credits.Reserved,
+		"expiring":  expiring,
+	})
+}
+
+func (h *CreditsHandler) GetHistory(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	history, err := h.c.GetHistory(c.Context(), userId, c.QueryInt("limit"), c.QueryInt("offset"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to get credit history",
+		})
+	}
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"credits": credits,
+		"transactions": history,
 	})
 }
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maheshrc27/postflow/internal/service"
+)
+
+type EmailClaimHandler struct {
+	s service.EmailClaimService
+}
+
+func NewEmailClaimHandler(service service.EmailClaimService) *EmailClaimHandler {
+	return &EmailClaimHandler{s: service}
+}
+
+// ClaimEmail mails a verification code to an address the user wants to link
+// to their account.
+func (h *EmailClaimHandler) ClaimEmail(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to parse request",
+		})
+	}
+
+	if err := h.s.Start(c.Context(), userId, req.Email); err != nil {
+		return emailClaimErrorResponse(c, err, "Unable to send verification code")
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Verification code sent",
+	})
+}
+
+func (h *EmailClaimHandler) ConfirmEmail(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	var req struct {
+		Email string `json:"email"`
+		Code  string `json:"code"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Email == "" || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to parse request",
+		})
+	}
+
+	merge, err := h.s.Confirm(c.Context(), userId, req.Email, req.Code)
+	if err != nil {
+		return emailClaimErrorResponse(c, err, "Unable to verify email")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(merge)
+}
+
+func (h *EmailClaimHandler) ListEmails(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	emails, err := h.s.ListEmails(c.Context(), userId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Unable to get emails",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"emails": emails,
+	})
+}
+
+func emailClaimErrorResponse(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidEmail), errors.Is(err, service.ErrInvalidClaimCode):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, service.ErrEmailClaimNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, service.ErrEmailOwned):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, service.ErrEmailClaimLimit):
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": fallback,
+	})
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/maheshrc27/postflow/internal/service"
+)
+
+type EntitlementHandler struct {
+	e service.EntitlementService
+}
+
+func NewEntitlementHandler(service service.EntitlementService) *EntitlementHandler {
+	return &EntitlementHandler{e: service}
+}
+
+func (h *EntitlementHandler) GetEntitlements(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	entitlements, err := h.e.GetEntitlements(c.Context(), userId)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to get entitlements",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(entitlements)
+}
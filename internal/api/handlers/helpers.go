@@ -10,3 +10,8 @@ func GetUserID(c *fiber.Ctx) int64 {
 	userID, _ := strconv.Atoi(c.Locals("user_id").(string))
 	return int64(userID)
 }
+
+func GetSessionID(c *fiber.Ctx) string {
+	sessionID, _ := c.Locals("session_id").(string)
+	return sessionID
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maheshrc27/postflow/internal/service"
+)
+
+type InvoiceHandler struct {
+	o service.OrderService
+}
+
+func NewInvoiceHandler(service service.OrderService) *InvoiceHandler {
+	return &InvoiceHandler{o: service}
+}
+
+func (h *InvoiceHandler) ListInvoices(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	invoices, err := h.o.ListInvoices(c.Context(), userId)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to get invoices",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"invoices": invoices,
+	})
+}
+
+func (h *InvoiceHandler) GetInvoicePDF(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	orderID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid invoice id",
+		})
+	}
+
+	var pdf bytes.Buffer
+	if err := h.o.RenderInvoice(c.Context(), userId, int64(orderID), &pdf); err != nil {
+		if errors.Is(err, service.ErrOrderNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Invoice not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Unable to render invoice",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/pdf")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`inline; filename="invoice-%d.pdf"`, orderID))
+	return c.Status(fiber.StatusOK).Send(pdf.Bytes())
+}
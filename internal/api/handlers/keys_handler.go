@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/maheshrc27/postflow/internal/keyring"
+)
+
+type KeysHandler struct {
+	keys *keyring.Keyring
+}
+
+func NewKeysHandler(keys *keyring.Keyring) *KeysHandler {
+	return &KeysHandler{keys: keys}
+}
+
+// JWKS publishes the public keys session tokens are signed with, so that
+// other services can verify them.
+func (h *KeysHandler) JWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.Status(fiber.StatusOK).JSON(h.keys.JWKS(c.Context()))
+}
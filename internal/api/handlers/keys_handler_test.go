@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/maheshrc27/postflow/internal/keyring"
+)
+
+func TestAccessTokenVerifiesAgainstJWKS(t *testing.T) {
+	lt := newLoginTest(t)
+	cookies := lt.signIn(t, testUser)
+
+	resp := lt.do(t, "/.well-known/jwks.json", nil)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	var set keyring.JSONWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		t.Fatalf("decoding JWKS: %v", err)
+	}
+	if len(set.Keys) != 1 || set.Keys[0].KTY != "OKP" || set.Keys[0].Alg != keyring.EdDSA {
+		t.Fatalf("keys = %+v, want one Ed25519 key", set.Keys)
+	}
+
+	// A service holding only the JWKS can verify session tokens.
+	x, err := base64.RawURLEncoding.DecodeString(set.Keys[0].X)
+	if err != nil {
+		t.Fatalf("decoding key: %v", err)
+	}
+	token, err := jwt.Parse(cookies[0].Value, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["kid"] != set.Keys[0].KID {
+			t.Errorf("kid = %v, want %s", token.Header["kid"], set.Keys[0].KID)
+		}
+		return ed25519.PublicKey(x), nil
+	}, jwt.WithValidMethods([]string{keyring.EdDSA}))
+	if err != nil || !token.Valid {
+		t.Fatalf("access token does not verify against JWKS: %v", err)
+	}
+
+	if resp.Header.Get(fiber.HeaderCacheControl) == "" {
+		t.Error("JWKS is not cacheable")
+	}
+}
+
+func TestAccessTokenSignedWithSecretIsRejected(t *testing.T) {
+	lt := newLoginTest(t)
+
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": "1",
+		"sid":     "session",
+		"iss":     "postflow",
+	}).SignedString([]byte("test-secret-key"))
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+
+	resp := lt.api(t, http.MethodGet, "/api/sessions", &http.Cookie{Name: "token", Value: forged})
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, fiber.StatusUnauthorized)
+	}
+}
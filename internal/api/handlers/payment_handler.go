@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"log"
+	"net/http"
+	"net/url"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/maheshrc27/postflow/internal/payment"
 	"github.com/maheshrc27/postflow/internal/service"
 )
 
@@ -15,20 +19,86 @@ func NewPaymentHandler(service service.PaymentService) *PaymentHandler {
 	return &PaymentHandler{c: service}
 }
 
+// PaymentWebhook receives provider webhooks on /payment/webhook/:provider.
+// The bare /payment/webhook route predates provider selection and is kept
+// for the Gumroad ping URL.
 func (h *PaymentHandler) PaymentWebhook(c *fiber.Ctx) error {
-	customerEmail := c.FormValue("email")
-	productId := c.FormValue("short_product_id")
-	productPrice := c.FormValue("price")
+	provider := c.Params("provider", payment.ProviderGumroad)
 
-	if customerEmail == "" || productId == "" {
-		log.Println("Error: Missing email or product_id in webhook payload")
-		return c.Status(fiber.StatusBadRequest).SendString("Email or product_id is empty")
+	query, _ := url.ParseQuery(string(c.Request().URI().QueryString()))
+	header := http.Header{}
+	for key, values := range c.GetReqHeaders() {
+		for _, value := range values {
+			header.Add(key, value)
+		}
 	}
 
-	err := h.c.HandlePayment(c.Context(), customerEmail, productId, productPrice)
+	err := h.c.HandleWebhook(c.Context(), provider, &payment.WebhookRequest{
+		Header: header,
+		Query:  query,
+		Body:   append([]byte(nil), c.Body()...),
+	})
 	if err != nil {
+		log.Printf("Error: Payment webhook from %s failed: %v", provider, err)
+		switch {
+		case errors.Is(err, payment.ErrUnknownProvider):
+			return c.Status(fiber.StatusNotFound).SendString("Unknown payment provider")
+		case errors.Is(err, payment.ErrInvalidSignature):
+			return c.Status(fiber.StatusUnauthorized).SendString("Invalid webhook signature")
+		case errors.Is(err, payment.ErrMalformedWebhook):
+			return c.Status(fiber.StatusBadRequest).SendString("Malformed webhook payload")
+		}
 		return c.Status(fiber.StatusInternalServerError).SendString("Something went wrong while saving account")
 	}
 
 	return c.SendStatus(fiber.StatusOK)
 }
+
+func (h *PaymentHandler) GetPricing(c *fiber.Ctx) error {
+	priceList, products, err := h.c.ListProducts(c.Context(), c.Query("country"), c.IP())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Unable to get pricing",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"price_list": priceList.Code,
+		"currency":   priceList.Currency,
+		"products":   products,
+	})
+}
+
+func (h *PaymentHandler) CreateCheckout(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	var req struct {
+		ProductID int64  `json:"product_id"`
+		Coupon    string `json:"coupon"`
+		Country   string `json:"country"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.ProductID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to parse request",
+		})
+	}
+
+	session, err := h.c.CreateCheckout(c.Context(), userId, req.ProductID, req.Coupon, req.Country, c.IP())
+	if err != nil {
+		if errors.Is(err, service.ErrProductNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Product not found",
+			})
+		}
+		if status, message, ok := couponError(err); ok {
+			return c.Status(status).JSON(fiber.Map{
+				"error": message,
+			})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to start checkout",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(session)
+}
@@ -0,0 +1,527 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/payment"
+	"github.com/maheshrc27/postflow/internal/repository"
+	"github.com/maheshrc27/postflow/internal/service"
+)
+
+const testWebhookSecret = "test-webhook-secret"
+
+const testSignupBonus = 1
+
+// fakeStore backs the repositories used by the payment service with maps.
+// Methods the webhook path doesn't call are left to the embedded interfaces
+// and panic if reached.
+type fakeStore struct {
+	mu           sync.Mutex
+	users        map[string]*models.User
+	balances     map[int64]int64
+	transactions []*models.CreditTransaction
+	events       map[string]*models.PaymentEvent
+	products     []*models.Product
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		users:    map[string]*models.User{},
+		balances: map[int64]int64{},
+		events:   map[string]*models.PaymentEvent{},
+		products: []*models.Product{
+			{ID: 1, Provider: payment.ProviderGumroad, ProductID: "ehajql", Name: "Starter pack", PriceMinor: 500, Currency: "usd", Credits: 10, Active: true},
+			{ID: 2, Provider: payment.ProviderGumroad, ProductID: "ehajql", Name: "Creator pack", PriceMinor: 900, Currency: "usd", Credits: 30, Active: true},
+			{ID: 3, Provider: payment.ProviderGumroad, ProductID: "ehajql", Name: "Studio pack", PriceMinor: 1500, Currency: "usd", Credits: 50, Active: true},
+		},
+	}
+}
+
+type fakeUserRepository struct {
+	repository.UserRepository
+	s *fakeStore
+}
+
+func (r *fakeUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for key, user := range r.s.users {
+		if strings.EqualFold(key, email) {
+			return user, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (r *fakeUserRepository) GetByID(ctx context.Context, id int64) (*models.User, bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, user := range r.s.users {
+		if user.ID == id {
+			return user, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (r *fakeUserRepository) GetByLinkedEmail(ctx context.Context, email string) (*models.User, bool, error) {
+	return nil, false, nil
+}
+
+func (r *fakeUserRepository) Create(ctx context.Context, user *models.User) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	user.ID = int64(len(r.s.users) + 1)
+	r.s.users[user.Email] = user
+	return user.ID, nil
+}
+
+type fakeCreditsRepository struct {
+	repository.CreditsRepository
+	s *fakeStore
+}
+
+func (r *fakeCreditsRepository) Create(ctx context.Context, credits *models.Credits) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.s.balances[credits.UserID] = credits.Credits
+	return credits.UserID, nil
+}
+
+func (r *fakeCreditsRepository) GetByUserID(ctx context.Context, userID int64) (*models.Credits, bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	balance, ok := r.s.balances[userID]
+	return &models.Credits{UserID: userID, Credits: balance}, ok, nil
+}
+
+func (r *fakeCreditsRepository) Apply(ctx context.Context, t *models.CreditTransaction) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, existing := range r.s.transactions {
+		if t.ReferenceID != "" && existing.Kind == t.Kind && existing.ReferenceType == t.ReferenceType && existing.ReferenceID == t.ReferenceID {
+			return repository.ErrDuplicateTransaction
+		}
+	}
+	r.s.balances[t.UserID] += t.Amount
+	t.BalanceAfter = r.s.balances[t.UserID]
+	r.s.transactions = append(r.s.transactions, t)
+	return nil
+}
+
+func (r *fakeCreditsRepository) GetByReference(ctx context.Context, kind, referenceType, referenceID string) (*models.CreditTransaction, bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, t := range r.s.transactions {
+		if t.Kind == kind && t.ReferenceType == referenceType && t.ReferenceID == referenceID {
+			return t, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+type fakePaymentEventRepository struct {
+	repository.PaymentEventRepository
+	s *fakeStore
+}
+
+func (r *fakePaymentEventRepository) Claim(ctx context.Context, e *models.PaymentEvent) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	key := e.Provider + "/" + e.SaleID
+	if existing, ok := r.s.events[key]; ok {
+		if existing.Status != models.PaymentEventFailed {
+			return false, nil
+		}
+		e.ID = existing.ID
+	} else {
+		e.ID = int64(len(r.s.events) + 1)
+	}
+	e.Status = models.PaymentEventProcessing
+	stored := *e
+	r.s.events[key] = &stored
+	return true, nil
+}
+
+func (r *fakePaymentEventRepository) GetBySaleID(ctx context.Context, provider, saleID string) (*models.PaymentEvent, bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	e, ok := r.s.events[provider+"/"+saleID]
+	return e, ok, nil
+}
+
+func (r *fakePaymentEventRepository) setStatus(id int64, status, reason string) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, e := range r.s.events {
+		if e.ID == id {
+			e.Status = status
+			e.Error = reason
+		}
+	}
+}
+
+func (r *fakePaymentEventRepository) MarkProcessed(ctx context.Context, id, userID int64) error {
+	r.setStatus(id, models.PaymentEventProcessed, "")
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, e := range r.s.events {
+		if e.ID == id {
+			e.UserID = &userID
+		}
+	}
+	return nil
+}
+
+func (r *fakePaymentEventRepository) MarkReversed(ctx context.Context, id int64, status string) error {
+	r.setStatus(id, status, "")
+	return nil
+}
+
+func (r *fakePaymentEventRepository) MarkRestored(ctx context.Context, id int64) error {
+	r.setStatus(id, models.PaymentEventProcessed, "")
+	return nil
+}
+
+func (r *fakePaymentEventRepository) MarkFailed(ctx context.Context, id int64, reason string) error {
+	r.setStatus(id, models.PaymentEventFailed, reason)
+	return nil
+}
+
+type fakeProductRepository struct {
+	repository.ProductRepository
+	s *fakeStore
+}
+
+func (r *fakeProductRepository) GetByProviderPrice(ctx context.Context, provider, productID, currency string, priceMinor int64) (*models.Product, bool, error) {
+	for _, p := range r.s.products {
+		if p.Active && p.Provider == provider && p.ProductID == productID && p.Currency == currency && p.PriceMinor == priceMinor {
+			return p, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// fakeReferralRepository has no referrals, so purchases never pay out rewards.
+type fakeReferralRepository struct {
+	repository.ReferralRepository
+}
+
+func (fakeReferralRepository) GetByRefereeID(ctx context.Context, refereeID int64) (*models.Referral, bool, error) {
+	return nil, false, nil
+}
+
+func (fakeReferralRepository) ReverseReward(ctx context.Context, paymentEventID int64) (*models.Referral, bool, error) {
+	return nil, false, nil
+}
+
+// fakeOrderService skips order bookkeeping, which the webhook tests don't
+// cover.
+type fakeOrderService struct {
+	service.OrderService
+}
+
+func (fakeOrderService) RecordPurchase(ctx context.Context, userID, eventID int64, product *models.Product, coupon *models.Coupon, event *payment.Event) error {
+	return nil
+}
+
+func newWebhookApp(t *testing.T, secret string) (*fiber.App, *fakeStore) {
+	t.Helper()
+
+	store := newFakeStore()
+	providers := payment.Providers{}
+	providers.Register(payment.NewGumroad(secret))
+
+	cfg := config.Config{Credits: config.Credits{SignupBonus: testSignupBonus}}
+	paymentService := service.NewPaymentService(cfg,
+		&fakeUserRepository{s: store},
+		&fakeCreditsRepository{s: store},
+		&fakePaymentEventRepository{s: store},
+		&fakeProductRepository{s: store},
+		nil,
+		nil,
+		service.NewReferralService(config.Config{}, fakeReferralRepository{}),
+		fakeOrderService{},
+		nil,
+		providers,
+	)
+
+	app := fiber.New()
+	app.Post("/payment/webhook", NewPaymentHandler(paymentService).PaymentWebhook)
+	return app, store
+}
+
+func loadPayload(t *testing.T, name string) string {
+	t.Helper()
+
+	body, err := os.ReadFile(filepath.Join("testdata", "gumroad", name))
+	if err != nil {
+		t.Fatalf("reading payload %s: %v", name, err)
+	}
+	return string(body)
+}
+
+func postWebhook(t *testing.T, app *fiber.App, target, body string, header http.Header) int {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("sending webhook: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestPaymentWebhookGrantsCredits(t *testing.T) {
+	tests := []struct {
+		payload string
+		email   string
+		credits int64
+	}{
+		{"sale_500.txt", "buyer@example.com", testSignupBonus + 10},
+		{"sale_1500.txt", "studio@example.org", testSignupBonus + 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.payload, func(t *testing.T) {
+			app, store := newWebhookApp(t, testWebhookSecret)
+
+			status := postWebhook(t, app, "/payment/webhook?secret="+testWebhookSecret, loadPayload(t, tt.payload), nil)
+			if status != fiber.StatusOK {
+				t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+			}
+
+			user, ok := store.users[tt.email]
+			if !ok {
+				t.Fatalf("no user created for %s", tt.email)
+			}
+			if got := store.balances[user.ID]; got != tt.credits {
+				t.Errorf("balance = %d, want %d", got, tt.credits)
+			}
+		})
+	}
+}
+
+func TestPaymentWebhookReplayIsIgnored(t *testing.T) {
+	app, store := newWebhookApp(t, testWebhookSecret)
+	body := loadPayload(t, "sale_500.txt")
+
+	for i := 0; i < 3; i++ {
+		status := postWebhook(t, app, "/payment/webhook?secret="+testWebhookSecret, body, nil)
+		if status != fiber.StatusOK {
+			t.Fatalf("delivery %d: status = %d, want %d", i+1, status, fiber.StatusOK)
+		}
+	}
+
+	user := store.users["buyer@example.com"]
+	if got, want := store.balances[user.ID], int64(testSignupBonus+10); got != want {
+		t.Errorf("balance after replays = %d, want %d", got, want)
+	}
+	if got := len(store.events); got != 1 {
+		t.Errorf("stored events = %d, want 1", got)
+	}
+}
+
+func TestPaymentWebhookAcceptsSignature(t *testing.T) {
+	app, store := newWebhookApp(t, testWebhookSecret)
+	body := loadPayload(t, "sale_500.txt")
+
+	header := http.Header{}
+	header.Set(payment.GumroadSignatureHeader, sign(testWebhookSecret, body))
+
+	if status := postWebhook(t, app, "/payment/webhook", body, header); status != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+	}
+	if _, ok := store.users["buyer@example.com"]; !ok {
+		t.Error("signed webhook was not processed")
+	}
+}
+
+func TestPaymentWebhookRejectsUnverified(t *testing.T) {
+	body := loadPayload(t, "sale_500.txt")
+	badSignature := http.Header{}
+	badSignature.Set(payment.GumroadSignatureHeader, sign("another-secret", body))
+
+	tests := []struct {
+		name   string
+		secret string
+		target string
+		header http.Header
+	}{
+		{"no secret", testWebhookSecret, "/payment/webhook", nil},
+		{"wrong secret", testWebhookSecret, "/payment/webhook?secret=guess", nil},
+		{"wrong signature", testWebhookSecret, "/payment/webhook", badSignature},
+		{"unconfigured", "", "/payment/webhook?secret=", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, store := newWebhookApp(t, tt.secret)
+
+			if status := postWebhook(t, app, tt.target, body, tt.header); status != fiber.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", status, fiber.StatusUnauthorized)
+			}
+			if len(store.events) != 0 || len(store.transactions) != 0 {
+				t.Error("unverified webhook was processed")
+			}
+		})
+	}
+}
+
+func TestPaymentWebhookFailedEventCanBeRetried(t *testing.T) {
+	app, store := newWebhookApp(t, testWebhookSecret)
+	body := loadPayload(t, "sale_unknown_price.txt")
+
+	for i := 0; i < 2; i++ {
+		status := postWebhook(t, app, "/payment/webhook?secret="+testWebhookSecret, body, nil)
+		if status != fiber.StatusInternalServerError {
+			t.Fatalf("delivery %d: status = %d, want %d", i+1, status, fiber.StatusInternalServerError)
+		}
+	}
+
+	if got := len(store.events); got != 1 {
+		t.Fatalf("stored events = %d, want 1", got)
+	}
+	for _, e := range store.events {
+		if e.Status != models.PaymentEventFailed || e.Error == "" {
+			t.Errorf("event status = %q (%q), want failed with a reason", e.Status, e.Error)
+		}
+	}
+	if len(store.transactions) != 0 {
+		t.Error("credits granted for an unknown price")
+	}
+}
+
+func TestPaymentWebhookRejectsOtherCurrency(t *testing.T) {
+	app, store := newWebhookApp(t, testWebhookSecret)
+	// The amount of the pack's dollar price, paid in euros.
+	body := strings.Replace(loadPayload(t, "sale_500.txt"), "currency=usd", "currency=eur", 1)
+
+	status := postWebhook(t, app, "/payment/webhook?secret="+testWebhookSecret, body, nil)
+	if status != fiber.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusInternalServerError)
+	}
+	for _, e := range store.events {
+		if e.Status != models.PaymentEventFailed || !strings.Contains(e.Error, "eur") {
+			t.Errorf("event status = %q (%q), want failed for the currency", e.Status, e.Error)
+		}
+	}
+	if len(store.transactions) != 0 {
+		t.Error("credits granted for a sale in another currency")
+	}
+}
+
+func TestPaymentWebhookRefundReversesPurchase(t *testing.T) {
+	app, store := newWebhookApp(t, testWebhookSecret)
+	target := "/payment/webhook?secret=" + testWebhookSecret
+
+	if status := postWebhook(t, app, target, loadPayload(t, "sale_500.txt"), nil); status != fiber.StatusOK {
+		t.Fatalf("sale: status = %d, want %d", status, fiber.StatusOK)
+	}
+
+	// Spend more than the signup credit so the reversal has to go negative.
+	user := store.users["buyer@example.com"]
+	store.balances[user.ID] -= 5
+
+	for i := 0; i < 2; i++ {
+		if status := postWebhook(t, app, target, loadPayload(t, "refund_500.txt"), nil); status != fiber.StatusOK {
+			t.Fatalf("refund delivery %d: status = %d, want %d", i+1, status, fiber.StatusOK)
+		}
+	}
+
+	if got, want := store.balances[user.ID], int64(testSignupBonus+10-5-10); got != want {
+		t.Errorf("balance after refund = %d, want %d", got, want)
+	}
+
+	sale := store.events[payment.ProviderGumroad+"/k1SxR0WqF7dC9b3uZg5YtA=="]
+	if sale == nil || sale.Status != models.PaymentEventRefunded {
+		t.Errorf("original sale = %+v, want status %q", sale, models.PaymentEventRefunded)
+	}
+}
+
+func TestPaymentWebhookWonDisputeRestoresPurchase(t *testing.T) {
+	app, store := newWebhookApp(t, testWebhookSecret)
+	target := "/payment/webhook?secret=" + testWebhookSecret
+
+	for _, payload := range []string{"sale_500.txt", "dispute_500.txt"} {
+		if status := postWebhook(t, app, target, loadPayload(t, payload), nil); status != fiber.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", payload, status, fiber.StatusOK)
+		}
+	}
+
+	user := store.users["buyer@example.com"]
+	if got, want := store.balances[user.ID], int64(testSignupBonus); got != want {
+		t.Fatalf("balance after dispute = %d, want %d", got, want)
+	}
+
+	for i := 0; i < 2; i++ {
+		if status := postWebhook(t, app, target, loadPayload(t, "dispute_won_500.txt"), nil); status != fiber.StatusOK {
+			t.Fatalf("won dispute delivery %d: status = %d, want %d", i+1, status, fiber.StatusOK)
+		}
+	}
+
+	if got, want := store.balances[user.ID], int64(testSignupBonus+10); got != want {
+		t.Errorf("balance after won dispute = %d, want %d", got, want)
+	}
+
+	sale := store.events[payment.ProviderGumroad+"/k1SxR0WqF7dC9b3uZg5YtA=="]
+	if sale == nil || sale.Status != models.PaymentEventProcessed {
+		t.Errorf("original sale = %+v, want status %q", sale, models.PaymentEventProcessed)
+	}
+}
+
+func TestPaymentWebhookWonDisputeBeforeReversalIsRetried(t *testing.T) {
+	app, store := newWebhookApp(t, testWebhookSecret)
+	target := "/payment/webhook?secret=" + testWebhookSecret
+
+	if status := postWebhook(t, app, target, loadPayload(t, "sale_500.txt"), nil); status != fiber.StatusOK {
+		t.Fatalf("sale: status = %d, want %d", status, fiber.StatusOK)
+	}
+
+	if status := postWebhook(t, app, target, loadPayload(t, "dispute_won_500.txt"), nil); status != fiber.StatusInternalServerError {
+		t.Fatalf("won dispute: status = %d, want %d", status, fiber.StatusInternalServerError)
+	}
+
+	user := store.users["buyer@example.com"]
+	if got, want := store.balances[user.ID], int64(testSignupBonus+10); got != want {
+		t.Errorf("balance = %d, want %d", got, want)
+	}
+}
+
+func TestPaymentWebhookRefundBeforeSaleIsRetried(t *testing.T) {
+	app, store := newWebhookApp(t, testWebhookSecret)
+
+	status := postWebhook(t, app, "/payment/webhook?secret="+testWebhookSecret, loadPayload(t, "refund_500.txt"), nil)
+	if status != fiber.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusInternalServerError)
+	}
+	if len(store.transactions) != 0 {
+		t.Error("credits moved for a refund of an unknown sale")
+	}
+}
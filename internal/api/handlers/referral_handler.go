@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/maheshrc27/postflow/internal/service"
+)
+
+type ReferralHandler struct {
+	r service.ReferralService
+}
+
+func NewReferralHandler(service service.ReferralService) *ReferralHandler {
+	return &ReferralHandler{r: service}
+}
+
+func (h *ReferralHandler) GetReferrals(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	stats, err := h.r.GetStats(c.Context(), userId)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to get referrals",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(stats)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/api/middleware"
+	"github.com/maheshrc27/postflow/internal/service"
+)
+
+type SessionHandler struct {
+	s   service.SessionService
+	cfg config.Config
+}
+
+func NewSessionHandler(service service.SessionService, cfg config.Config) *SessionHandler {
+	return &SessionHandler{s: service, cfg: cfg}
+}
+
+// ListSessions returns the devices the user is signed in on.
+func (h *SessionHandler) ListSessions(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	sessions, err := h.s.List(c.Context(), userId, GetSessionID(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Unable to get sessions",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sessions": sessions,
+	})
+}
+
+// RevokeSession signs the user out on one of their devices.
+func (h *SessionHandler) RevokeSession(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	if err := h.s.Revoke(c.Context(), userId, c.Params("id")); err != nil {
+		return sessionErrorResponse(c, err, "Unable to revoke session")
+	}
+
+	if c.Params("id") == GetSessionID(c) {
+		middleware.ClearSessionCookies(c, &h.cfg)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// Logout ends the session the request was made with.
+func (h *SessionHandler) Logout(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	if err := h.s.Revoke(c.Context(), userId, GetSessionID(c)); err != nil && !errors.Is(err, service.ErrSessionNotFound) {
+		return sessionErrorResponse(c, err, "Unable to log out")
+	}
+
+	middleware.ClearSessionCookies(c, &h.cfg)
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// LogoutAll ends all of the user's sessions, including the current one.
+func (h *SessionHandler) LogoutAll(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	if err := h.s.RevokeAll(c.Context(), userId); err != nil {
+		return sessionErrorResponse(c, err, "Unable to log out")
+	}
+
+	middleware.ClearSessionCookies(c, &h.cfg)
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func sessionErrorResponse(c *fiber.Ctx, err error, fallback string) error {
+	if errors.Is(err, service.ErrSessionNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": fallback,
+	})
+}
@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/identity/identitytest"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+type fakeSessionRepository struct {
+	repository.SessionRepository
+	sessions      map[string]*models.Session
+	refreshTokens map[string]*models.RefreshToken
+}
+
+func newFakeSessionRepository() *fakeSessionRepository {
+	return &fakeSessionRepository{
+		sessions:      map[string]*models.Session{},
+		refreshTokens: map[string]*models.RefreshToken{},
+	}
+}
+
+func (r *fakeSessionRepository) Create(ctx context.Context, s *models.Session) error {
+	s.CreatedAt = time.Now()
+	s.LastSeenAt = s.CreatedAt
+	r.sessions[s.ID] = s
+	return nil
+}
+
+func (r *fakeSessionRepository) GetByID(ctx context.Context, id string) (*models.Session, bool, error) {
+	s, ok := r.sessions[id]
+	return s, ok, nil
+}
+
+func (r *fakeSessionRepository) Touch(ctx context.Context, id, ip string) error {
+	r.sessions[id].LastSeenAt = time.Now()
+	r.sessions[id].IP = ip
+	return nil
+}
+
+func (r *fakeSessionRepository) MarkTwoFactor(ctx context.Context, id string) error {
+	now := time.Now()
+	r.sessions[id].TwoFactorAt = &now
+	return nil
+}
+
+func (r *fakeSessionRepository) ListActive(ctx context.Context, userID int64) ([]*models.Session, error) {
+	var sessions []*models.Session
+	for _, s := range r.sessions {
+		if s.UserID == userID && s.RevokedAt == nil && s.ExpiresAt.After(time.Now()) {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions, nil
+}
+
+func (r *fakeSessionRepository) Revoke(ctx context.Context, userID int64, id string) (bool, error) {
+	s, ok := r.sessions[id]
+	if !ok || s.UserID != userID || s.RevokedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	s.RevokedAt = &now
+	return true, nil
+}
+
+func (r *fakeSessionRepository) RevokeAll(ctx context.Context, userID int64) error {
+	for _, s := range r.sessions {
+		if s.UserID == userID && s.RevokedAt == nil {
+			now := time.Now()
+			s.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *fakeSessionRepository) AddRefreshToken(ctx context.Context, t *models.RefreshToken) error {
+	t.CreatedAt = time.Now()
+	r.refreshTokens[t.TokenHash] = t
+	return nil
+}
+
+func (r *fakeSessionRepository) RotateRefreshToken(ctx context.Context, tokenHash string, next *models.RefreshToken, expiresAt time.Time, reuseGrace time.Duration) (*models.Session, bool, error) {
+	current, ok := r.refreshTokens[tokenHash]
+	if !ok {
+		return nil, false, repository.ErrRefreshTokenInvalid
+	}
+
+	s := r.sessions[current.SessionID]
+	if s.RevokedAt != nil || time.Now().After(s.ExpiresAt) {
+		return nil, false, repository.ErrRefreshTokenInvalid
+	}
+
+	now := time.Now()
+	if current.UsedAt != nil {
+		if time.Since(*current.UsedAt) > reuseGrace {
+			s.RevokedAt = &now
+			return nil, false, repository.ErrRefreshTokenReused
+		}
+		return s, false, nil
+	}
+	current.UsedAt = &now
+
+	next.SessionID = s.ID
+	r.AddRefreshToken(ctx, next)
+	s.ExpiresAt = expiresAt
+	s.LastSeenAt = now
+	return s, true, nil
+}
+
+// signIn logs the user in and returns their session cookies.
+func (lt *loginTest) signIn(t *testing.T, user identitytest.User) []*http.Cookie {
+	t.Helper()
+
+	resp := lt.login(t, user)
+	if sessionCookie(resp) == nil || refreshCookie(resp) == nil {
+		t.Fatal("no session cookies set")
+	}
+	return []*http.Cookie{sessionCookie(resp), refreshCookie(resp)}
+}
+
+func refreshCookie(resp *http.Response) *http.Cookie {
+	for _, c := range resp.Cookies() {
+		if c.Name == "refresh_token" && c.Value != "" {
+			return c
+		}
+	}
+	return nil
+}
+
+func (lt *loginTest) api(t *testing.T, method, target string, cookies ...*http.Cookie) *http.Response {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+
+	resp, err := lt.app.Test(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, target, err)
+	}
+	return resp
+}
+
+func listSessions(t *testing.T, lt *loginTest, cookies []*http.Cookie) []*models.Session {
+	t.Helper()
+
+	resp := lt.api(t, http.MethodGet, "/api/sessions", cookies...)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("GET /api/sessions status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	var body struct {
+		Sessions []*models.Session `json:"sessions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding sessions: %v", err)
+	}
+	return body.Sessions
+}
+
+var testUser = identitytest.User{Subject: "42", Email: "ada@example.com", EmailVerified: true}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	lt := newLoginTest(t)
+	laptop := lt.signIn(t, testUser)
+	phone := lt.signIn(t, testUser)
+
+	sessions := listSessions(t, lt, laptop)
+	if len(sessions) != 2 {
+		t.Fatalf("sessions = %d, want 2", len(sessions))
+	}
+
+	if resp := lt.api(t, http.MethodPost, "/api/logout", laptop...); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("logout status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	if resp := lt.api(t, http.MethodGet, "/api/sessions", laptop...); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("status after logout = %d, want %d", resp.StatusCode, fiber.StatusUnauthorized)
+	}
+
+	sessions = listSessions(t, lt, phone)
+	if len(sessions) != 1 || !sessions[0].Current {
+		t.Errorf("sessions = %+v, want only the current one", sessions)
+	}
+}
+
+func TestRevokeOtherSession(t *testing.T) {
+	lt := newLoginTest(t)
+	laptop := lt.signIn(t, testUser)
+	phone := lt.signIn(t, testUser)
+
+	var phoneID string
+	for _, s := range listSessions(t, lt, laptop) {
+		if !s.Current {
+			phoneID = s.ID
+		}
+	}
+
+	if resp := lt.api(t, http.MethodPost, "/api/sessions/"+phoneID+"/revoke", laptop...); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("revoke status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	if resp := lt.api(t, http.MethodGet, "/api/sessions", phone...); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("revoked session status = %d, want %d", resp.StatusCode, fiber.StatusUnauthorized)
+	}
+
+	if resp := lt.api(t, http.MethodPost, "/api/sessions/"+phoneID+"/revoke", laptop...); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("second revoke status = %d, want %d", resp.StatusCode, fiber.StatusNotFound)
+	}
+}
+
+func TestRevokeSessionOfAnotherUser(t *testing.T) {
+	lt := newLoginTest(t)
+	ada := lt.signIn(t, testUser)
+	grace := lt.signIn(t, identitytest.User{Subject: "43", Email: "grace@example.com", EmailVerified: true})
+
+	adaID := listSessions(t, lt, ada)[0].ID
+	if resp := lt.api(t, http.MethodPost, "/api/sessions/"+adaID+"/revoke", grace...); resp.StatusCode != fiber.StatusNotFound {
+		t.Fatalf("revoke status = %d, want %d", resp.StatusCode, fiber.StatusNotFound)
+	}
+
+	if resp := lt.api(t, http.MethodGet, "/api/sessions", ada...); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+}
+
+func TestLogoutAllRevokesEverySession(t *testing.T) {
+	lt := newLoginTest(t)
+	laptop := lt.signIn(t, testUser)
+	phone := lt.signIn(t, testUser)
+
+	if resp := lt.api(t, http.MethodPost, "/api/logout-all", laptop...); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("logout-all status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	for _, cookies := range [][]*http.Cookie{laptop, phone} {
+		if resp := lt.api(t, http.MethodGet, "/api/sessions", cookies...); resp.StatusCode != fiber.StatusUnauthorized {
+			t.Errorf("status after logout-all = %d, want %d", resp.StatusCode, fiber.StatusUnauthorized)
+		}
+	}
+}
+
+func (lt *loginTest) refresh(t *testing.T, cookie *http.Cookie) *http.Response {
+	t.Helper()
+	return lt.api(t, http.MethodPost, "/auth/refresh", cookie)
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	lt := newLoginTest(t)
+	cookies := lt.signIn(t, testUser)
+
+	resp := lt.refresh(t, cookies[1])
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("refresh status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	access, refresh := sessionCookie(resp), refreshCookie(resp)
+	if access == nil || refresh == nil {
+		t.Fatal("refresh set no session cookies")
+	}
+	if refresh.Value == cookies[1].Value {
+		t.Error("refresh token was not rotated")
+	}
+
+	if resp := lt.api(t, http.MethodGet, "/api/sessions", access); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("status with refreshed access token = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+	if resp := lt.refresh(t, refresh); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("second refresh status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	lt := newLoginTest(t)
+	cookies := lt.signIn(t, testUser)
+
+	resp := lt.refresh(t, cookies[1])
+	rotated := []*http.Cookie{sessionCookie(resp), refreshCookie(resp)}
+
+	// Requests that raced to refresh may present the old token again.
+	if resp := lt.refresh(t, cookies[1]); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("refresh within grace status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	for _, token := range lt.sessions.refreshTokens {
+		if token.UsedAt != nil {
+			usedAt := token.UsedAt.Add(-2 * time.Minute)
+			token.UsedAt = &usedAt
+		}
+	}
+
+	if resp := lt.refresh(t, cookies[1]); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Fatalf("reused refresh status = %d, want %d", resp.StatusCode, fiber.StatusUnauthorized)
+	}
+
+	// The whole family is revoked, including the tokens it was rotated to.
+	if resp := lt.api(t, http.MethodGet, "/api/sessions", rotated...); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("status with rotated tokens = %d, want %d", resp.StatusCode, fiber.StatusUnauthorized)
+	}
+	if resp := lt.refresh(t, rotated[1]); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("rotated refresh status = %d, want %d", resp.StatusCode, fiber.StatusUnauthorized)
+	}
+}
+
+func TestRefreshReplayWithinGraceIssuesNoToken(t *testing.T) {
+	lt := newLoginTest(t)
+	cookies := lt.signIn(t, testUser)
+
+	first := lt.refresh(t, cookies[1])
+	successor := refreshCookie(first)
+	if successor == nil {
+		t.Fatal("refresh set no refresh cookie")
+	}
+	tokens := len(lt.sessions.refreshTokens)
+
+	// A request that raced the first refresh gets an access token, but no
+	// refresh token of its own: the client keeps the successor.
+	resp := lt.refresh(t, cookies[1])
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("refresh within grace status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+	if sessionCookie(resp) == nil {
+		t.Error("replay within grace set no access cookie")
+	}
+	if refreshCookie(resp) != nil {
+		t.Error("replay within grace issued another refresh token")
+	}
+	if len(lt.sessions.refreshTokens) != tokens {
+		t.Errorf("refresh tokens = %d, want %d", len(lt.sessions.refreshTokens), tokens)
+	}
+
+	if resp := lt.refresh(t, successor); resp.StatusCode != fiber.StatusOK || refreshCookie(resp) == nil {
+		t.Errorf("successor refresh status = %d, want %d with a new token", resp.StatusCode, fiber.StatusOK)
+	}
+}
+
+func TestAuthMiddlewareRefreshesExpiredAccessToken(t *testing.T) {
+	lt := newLoginTest(t)
+	cookies := lt.signIn(t, testUser)
+
+	// The browser drops the access cookie when the access token expires.
+	resp := lt.api(t, http.MethodGet, "/api/sessions", cookies[1])
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+	if sessionCookie(resp) == nil || refreshCookie(resp) == nil {
+		t.Error("no session cookies set")
+	}
+
+	if resp := lt.api(t, http.MethodGet, "/api/sessions", &http.Cookie{Name: "refresh_token", Value: "forged"}); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("forged refresh status = %d, want %d", resp.StatusCode, fiber.StatusUnauthorized)
+	}
+}
+
+func TestAuthMiddlewareRefreshesNearExpiry(t *testing.T) {
+	lt := newLoginTest(t, func(cfg *config.Config) {
+		cfg.Sessions.RefreshWindow = cfg.Sessions.AccessTokenTTL
+	})
+	cookies := lt.signIn(t, testUser)
+
+	resp := lt.api(t, http.MethodGet, "/api/sessions", cookies...)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+	if refresh := refreshCookie(resp); refresh == nil || refresh.Value == cookies[1].Value {
+		t.Error("refresh token was not rotated")
+	}
+}
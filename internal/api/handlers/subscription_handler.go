@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maheshrc27/postflow/internal/payment"
+	"github.com/maheshrc27/postflow/internal/service"
+)
+
+type SubscriptionHandler struct {
+	s service.SubscriptionService
+}
+
+func NewSubscriptionHandler(service service.SubscriptionService) *SubscriptionHandler {
+	return &SubscriptionHandler{s: service}
+}
+
+func (h *SubscriptionHandler) GetSubscription(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	sub, err := h.s.GetSubscription(c.Context(), userId)
+	if err != nil {
+		if errors.Is(err, service.ErrNoSubscription) {
+			return c.Status(fiber.StatusOK).JSON(fiber.Map{
+				"subscription": nil,
+			})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to get subscription",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"subscription": sub,
+	})
+}
+
+func (h *SubscriptionHandler) CancelSubscription(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	err := h.s.Cancel(c.Context(), userId)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNoSubscription):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "No active subscription",
+			})
+		case errors.Is(err, payment.ErrNotSupported):
+			return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
+				"error": "This subscription can only be canceled from the store it was bought in",
+			})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to cancel subscription",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maheshrc27/postflow/internal/service"
+)
+
+type TwoFactorHandler struct {
+	s service.TwoFactorService
+}
+
+func NewTwoFactorHandler(service service.TwoFactorService) *TwoFactorHandler {
+	return &TwoFactorHandler{s: service}
+}
+
+func (h *TwoFactorHandler) GetStatus(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	status, err := h.s.Status(c.Context(), userId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Unable to get two-factor status",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(status)
+}
+
+// Setup returns the secret and QR code URI to add the account to an
+// authenticator app.
+func (h *TwoFactorHandler) Setup(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	setup, err := h.s.Setup(c.Context(), userId)
+	if err != nil {
+		return twoFactorErrorResponse(c, err, "Unable to set up two-factor authentication")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(setup)
+}
+
+// Enable turns on two-factor authentication with a first code from the app.
+func (h *TwoFactorHandler) Enable(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	code, ok := parseTwoFactorCode(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to parse request",
+		})
+	}
+
+	codes, err := h.s.Enable(c.Context(), userId, code)
+	if err != nil {
+		return twoFactorErrorResponse(c, err, "Unable to enable two-factor authentication")
+	}
+
+	// The code was just entered on this session.
+	if err := h.s.MarkSession(c.Context(), GetSessionID(c)); err != nil {
+		return twoFactorErrorResponse(c, err, "Unable to enable two-factor authentication")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"recovery_codes": codes,
+	})
+}
+
+func (h *TwoFactorHandler) Disable(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	if err := h.s.Disable(c.Context(), userId); err != nil {
+		return twoFactorErrorResponse(c, err, "Unable to disable two-factor authentication")
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	codes, err := h.s.RegenerateRecoveryCodes(c.Context(), userId)
+	if err != nil {
+		return twoFactorErrorResponse(c, err, "Unable to create recovery codes")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"recovery_codes": codes,
+	})
+}
+
+// Verify checks a code to allow sensitive actions on the current session.
+func (h *TwoFactorHandler) Verify(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	code, ok := parseTwoFactorCode(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to parse request",
+		})
+	}
+
+	if err := h.s.Verify(c.Context(), userId, code); err != nil {
+		return twoFactorErrorResponse(c, err, "Unable to verify code")
+	}
+
+	if err := h.s.MarkSession(c.Context(), GetSessionID(c)); err != nil {
+		return twoFactorErrorResponse(c, err, "Unable to verify code")
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func parseTwoFactorCode(c *fiber.Ctx) (string, bool) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return "", false
+	}
+	return req.Code, true
+}
+
+func twoFactorErrorResponse(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidTwoFactorCode), errors.Is(err, service.ErrTwoFactorNotSetUp):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, service.ErrTwoFactorEnabled), errors.Is(err, service.ErrTwoFactorNotEnabled):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, service.ErrTwoFactorLocked):
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": fallback,
+	})
+}
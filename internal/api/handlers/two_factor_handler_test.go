@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+	"github.com/maheshrc27/postflow/internal/totp"
+)
+
+type fakeTwoFactorRepository struct {
+	repository.TwoFactorRepository
+	entries map[int64]*models.TwoFactor
+	// recoveryCodes maps users to their recovery code hashes, and whether
+	// each was used.
+	recoveryCodes map[int64]map[string]bool
+}
+
+func newFakeTwoFactorRepository() *fakeTwoFactorRepository {
+	return &fakeTwoFactorRepository{
+		entries:       map[int64]*models.TwoFactor{},
+		recoveryCodes: map[int64]map[string]bool{},
+	}
+}
+
+func (r *fakeTwoFactorRepository) Get(ctx context.Context, userID int64) (*models.TwoFactor, bool, error) {
+	tf, ok := r.entries[userID]
+	return tf, ok, nil
+}
+
+func (r *fakeTwoFactorRepository) SetPending(ctx context.Context, userID int64, secret []byte) (bool, error) {
+	if tf, ok := r.entries[userID]; ok && tf.ConfirmedAt != nil {
+		return false, nil
+	}
+	r.entries[userID] = &models.TwoFactor{UserID: userID, Secret: secret, CreatedAt: time.Now()}
+	return true, nil
+}
+
+func (r *fakeTwoFactorRepository) Confirm(ctx context.Context, userID, step int64, codeHashes []string) error {
+	tf, ok := r.entries[userID]
+	if !ok || tf.ConfirmedAt != nil {
+		return repository.ErrTwoFactorNotPending
+	}
+	now := time.Now()
+	tf.ConfirmedAt = &now
+	tf.LastUsedStep = step
+	tf.FailedAttempts = 0
+	return r.ReplaceRecoveryCodes(ctx, userID, codeHashes)
+}
+
+func (r *fakeTwoFactorRepository) Delete(ctx context.Context, userID int64) error {
+	delete(r.entries, userID)
+	delete(r.recoveryCodes, userID)
+	return nil
+}
+
+func (r *fakeTwoFactorRepository) UseStep(ctx context.Context, userID, step int64) (bool, error) {
+	tf := r.entries[userID]
+	if tf.LastUsedStep >= step {
+		return false, nil
+	}
+	tf.LastUsedStep = step
+	tf.FailedAttempts = 0
+	return true, nil
+}
+
+func (r *fakeTwoFactorRepository) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	used, ok := r.recoveryCodes[userID][codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	r.recoveryCodes[userID][codeHash] = true
+	r.entries[userID].FailedAttempts = 0
+	return true, nil
+}
+
+func (r *fakeTwoFactorRepository) RecordAttempt(ctx context.Context, userID int64, maxAttempts int, lockout time.Duration) (bool, error) {
+	tf := r.entries[userID]
+	if tf.FailedAttempts >= maxAttempts && tf.LastFailedAt != nil && time.Since(*tf.LastFailedAt) < lockout {
+		return false, nil
+	}
+	now := time.Now()
+	tf.FailedAttempts++
+	tf.LastFailedAt = &now
+	return true, nil
+}
+
+func (r *fakeTwoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error {
+	r.recoveryCodes[userID] = map[string]bool{}
+	for _, hash := range codeHashes {
+		r.recoveryCodes[userID][hash] = false
+	}
+	return nil
+}
+
+func (r *fakeTwoFactorRepository) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	n := 0
+	for _, used := range r.recoveryCodes[userID] {
+		if !used {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (lt *loginTest) postJSON(t *testing.T, target string, body any, cookies ...*http.Cookie) *http.Response {
+	t.Helper()
+
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(b))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+
+	resp, err := lt.app.Test(req)
+	if err != nil {
+		t.Fatalf("POST %s: %v", target, err)
+	}
+	return resp
+}
+
+// enableTwoFactor enrolls the signed in user with a code of the current
+// step, and returns their secret and recovery codes.
+func (lt *loginTest) enableTwoFactor(t *testing.T, cookies []*http.Cookie) (string, []string) {
+	t.Helper()
+
+	resp := lt.api(t, http.MethodPost, "/api/2fa/setup", cookies...)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("setup status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+	var setup models.TwoFactorSetup
+	if err := json.NewDecoder(resp.Body).Decode(&setup); err != nil {
+		t.Fatalf("decoding setup: %v", err)
+	}
+	if !strings.HasPrefix(setup.URI, "otpauth://totp/") || !strings.Contains(setup.URI, setup.Secret) {
+		t.Errorf("URI = %q, want an otpauth URI with the secret", setup.URI)
+	}
+
+	resp = lt.postJSON(t, "/api/2fa/enable", map[string]string{"code": totpCode(t, setup.Secret, 0)}, cookies...)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("enable status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+	var body struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding recovery codes: %v", err)
+	}
+	return setup.Secret, body.RecoveryCodes
+}
+
+// totpCode returns the code of the time step offset steps from now. Codes
+// are accepted one step either way, and each step only once.
+func totpCode(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+
+	code, err := totp.Code(secret, totp.Step(time.Now())+offset)
+	if err != nil {
+		t.Fatalf("generating code: %v", err)
+	}
+	return code
+}
+
+func twoFactorChallenge(resp *http.Response) *http.Cookie {
+	for _, c := range resp.Cookies() {
+		if c.Name == twoFactorCookie && c.Value != "" {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	lt := newLoginTest(t)
+	secret, recoveryCodes := lt.enableTwoFactor(t, lt.signIn(t, testUser))
+	if len(recoveryCodes) != 10 {
+		t.Fatalf("recovery codes = %d, want 10", len(recoveryCodes))
+	}
+
+	resp := lt.login(t, testUser)
+	if loc := resp.Header.Get("Location"); loc != testFrontendURL+"/login/2fa" {
+		t.Fatalf("Location = %q, want the two-factor page", loc)
+	}
+	if sessionCookie(resp) != nil {
+		t.Fatal("session cookie set before the two-factor code")
+	}
+	challenge := twoFactorChallenge(resp)
+	if challenge == nil {
+		t.Fatal("no two-factor challenge cookie set")
+	}
+
+	if resp := lt.postJSON(t, "/login/2fa", map[string]string{"code": "000000"}, challenge); resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("wrong code status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+	}
+
+	code := totpCode(t, secret, 1)
+	resp = lt.postJSON(t, "/login/2fa", map[string]string{"code": code}, challenge)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("two-factor login status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+	if sessionCookie(resp) == nil || refreshCookie(resp) == nil {
+		t.Fatal("no session cookies set")
+	}
+	cookies := []*http.Cookie{sessionCookie(resp), refreshCookie(resp)}
+
+	// The session passed two-factor authentication just now.
+	if resp := lt.api(t, http.MethodPost, "/api/sensitive", cookies...); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("sensitive action status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	if resp := lt.postJSON(t, "/login/2fa", map[string]string{"code": code}, challenge); resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("replayed code status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+	}
+	if resp := lt.postJSON(t, "/login/2fa", map[string]string{"code": code}); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("status without challenge = %d, want %d", resp.StatusCode, fiber.StatusUnauthorized)
+	}
+}
+
+func TestTwoFactorLoginWithRecoveryCode(t *testing.T) {
+	lt := newLoginTest(t)
+	_, recoveryCodes := lt.enableTwoFactor(t, lt.signIn(t, testUser))
+
+	challenge := twoFactorChallenge(lt.login(t, testUser))
+	if resp := lt.postJSON(t, "/login/2fa", map[string]string{"code": strings.ToUpper(recoveryCodes[0])}, challenge); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("recovery code status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	if resp := lt.postJSON(t, "/login/2fa", map[string]string{"code": recoveryCodes[0]}, challenge); resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("reused recovery code status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+	}
+}
+
+func TestTwoFactorLockout(t *testing.T) {
+	lt := newLoginTest(t)
+	secret, _ := lt.enableTwoFactor(t, lt.signIn(t, testUser))
+
+	challenge := twoFactorChallenge(lt.login(t, testUser))
+	for range 5 {
+		lt.postJSON(t, "/login/2fa", map[string]string{"code": "000000"}, challenge)
+	}
+
+	resp := lt.postJSON(t, "/login/2fa", map[string]string{"code": totpCode(t, secret, 1)}, challenge)
+	if resp.StatusCode != fiber.StatusTooManyRequests {
+		t.Errorf("status after failures = %d, want %d", resp.StatusCode, fiber.StatusTooManyRequests)
+	}
+}
+
+func TestTwoFactorValidCodeResetsAttempts(t *testing.T) {
+	lt := newLoginTest(t)
+	secret, _ := lt.enableTwoFactor(t, lt.signIn(t, testUser))
+
+	challenge := twoFactorChallenge(lt.login(t, testUser))
+	for range 4 {
+		lt.postJSON(t, "/login/2fa", map[string]string{"code": "000000"}, challenge)
+	}
+	if resp := lt.postJSON(t, "/login/2fa", map[string]string{"code": totpCode(t, secret, 1)}, challenge); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("valid code status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	challenge = twoFactorChallenge(lt.login(t, testUser))
+	if resp := lt.postJSON(t, "/login/2fa", map[string]string{"code": "000000"}, challenge); resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("status after a valid code = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+	}
+}
+
+func TestSensitiveActionsNeedRecentCode(t *testing.T) {
+	lt := newLoginTest(t)
+	cookies := lt.signIn(t, testUser)
+
+	// Without two-factor authentication, nothing is asked.
+	if resp := lt.api(t, http.MethodPost, "/api/sensitive", cookies...); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status without two-factor = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	_, recoveryCodes := lt.enableTwoFactor(t, cookies)
+	if resp := lt.api(t, http.MethodPost, "/api/sensitive", cookies...); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status after enabling = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	for _, s := range lt.sessions.sessions {
+		if s.TwoFactorAt != nil {
+			verifiedAt := s.TwoFactorAt.Add(-time.Hour)
+			s.TwoFactorAt = &verifiedAt
+		}
+	}
+
+	resp := lt.api(t, http.MethodPost, "/api/sensitive", cookies...)
+	var body struct {
+		TwoFactorRequired bool `json:"two_factor_required"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != fiber.StatusForbidden || !body.TwoFactorRequired {
+		t.Fatalf("stale session status = %d, two_factor_required %v, want %d and true", resp.StatusCode, body.TwoFactorRequired, fiber.StatusForbidden)
+	}
+
+	if resp := lt.postJSON(t, "/api/2fa/verify", map[string]string{"code": recoveryCodes[0]}, cookies...); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("verify status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+	if resp := lt.api(t, http.MethodPost, "/api/sensitive", cookies...); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("status after verifying = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	var status models.TwoFactorStatus
+	json.NewDecoder(lt.api(t, http.MethodGet, "/api/2fa", cookies...).Body).Decode(&status)
+	if !status.Enabled || status.RecoveryCodesLeft != len(recoveryCodes)-1 {
+		t.Errorf("status = %+v, want enabled with %d recovery codes left", status, len(recoveryCodes)-1)
+	}
+}
+
+func TestDisableTwoFactor(t *testing.T) {
+	lt := newLoginTest(t)
+	cookies := lt.signIn(t, testUser)
+	lt.enableTwoFactor(t, cookies)
+
+	for _, s := range lt.sessions.sessions {
+		verifiedAt := time.Now().Add(-time.Hour)
+		s.TwoFactorAt = &verifiedAt
+	}
+	if resp := lt.api(t, http.MethodPost, "/api/2fa/disable", cookies...); resp.StatusCode != fiber.StatusForbidden {
+		t.Fatalf("disable without recent code status = %d, want %d", resp.StatusCode, fiber.StatusForbidden)
+	}
+
+	for _, s := range lt.sessions.sessions {
+		now := time.Now()
+		s.TwoFactorAt = &now
+	}
+	if resp := lt.api(t, http.MethodPost, "/api/2fa/disable", cookies...); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("disable status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	if resp := lt.login(t, testUser); sessionCookie(resp) == nil {
+		t.Error("login after disabling asked for a code")
+	}
+}
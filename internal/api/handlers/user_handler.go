@@ -3,6 +3,7 @@ package handlers
 import (
 	"github.com/gofiber/fiber/v2"
 	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/models"
 	"github.com/maheshrc27/postflow/internal/service"
 )
 
@@ -28,6 +29,26 @@ func (h *UserHandler) GetUserInfo(c *fiber.Ctx) error {
 	return c.JSON(userInfo)
 }
 
+func (h *UserHandler) UpdateBilling(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	var billing models.User
+	if err := c.BodyParser(&billing); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to parse request",
+		})
+	}
+
+	user, err := h.s.UpdateBilling(c.Context(), userId, &billing)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to update billing details",
+		})
+	}
+
+	return c.JSON(user)
+}
+
 func (h *UserHandler) DeleteAccount(c *fiber.Ctx) error {
 	userId := GetUserID(c)
 	confirmation := c.FormValue("confirmation")
@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"errors"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/maheshrc27/postflow/internal/models"
 	"github.com/maheshrc27/postflow/internal/service"
 	"github.com/maheshrc27/postflow/internal/transfer"
 )
@@ -38,15 +41,59 @@ func (h *VideoHandler) CreateVideo(c *fiber.Ctx) error {
 		})
 	}
 
-	videoURL, err := h.v.RequestVideo(c.Context(), userId, string(c.Body()))
+	jobID, err := h.v.RequestVideo(c.Context(), userId, string(c.Body()))
 	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrAccountLocked):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Account is locked, please contact support",
+			})
+		case errors.Is(err, service.ErrNotEntitled):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		case errors.Is(err, service.ErrInvalidVideo):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Unable to parse request",
+			})
+		case errors.Is(err, service.ErrOutstandingBalance):
+			return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
+				"error": "Outstanding negative balance, please buy credits to continue",
+			})
+		}
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Unable to generate video",
 		})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"video_url": videoURL,
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"job_id": jobID,
+		"status": models.JobStatusQueued,
 	})
 
 }
+
+func (h *VideoHandler) GetJob(c *fiber.Ctx) error {
+	userId := GetUserID(c)
+
+	jobID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid job id",
+		})
+	}
+
+	job, err := h.v.GetJob(c.Context(), userId, int64(jobID))
+	if err != nil {
+		if errors.Is(err, service.ErrJobNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Job not found",
+			})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unable to get job",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(job)
+}
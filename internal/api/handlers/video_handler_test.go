@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/service"
+)
+
+// newVideoApp serves video requests for a user in good standing. Only the
+// user and credits repositories are backed; a request that gets past parsing
+// reaches a nil dependency and fails the test.
+func newVideoApp(t *testing.T) *fiber.App {
+	t.Helper()
+
+	store := newFakeStore()
+	store.users["creator@example.com"] = &models.User{ID: 1, Email: "creator@example.com"}
+	store.balances[1] = 5
+
+	videoService := service.NewVideoService(&fakeUserRepository{s: store}, &fakeCreditsRepository{s: store}, nil, nil, nil, config.Config{})
+
+	app := fiber.New()
+	app.Post("/videos", func(c *fiber.Ctx) error {
+		c.Locals("user_id", "1")
+		return c.Next()
+	}, NewVideoHandler(videoService).CreateVideo)
+	return app
+}
+
+func TestCreateVideoRejectsNonObjectBodies(t *testing.T) {
+	app := newVideoApp(t)
+
+	for _, body := range []string{`null`, `[]`, `[{"duration":10}]`, `"video"`, `42`, `true`} {
+		t.Run(body, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/videos", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("sending request: %v", err)
+			}
+			if resp.StatusCode != fiber.StatusBadRequest {
+				t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestCreateVideoRejectsMissingDuration(t *testing.T) {
+	app := newVideoApp(t)
+
+	for _, body := range []string{`{}`, `{"duration":0}`, `{"duration":-5}`} {
+		t.Run(body, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/videos", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("sending request: %v", err)
+			}
+			if resp.StatusCode != fiber.StatusBadRequest {
+				t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+			}
+		})
+	}
+}
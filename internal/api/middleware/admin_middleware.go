@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+// AdminMiddleware only lets through users whose email is listed in
+// cfg.AdminEmails. It must run after AuthMiddleware.
+func AdminMiddleware(cfg *config.Config, u repository.UserRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, _ := strconv.ParseInt(c.Locals("user_id").(string), 10, 64)
+
+		user, isExist, err := u.GetByID(c.Context(), userID)
+		if err != nil || !isExist || !isAdmin(cfg, user.Email) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Admin access required",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+func isAdmin(cfg *config.Config, email string) bool {
+	for _, admin := range cfg.AdminEmails {
+		if strings.EqualFold(admin, email) {
+			return true
+		}
+	}
+	return false
+}
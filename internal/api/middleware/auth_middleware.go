@@ -1,38 +1,142 @@
 package middleware
 
 import (
+	"errors"
 	"log"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/keyring"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/service"
+	"github.com/maheshrc27/postflow/internal/transfer"
 	"github.com/maheshrc27/postflow/pkg/utils"
 )
 
-func AuthMiddleware(cfg *config.Config) fiber.Handler {
+// AuthMiddleware accepts requests with a valid access token whose session is
+// neither revoked nor expired. Access tokens that expired, or are about to,
+// are renewed with the refresh cookie.
+//
+// Requests may instead send an API key as a bearer token. API keys are only
+// accepted when scopes are given, and must have all of them.
+func AuthMiddleware(cfg *config.Config, sessions service.SessionService, keys *keyring.Keyring, apiKeys service.APIKeyService, scopes ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		if secret, ok := bearerToken(c); ok {
+			return authenticateAPIKey(c, apiKeys, secret, scopes)
+		}
+
 		tokenString := c.Cookies(cfg.CookieName)
-		if tokenString == "" {
+		refreshToken := c.Cookies(cfg.Sessions.RefreshCookieName)
+		if tokenString == "" && refreshToken == "" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Authentication cookie missing",
 			})
 		}
 
-		claims, err := utils.ValidateToken(cfg.SecretKey, tokenString)
+		var claims *transfer.CustomClaims
+		if tokenString != "" {
+			var err error
+			if claims, err = utils.ValidateToken(c.Context(), keys, tokenString); err != nil {
+				log.Printf("Token validation failed: %v", err)
+			}
+		}
+
+		if claims == nil {
+			tokens, err := sessions.Refresh(c.Context(), refreshToken, c.IP())
+			if err != nil {
+				return refreshFailed(c, cfg, err)
+			}
+			SetSessionCookies(c, cfg, tokens)
+			return next(c, tokens.Session)
+		}
+
+		userID, _ := strconv.ParseInt(claims.UserID, 10, 64)
+		session, err := sessions.Validate(c.Context(), userID, claims.SessionID, c.IP())
 		if err != nil {
-			c.Cookie(&fiber.Cookie{
-				Name:   cfg.CookieName,
-				Value:  "",
-				Path:   "/",
-				MaxAge: -1, // Delete cookie
+			if errors.Is(err, service.ErrSessionNotFound) {
+				return unauthorized(c, cfg)
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Unable to check session",
 			})
+		}
+
+		if refreshToken != "" && claims.ExpiresAt != nil && time.Until(claims.ExpiresAt.Time) < cfg.Sessions.RefreshWindow {
+			tokens, err := sessions.Refresh(c.Context(), refreshToken, c.IP())
+			switch {
+			case err == nil:
+				SetSessionCookies(c, cfg, tokens)
+			case errors.Is(err, service.ErrRefreshTokenReused):
+				return unauthorized(c, cfg)
+			default:
+				// The access token is still good for this request.
+				log.Printf("Session refresh failed: %v", err)
+			}
+		}
+
+		return next(c, session)
+	}
+}
+
+func next(c *fiber.Ctx, session *models.Session) error {
+	c.Locals("user_id", strconv.FormatInt(session.UserID, 10))
+	c.Locals("session_id", session.ID)
+	return c.Next()
+}
+
+func bearerToken(c *fiber.Ctx) (string, bool) {
+	scheme, token, ok := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
 
-			log.Printf("Token validation failed: %v", err)
+func authenticateAPIKey(c *fiber.Ctx, apiKeys service.APIKeyService, secret string, scopes []string) error {
+	if len(scopes) == 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "API keys can't be used for this endpoint",
+		})
+	}
+
+	key, err := apiKeys.Authenticate(c.Context(), secret, c.IP(), scopes)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidAPIKey):
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid or expired token",
+				"error": err.Error(),
+			})
+		case errors.Is(err, service.ErrMissingScope):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": err.Error(),
 			})
 		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Unable to check API key",
+		})
+	}
+
+	c.Locals("user_id", strconv.FormatInt(key.UserID, 10))
+	c.Locals("api_key_id", key.ID)
+	return c.Next()
+}
 
-		c.Locals("user_id", claims.UserID)
-		return c.Next()
+func refreshFailed(c *fiber.Ctx, cfg *config.Config, err error) error {
+	if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+		return unauthorized(c, cfg)
 	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Unable to refresh session",
+	})
+}
+
+func unauthorized(c *fiber.Ctx, cfg *config.Config) error {
+	ClearSessionCookies(c, cfg)
+
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error": "Invalid or expired token",
+	})
 }
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+// sessionCookieDomain shares the session cookies between the API and the
+// frontend.
+const sessionCookieDomain = ".postflow.org"
+
+// SetSessionCookies hands the tokens of a session to the browser. The
+// access cookie lasts as long as the access token; the refresh cookie as
+// long as the session. Without a refresh token the refresh cookie is left
+// as it is.
+func SetSessionCookies(c *fiber.Ctx, cfg *config.Config, tokens *models.SessionTokens) {
+	c.Cookie(&fiber.Cookie{
+		Name:     cfg.CookieName,
+		Value:    tokens.AccessToken,
+		HTTPOnly: true,
+		Secure:   true,
+		Domain:   sessionCookieDomain,
+		SameSite: fiber.CookieSameSiteNoneMode,
+		Path:     "/",
+		Expires:  tokens.AccessExpiresAt,
+	})
+	if tokens.RefreshToken == "" {
+		return
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     cfg.Sessions.RefreshCookieName,
+		Value:    tokens.RefreshToken,
+		HTTPOnly: true,
+		Secure:   true,
+		Domain:   sessionCookieDomain,
+		SameSite: fiber.CookieSameSiteNoneMode,
+		Path:     "/",
+		Expires:  tokens.Session.ExpiresAt,
+	})
+}
+
+func ClearSessionCookies(c *fiber.Ctx, cfg *config.Config) {
+	for _, name := range []string{cfg.CookieName, cfg.Sessions.RefreshCookieName} {
+		c.Cookie(&fiber.Cookie{
+			Name:     name,
+			Value:    "",
+			HTTPOnly: true,
+			Secure:   true,
+			Domain:   sessionCookieDomain,
+			SameSite: fiber.CookieSameSiteNoneMode,
+			Path:     "/",
+			MaxAge:   -1,
+		})
+	}
+}
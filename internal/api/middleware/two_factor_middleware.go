@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/maheshrc27/postflow/internal/service"
+)
+
+// TwoFactorMiddleware guards sensitive actions. Users with two-factor
+// authentication must have entered a code on their session recently, which
+// they do through /api/2fa/verify. It must run after AuthMiddleware.
+func TwoFactorMiddleware(twoFactor service.TwoFactorService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, _ := strconv.ParseInt(c.Locals("user_id").(string), 10, 64)
+		sessionID, _ := c.Locals("session_id").(string)
+
+		if err := twoFactor.CheckSession(c.Context(), userID, sessionID); err != nil {
+			if errors.Is(err, service.ErrTwoFactorRequired) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error":               err.Error(),
+					"two_factor_required": true,
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Unable to check two-factor authentication",
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,106 @@
+// Package geoip maps IP addresses to countries using an offline database.
+//
+// The database is a CSV file with one network per line in CIDR notation
+// followed by an ISO 3166-1 alpha-2 country code, such as the country
+// exports of db-ip.com or ipdeny.com:
+//
+//	1.0.0.0/24,AU
+//	2001:200::/32,JP
+//
+// Lines starting with '#' are ignored. Networks may nest, in which case the
+// most specific one wins.
+package geoip
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DB is an in-memory country database. The zero value and a nil *DB know no
+// addresses.
+type DB struct {
+	networks map[netip.Prefix]string
+	// bits lists the prefix lengths in use, longest first.
+	bits []int
+}
+
+// Open loads the database at path.
+func Open(path string) (*DB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Load(f)
+}
+
+// Load reads a database in the CSV format described in the package
+// documentation.
+func Load(r io.Reader) (*DB, error) {
+	db := &DB{networks: map[netip.Prefix]string{}}
+	seen := map[int]bool{}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		cidr, country, ok := strings.Cut(text, ",")
+		if !ok {
+			return nil, fmt.Errorf("geoip: line %d: expected network,country", line)
+		}
+
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("geoip: line %d: %w", line, err)
+		}
+		prefix = prefix.Masked()
+
+		db.networks[prefix] = strings.ToUpper(strings.TrimSpace(country))
+		if !seen[prefix.Bits()] {
+			seen[prefix.Bits()] = true
+			db.bits = append(db.bits, prefix.Bits())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(db.bits)))
+
+	return db, nil
+}
+
+// Country returns the country code for ip, or "" if it is unknown.
+func (db *DB) Country(ip string) string {
+	if db == nil {
+		return ""
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+
+	// Try the networks that could contain addr, most specific first.
+	for _, bits := range db.bits {
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			// Longer than addr, so only an IPv6 length for an IPv4 addr.
+			continue
+		}
+		if country, ok := db.networks[prefix]; ok {
+			return country
+		}
+	}
+	return ""
+}
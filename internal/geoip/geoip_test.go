@@ -0,0 +1,58 @@
+package geoip
+
+import (
+	"strings"
+	"testing"
+)
+
+const testDB = `
+# country,network
+10.0.0.0/8,us
+10.1.0.0/16,CA
+10.1.2.0/24,MX
+1.0.0.0/24,AU
+2001:200::/32,JP
+`
+
+func TestCountry(t *testing.T) {
+	db, err := Load(strings.NewReader(testDB))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	tests := []struct {
+		ip, want string
+	}{
+		{"1.0.0.1", "AU"},
+		{"1.0.1.1", ""},
+		// Nested networks resolve to the most specific one.
+		{"10.0.0.1", "US"},
+		{"10.1.0.1", "CA"},
+		{"10.1.2.3", "MX"},
+		{"10.1.3.1", "CA"},
+		{"10.2.0.1", "US"},
+		{"::ffff:10.1.2.3", "MX"},
+		{"2001:200::1", "JP"},
+		{"2001:201::1", ""},
+		{"not an ip", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := db.Country(tt.ip); got != tt.want {
+			t.Errorf("Country(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+
+	var none *DB
+	if got := none.Country("1.0.0.1"); got != "" {
+		t.Errorf("Country on a nil DB = %q, want none", got)
+	}
+}
+
+func TestLoadRejectsBadLines(t *testing.T) {
+	for _, line := range []string{"1.0.0.0/24", "1.0.0.0/33,AU", "AU,1.0.0.0/24"} {
+		if _, err := Load(strings.NewReader(line)); err == nil {
+			t.Errorf("Load(%q) succeeded", line)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+)
+
+const (
+	ProviderGitHub = "github"
+	GitHubAPIURL   = "https://api.github.com"
+)
+
+type gitHubProvider struct {
+	config *oauth2.Config
+	apiURL string
+	client *http.Client
+}
+
+// NewGitHub returns the GitHub provider. GitHub has no OpenID Connect for
+// users, so the identity comes from its REST API.
+func NewGitHub(clientID, clientSecret, redirectURL string, client *http.Client) Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &gitHubProvider{
+		config: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       []string{"read:user", "user:email"},
+			Endpoint:     github.Endpoint,
+		},
+		apiURL: GitHubAPIURL,
+		client: client,
+	}
+}
+
+func (p *gitHubProvider) Name() string {
+	return ProviderGitHub
+}
+
+// AuthURL ignores nonce, which only applies to ID tokens.
+func (p *gitHubProvider) AuthURL(ctx context.Context, state, verifier, nonce string) (string, error) {
+	return p.config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier)), nil
+}
+
+func (p *gitHubProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := p.config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		slog.Info(err.Error(), "provider", ProviderGitHub)
+		return nil, err
+	}
+	client := p.config.Client(ctx, token)
+
+	var user struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err := p.get(client, "/user", &user); err != nil {
+		return nil, err
+	}
+
+	// The profile email is optional and unverified; the emails endpoint
+	// says which address is primary and verified.
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := p.get(client, "/user/emails", &emails); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Provider: ProviderGitHub,
+		Subject:  strconv.FormatInt(user.ID, 10),
+		Name:     user.Name,
+		Picture:  user.AvatarURL,
+	}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+
+	for _, e := range emails {
+		if e.Primary {
+			identity.Email = e.Email
+			identity.EmailVerified = e.Verified
+		}
+	}
+
+	if identity.Email == "" {
+		return nil, ErrNoEmail
+	}
+
+	return identity, nil
+}
+
+func (p *gitHubProvider) get(client *http.Client, path string, v any) error {
+	req, err := http.NewRequest(http.MethodGet, p.apiURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		slog.Info(err.Error(), "provider", ProviderGitHub)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", path, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
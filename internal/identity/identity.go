@@ -0,0 +1,63 @@
+// Package identity signs users in through external identity providers:
+// OpenID Connect issuers found through discovery, and GitHub, which only
+// speaks OAuth 2.
+package identity
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	ErrInvalidIDToken  = errors.New("invalid ID token")
+	ErrNoEmail         = errors.New("identity provider returned no email")
+)
+
+// Identity is a user as an identity provider knows them. Subject is stable
+// per provider; the email may change.
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// Provider is an identity provider users can sign in with.
+type Provider interface {
+	Name() string
+	// AuthURL returns the provider's consent page. The login must be
+	// finished with the same verifier (PKCE) and nonce.
+	AuthURL(ctx context.Context, state, verifier, nonce string) (string, error)
+	// Exchange trades the code the provider redirected back with for the
+	// identity of the user.
+	Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error)
+}
+
+// Registry holds the configured providers by name.
+type Registry map[string]Provider
+
+func (r Registry) Register(provider Provider) {
+	r[provider.Name()] = provider
+}
+
+func (r Registry) Get(name string) (Provider, error) {
+	provider, ok := r[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+// Names returns the registered provider names, sorted.
+func (r Registry) Names() []string {
+	names := make([]string, 0, len(r))
+	for name := range r {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
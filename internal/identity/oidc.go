@@ -0,0 +1,347 @@
+package identity
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// jwksRefreshInterval limits how often an unknown key ID makes us fetch the
+// issuer's keys again.
+const jwksRefreshInterval = time.Minute
+
+// OIDCConfig configures a standards-compliant OpenID Connect provider.
+type OIDCConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes default to openid, email and profile.
+	Scopes []string
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcProvider struct {
+	cfg    OIDCConfig
+	client *http.Client
+	now    func() time.Time
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      map[string]any
+	fetchedAt time.Time
+}
+
+// NewOIDC returns a provider for the issuer. Its endpoints are discovered on
+// first use, so an issuer that is down doesn't keep the server from
+// starting.
+func NewOIDC(cfg OIDCConfig, client *http.Client) Provider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &oidcProvider{
+		cfg:    cfg,
+		client: client,
+		now:    time.Now,
+	}
+}
+
+func (p *oidcProvider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *oidcProvider) AuthURL(ctx context.Context, state, verifier, nonce string) (string, error) {
+	oauth2Config, _, err := p.oauth2Config(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return oauth2Config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oauth2.SetAuthURLParam("nonce", nonce)), nil
+}
+
+func (p *oidcProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	oauth2Config, d, err := p.oauth2Config(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := oauth2Config.Exchange(context.WithValue(ctx, oauth2.HTTPClient, p.client), code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		slog.Info(err.Error(), "provider", p.cfg.Name)
+		return nil, err
+	}
+
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return nil, fmt.Errorf("%w: token response has no id_token", ErrInvalidIDToken)
+	}
+
+	claims, err := p.verify(ctx, d, rawIDToken, nonce)
+	if err != nil {
+		slog.Info(err.Error(), "provider", p.cfg.Name)
+		return nil, err
+	}
+
+	identity := &Identity{
+		Provider: p.cfg.Name,
+		Email:    stringClaim(claims, "email"),
+		// Microsoft doesn't send email_verified; xms_edov is its optional
+		// claim for a verified email domain.
+		EmailVerified: boolClaim(claims, "email_verified") || boolClaim(claims, "xms_edov"),
+		Name:          stringClaim(claims, "name"),
+		Picture:       stringClaim(claims, "picture"),
+	}
+	identity.Subject, _ = claims.GetSubject()
+
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+
+	return identity, nil
+}
+
+// verify checks the signature, issuer, audience, expiry and nonce of an ID
+// token and returns its claims.
+func (p *oidcProvider) verify(ctx context.Context, d *discovery, rawIDToken, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, d, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384"}),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+		jwt.WithTimeFunc(p.now),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	// Multi-tenant issuers such as Microsoft's "common" endpoint publish an
+	// issuer template that is completed with the token's tenant.
+	issuer := strings.ReplaceAll(d.Issuer, "{tenantid}", stringClaim(claims, "tid"))
+	if iss, _ := claims.GetIssuer(); iss != issuer {
+		return nil, fmt.Errorf("%w: issuer %q", ErrInvalidIDToken, iss)
+	}
+
+	if stringClaim(claims, "nonce") != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	return claims, nil
+}
+
+func (p *oidcProvider) oauth2Config(ctx context.Context) (*oauth2.Config, *discovery, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Scopes:       p.cfg.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  d.AuthorizationEndpoint,
+			TokenURL: d.TokenEndpoint,
+		},
+	}, d, nil
+}
+
+func (p *oidcProvider) discover(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var d discovery
+	wellKnown := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &d); err != nil {
+		return nil, fmt.Errorf("discovering %s failed: %w", p.cfg.Name, err)
+	}
+
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("discovering %s failed: incomplete provider metadata", p.cfg.Name)
+	}
+
+	// The issuer must be the one we were configured with, or tokens from
+	// another issuer could pass.
+	if !issuerMatches(d.Issuer, p.cfg.Issuer) {
+		return nil, fmt.Errorf("discovering %s failed: issuer %q does not match", p.cfg.Name, d.Issuer)
+	}
+
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// key returns the issuer's signing key with the ID. Keys are fetched again
+// when the issuer rotates to a key we don't know yet.
+func (p *oidcProvider) key(ctx context.Context, d *discovery, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	if p.keys != nil && p.now().Sub(p.fetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, d.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("fetching signing keys failed: %w", err)
+	}
+
+	p.keys = map[string]any{}
+	p.fetchedAt = p.now()
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			slog.Info(err.Error(), "provider", p.cfg.Name, "kid", k.KID)
+			continue
+		}
+		p.keys[k.KID] = key
+	}
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *oidcProvider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", url, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// jsonWebKey is a public key from a JWKS document (RFC 7517).
+type jsonWebKey struct {
+	KTY string `json:"kty"`
+	KID string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	CRV string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (any, error) {
+	switch k.KTY {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.CRV {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.CRV)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.KTY)
+}
+
+// issuerMatches compares a discovered issuer to the configured one. An issuer
+// template matches the configured issuer with any tenant in its place.
+func issuerMatches(discovered, configured string) bool {
+	discovered = strings.TrimSuffix(discovered, "/")
+	configured = strings.TrimSuffix(configured, "/")
+	if discovered == configured {
+		return true
+	}
+
+	prefix, suffix, ok := strings.Cut(discovered, "{tenantid}")
+	return ok && len(configured) > len(prefix)+len(suffix) &&
+		strings.HasPrefix(configured, prefix) && strings.HasSuffix(configured, suffix)
+}
+
+func stringClaim(claims jwt.MapClaims, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// boolClaim reads a boolean claim. Some issuers send booleans as strings.
+func boolClaim(claims jwt.MapClaims, name string) bool {
+	switch v := claims[name].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/maheshrc27/postflow/internal/identity/identitytest"
+	"golang.org/x/oauth2"
+)
+
+const testRedirectURL = "https://app.example.com/login/test/callback"
+
+var testUser = identitytest.User{
+	Subject:       "user-123",
+	Email:         "ada@example.com",
+	EmailVerified: true,
+	Name:          "Ada Lovelace",
+}
+
+func newTestOIDC(server *identitytest.Server) Provider {
+	return NewOIDC(OIDCConfig{
+		Name:         "test",
+		Issuer:       server.Issuer(),
+		ClientID:     identitytest.ClientID,
+		ClientSecret: identitytest.ClientSecret,
+		RedirectURL:  testRedirectURL,
+	}, server.Client())
+}
+
+// login runs a login against the fake issuer up to the code exchange, which
+// is done with exchangeNonce.
+func login(t *testing.T, server *identitytest.Server, p Provider, exchangeNonce string) (*Identity, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	verifier := oauth2.GenerateVerifier()
+	authURL, err := p.AuthURL(ctx, "state-1", verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("AuthURL: %v", err)
+	}
+
+	callback, err := url.Parse(server.Authorize(t, authURL, testUser))
+	if err != nil {
+		t.Fatalf("parsing callback: %v", err)
+	}
+
+	if got := callback.Query().Get("state"); got != "state-1" {
+		t.Fatalf("state = %q, want state-1", got)
+	}
+
+	return p.Exchange(ctx, callback.Query().Get("code"), verifier, exchangeNonce)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	server := identitytest.NewServer(t)
+	p := newTestOIDC(server)
+
+	identity, err := login(t, server, p, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	want := Identity{
+		Provider:      "test",
+		Subject:       testUser.Subject,
+		Email:         testUser.Email,
+		EmailVerified: true,
+		Name:          testUser.Name,
+	}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestOIDCRejectsNonceMismatch(t *testing.T) {
+	server := identitytest.NewServer(t)
+	p := newTestOIDC(server)
+
+	if _, err := login(t, server, p, "other-nonce"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("err = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestOIDCRejectsForeignSignature(t *testing.T) {
+	server := identitytest.NewServer(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.SigningKey = key
+	p := newTestOIDC(server)
+
+	if _, err := login(t, server, p, "nonce-1"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("err = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestOIDCRejectsWrongVerifier(t *testing.T) {
+	server := identitytest.NewServer(t)
+	p := newTestOIDC(server)
+	ctx := context.Background()
+
+	authURL, err := p.AuthURL(ctx, "state-1", oauth2.GenerateVerifier(), "nonce-1")
+	if err != nil {
+		t.Fatalf("AuthURL: %v", err)
+	}
+	callback, _ := url.Parse(server.Authorize(t, authURL, testUser))
+
+	if _, err := p.Exchange(ctx, callback.Query().Get("code"), oauth2.GenerateVerifier(), "nonce-1"); err == nil {
+		t.Fatal("exchange with another verifier succeeded")
+	}
+}
+
+func TestOIDCRejectsIssuerMismatch(t *testing.T) {
+	server := identitytest.NewServer(t)
+	p := NewOIDC(OIDCConfig{
+		Name:     "test",
+		Issuer:   server.Issuer() + "/",
+		ClientID: identitytest.ClientID,
+	}, server.Client())
+
+	// A trailing slash is the same issuer.
+	if _, err := p.AuthURL(context.Background(), "s", oauth2.GenerateVerifier(), "n"); err != nil {
+		t.Fatalf("AuthURL: %v", err)
+	}
+
+	p = NewOIDC(OIDCConfig{
+		Name:     "test",
+		Issuer:   server.Issuer() + "/.",
+		ClientID: identitytest.ClientID,
+	}, server.Client())
+	if _, err := p.AuthURL(context.Background(), "s", oauth2.GenerateVerifier(), "n"); err == nil {
+		t.Fatal("AuthURL succeeded for a mismatched issuer")
+	}
+}
+
+func TestIssuerMatches(t *testing.T) {
+	tests := []struct {
+		discovered, configured string
+		want                   bool
+	}{
+		{"https://accounts.google.com", "https://accounts.google.com", true},
+		{"https://login.microsoftonline.com/{tenantid}/v2.0", "https://login.microsoftonline.com/common/v2.0", true},
+		{"https://login.microsoftonline.com/{tenantid}/v2.0", "https://login.microsoftonline.com/v2.0", false},
+		{"https://evil.example.com", "https://accounts.google.com", false},
+	}
+
+	for _, tt := range tests {
+		if got := issuerMatches(tt.discovered, tt.configured); got != tt.want {
+			t.Errorf("issuerMatches(%q, %q) = %v, want %v", tt.discovered, tt.configured, got, tt.want)
+		}
+	}
+}
+
+func TestOIDCRejectsWrongAudience(t *testing.T) {
+	server := identitytest.NewServer(t)
+	server.Audience = "other-client"
+	p := newTestOIDC(server)
+
+	if _, err := login(t, server, p, "nonce-1"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("err = %v, want ErrInvalidIDToken", err)
+	}
+}
@@ -0,0 +1,140 @@
+// Package invoice renders purchase invoices as PDF documents.
+package invoice
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+// Seller is the business issuing the invoices.
+type Seller struct {
+	Name    string
+	Address string
+	VATID   string
+	Email   string
+	// Country is the ISO code of the country the seller is established in.
+	Country string
+}
+
+const (
+	marginLeft  = 56.0
+	marginRight = pageWidth - 56.0
+)
+
+// Render writes the invoice for order as a PDF.
+func Render(w io.Writer, seller Seller, order *models.Order) error {
+	p := &page{}
+
+	p.text(marginLeft, 72, fontBold, 22, "Invoice")
+	p.textRight(marginRight, 64, fontRegular, 10, "Invoice no. "+order.InvoiceNumber)
+	p.textRight(marginRight, 78, fontRegular, 10, "Date "+order.CreatedAt.Format("2006-01-02"))
+
+	y := 120.0
+	p.text(marginLeft, y, fontBold, 10, seller.Name)
+	sellerLines := append(splitLines(seller.Address), seller.Email)
+	if seller.VATID != "" {
+		sellerLines = append(sellerLines, "VAT ID "+seller.VATID)
+	}
+	for _, line := range sellerLines {
+		if line == "" {
+			continue
+		}
+		y += 14
+		p.text(marginLeft, y, fontRegular, 10, line)
+	}
+
+	y = 120.0
+	billTo := 320.0
+	p.text(billTo, y, fontBold, 10, "Bill to")
+	name := order.BillingName
+	if name == "" {
+		name = order.BillingEmail
+	}
+	buyerLines := append([]string{name}, splitLines(order.BillingAddress)...)
+	buyerLines = append(buyerLines, order.BillingCountry)
+	if order.BillingName != "" {
+		buyerLines = append(buyerLines, order.BillingEmail)
+	}
+	if order.VATID != "" {
+		buyerLines = append(buyerLines, "VAT ID "+order.VATID)
+	}
+	for _, line := range buyerLines {
+		if line == "" {
+			continue
+		}
+		y += 14
+		p.text(billTo, y, fontRegular, 10, line)
+	}
+
+	y = 260.0
+	p.text(marginLeft, y, fontBold, 10, "Description")
+	p.textRight(360, y, fontBold, 10, "Qty")
+	p.textRight(450, y, fontBold, 10, "Unit price")
+	p.textRight(marginRight, y, fontBold, 10, "Amount")
+	y += 8
+	p.line(marginLeft, y, marginRight, y)
+
+	for _, line := range order.Lines {
+		y += 18
+		p.text(marginLeft, y, fontRegular, 10, line.Description)
+		p.textRight(360, y, fontRegular, 10, fmt.Sprintf("%d", line.Quantity))
+		p.textRight(450, y, fontRegular, 10, formatMoney(line.UnitPriceMinor, order.Currency))
+		p.textRight(marginRight, y, fontRegular, 10, formatMoney(line.AmountMinor, order.Currency))
+	}
+
+	y += 12
+	p.line(marginLeft, y, marginRight, y)
+
+	totals := []struct {
+		label  string
+		amount int64
+		font   string
+	}{
+		{"Subtotal", order.SubtotalMinor, fontRegular},
+		{"Tax", order.TaxMinor, fontRegular},
+		{"Total", order.TotalMinor, fontBold},
+	}
+	for _, total := range totals {
+		y += 18
+		p.textRight(450, y, total.font, 10, total.label)
+		p.textRight(marginRight, y, total.font, 10, formatMoney(total.amount, order.Currency))
+	}
+
+	y += 40
+	p.text(marginLeft, y, fontRegular, 9, fmt.Sprintf("Paid via %s.", order.Provider))
+	if reverseCharge(seller, order) {
+		y += 12
+		p.text(marginLeft, y, fontRegular, 9, "Reverse charge: VAT to be accounted for by the recipient.")
+	}
+
+	return writePDF(w, []*page{p})
+}
+
+// reverseCharge reports whether the buyer accounts for the VAT of an untaxed
+// order, which is the case for businesses buying from another country.
+func reverseCharge(seller Seller, order *models.Order) bool {
+	if order.TaxMinor != 0 || order.VATID == "" {
+		return false
+	}
+	if seller.Country == "" || order.BillingCountry == "" {
+		return false
+	}
+	return !strings.EqualFold(seller.Country, order.BillingCountry)
+}
+
+// formatMoney formats an amount in minor units, e.g. 1500 usd as "15.00 USD".
+func formatMoney(minor int64, currency string) string {
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	return fmt.Sprintf("%s%d.%02d %s", sign, minor/100, minor%100, strings.ToUpper(currency))
+}
+
+func splitLines(s string) []string {
+	return strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+}
@@ -0,0 +1,56 @@
+package invoice
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+func TestRenderReverseCharge(t *testing.T) {
+	seller := Seller{Name: "Postflow", VATID: "DE123456789", Country: "DE"}
+
+	tests := []struct {
+		name    string
+		country string
+		vatID   string
+		tax     int64
+		want    bool
+	}{
+		{"cross-border business", "FR", "FR12345678901", 0, true},
+		{"domestic business", "DE", "DE987654321", 0, false},
+		{"cross-border consumer", "FR", "", 0, false},
+		{"taxed business", "FR", "FR12345678901", 190, false},
+		{"unknown country", "", "FR12345678901", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &models.Order{
+				InvoiceNumber:  "2026-000001",
+				Provider:       "stripe",
+				Currency:       "eur",
+				SubtotalMinor:  1000,
+				TaxMinor:       tt.tax,
+				TotalMinor:     1000 + tt.tax,
+				BillingEmail:   "buyer@example.com",
+				BillingCountry: tt.country,
+				VATID:          tt.vatID,
+				CreatedAt:      time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+				Lines:          []*models.OrderLine{{Description: "Pro (40 credits)", Quantity: 1, UnitPriceMinor: 1000, AmountMinor: 1000}},
+			}
+
+			var buf bytes.Buffer
+			if err := Render(&buf, seller, order); err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if got := bytes.Contains(buf.Bytes(), []byte("Reverse charge")); got != tt.want {
+				t.Errorf("reverse charge line printed = %v, want %v", got, tt.want)
+			}
+			if !bytes.Contains(buf.Bytes(), []byte("(Invoice no. 2026-000001)")) {
+				t.Error("invoice number is missing")
+			}
+		})
+	}
+}
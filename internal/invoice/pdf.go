@@ -0,0 +1,123 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 page size in points.
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+)
+
+const (
+	fontRegular = "F1"
+	fontBold    = "F2"
+)
+
+// page collects the drawing operators of one PDF page. Coordinates have
+// their origin in the top left corner, unlike PDF's bottom left.
+type page struct {
+	content bytes.Buffer
+}
+
+func (p *page) text(x, y float64, font string, size float64, s string) {
+	fmt.Fprintf(&p.content, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, pageHeight-y, escapeText(s))
+}
+
+// textRight draws s so that it ends at x. Widths are approximated from the
+// average Helvetica glyph width, which is close enough for numbers.
+func (p *page) textRight(x, y float64, font string, size float64, s string) {
+	p.text(x-textWidth(s, size), y, font, size, s)
+}
+
+func (p *page) line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(&p.content, "%.2f %.2f m %.2f %.2f l S\n", x1, pageHeight-y1, x2, pageHeight-y2)
+}
+
+func textWidth(s string, size float64) float64 {
+	return float64(len([]rune(s))) * size * 0.5
+}
+
+// winAnsi holds the WinAnsiEncoding codes of common characters outside
+// Latin-1.
+var winAnsi = map[rune]string{
+	'€': `\200`,
+	'‘': `\221`,
+	'’': `\222`,
+	'“': `\223`,
+	'”': `\224`,
+	'•': `\225`,
+	'–': `\226`,
+	'—': `\227`,
+}
+
+// escapeText maps s to a PDF literal string in WinAnsiEncoding. Characters
+// outside Latin-1 are replaced, since the standard fonts can't show them.
+func escapeText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteByte(' ')
+		case r < 0x20:
+		case r < 0x80:
+			b.WriteRune(r)
+		case winAnsi[r] != "":
+			b.WriteString(winAnsi[r])
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, `\%03o`, r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// writePDF writes a document made of pages using the built-in Helvetica
+// fonts, so no font needs to be embedded.
+func writePDF(w io.Writer, pages []*page) error {
+	var buf bytes.Buffer
+	var offsets []int
+
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1-4 are the catalog, the page tree and the fonts; each page
+	// then takes two objects, the page and its content stream.
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, p := range pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, fontRegular, fontBold, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.content.Len(), p.content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
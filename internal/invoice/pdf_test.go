@@ -0,0 +1,76 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestWritePDFCrossReferences(t *testing.T) {
+	first, second := &page{}, &page{}
+	first.text(marginLeft, 72, fontBold, 22, "Invoice")
+	second.line(marginLeft, 100, marginRight, 100)
+
+	var buf bytes.Buffer
+	if err := writePDF(&buf, []*page{first, second}); err != nil {
+		t.Fatalf("writePDF: %v", err)
+	}
+	pdf := buf.Bytes()
+
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatalf("document isn't framed by a PDF header and EOF marker")
+	}
+	if !bytes.Contains(pdf, []byte("/Kids [5 0 R 7 0 R] /Count 2")) {
+		t.Errorf("page tree doesn't list both pages")
+	}
+
+	// startxref points at the cross-reference table, whose entries point at
+	// the objects in order.
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	if m == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(pdf[xref:], []byte("xref\n0 9\n")) {
+		t.Fatalf("startxref %d doesn't point at a table of 9 entries", xref)
+	}
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	if len(entries) != 8 {
+		t.Fatalf("got %d object offsets, want 8", len(entries))
+	}
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(pdf[offset:], []byte(want)) {
+			t.Errorf("offset of object %d points at %q", i+1, pdf[offset:min(offset+len(want), len(pdf))])
+		}
+	}
+
+	// Stream lengths match the content they announce.
+	for _, p := range []*page{first, second} {
+		want := fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.content.Len(), p.content.String())
+		if !bytes.Contains(pdf, []byte(want)) {
+			t.Errorf("content stream %q is missing or has the wrong length", p.content.String())
+		}
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Pro (monthly)", `Pro \(monthly\)`},
+		{`C:\path`, `C:\\path`},
+		{"two\nlines", "two lines"},
+		{"15.00 €", `15.00 \200`},
+		{"Müller", `M\374ller`},
+		{"東京", "??"},
+	}
+	for _, tt := range tests {
+		if got := escapeText(tt.in); got != tt.want {
+			t.Errorf("escapeText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
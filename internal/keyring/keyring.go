@@ -0,0 +1,226 @@
+// Package keyring signs and verifies session tokens with a set of rotating
+// asymmetric keys, and publishes their public halves as a JWKS.
+package keyring
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+const (
+	// reloadInterval is how often keys are loaded again, so that keys
+	// rotated from another instance or the keys command are picked up.
+	reloadInterval = time.Minute
+	// minReloadInterval limits the reloads tokens with an unknown key ID
+	// trigger.
+	minReloadInterval = 10 * time.Second
+)
+
+var (
+	ErrNoSigningKey = errors.New("no activated signing key")
+	ErrUnknownKey   = errors.New("unknown signing key")
+)
+
+// Store is where keys are kept.
+type Store interface {
+	// List returns all keys, retired ones included.
+	List(ctx context.Context) ([]*models.SigningKey, error)
+}
+
+// Keyring holds the keys that aren't retired. The most recently activated
+// key signs; any of them verifies.
+type Keyring struct {
+	store  Store
+	secret string
+	now    func() time.Time
+
+	mu       sync.Mutex
+	keys     []*key
+	signer   *key
+	loadedAt time.Time
+}
+
+// New returns a keyring over the store. secret decrypts the private keys.
+func New(store Store, secret string) *Keyring {
+	return &Keyring{
+		store:  store,
+		secret: secret,
+		now:    time.Now,
+	}
+}
+
+// Load reads the keys from the store.
+func (k *Keyring) Load(ctx context.Context) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.load(ctx)
+}
+
+func (k *Keyring) load(ctx context.Context) error {
+	stored, err := k.store.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	var keys []*key
+	var signer *key
+	for _, s := range stored {
+		if s.RetiredAt != nil {
+			continue
+		}
+
+		decoded, err := decode(s, k.secret)
+		if err != nil {
+			return fmt.Errorf("loading signing key %s: %w", s.KID, err)
+		}
+		keys = append(keys, decoded)
+
+		if decoded.activatedAt != nil && (signer == nil || decoded.activatedAt.After(*signer.activatedAt)) {
+			signer = decoded
+		}
+	}
+
+	k.keys = keys
+	k.signer = signer
+	k.loadedAt = k.now()
+	return nil
+}
+
+// refresh loads the keys again once they are older than maxAge. Failures
+// keep the keys loaded before.
+func (k *Keyring) refresh(ctx context.Context, maxAge time.Duration) {
+	if k.now().Sub(k.loadedAt) < maxAge {
+		return
+	}
+	if err := k.load(ctx); err != nil {
+		slog.Error("failed to reload signing keys", "error", err)
+	}
+}
+
+// CanSign reports whether a key is activated.
+func (k *Keyring) CanSign(ctx context.Context) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.refresh(ctx, reloadInterval)
+	return k.signer != nil
+}
+
+// Sign returns the claims as a token signed with the current key.
+func (k *Keyring) Sign(ctx context.Context, claims jwt.Claims) (string, error) {
+	k.mu.Lock()
+	k.refresh(ctx, reloadInterval)
+	signer := k.signer
+	k.mu.Unlock()
+
+	if signer == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(signer.method, claims)
+	token.Header["kid"] = signer.id
+	return token.SignedString(signer.private)
+}
+
+// Parse verifies a token against the key its kid names and decodes its
+// claims.
+func (k *Keyring) Parse(ctx context.Context, tokenString string, claims jwt.Claims, opts ...jwt.ParserOption) (*jwt.Token, error) {
+	opts = append(opts, jwt.WithValidMethods([]string{EdDSA, RS256}))
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		key := k.lookup(ctx, kid)
+		if key == nil {
+			return nil, fmt.Errorf("%w %q", ErrUnknownKey, kid)
+		}
+
+		// The key decides the algorithm, not the token.
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("key %q does not sign %s", kid, token.Method.Alg())
+		}
+
+		return key.public, nil
+	}, opts...)
+}
+
+func (k *Keyring) lookup(ctx context.Context, kid string) *key {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.refresh(ctx, reloadInterval)
+	if key := k.find(kid); key != nil {
+		return key
+	}
+
+	// The key may have been created since the last load.
+	k.refresh(ctx, minReloadInterval)
+	return k.find(kid)
+}
+
+func (k *Keyring) find(kid string) *key {
+	for _, key := range k.keys {
+		if key.id == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+// JSONWebKey is a public key in a JWKS (RFC 7517).
+type JSONWebKey struct {
+	KTY string `json:"kty"`
+	KID string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	CRV string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns the public keys tokens may be signed with.
+func (k *Keyring) JWKS(ctx context.Context) *JSONWebKeySet {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.refresh(ctx, reloadInterval)
+
+	set := &JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range k.keys {
+		jwk := JSONWebKey{
+			KID: key.id,
+			Use: "sig",
+			Alg: key.method.Alg(),
+		}
+
+		switch public := key.public.(type) {
+		case ed25519.PublicKey:
+			jwk.KTY = "OKP"
+			jwk.CRV = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.KTY = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
@@ -0,0 +1,184 @@
+package keyring
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+const testSecret = "test-key-encryption-key"
+
+type memoryStore struct {
+	mu   sync.Mutex
+	keys []*models.SigningKey
+}
+
+func (s *memoryStore) List(ctx context.Context) ([]*models.SigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*models.SigningKey(nil), s.keys...), nil
+}
+
+// add generates a key and activates it at activatedAt, unless that is zero.
+func (s *memoryStore) add(t *testing.T, alg string, activatedAt time.Time) *models.SigningKey {
+	t.Helper()
+
+	key, err := Generate(alg, testSecret)
+	if err != nil {
+		t.Fatalf("generating %s key: %v", alg, err)
+	}
+	if !activatedAt.IsZero() {
+		key.ActivatedAt = &activatedAt
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, key)
+	return key
+}
+
+func newKeyring(t *testing.T, store Store) *Keyring {
+	t.Helper()
+
+	k := New(store, testSecret)
+	if err := k.Load(context.Background()); err != nil {
+		t.Fatalf("loading keys: %v", err)
+	}
+	return k
+}
+
+func sign(t *testing.T, k *Keyring) string {
+	t.Helper()
+
+	token, err := k.Sign(context.Background(), jwt.RegisteredClaims{
+		Subject:   "42",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatalf("signing: %v", err)
+	}
+	return token
+}
+
+func parse(k *Keyring, token string) (*jwt.Token, error) {
+	return k.Parse(context.Background(), token, &jwt.RegisteredClaims{})
+}
+
+func TestSignAndParse(t *testing.T) {
+	for _, alg := range []string{EdDSA, RS256} {
+		t.Run(alg, func(t *testing.T) {
+			store := &memoryStore{}
+			key := store.add(t, alg, time.Now())
+			k := newKeyring(t, store)
+
+			token, err := parse(k, sign(t, k))
+			if err != nil {
+				t.Fatalf("parsing: %v", err)
+			}
+			if token.Method.Alg() != alg || token.Header["kid"] != key.KID {
+				t.Errorf("token signed with %s %v, want %s %s", token.Method.Alg(), token.Header["kid"], alg, key.KID)
+			}
+		})
+	}
+}
+
+func TestRotation(t *testing.T) {
+	store := &memoryStore{}
+	old := store.add(t, EdDSA, time.Now().Add(-time.Hour))
+	k := newKeyring(t, store)
+	before := sign(t, k)
+
+	next := store.add(t, RS256, time.Now())
+	if err := k.Load(context.Background()); err != nil {
+		t.Fatalf("loading keys: %v", err)
+	}
+
+	after := sign(t, k)
+	if token, err := parse(k, after); err != nil || token.Header["kid"] != next.KID {
+		t.Fatalf("token after rotation = %v, %v, want signed with %s", token, err, next.KID)
+	}
+	if _, err := parse(k, before); err != nil {
+		t.Errorf("token of the previous key no longer verifies: %v", err)
+	}
+
+	retiredAt := time.Now()
+	old.RetiredAt = &retiredAt
+	if err := k.Load(context.Background()); err != nil {
+		t.Fatalf("loading keys: %v", err)
+	}
+
+	if _, err := parse(k, before); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("token of a retired key: err = %v, want %v", err, ErrUnknownKey)
+	}
+	if got := k.JWKS(context.Background()).Keys; len(got) != 1 || got[0].KID != next.KID || got[0].N == "" || got[0].E == "" {
+		t.Errorf("JWKS = %+v, want only %s", got, next.KID)
+	}
+}
+
+func TestUnknownKeyReloads(t *testing.T) {
+	store := &memoryStore{}
+	store.add(t, EdDSA, time.Now().Add(-time.Hour))
+	k := newKeyring(t, store)
+
+	// Another instance rotated to a new key.
+	store.add(t, EdDSA, time.Now())
+	token := sign(t, newKeyring(t, store))
+
+	if _, err := parse(k, token); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("err = %v, want %v right after a load", err, ErrUnknownKey)
+	}
+
+	now := time.Now().Add(minReloadInterval + time.Second)
+	k.now = func() time.Time { return now }
+	if _, err := parse(k, token); err != nil {
+		t.Fatalf("parsing after reload: %v", err)
+	}
+}
+
+func TestParseRejectsAlgorithmConfusion(t *testing.T) {
+	store := &memoryStore{}
+	key := store.add(t, RS256, time.Now())
+	k := newKeyring(t, store)
+
+	// A token claiming HMAC, keyed with the published public key.
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "42"})
+	forged.Header["kid"] = key.KID
+	token, err := forged.SignedString(key.PublicKey)
+	if err != nil {
+		t.Fatalf("signing: %v", err)
+	}
+
+	if _, err := parse(k, token); err == nil {
+		t.Fatal("HS256 token verified")
+	}
+}
+
+func TestSignWithoutActivatedKey(t *testing.T) {
+	store := &memoryStore{}
+	store.add(t, EdDSA, time.Time{})
+	k := newKeyring(t, store)
+
+	if k.CanSign(context.Background()) {
+		t.Error("CanSign = true without an activated key")
+	}
+	if _, err := k.Sign(context.Background(), jwt.RegisteredClaims{}); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("err = %v, want %v", err, ErrNoSigningKey)
+	}
+	if got := len(k.JWKS(context.Background()).Keys); got != 1 {
+		t.Errorf("JWKS has %d keys, want the pending key published", got)
+	}
+}
+
+func TestLoadWithWrongSecret(t *testing.T) {
+	store := &memoryStore{}
+	store.add(t, EdDSA, time.Now())
+
+	if err := New(store, "wrong").Load(context.Background()); !errors.Is(err, ErrDecryptKey) {
+		t.Fatalf("err = %v, want %v", err, ErrDecryptKey)
+	}
+}
@@ -0,0 +1,162 @@
+package keyring
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+// Algorithms keys can be generated for.
+const (
+	EdDSA = "EdDSA"
+	RS256 = "RS256"
+)
+
+const rsaKeyBits = 2048
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrDecryptKey           = errors.New("unable to decrypt signing key, is KEY_ENCRYPTION_KEY right?")
+)
+
+// Generate returns a new key for the algorithm. Its private key is encrypted
+// with secret. The key is neither stored nor activated.
+func Generate(alg, secret string) (*models.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch alg {
+	case EdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case RS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := seal(secret, der)
+	if err != nil {
+		return nil, err
+	}
+
+	public, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	return &models.SigningKey{
+		KID:        time.Now().UTC().Format("20060102") + "-" + hex.EncodeToString(b),
+		Algorithm:  alg,
+		PrivateKey: sealed,
+		PublicKey:  public,
+	}, nil
+}
+
+// key is a stored key, decoded.
+type key struct {
+	id          string
+	method      jwt.SigningMethod
+	private     crypto.Signer
+	public      crypto.PublicKey
+	activatedAt *time.Time
+}
+
+func decode(k *models.SigningKey, secret string) (*key, error) {
+	method := jwt.GetSigningMethod(k.Algorithm)
+	if method == nil || (k.Algorithm != EdDSA && k.Algorithm != RS256) {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, k.Algorithm)
+	}
+
+	public, err := x509.ParsePKIXPublicKey(k.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := open(secret, k.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedAlgorithm, parsed)
+	}
+
+	return &key{
+		id:          k.KID,
+		method:      method,
+		private:     private,
+		public:      public,
+		activatedAt: k.ActivatedAt,
+	}, nil
+}
+
+// seal encrypts a private key with AES-GCM under a key derived from secret.
+func seal(secret string, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(secret string, sealed []byte) ([]byte, error) {
+	aead, err := newAEAD(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrDecryptKey
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrDecryptKey
+	}
+	return plaintext, nil
+}
+
+func newAEAD(secret string) (cipher.AEAD, error) {
+	sum := sha256.Sum256([]byte("signing-keys:" + secret))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,28 @@
+// Package mailer sends transactional email.
+package mailer
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidMessage = errors.New("invalid email message")
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+func (m *Message) validate() error {
+	if m.To == "" || strings.ContainsAny(m.To, "\r\n") || strings.ContainsAny(m.Subject, "\r\n") {
+		return ErrInvalidMessage
+	}
+	return nil
+}
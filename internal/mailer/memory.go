@@ -0,0 +1,49 @@
+package mailer
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// Memory keeps sent messages instead of delivering them. It is used when no
+// SMTP server is configured, and lets tests read what was sent.
+type Memory struct {
+	mu       sync.Mutex
+	messages []*Message
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Send(ctx context.Context, msg *Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	slog.Info("email kept in memory", "to", msg.To, "subject", msg.Subject)
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first.
+func (m *Memory) Messages() []*Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*Message(nil), m.messages...)
+}
+
+// Last returns the latest message sent to the address, or nil.
+func (m *Memory) Last(to string) *Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To == to {
+			return m.messages[i]
+		}
+	}
+	return nil
+}
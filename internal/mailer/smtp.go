@@ -0,0 +1,59 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+type smtpMailer struct {
+	addr string
+	host string
+	auth smtp.Auth
+	from *mail.Address
+}
+
+// NewSMTP returns a mailer that delivers through an SMTP server, with PLAIN
+// authentication when username is set. from may include a display name.
+func NewSMTP(host string, port int, username, password, from string) (Mailer, error) {
+	address, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %w", from, err)
+	}
+
+	m := &smtpMailer{
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		host: host,
+		from: address,
+	}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m, nil
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg *Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\n", m.from.String())
+	fmt.Fprintf(&body, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&body, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	body.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	body.WriteString(msg.Body)
+
+	// net/smtp has no context support; a cancelled request still waits for
+	// the server.
+	return smtp.SendMail(m.addr, m.auth, m.from.Address, []string{msg.To}, body.Bytes())
+}
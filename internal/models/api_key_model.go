@@ -0,0 +1,36 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Scopes of API keys.
+const (
+	ScopeVideosRead     = "videos:read"
+	ScopeVideosGenerate = "videos:generate"
+	ScopeCreditsRead    = "credits:read"
+)
+
+// APIKeyScopes are the scopes an API key can be given.
+var APIKeyScopes = []string{ScopeVideosRead, ScopeVideosGenerate, ScopeCreditsRead}
+
+// APIKey authenticates a user's scripts. Its secret is only shown once, when
+// it is created.
+type APIKey struct {
+	ID         int64      `db:"id" json:"id"`
+	UserID     int64      `db:"user_id" json:"-"`
+	Name       string     `db:"name" json:"name"`
+	Prefix     string     `db:"prefix" json:"prefix"`
+	KeyHash    string     `db:"key_hash" json:"-"`
+	Scopes     []string   `db:"scopes" json:"scopes"`
+	UsageCount int64      `db:"usage_count" json:"usage_count"`
+	LastUsedAt *time.Time `db:"last_used_at" json:"last_used_at"`
+	LastUsedIP string     `db:"last_used_ip" json:"last_used_ip"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	RevokedAt  *time.Time `db:"revoked_at" json:"-"`
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
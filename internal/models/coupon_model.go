@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Coupon is a promo code. It either grants Credits when redeemed or takes
+// DiscountPercent off a purchase made with it. MaxRedemptions of zero means
+// unlimited.
+type Coupon struct {
+	ID              int64      `db:"id" json:"id"`
+	Code            string     `db:"code" json:"code"`
+	Credits         int64      `db:"credits" json:"credits"`
+	DiscountPercent int        `db:"discount_percent" json:"discount_percent"`
+	MaxRedemptions  int        `db:"max_redemptions" json:"max_redemptions"`
+	Redemptions     int        `db:"redemptions" json:"redemptions"`
+	StartsAt        *time.Time `db:"starts_at" json:"starts_at"`
+	ExpiresAt       *time.Time `db:"expires_at" json:"expires_at"`
+	Campaign        string     `db:"campaign" json:"campaign"`
+	CreatedAt       time.Time  `db:"created_at" json:"created_at"`
+}
+
+func (c *Coupon) IsDiscount() bool {
+	return c.DiscountPercent > 0
+}
+
+// DiscountedPrice is what a product priced at priceMinor costs with the
+// coupon applied, rounded to the nearest minor unit.
+func (c *Coupon) DiscountedPrice(priceMinor int64) int64 {
+	return (priceMinor*int64(100-c.DiscountPercent) + 50) / 100
+}
+
+// ValidAt reports whether t falls in the coupon's validity window.
+func (c *Coupon) ValidAt(t time.Time) bool {
+	if c.StartsAt != nil && t.Before(*c.StartsAt) {
+		return false
+	}
+	if c.ExpiresAt != nil && !t.Before(*c.ExpiresAt) {
+		return false
+	}
+	return true
+}
+
+type CouponRedemption struct {
+	ID        int64     `db:"id" json:"id"`
+	CouponID  int64     `db:"coupon_id" json:"coupon_id"`
+	UserID    int64     `db:"user_id" json:"user_id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// CreditBucket is a portion of a user's balance with a common source and
+// expiry. Source is the kind of the ledger entry that created it. Buckets
+// without ExpiresAt never expire.
+type CreditBucket struct {
+	ID            int64      `db:"id" json:"id"`
+	UserID        int64      `db:"user_id" json:"user_id"`
+	Source        string     `db:"source" json:"source"`
+	Amount        int64      `db:"amount" json:"amount"`
+	Remaining     int64      `db:"remaining" json:"remaining"`
+	ExpiresAt     *time.Time `db:"expires_at" json:"expires_at"`
+	TransactionID *int64     `db:"transaction_id" json:"transaction_id,omitempty"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+const (
+	ReservationHeld     = "held"
+	ReservationCaptured = "captured"
+	ReservationReleased = "released"
+)
+
+// CreditReservation is a hold on part of a user's balance. Held credits are
+// not available for other spending until they are captured (spent) or
+// released back to the balance.
+type CreditReservation struct {
+	ID         int64      `db:"id" json:"id"`
+	UserID     int64      `db:"user_id" json:"user_id"`
+	Amount     int64      `db:"amount" json:"amount"`
+	Status     string     `db:"status" json:"status"`
+	Reason     string     `db:"reason" json:"reason"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	ResolvedAt *time.Time `db:"resolved_at" json:"resolved_at,omitempty"`
+}
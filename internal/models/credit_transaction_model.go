@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+const (
+	CreditGrant      = "grant"
+	CreditPurchase   = "purchase"
+	CreditSpend      = "spend"
+	CreditRefund     = "refund"
+	CreditAdjustment = "adjustment"
+	// CreditReversal takes back the credits of a refunded or disputed sale.
+	CreditReversal = "reversal"
+	// CreditRestore gives back the credits of a disputed sale once the
+	// dispute is won.
+	CreditRestore  = "restore"
+	CreditCoupon   = "coupon"
+	CreditReferral = "referral"
+	// CreditExpiry removes promotional credits that were not used in time.
+	CreditExpiry = "expiry"
+
+	CreditTransferOut = "transfer_out"
+	CreditTransferIn  = "transfer_in"
+)
+
+// CreditTransaction is one entry of the credits ledger. Amount is signed:
+// positive entries add to the balance and negative entries take from it.
+type CreditTransaction struct {
+	ID            int64     `db:"id" json:"id"`
+	UserID        int64     `db:"user_id" json:"user_id"`
+	Kind          string    `db:"kind" json:"kind"`
+	Amount        int64     `db:"amount" json:"amount"`
+	BalanceAfter  int64     `db:"balance_after" json:"balance_after"`
+	Reason        string    `db:"reason" json:"reason"`
+	ReferenceType string    `db:"reference_type" json:"reference_type,omitempty"`
+	ReferenceID   string    `db:"reference_id" json:"reference_id,omitempty"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+
+	// AllowNegative lets a debit take the balance below zero. It is only
+	// used to claw back credits that were already spent.
+	AllowNegative bool `db:"-" json:"-"`
+	// ExpiresAt is when the credits added by a positive entry expire. Nil
+	// means never.
+	ExpiresAt *time.Time `db:"-" json:"-"`
+	// Parts splits the credits added by a positive entry into buckets with
+	// their own expiry, soonest-expiring first. Without parts the entry
+	// opens one bucket expiring at ExpiresAt.
+	Parts []CreditPart `db:"-" json:"-"`
+	// Offsets is the ledger entry a reversal takes back. The debit draws
+	// from the bucket that entry opened before any other.
+	Offsets int64 `db:"-" json:"-"`
+}
+
+// CreditPart is a share of a credit that expires at ExpiresAt, or never if
+// it is nil.
+type CreditPart struct {
+	Amount    int64      `db:"amount" json:"amount"`
+	ExpiresAt *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// CreditTransfer moves credits from one user to another. Gifts carry a
+// GiftCode and get their RecipientID when the code is redeemed.
+type CreditTransfer struct {
+	ID          int64      `db:"id" json:"id"`
+	SenderID    int64      `db:"sender_id" json:"sender_id"`
+	RecipientID *int64     `db:"recipient_id" json:"recipient_id,omitempty"`
+	Amount      int64      `db:"amount" json:"amount"`
+	GiftCode    *string    `db:"gift_code" json:"gift_code,omitempty"`
+	Note        string     `db:"note" json:"note"`
+	ExpiresAt   *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+	RedeemedAt  *time.Time `db:"redeemed_at" json:"redeemed_at,omitempty"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+
+	// Parts are the shares of the transferred credits by expiry. ExpiresAt
+	// is the soonest of them.
+	Parts []CreditPart `db:"-" json:"-"`
+}
@@ -5,6 +5,12 @@ import "time"
 type Credits struct {
 	UserID    int64     `db:"ser_id" json:"ser_id"`
 	Credits   int64     `db:"credits" json:"credits"`
+	Reserved  int64     `db:"reserved" json:"reserved"`
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
 }
+
+// Available is the part of the balance that is not held by a reservation.
+func (c *Credits) Available() int64 {
+	return c.Credits - c.Reserved
+}
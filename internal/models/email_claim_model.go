@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// EmailClaim is a user's pending proof that they own another email address.
+type EmailClaim struct {
+	ID          int64      `db:"id" json:"id"`
+	UserID      int64      `db:"user_id" json:"user_id"`
+	Email       string     `db:"email" json:"email"`
+	CodeHash    string     `db:"code_hash" json:"-"`
+	Attempts    int        `db:"attempts" json:"attempts"`
+	ExpiresAt   time.Time  `db:"expires_at" json:"expires_at"`
+	ConfirmedAt *time.Time `db:"confirmed_at" json:"confirmed_at,omitempty"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+}
+
+// UserEmail is an additional address a user proved they own.
+type UserEmail struct {
+	Email      string    `db:"email" json:"email"`
+	UserID     int64     `db:"user_id" json:"user_id"`
+	VerifiedAt time.Time `db:"verified_at" json:"verified_at"`
+}
+
+// AccountMerge is what confirming a claim moved into the user's account.
+type AccountMerge struct {
+	Email string `json:"email"`
+	// MergedUserID is the account that was created for purchases under
+	// Email, if there was one.
+	MergedUserID *int64 `json:"merged_user_id,omitempty"`
+	Credits      int64  `json:"credits"`
+}
@@ -0,0 +1,27 @@
+package models
+
+const (
+	PlanFree = "free"
+	PlanPack = "pack"
+)
+
+// Entitlements are the limits that apply to a user on their current plan.
+// StorageQuota is the number of videos that can be kept in the library.
+type Entitlements struct {
+	Plan               string   `json:"plan"`
+	MaxConcurrentJobs  int      `json:"max_concurrent_jobs"`
+	MaxDurationSeconds int      `json:"max_duration_seconds"`
+	Resolutions        []string `json:"resolutions"`
+	Watermark          bool     `json:"watermark"`
+	StorageQuota       int      `json:"storage_quota"`
+}
+
+// AllowsResolution reports whether resolution is available on the plan.
+func (e *Entitlements) AllowsResolution(resolution string) bool {
+	for _, r := range e.Resolutions {
+		if r == resolution {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// LoginLink is a single-use link mailed to sign in without a password.
+type LoginLink struct {
+	ID        int64      `db:"id" json:"id"`
+	Email     string     `db:"email" json:"email"`
+	TokenHash string     `db:"token_hash" json:"-"`
+	IP        string     `db:"ip" json:"-"`
+	ReturnTo  string     `db:"return_to" json:"return_to"`
+	ExpiresAt time.Time  `db:"expires_at" json:"expires_at"`
+	UsedAt    *time.Time `db:"used_at" json:"used_at,omitempty"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Order is a completed purchase as it appears on the invoice. Billing
+// details are copied from the user at purchase time so that later profile
+// changes don't alter issued invoices. UserID becomes nil when the account is
+// deleted; the order itself is kept for bookkeeping.
+type Order struct {
+	ID             int64        `db:"id" json:"id"`
+	UserID         *int64       `db:"user_id" json:"user_id"`
+	PaymentEventID int64        `db:"payment_event_id" json:"-"`
+	Provider       string       `db:"provider" json:"provider"`
+	InvoiceNumber  string       `db:"invoice_number" json:"invoice_number"`
+	Currency       string       `db:"currency" json:"currency"`
+	SubtotalMinor  int64        `db:"subtotal_minor" json:"subtotal_minor"`
+	TaxMinor       int64        `db:"tax_minor" json:"tax_minor"`
+	TotalMinor     int64        `db:"total_minor" json:"total_minor"`
+	BillingName    string       `db:"billing_name" json:"billing_name"`
+	BillingEmail   string       `db:"billing_email" json:"billing_email"`
+	BillingAddress string       `db:"billing_address" json:"billing_address"`
+	BillingCountry string       `db:"billing_country" json:"billing_country"`
+	VATID          string       `db:"vat_id" json:"vat_id"`
+	CreatedAt      time.Time    `db:"created_at" json:"created_at"`
+	Lines          []*OrderLine `db:"-" json:"lines"`
+}
+
+type OrderLine struct {
+	ID             int64  `db:"id" json:"id"`
+	OrderID        int64  `db:"order_id" json:"-"`
+	Description    string `db:"description" json:"description"`
+	Quantity       int64  `db:"quantity" json:"quantity"`
+	UnitPriceMinor int64  `db:"unit_price_minor" json:"unit_price_minor"`
+	AmountMinor    int64  `db:"amount_minor" json:"amount_minor"`
+}
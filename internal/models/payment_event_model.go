@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+const (
+	PaymentEventProcessing = "processing"
+	PaymentEventProcessed  = "processed"
+	PaymentEventFailed     = "failed"
+	// A processed purchase moves to refunded or disputed once its credits
+	// have been reversed.
+	PaymentEventRefunded = "refunded"
+	PaymentEventDisputed = "disputed"
+)
+
+// PaymentEvent is a webhook delivery from a payment provider, stored once per
+// sale so that retried deliveries are not processed twice.
+type PaymentEvent struct {
+	ID          int64      `db:"id" json:"id"`
+	Provider    string     `db:"provider" json:"provider"`
+	SaleID      string     `db:"sale_id" json:"sale_id"`
+	Status      string     `db:"status" json:"status"`
+	UserID      *int64     `db:"user_id" json:"user_id,omitempty"`
+	Email       string     `db:"email" json:"email"`
+	ProductID   string     `db:"product_id" json:"product_id"`
+	Price       string     `db:"price" json:"price"`
+	Payload     string     `db:"payload" json:"-"`
+	Error       string     `db:"error" json:"error,omitempty"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time  `db:"updated_at" json:"updated_at"`
+	ProcessedAt *time.Time `db:"processed_at" json:"processed_at,omitempty"`
+
+	// A subscription payment records the subscription and the period it
+	// paid for.
+	SubscriptionID *int64     `db:"subscription_id" json:"subscription_id,omitempty"`
+	PeriodStart    *time.Time `db:"period_start" json:"period_start,omitempty"`
+	PeriodEnd      *time.Time `db:"period_end" json:"period_end,omitempty"`
+}
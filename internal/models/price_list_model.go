@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// PriceList prices the catalog in one currency for a set of countries.
+type PriceList struct {
+	ID        int64     `db:"id" json:"id"`
+	Code      string    `db:"code" json:"code"`
+	Name      string    `db:"name" json:"name"`
+	Currency  string    `db:"currency" json:"currency"`
+	Countries []string  `db:"countries" json:"countries"`
+	IsDefault bool      `db:"is_default" json:"is_default"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+const (
+	IntervalMonth = "month"
+	IntervalYear  = "year"
+)
+
+// Product is a credit pack or subscription plan sold through a payment
+// provider. PriceMinor is in the smallest unit of Currency (cents for usd).
+// Subscription plans have an Interval and grant Credits every month.
+type Product struct {
+	ID         int64     `db:"id" json:"id"`
+	Provider   string    `db:"provider" json:"provider"`
+	ProductID  string    `db:"product_id" json:"product_id"`
+	Name       string    `db:"name" json:"name"`
+	PriceMinor int64     `db:"price_minor" json:"price_minor"`
+	Currency   string    `db:"currency" json:"currency"`
+	Credits    int64     `db:"credits" json:"credits"`
+	Interval   string    `db:"interval" json:"interval,omitempty"`
+	Plan       string    `db:"plan" json:"plan,omitempty"`
+	Active     bool      `db:"active" json:"active"`
+	SortOrder  int       `db:"sort_order" json:"-"`
+	CreatedAt  time.Time `db:"created_at" json:"-"`
+	UpdatedAt  time.Time `db:"updated_at" json:"-"`
+}
+
+func (p *Product) IsSubscription() bool {
+	return p.Interval != ""
+}
@@ -0,0 +1,36 @@
+package models
+
+const (
+	// ReconcileMissingEvent is a sale no webhook was recorded for.
+	ReconcileMissingEvent = "missing_event"
+	// ReconcileFailedEvent is a sale whose webhook failed to process.
+	ReconcileFailedEvent = "failed_event"
+	// ReconcileProcessing is a sale whose webhook is still being processed.
+	ReconcileProcessing = "processing"
+	// ReconcileMissingGrant is a processed purchase without its credit grant.
+	ReconcileMissingGrant = "missing_grant"
+	// ReconcileAmountMismatch is a sale recorded at a different price than
+	// the provider reports.
+	ReconcileAmountMismatch = "amount_mismatch"
+	// ReconcileMissingReversal is a refunded or disputed sale whose credits
+	// were not taken back.
+	ReconcileMissingReversal = "missing_reversal"
+)
+
+// ReconcileMismatch is a sale in a provider export that doesn't match what
+// was recorded for it.
+type ReconcileMismatch struct {
+	Provider string `json:"provider"`
+	SaleID   string `json:"sale_id"`
+	Email    string `json:"email"`
+	Problem  string `json:"problem"`
+	Detail   string `json:"detail,omitempty"`
+	// Applied is set when the sale was processed again and now matches.
+	Applied bool   `json:"applied"`
+	Error   string `json:"error,omitempty"`
+}
+
+type ReconcileReport struct {
+	Checked    int                  `json:"checked"`
+	Mismatches []*ReconcileMismatch `json:"mismatches"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+const (
+	ReferralPending  = "pending"
+	ReferralRewarded = "rewarded"
+	ReferralRejected = "rejected"
+	// ReferralReversed is a rewarded referral whose purchase was refunded or
+	// disputed. Its rewards were taken back and it can't be rewarded again.
+	ReferralReversed = "reversed"
+)
+
+// Referral links a new user to the user whose code they signed up with. It
+// stays pending until the referee's first purchase.
+type Referral struct {
+	ID           int64      `db:"id" json:"id"`
+	ReferrerID   int64      `db:"referrer_id" json:"referrer_id"`
+	RefereeID    int64      `db:"referee_id" json:"referee_id"`
+	Status       string     `db:"status" json:"status"`
+	RejectReason string     `db:"reject_reason" json:"reject_reason,omitempty"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+	ResolvedAt   *time.Time `db:"resolved_at" json:"resolved_at,omitempty"`
+	// PaymentEventID is the purchase the referral was rewarded for.
+	PaymentEventID *int64 `db:"payment_event_id" json:"-"`
+}
+
+type ReferralStats struct {
+	Code          string `json:"code"`
+	Pending       int    `json:"pending"`
+	Rewarded      int    `json:"rewarded"`
+	Rejected      int    `json:"rejected"`
+	CreditsEarned int64  `json:"credits_earned"`
+}
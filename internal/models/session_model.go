@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Session is a sign-in of a user on one device.
+type Session struct {
+	ID         string     `db:"id" json:"id"`
+	UserID     int64      `db:"user_id" json:"-"`
+	UserAgent  string     `db:"user_agent" json:"user_agent"`
+	IP         string     `db:"ip" json:"ip"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	LastSeenAt time.Time  `db:"last_seen_at" json:"last_seen_at"`
+	ExpiresAt  time.Time  `db:"expires_at" json:"expires_at"`
+	RevokedAt  *time.Time `db:"revoked_at" json:"-"`
+	// TwoFactorAt is when a two-factor code was last entered on the
+	// session.
+	TwoFactorAt *time.Time `db:"two_factor_at" json:"-"`
+	// Current is set on the session a listing was requested with.
+	Current bool `db:"-" json:"current"`
+}
+
+// RefreshToken renews the access token of a session. It can be used once.
+type RefreshToken struct {
+	ID        int64      `db:"id" json:"id"`
+	SessionID string     `db:"session_id" json:"session_id"`
+	TokenHash string     `db:"token_hash" json:"-"`
+	UsedAt    *time.Time `db:"used_at" json:"used_at,omitempty"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+}
+
+// SessionTokens are handed to the client when a session starts or is
+// refreshed. The refresh token is valid until the session expires. It is
+// empty when a refresh raced another one and the client keeps the token that
+// one handed out.
+type SessionTokens struct {
+	Session         *Session
+	AccessToken     string
+	AccessExpiresAt time.Time
+	RefreshToken    string
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// SigningKey is a key session tokens are signed with. A key is published
+// once created, signs once activated and stops verifying once retired.
+type SigningKey struct {
+	KID       string `db:"kid" json:"kid"`
+	Algorithm string `db:"algorithm" json:"algorithm"`
+	// PrivateKey is the encrypted PKCS #8 private key.
+	PrivateKey []byte `db:"private_key" json:"-"`
+	// PublicKey is the PKIX public key.
+	PublicKey   []byte     `db:"public_key" json:"-"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	ActivatedAt *time.Time `db:"activated_at" json:"activated_at,omitempty"`
+	RetiredAt   *time.Time `db:"retired_at" json:"retired_at,omitempty"`
+}
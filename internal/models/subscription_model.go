@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+const (
+	SubscriptionActive   = "active"
+	SubscriptionPastDue  = "past_due"
+	SubscriptionCanceled = "canceled"
+	// SubscriptionInactive is a subscription the provider reports as neither
+	// paid up nor over, such as a paused one or one whose first payment is
+	// incomplete. It is granted nothing.
+	SubscriptionInactive = "inactive"
+)
+
+// Subscription is a user's recurring plan. Credits are granted monthly at
+// NextGrantAt for as long as the subscription is active and paid up.
+type Subscription struct {
+	ID                     int64      `db:"id" json:"id"`
+	UserID                 int64      `db:"user_id" json:"user_id"`
+	ProductID              int64      `db:"product_id" json:"product_id"`
+	Provider               string     `db:"provider" json:"provider"`
+	ProviderSubscriptionID string     `db:"provider_subscription_id" json:"-"`
+	Status                 string     `db:"status" json:"status"`
+	CurrentPeriodStart     time.Time  `db:"current_period_start" json:"current_period_start"`
+	CurrentPeriodEnd       time.Time  `db:"current_period_end" json:"current_period_end"`
+	CancelAtPeriodEnd      bool       `db:"cancel_at_period_end" json:"cancel_at_period_end"`
+	NextGrantAt            time.Time  `db:"next_grant_at" json:"next_grant_at"`
+	CanceledAt             *time.Time `db:"canceled_at" json:"canceled_at,omitempty"`
+	CreatedAt              time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt              time.Time  `db:"updated_at" json:"updated_at"`
+}
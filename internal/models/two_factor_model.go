@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// TwoFactor is a user's authenticator app. Until ConfirmedAt is set, it is
+// being enrolled and doesn't protect the account.
+type TwoFactor struct {
+	UserID         int64      `db:"user_id" json:"-"`
+	Secret         []byte     `db:"secret" json:"-"`
+	ConfirmedAt    *time.Time `db:"confirmed_at" json:"confirmed_at"`
+	LastUsedStep   int64      `db:"last_used_step" json:"-"`
+	FailedAttempts int        `db:"failed_attempts" json:"-"`
+	LastFailedAt   *time.Time `db:"last_failed_at" json:"-"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+}
+
+// TwoFactorSetup is shown to add an account to an authenticator app.
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth:// URI to show as a QR code.
+	URI string `json:"uri"`
+}
+
+type TwoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// UserIdentity links a user to their account at an identity provider.
+type UserIdentity struct {
+	ID          int64     `db:"id" json:"id"`
+	UserID      int64     `db:"user_id" json:"user_id"`
+	Provider    string    `db:"provider" json:"provider"`
+	Subject     string    `db:"subject" json:"-"`
+	Email       string    `db:"email" json:"email"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	LastLoginAt time.Time `db:"last_login_at" json:"last_login_at"`
+}
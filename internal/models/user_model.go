@@ -3,11 +3,17 @@ package models
 import "time"
 
 type User struct {
-	ID             int64     `db:"id" json:"id"`
-	GoogleID       string    `db:"google_id" json:"google_id"`
-	Email          string    `db:"email" json:"email"`
-	Name           string    `db:"name" json:"name"`
-	ProfilePicture string    `db:"profile_picture" json:"profile_picture"`
-	CreatedAt      time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
+	ID             int64      `db:"id" json:"id"`
+	GoogleID       string     `db:"google_id" json:"google_id"`
+	Email          string     `db:"email" json:"email"`
+	Name           string     `db:"name" json:"name"`
+	ProfilePicture string     `db:"profile_picture" json:"profile_picture"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time  `db:"updated_at" json:"updated_at"`
+	LockedAt       *time.Time `db:"locked_at" json:"locked_at,omitempty"`
+	LockReason     string     `db:"lock_reason" json:"lock_reason,omitempty"`
+	BillingName    string     `db:"billing_name" json:"billing_name"`
+	BillingAddress string     `db:"billing_address" json:"billing_address"`
+	BillingCountry string     `db:"billing_country" json:"billing_country"`
+	VATID          string     `db:"vat_id" json:"vat_id"`
 }
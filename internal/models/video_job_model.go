@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+)
+
+type VideoJob struct {
+	ID            int64      `db:"id" json:"id"`
+	UserID        int64      `db:"user_id" json:"user_id"`
+	Status        string     `db:"status" json:"status"`
+	Payload       string     `db:"payload" json:"-"`
+	ReservationID *int64     `db:"reservation_id" json:"-"`
+	VideoID       string     `db:"video_id" json:"video_id,omitempty"`
+	MediaAssetID  *int64     `db:"media_asset_id" json:"media_asset_id,omitempty"`
+	Error         string     `db:"error" json:"error,omitempty"`
+	Attempts      int        `db:"attempts" json:"attempts"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+	StartedAt     *time.Time `db:"started_at" json:"started_at,omitempty"`
+	FinishedAt    *time.Time `db:"finished_at" json:"finished_at,omitempty"`
+}
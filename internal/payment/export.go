@@ -0,0 +1,250 @@
+package payment
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var ErrMalformedExport = errors.New("malformed sales export")
+
+// exportColumns maps the Event fields a sales export is read into to the
+// column names providers use for them. Column names are compared after
+// lowercasing them and replacing spaces and dashes with underscores.
+var exportColumns = map[string][]string{
+	"sale_id":         {"sale_id", "payment_intent", "payment_intent_id", "id"},
+	"type":            {"type"},
+	"email":           {"email", "purchase_email", "customer_email", "buyer_email"},
+	"product_id":      {"product_id", "short_product_id", "product_id_(metadata)", "metadata_product_id"},
+	"price":           {"price_minor", "price", "amount_total", "amount"},
+	"currency":        {"currency"},
+	"coupon":          {"coupon", "offer_code", "discount_code", "coupon_(metadata)", "metadata_coupon"},
+	"subscription_id": {"subscription_id", "subscription"},
+	"status":          {"status", "refund_status"},
+	"refunded":        {"refunded", "refunded?", "fully_refunded", "fully_refunded?"},
+	"disputed":        {"disputed", "disputed?", "chargedback", "chargedback?", "charged_back"},
+}
+
+// reversalStatuses map the statuses of refunded and disputed sales to the
+// event reversing them.
+var reversalStatuses = map[string]string{
+	"refunded":     EventRefund,
+	"disputed":     EventDispute,
+	"dispute_lost": EventDispute,
+	"lost":         EventDispute,
+	"chargedback":  EventDispute,
+	"charged_back": EventDispute,
+	"chargeback":   EventDispute,
+}
+
+// ReadExport reads the sales a provider lists in an export file, in "csv"
+// (with a header row) or "json" (an array of objects) format, as the events
+// their webhooks would have delivered. A refunded, disputed or charged-back
+// sale is read as its purchase followed by the refund or dispute. Prices
+// without a decimal point are taken to be in minor units; prices with one
+// are in major units with up to two decimals.
+func ReadExport(provider, format string, r io.Reader) ([]*Event, error) {
+	var rows []map[string]string
+	var err error
+	switch strings.ToLower(format) {
+	case "csv":
+		rows, err = readCSVExport(r)
+	case "json":
+		rows, err = readJSONExport(r)
+	default:
+		return nil, fmt.Errorf("%w: unknown format %q", ErrMalformedExport, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*Event, 0, len(rows))
+	for i, row := range rows {
+		event, err := exportEvent(provider, row)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+		if event.Type != EventRefund && event.Type != EventDispute {
+			events = append(events, event)
+			if reversal := exportReversal(row); reversal != "" {
+				events = append(events, reversalEvent(event, reversal))
+			}
+			continue
+		}
+		events = append(events, reversalEvent(event, event.Type))
+	}
+
+	return events, nil
+}
+
+func readCSVExport(r io.Reader) ([]map[string]string, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedExport, err)
+	}
+
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0]
+	rows := make([]map[string]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]string, len(header))
+		for i, name := range header {
+			if i < len(record) {
+				row[exportColumnName(name)] = strings.TrimSpace(record[i])
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func readJSONExport(r io.Reader) ([]map[string]string, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	var objects []map[string]any
+	if err := decoder.Decode(&objects); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedExport, err)
+	}
+
+	rows := make([]map[string]string, 0, len(objects))
+	for _, object := range objects {
+		row := make(map[string]string, len(object))
+		for name, value := range object {
+			switch v := value.(type) {
+			case nil:
+			case string:
+				row[exportColumnName(name)] = strings.TrimSpace(v)
+			case json.Number:
+				row[exportColumnName(name)] = v.String()
+			case bool:
+				row[exportColumnName(name)] = strconv.FormatBool(v)
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func exportColumnName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+}
+
+func exportValue(row map[string]string, field string) string {
+	for _, name := range exportColumns[field] {
+		if value := row[name]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func exportEvent(provider string, row map[string]string) (*Event, error) {
+	event := &Event{
+		Provider:       provider,
+		Type:           exportValue(row, "type"),
+		SaleID:         exportValue(row, "sale_id"),
+		Email:          exportValue(row, "email"),
+		ProductID:      exportValue(row, "product_id"),
+		Currency:       strings.ToLower(exportValue(row, "currency")),
+		CouponCode:     exportValue(row, "coupon"),
+		SubscriptionID: exportValue(row, "subscription_id"),
+	}
+
+	if event.SaleID == "" || event.Email == "" || event.ProductID == "" {
+		return nil, fmt.Errorf("%w: sale ID, email or product ID is empty", ErrMalformedExport)
+	}
+
+	switch event.Type {
+	case "":
+		event.Type = EventPurchase
+		if event.SubscriptionID != "" {
+			event.Type = EventSubscriptionStarted
+		}
+	case EventPurchase, EventSubscriptionStarted, EventRefund, EventDispute:
+	default:
+		return nil, fmt.Errorf("%w: unsupported type %q", ErrMalformedExport, event.Type)
+	}
+
+	price, err := parseExportPrice(exportValue(row, "price"))
+	if err != nil {
+		return nil, err
+	}
+	event.PriceMinor = price
+
+	var payload bytes.Buffer
+	if err := json.NewEncoder(&payload).Encode(row); err != nil {
+		return nil, err
+	}
+	event.Payload = strings.TrimSpace(payload.String())
+
+	return event, nil
+}
+
+// exportReversal returns the event type reversing the sale of row, or ""
+// if the sale stands.
+func exportReversal(row map[string]string) string {
+	if reversal := reversalStatuses[exportColumnName(exportValue(row, "status"))]; reversal != "" {
+		return reversal
+	}
+	if isTrue(exportValue(row, "disputed")) {
+		return EventDispute
+	}
+	if isTrue(exportValue(row, "refunded")) {
+		return EventRefund
+	}
+	return ""
+}
+
+// reversalEvent is the refund or dispute of sale, with the sale ID the
+// webhook of the reversal is recorded under.
+func reversalEvent(sale *Event, eventType string) *Event {
+	reversal := *sale
+	reversal.Type = eventType
+	reversal.OriginalSaleID = sale.SaleID
+	reversal.SaleID = eventType + ":" + sale.SaleID
+	return &reversal
+}
+
+func isTrue(value string) bool {
+	switch strings.ToLower(value) {
+	case "true", "yes", "1":
+		return true
+	}
+	return false
+}
+
+func parseExportPrice(value string) (int64, error) {
+	value = strings.NewReplacer(",", "", "$", "", "€", "", "£", "").Replace(value)
+
+	major, minor, hasDecimals := strings.Cut(value, ".")
+	if !hasDecimals {
+		price, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: invalid price %q", ErrMalformedExport, value)
+		}
+		return price, nil
+	}
+
+	if len(minor) > 2 {
+		return 0, fmt.Errorf("%w: invalid price %q", ErrMalformedExport, value)
+	}
+	minor += strings.Repeat("0", 2-len(minor))
+
+	price, err := strconv.ParseInt(major+minor, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid price %q", ErrMalformedExport, value)
+	}
+	return price, nil
+}
@@ -0,0 +1,118 @@
+package payment
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReadExportCSV(t *testing.T) {
+	export := "Sale ID,Purchase Email,Short Product ID,Price,Currency,Offer Code\n" +
+		"sale_1,buyer@example.com,abcde,9.00,USD,\n" +
+		"sale_2,other@example.com,abcde,7.5,EUR,LAUNCH\n"
+
+	events, err := ReadExport(ProviderGumroad, "csv", strings.NewReader(export))
+	if err != nil {
+		t.Fatalf("ReadExport: %v", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+
+	first := events[0]
+	if first.Provider != ProviderGumroad || first.Type != EventPurchase || first.SaleID != "sale_1" ||
+		first.Email != "buyer@example.com" || first.ProductID != "abcde" || first.PriceMinor != 900 || first.Currency != "usd" {
+		t.Errorf("first event = %+v", first)
+	}
+
+	second := events[1]
+	if second.PriceMinor != 750 || second.Currency != "eur" || second.CouponCode != "LAUNCH" {
+		t.Errorf("second event = %+v", second)
+	}
+}
+
+func TestReadExportJSON(t *testing.T) {
+	export := `[
+		{"id": "ch_1", "payment_intent": "pi_1", "customer_email": "buyer@example.com",
+		 "metadata_product_id": "price_1", "amount": 900, "currency": "usd"},
+		{"payment_intent": "pi_2", "customer_email": "sub@example.com",
+		 "metadata_product_id": "price_2", "amount": 1500, "currency": "usd", "subscription": "sub_1"}
+	]`
+
+	events, err := ReadExport(ProviderStripe, "json", strings.NewReader(export))
+	if err != nil {
+		t.Fatalf("ReadExport: %v", err)
+	}
+
+	if events[0].SaleID != "pi_1" || events[0].PriceMinor != 900 || events[0].Type != EventPurchase {
+		t.Errorf("first event = %+v", events[0])
+	}
+
+	if events[1].Type != EventSubscriptionStarted || events[1].SubscriptionID != "sub_1" {
+		t.Errorf("second event = %+v", events[1])
+	}
+}
+
+func TestReadExportRejectsIncompleteRows(t *testing.T) {
+	export := "sale_id,email,product_id,price\nsale_1,,abcde,900\n"
+
+	_, err := ReadExport(ProviderGumroad, "csv", strings.NewReader(export))
+	if !errors.Is(err, ErrMalformedExport) {
+		t.Fatalf("err = %v, want ErrMalformedExport", err)
+	}
+}
+
+func TestReadExportReversals(t *testing.T) {
+	export := "Sale ID,Purchase Email,Short Product ID,Price,Refunded?,Disputed?\n" +
+		"sale_1,a@example.com,abcde,900,false,false\n" +
+		"sale_2,b@example.com,abcde,900,true,false\n" +
+		"sale_3,c@example.com,abcde,900,false,true\n"
+
+	events, err := ReadExport(ProviderGumroad, "csv", strings.NewReader(export))
+	if err != nil {
+		t.Fatalf("ReadExport: %v", err)
+	}
+
+	want := []struct{ eventType, saleID, originalSaleID string }{
+		{EventPurchase, "sale_1", ""},
+		{EventPurchase, "sale_2", ""},
+		{EventRefund, "refund:sale_2", "sale_2"},
+		{EventPurchase, "sale_3", ""},
+		{EventDispute, "dispute:sale_3", "sale_3"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events), len(want))
+	}
+	for i, w := range want {
+		if e := events[i]; e.Type != w.eventType || e.SaleID != w.saleID || e.OriginalSaleID != w.originalSaleID {
+			t.Errorf("event %d = %s %s of %q, want %s %s of %q", i, e.Type, e.SaleID, e.OriginalSaleID, w.eventType, w.saleID, w.originalSaleID)
+		}
+	}
+}
+
+func TestReadExportReversalStatuses(t *testing.T) {
+	export := `[
+		{"payment_intent": "pi_1", "customer_email": "a@example.com", "metadata_product_id": "price_1", "amount": 900, "status": "Charged Back"},
+		{"payment_intent": "pi_2", "customer_email": "b@example.com", "metadata_product_id": "price_1", "amount": 900, "status": "Refunded"},
+		{"payment_intent": "pi_3", "customer_email": "c@example.com", "metadata_product_id": "price_1", "amount": 900, "status": "Succeeded"},
+		{"payment_intent": "pi_4", "customer_email": "d@example.com", "metadata_product_id": "price_1", "amount": 900, "type": "refund"}
+	]`
+
+	events, err := ReadExport(ProviderStripe, "json", strings.NewReader(export))
+	if err != nil {
+		t.Fatalf("ReadExport: %v", err)
+	}
+
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	want := []string{EventPurchase, EventDispute, EventPurchase, EventRefund, EventPurchase, EventRefund}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("types = %v, want %v", types, want)
+	}
+	if last := events[len(events)-1]; last.SaleID != "refund:pi_4" || last.OriginalSaleID != "pi_4" {
+		t.Errorf("refund row = %s of %s, want refund:pi_4 of pi_4", last.SaleID, last.OriginalSaleID)
+	}
+}
@@ -0,0 +1,178 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	ProviderGumroad = "gumroad"
+
+	GumroadSignatureHeader = "X-Webhook-Signature"
+	gumroadCheckoutURL     = "https://gumroad.com/l/"
+)
+
+type gumroad struct {
+	secret string
+}
+
+// NewGumroad returns the Gumroad provider. Gumroad pings can't be signed, so
+// secret is expected either in the "secret" query parameter of the ping URL
+// or as the HMAC-SHA256 key of the X-Webhook-Signature header when a relay
+// signs the body.
+func NewGumroad(secret string) Provider {
+	return &gumroad{secret: secret}
+}
+
+func (g *gumroad) Name() string {
+	return ProviderGumroad
+}
+
+func (g *gumroad) ParseWebhook(r *WebhookRequest) (*Event, error) {
+	if !g.verify(r) {
+		return nil, ErrInvalidSignature
+	}
+
+	form, err := url.ParseQuery(string(r.Body))
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, fmt.Errorf("%w: %v", ErrMalformedWebhook, err)
+	}
+
+	if form.Get("sale_id") == "" {
+		return g.parseSubscriptionPing(form, r.Body)
+	}
+
+	event := &Event{
+		Provider:  ProviderGumroad,
+		Type:      EventPurchase,
+		SaleID:    form.Get("sale_id"),
+		Email:     form.Get("email"),
+		ProductID: form.Get("short_product_id"),
+		Currency:  strings.ToLower(form.Get("currency")),
+		Payload:   string(r.Body),
+		// Gumroad offer codes double as our discount coupons.
+		CouponCode: form.Get("offer_code"),
+		// Query parameters of the checkout link come back as url_params.
+		AccountToken: form.Get("url_params[account]"),
+
+		SubscriptionID: form.Get("subscription_id"),
+	}
+
+	if event.SaleID == "" || event.Email == "" || event.ProductID == "" {
+		return nil, fmt.Errorf("%w: sale_id, email or short_product_id is empty", ErrMalformedWebhook)
+	}
+
+	event.PriceMinor, err = strconv.ParseInt(form.Get("price"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid price %q", ErrMalformedWebhook, form.Get("price"))
+	}
+
+	// Refund and dispute pings repeat the sale with a flag set. They get their
+	// own sale ID so that they are not deduplicated against the purchase.
+	switch {
+	case form.Get("refunded") == "true":
+		event.Type = EventRefund
+	case form.Get("disputed") == "true" && form.Get("dispute_won") == "true":
+		event.Type = EventDisputeWon
+	case form.Get("disputed") == "true":
+		event.Type = EventDispute
+	case event.SubscriptionID != "" && form.Get("is_recurring_charge") == "true":
+		event.Type = EventSubscriptionRenewed
+	case event.SubscriptionID != "":
+		event.Type = EventSubscriptionStarted
+	}
+	if event.Type == EventRefund || event.Type == EventDispute || event.Type == EventDisputeWon {
+		event.OriginalSaleID = event.SaleID
+		event.SaleID = event.Type + ":" + event.SaleID
+	}
+
+	return event, nil
+}
+
+// parseSubscriptionPing handles the cancellation and subscription_ended
+// resources, which describe a subscription rather than a sale.
+func (g *gumroad) parseSubscriptionPing(form url.Values, body []byte) (*Event, error) {
+	subscriptionID := form.Get("subscription_id")
+	if subscriptionID == "" {
+		return nil, fmt.Errorf("%w: neither sale_id nor subscription_id is set", ErrMalformedWebhook)
+	}
+
+	event := &Event{
+		Provider:       ProviderGumroad,
+		Email:          form.Get("user_email"),
+		ProductID:      form.Get("product_id"),
+		Payload:        string(body),
+		SubscriptionID: subscriptionID,
+	}
+
+	switch {
+	case form.Get("ended_reason") != "":
+		event.Type = EventSubscriptionCanceled
+		event.SaleID = "ended:" + subscriptionID
+	case form.Get("cancelled") == "true":
+		// Gumroad keeps access until the end of the paid period.
+		event.Type = EventSubscriptionUpdated
+		event.CancelAtPeriodEnd = true
+		event.SaleID = "cancellation:" + subscriptionID
+	default:
+		return nil, ErrIgnoredEvent
+	}
+
+	return event, nil
+}
+
+// CancelSubscription is not available: Gumroad subscribers cancel from their
+// Gumroad library and we learn about it through the cancellation ping.
+func (g *gumroad) CancelSubscription(ctx context.Context, subscriptionID string) error {
+	return ErrNotSupported
+}
+
+// CreateCheckout links to the Gumroad product page. Gumroad has no checkout
+// session API; the sale is reported later through the ping.
+func (g *gumroad) CreateCheckout(ctx context.Context, req *CheckoutRequest) (*CheckoutSession, error) {
+	params := url.Values{}
+	params.Set("wanted", "true")
+	if req.Email != "" {
+		params.Set("email", req.Email)
+	}
+	if req.AccountToken != "" {
+		params.Set("account", req.AccountToken)
+	}
+
+	path := url.PathEscape(req.Product.ProductID)
+	if req.CouponCode != "" {
+		path += "/" + url.PathEscape(req.CouponCode)
+	}
+
+	return &CheckoutSession{
+		URL: gumroadCheckoutURL + path + "?" + params.Encode(),
+	}, nil
+}
+
+func (g *gumroad) verify(r *WebhookRequest) bool {
+	if g.secret == "" {
+		slog.Error("gumroad webhook secret is not configured")
+		return false
+	}
+
+	if signature := r.Header.Get(GumroadSignatureHeader); signature != "" {
+		got, err := hex.DecodeString(signature)
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha256.New, []byte(g.secret))
+		mac.Write(r.Body)
+		return hmac.Equal(got, mac.Sum(nil))
+	}
+
+	return subtle.ConstantTimeCompare([]byte(r.Query.Get("secret")), []byte(g.secret)) == 1
+}
@@ -0,0 +1,123 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+const (
+	EventPurchase = "purchase"
+	EventRefund   = "refund"
+	EventDispute  = "dispute"
+	// EventDisputeWon closes a dispute in our favour; the sale stands again.
+	EventDisputeWon = "dispute_won"
+
+	EventSubscriptionStarted  = "subscription_started"
+	EventSubscriptionRenewed  = "subscription_renewed"
+	EventSubscriptionUpdated  = "subscription_updated"
+	EventSubscriptionPastDue  = "subscription_past_due"
+	EventSubscriptionCanceled = "subscription_canceled"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrMalformedWebhook = errors.New("malformed webhook payload")
+	// ErrIgnoredEvent is returned for well-formed, authentic events that carry
+	// nothing for us to act on. The delivery should still be acknowledged.
+	ErrIgnoredEvent    = errors.New("webhook event ignored")
+	ErrUnknownProvider = errors.New("unknown payment provider")
+	ErrNotSupported    = errors.New("not supported by payment provider")
+)
+
+// WebhookRequest is the part of an incoming HTTP request a provider needs to
+// authenticate and parse a webhook.
+type WebhookRequest struct {
+	Header http.Header
+	Query  url.Values
+	Body   []byte
+}
+
+// Event is a provider webhook normalized to what the payment service acts on.
+type Event struct {
+	Provider string
+	Type     string
+	// SaleID identifies the sale at the provider and is used to deduplicate
+	// deliveries.
+	SaleID string
+	// OriginalSaleID is the purchase a refund or dispute reverses.
+	OriginalSaleID string
+	Email          string
+	ProductID      string
+	PriceMinor     int64
+	// TaxMinor is the part of PriceMinor that is tax, when the provider
+	// collects it.
+	TaxMinor int64
+	Currency string
+	Payload  string
+	// CouponCode is the discount code applied at checkout, if any.
+	CouponCode string
+	// AccountToken is the CheckoutRequest.AccountToken the sale was started
+	// with, when the provider passes it back.
+	AccountToken string
+
+	// Subscription events carry the provider's subscription ID and, when the
+	// provider reports it, the paid period.
+	SubscriptionID    string
+	PeriodStart       time.Time
+	PeriodEnd         time.Time
+	CancelAtPeriodEnd bool
+	// SubscriptionStatus is the status an update reports, as one of the
+	// models.Subscription* statuses. Empty leaves the status as it is.
+	SubscriptionStatus string
+}
+
+type CheckoutRequest struct {
+	Product *models.Product
+	UserID  int64
+	Email   string
+	// CouponCode is a discount code to apply. The provider must know the
+	// code under the same name.
+	CouponCode string
+	// AccountToken identifies the signed-in user, so that the sale can be
+	// credited to them whatever email the buyer enters at checkout.
+	AccountToken string
+	SuccessURL   string
+	CancelURL    string
+}
+
+type CheckoutSession struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// Provider is a payment provider credits can be sold through. Products name
+// their provider, so several providers can be active at once.
+type Provider interface {
+	Name() string
+	// ParseWebhook authenticates r and maps it to an Event.
+	ParseWebhook(r *WebhookRequest) (*Event, error)
+	CreateCheckout(ctx context.Context, req *CheckoutRequest) (*CheckoutSession, error)
+	// CancelSubscription cancels a subscription at the end of its current
+	// period.
+	CancelSubscription(ctx context.Context, subscriptionID string) error
+}
+
+// Providers holds the configured providers by name.
+type Providers map[string]Provider
+
+func (p Providers) Register(provider Provider) {
+	p[provider.Name()] = provider
+}
+
+func (p Providers) Get(name string) (Provider, error) {
+	provider, ok := p[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
+}
@@ -0,0 +1,463 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+const (
+	ProviderStripe = "stripe"
+
+	StripeSignatureHeader = "Stripe-Signature"
+	StripeAPIURL          = "https://api.stripe.com"
+
+	// stripeTolerance is how old a signed webhook may be before it is
+	// rejected as a possible replay.
+	stripeTolerance = 5 * time.Minute
+)
+
+type stripe struct {
+	secretKey     string
+	webhookSecret string
+	apiURL        string
+	client        *http.Client
+	now           func() time.Time
+}
+
+// NewStripe returns the Stripe Checkout provider. Products sold through it use
+// the Stripe price ID as their product ID. apiURL is normally StripeAPIURL.
+func NewStripe(secretKey, webhookSecret, apiURL string) Provider {
+	return &stripe{
+		secretKey:     secretKey,
+		webhookSecret: webhookSecret,
+		apiURL:        strings.TrimRight(apiURL, "/"),
+		client:        &http.Client{Timeout: 30 * time.Second},
+		now:           time.Now,
+	}
+}
+
+func (s *stripe) Name() string {
+	return ProviderStripe
+}
+
+type stripeEvent struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+type stripeCheckoutSession struct {
+	ID              string `json:"id"`
+	URL             string `json:"url"`
+	Mode            string `json:"mode"`
+	PaymentIntent   string `json:"payment_intent"`
+	Subscription    string `json:"subscription"`
+	PaymentStatus   string `json:"payment_status"`
+	AmountTotal     int64  `json:"amount_total"`
+	Currency        string `json:"currency"`
+	CustomerEmail   string `json:"customer_email"`
+	CustomerDetails struct {
+		Email string `json:"email"`
+	} `json:"customer_details"`
+	TotalDetails struct {
+		AmountTax int64 `json:"amount_tax"`
+	} `json:"total_details"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+type stripeCharge struct {
+	ID            string `json:"id"`
+	PaymentIntent string `json:"payment_intent"`
+	Amount        int64  `json:"amount"`
+	Refunded      bool   `json:"refunded"`
+	Currency      string `json:"currency"`
+}
+
+type stripeDispute struct {
+	ID            string `json:"id"`
+	PaymentIntent string `json:"payment_intent"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency"`
+	Status        string `json:"status"`
+}
+
+type stripeInvoice struct {
+	ID            string `json:"id"`
+	Subscription  string `json:"subscription"`
+	PaymentIntent string `json:"payment_intent"`
+	AmountPaid    int64  `json:"amount_paid"`
+	Tax           int64  `json:"tax"`
+	Currency      string `json:"currency"`
+	Lines         struct {
+		Data []struct {
+			Period struct {
+				Start int64 `json:"start"`
+				End   int64 `json:"end"`
+			} `json:"period"`
+		} `json:"data"`
+	} `json:"lines"`
+}
+
+type stripeSubscription struct {
+	ID                 string `json:"id"`
+	Status             string `json:"status"`
+	CancelAtPeriodEnd  bool   `json:"cancel_at_period_end"`
+	CurrentPeriodStart int64  `json:"current_period_start"`
+	CurrentPeriodEnd   int64  `json:"current_period_end"`
+	Items              struct {
+		Data []struct {
+			Quantity int64 `json:"quantity"`
+			Price    struct {
+				UnitAmount int64  `json:"unit_amount"`
+				Currency   string `json:"currency"`
+			} `json:"price"`
+		} `json:"data"`
+	} `json:"items"`
+}
+
+func (s *stripe) ParseWebhook(r *WebhookRequest) (*Event, error) {
+	if err := s.verify(r.Header.Get(StripeSignatureHeader), r.Body); err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+
+	var e stripeEvent
+	if err := json.Unmarshal(r.Body, &e); err != nil {
+		slog.Info(err.Error())
+		return nil, fmt.Errorf("%w: %v", ErrMalformedWebhook, err)
+	}
+
+	switch e.Type {
+	case "checkout.session.completed", "checkout.session.async_payment_succeeded":
+		var session stripeCheckoutSession
+		if err := json.Unmarshal(e.Data.Object, &session); err != nil {
+			slog.Info(err.Error())
+			return nil, fmt.Errorf("%w: %v", ErrMalformedWebhook, err)
+		}
+
+		// Delayed payment methods complete the session before the money
+		// arrives; those are granted on async_payment_succeeded instead.
+		if session.PaymentStatus != "paid" {
+			return nil, ErrIgnoredEvent
+		}
+
+		email := session.CustomerDetails.Email
+		if email == "" {
+			email = session.CustomerEmail
+		}
+
+		if session.Mode == "subscription" {
+			return &Event{
+				Provider:       ProviderStripe,
+				Type:           EventSubscriptionStarted,
+				SaleID:         e.ID,
+				Email:          email,
+				ProductID:      session.Metadata["product_id"],
+				PriceMinor:     session.AmountTotal,
+				TaxMinor:       session.TotalDetails.AmountTax,
+				Currency:       strings.ToLower(session.Currency),
+				Payload:        string(r.Body),
+				CouponCode:     session.Metadata["coupon"],
+				AccountToken:   session.Metadata["account"],
+				SubscriptionID: session.Subscription,
+			}, nil
+		}
+
+		// Refunds and disputes refer to the payment intent, not the session,
+		// so the intent identifies the sale whenever there is one.
+		saleID := session.PaymentIntent
+		if saleID == "" {
+			saleID = session.ID
+		}
+
+		return &Event{
+			Provider:     ProviderStripe,
+			Type:         EventPurchase,
+			SaleID:       saleID,
+			Email:        email,
+			ProductID:    session.Metadata["product_id"],
+			PriceMinor:   session.AmountTotal,
+			TaxMinor:     session.TotalDetails.AmountTax,
+			Currency:     strings.ToLower(session.Currency),
+			Payload:      string(r.Body),
+			CouponCode:   session.Metadata["coupon"],
+			AccountToken: session.Metadata["account"],
+		}, nil
+
+	case "charge.refunded":
+		var charge stripeCharge
+		if err := json.Unmarshal(e.Data.Object, &charge); err != nil {
+			slog.Info(err.Error())
+			return nil, fmt.Errorf("%w: %v", ErrMalformedWebhook, err)
+		}
+
+		// Partial refunds are settled by support; only a full refund takes
+		// the pack back.
+		if !charge.Refunded || charge.PaymentIntent == "" {
+			return nil, ErrIgnoredEvent
+		}
+
+		return &Event{
+			Provider:       ProviderStripe,
+			Type:           EventRefund,
+			SaleID:         EventRefund + ":" + charge.ID,
+			OriginalSaleID: charge.PaymentIntent,
+			PriceMinor:     charge.Amount,
+			Currency:       strings.ToLower(charge.Currency),
+			Payload:        string(r.Body),
+		}, nil
+
+	case "charge.dispute.created", "charge.dispute.closed":
+		var dispute stripeDispute
+		if err := json.Unmarshal(e.Data.Object, &dispute); err != nil {
+			slog.Info(err.Error())
+			return nil, fmt.Errorf("%w: %v", ErrMalformedWebhook, err)
+		}
+
+		if dispute.PaymentIntent == "" {
+			return nil, ErrIgnoredEvent
+		}
+
+		// A lost dispute leaves the reversal in place. A won dispute, or an
+		// inquiry that closed without a chargeback, gives the sale back.
+		eventType := EventDispute
+		if e.Type == "charge.dispute.closed" {
+			if dispute.Status != "won" && dispute.Status != "warning_closed" {
+				return nil, ErrIgnoredEvent
+			}
+			eventType = EventDisputeWon
+		}
+
+		return &Event{
+			Provider:       ProviderStripe,
+			Type:           eventType,
+			SaleID:         eventType + ":" + dispute.ID,
+			OriginalSaleID: dispute.PaymentIntent,
+			PriceMinor:     dispute.Amount,
+			Currency:       strings.ToLower(dispute.Currency),
+			Payload:        string(r.Body),
+		}, nil
+
+	case "invoice.paid", "invoice.payment_failed":
+		var invoice stripeInvoice
+		if err := json.Unmarshal(e.Data.Object, &invoice); err != nil {
+			slog.Info(err.Error())
+			return nil, fmt.Errorf("%w: %v", ErrMalformedWebhook, err)
+		}
+
+		if invoice.Subscription == "" {
+			return nil, ErrIgnoredEvent
+		}
+
+		event := &Event{
+			Provider:       ProviderStripe,
+			Type:           EventSubscriptionRenewed,
+			SaleID:         e.ID,
+			Payload:        string(r.Body),
+			SubscriptionID: invoice.Subscription,
+		}
+		if e.Type == "invoice.payment_failed" {
+			event.Type = EventSubscriptionPastDue
+			return event, nil
+		}
+
+		// Refunds and disputes of the payment refer to its payment intent.
+		if invoice.PaymentIntent != "" {
+			event.SaleID = invoice.PaymentIntent
+		}
+		event.PriceMinor = invoice.AmountPaid
+		event.TaxMinor = invoice.Tax
+		event.Currency = strings.ToLower(invoice.Currency)
+		if len(invoice.Lines.Data) > 0 {
+			period := invoice.Lines.Data[0].Period
+			event.PeriodStart = time.Unix(period.Start, 0)
+			event.PeriodEnd = time.Unix(period.End, 0)
+		}
+		return event, nil
+
+	case "customer.subscription.updated", "customer.subscription.deleted":
+		var sub stripeSubscription
+		if err := json.Unmarshal(e.Data.Object, &sub); err != nil {
+			slog.Info(err.Error())
+			return nil, fmt.Errorf("%w: %v", ErrMalformedWebhook, err)
+		}
+
+		event := &Event{
+			Provider:          ProviderStripe,
+			Type:              EventSubscriptionUpdated,
+			SaleID:            e.ID,
+			Payload:           string(r.Body),
+			SubscriptionID:    sub.ID,
+			PeriodStart:       time.Unix(sub.CurrentPeriodStart, 0),
+			PeriodEnd:         time.Unix(sub.CurrentPeriodEnd, 0),
+			CancelAtPeriodEnd: sub.CancelAtPeriodEnd,
+		}
+		if e.Type == "customer.subscription.deleted" {
+			event.Type = EventSubscriptionCanceled
+			return event, nil
+		}
+
+		// The price of the plan, which is checked before the new period is
+		// granted.
+		if len(sub.Items.Data) > 0 {
+			item := sub.Items.Data[0]
+			event.PriceMinor = item.Price.UnitAmount * max(item.Quantity, 1)
+			event.Currency = strings.ToLower(item.Price.Currency)
+		}
+
+		switch sub.Status {
+		case "active", "trialing":
+			event.SubscriptionStatus = models.SubscriptionActive
+		case "past_due", "unpaid":
+			event.Type = EventSubscriptionPastDue
+		case "canceled", "incomplete_expired":
+			event.Type = EventSubscriptionCanceled
+		default:
+			// incomplete, paused and any status Stripe adds later.
+			event.SubscriptionStatus = models.SubscriptionInactive
+		}
+		return event, nil
+	}
+
+	return nil, ErrIgnoredEvent
+}
+
+// verify checks a Stripe-Signature header of the form "t=<unix>,v1=<hex>".
+// Stripe may send several v1 signatures while a webhook secret is rolled.
+func (s *stripe) verify(header string, body []byte) error {
+	if s.webhookSecret == "" {
+		return fmt.Errorf("%w: stripe webhook secret is not configured", ErrInvalidSignature)
+	}
+
+	var timestamp string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			if sig, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return fmt.Errorf("%w: malformed %s header", ErrInvalidSignature, StripeSignatureHeader)
+	}
+
+	if age := s.now().Sub(time.Unix(unix, 0)); age > stripeTolerance || age < -stripeTolerance {
+		return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidSignature)
+	}
+
+	expected := StripeSignature(s.webhookSecret, timestamp, body)
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// StripeSignature computes the v1 signature Stripe sends for body at
+// timestamp.
+func StripeSignature(secret, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+func (s *stripe) CreateCheckout(ctx context.Context, req *CheckoutRequest) (*CheckoutSession, error) {
+	form := url.Values{}
+	form.Set("mode", "payment")
+	if req.Product.IsSubscription() {
+		form.Set("mode", "subscription")
+	}
+	form.Set("line_items[0][price]", req.Product.ProductID)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("success_url", req.SuccessURL)
+	form.Set("cancel_url", req.CancelURL)
+	form.Set("client_reference_id", strconv.FormatInt(req.UserID, 10))
+	form.Set("metadata[product_id]", req.Product.ProductID)
+	if req.Email != "" {
+		form.Set("customer_email", req.Email)
+	}
+	if req.AccountToken != "" {
+		form.Set("metadata[account]", req.AccountToken)
+	}
+	if req.CouponCode != "" {
+		form.Set("discounts[0][coupon]", req.CouponCode)
+		form.Set("metadata[coupon]", req.CouponCode)
+	}
+
+	var session stripeCheckoutSession
+	if err := s.post(ctx, "/v1/checkout/sessions", form, &session); err != nil {
+		return nil, err
+	}
+
+	return &CheckoutSession{ID: session.ID, URL: session.URL}, nil
+}
+
+func (s *stripe) CancelSubscription(ctx context.Context, subscriptionID string) error {
+	form := url.Values{}
+	form.Set("cancel_at_period_end", "true")
+
+	var sub stripeSubscription
+	return s.post(ctx, "/v1/subscriptions/"+url.PathEscape(subscriptionID), form, &sub)
+}
+
+func (s *stripe) post(ctx context.Context, path string, form url.Values, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.apiURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.secretKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		err = fmt.Errorf("stripe %s returned status %d: %s", path, resp.StatusCode, apiErr.Error.Message)
+		slog.Info(err.Error())
+		return err
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+package payment
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+const testStripeWebhookSecret = "whsec_test"
+
+var testNow = time.Date(2024, 11, 20, 14, 5, 12, 0, time.UTC)
+
+const checkoutCompleted = `{
+  "id": "evt_1QNf8kLkdIwHu7ixbYz2Jm3A",
+  "object": "event",
+  "type": "checkout.session.completed",
+  "data": {
+    "object": {
+      "id": "cs_test_a1b2c3",
+      "object": "checkout.session",
+      "mode": "payment",
+      "payment_status": "paid",
+      "payment_intent": "pi_3QNf8jLkdIwHu7ix0x1YzAbc",
+      "amount_total": 900,
+      "currency": "usd",
+      "client_reference_id": "42",
+      "customer_email": null,
+      "customer_details": {"email": "buyer@example.com"},
+      "metadata": {"product_id": "price_1QNf7cLkdIwHu7ix"}
+    }
+  }
+}`
+
+func newTestStripe(apiURL string) *stripe {
+	s := NewStripe("sk_test_123", testStripeWebhookSecret, apiURL).(*stripe)
+	s.now = func() time.Time { return testNow }
+	return s
+}
+
+func stripeRequest(body string, signedAt time.Time, secret string) *WebhookRequest {
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	sig := hex.EncodeToString(StripeSignature(secret, timestamp, []byte(body)))
+
+	header := http.Header{}
+	header.Set(StripeSignatureHeader, "t="+timestamp+",v1="+sig)
+	return &WebhookRequest{Header: header, Body: []byte(body)}
+}
+
+func TestStripeParseCheckoutCompleted(t *testing.T) {
+	s := newTestStripe(StripeAPIURL)
+
+	event, err := s.ParseWebhook(stripeRequest(checkoutCompleted, testNow, testStripeWebhookSecret))
+	if err != nil {
+		t.Fatalf("ParseWebhook: %v", err)
+	}
+
+	want := Event{
+		Provider:   ProviderStripe,
+		Type:       EventPurchase,
+		SaleID:     "pi_3QNf8jLkdIwHu7ix0x1YzAbc",
+		Email:      "buyer@example.com",
+		ProductID:  "price_1QNf7cLkdIwHu7ix",
+		PriceMinor: 900,
+		Currency:   "usd",
+		Payload:    checkoutCompleted,
+	}
+	if *event != want {
+		t.Errorf("event = %+v, want %+v", *event, want)
+	}
+}
+
+func TestStripeRejectsBadSignatures(t *testing.T) {
+	s := newTestStripe(StripeAPIURL)
+
+	tests := []struct {
+		name string
+		req  *WebhookRequest
+	}{
+		{"wrong secret", stripeRequest(checkoutCompleted, testNow, "whsec_other")},
+		{"too old", stripeRequest(checkoutCompleted, testNow.Add(-10*time.Minute), testStripeWebhookSecret)},
+		{"missing header", &WebhookRequest{Header: http.Header{}, Body: []byte(checkoutCompleted)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.ParseWebhook(tt.req); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("err = %v, want %v", err, ErrInvalidSignature)
+			}
+		})
+	}
+
+	tampered := stripeRequest(checkoutCompleted, testNow, testStripeWebhookSecret)
+	tampered.Body = []byte(`{"type":"checkout.session.completed"}`)
+	if _, err := s.ParseWebhook(tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered body: err = %v, want %v", err, ErrInvalidSignature)
+	}
+}
+
+func TestStripeIgnoresOtherEvents(t *testing.T) {
+	s := newTestStripe(StripeAPIURL)
+
+	body := `{"id":"evt_2","type":"customer.created","data":{"object":{}}}`
+	if _, err := s.ParseWebhook(stripeRequest(body, testNow, testStripeWebhookSecret)); !errors.Is(err, ErrIgnoredEvent) {
+		t.Errorf("err = %v, want %v", err, ErrIgnoredEvent)
+	}
+}
+
+func TestStripeParseDisputeEvents(t *testing.T) {
+	s := newTestStripe(StripeAPIURL)
+
+	dispute := func(eventType, status string) string {
+		return `{"id":"evt_dp","type":"` + eventType + `","data":{"object":{"id":"dp_1","payment_intent":"pi_1","amount":900,"currency":"USD","status":"` + status + `"}}}`
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"opened", dispute("charge.dispute.created", "needs_response"), EventDispute},
+		{"won", dispute("charge.dispute.closed", "won"), EventDisputeWon},
+		{"inquiry closed", dispute("charge.dispute.closed", "warning_closed"), EventDisputeWon},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := s.ParseWebhook(stripeRequest(tt.body, testNow, testStripeWebhookSecret))
+			if err != nil {
+				t.Fatalf("ParseWebhook: %v", err)
+			}
+
+			want := Event{
+				Provider:       ProviderStripe,
+				Type:           tt.want,
+				SaleID:         tt.want + ":dp_1",
+				OriginalSaleID: "pi_1",
+				PriceMinor:     900,
+				Currency:       "usd",
+				Payload:        tt.body,
+			}
+			if *event != want {
+				t.Errorf("event = %+v, want %+v", *event, want)
+			}
+		})
+	}
+
+	lost := dispute("charge.dispute.closed", "lost")
+	if _, err := s.ParseWebhook(stripeRequest(lost, testNow, testStripeWebhookSecret)); !errors.Is(err, ErrIgnoredEvent) {
+		t.Errorf("lost dispute: err = %v, want %v", err, ErrIgnoredEvent)
+	}
+}
+
+func TestStripeCreateCheckout(t *testing.T) {
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/checkout/sessions" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer sk_test_123" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]any{"error": map[string]string{"message": "bad key " + got}})
+			return
+		}
+
+		r.ParseForm()
+		expected := map[string]string{
+			"mode":                    "payment",
+			"line_items[0][price]":    "price_1QNf7cLkdIwHu7ix",
+			"line_items[0][quantity]": "1",
+			"client_reference_id":     "42",
+			"customer_email":          "buyer@example.com",
+			"metadata[product_id]":    "price_1QNf7cLkdIwHu7ix",
+			"success_url":             "https://app.example.com/ok",
+			"cancel_url":              "https://app.example.com/cancel",
+		}
+		for key, want := range expected {
+			if got := r.PostForm.Get(key); got != want {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]any{"error": map[string]string{"message": key + " = " + got}})
+				return
+			}
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"id":  "cs_test_a1b2c3",
+			"url": "https://checkout.stripe.com/c/pay/cs_test_a1b2c3",
+		})
+	}))
+	defer stub.Close()
+
+	s := newTestStripe(stub.URL)
+	session, err := s.CreateCheckout(context.Background(), &CheckoutRequest{
+		Product:    &models.Product{Provider: ProviderStripe, ProductID: "price_1QNf7cLkdIwHu7ix", PriceMinor: 900},
+		UserID:     42,
+		Email:      "buyer@example.com",
+		SuccessURL: "https://app.example.com/ok",
+		CancelURL:  "https://app.example.com/cancel",
+	})
+	if err != nil {
+		t.Fatalf("CreateCheckout: %v", err)
+	}
+
+	if session.ID != "cs_test_a1b2c3" || session.URL != "https://checkout.stripe.com/c/pay/cs_test_a1b2c3" {
+		t.Errorf("session = %+v", session)
+	}
+}
+
+func TestStripeCreateCheckoutAPIError(t *testing.T) {
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"No such price"}}`))
+	}))
+	defer stub.Close()
+
+	s := newTestStripe(stub.URL)
+	_, err := s.CreateCheckout(context.Background(), &CheckoutRequest{
+		Product: &models.Product{Provider: ProviderStripe, ProductID: "price_missing"},
+	})
+	if err == nil {
+		t.Fatal("CreateCheckout succeeded against a failing API")
+	}
+}
+
+func TestStripeParseSubscriptionEvents(t *testing.T) {
+	s := newTestStripe(StripeAPIURL)
+
+	tests := []struct {
+		name string
+		body string
+		want Event
+	}{
+		{
+			name: "checkout",
+			body: `{"id":"evt_sub_1","type":"checkout.session.completed","data":{"object":{"id":"cs_sub","mode":"subscription","payment_status":"paid","subscription":"sub_1","amount_total":1900,"currency":"usd","customer_details":{"email":"pro@example.com"},"metadata":{"product_id":"price_pro"}}}}`,
+			want: Event{Type: EventSubscriptionStarted, SaleID: "evt_sub_1", SubscriptionID: "sub_1", Email: "pro@example.com", ProductID: "price_pro", PriceMinor: 1900, Currency: "usd"},
+		},
+		{
+			name: "renewal",
+			body: `{"id":"evt_sub_2","type":"invoice.paid","data":{"object":{"id":"in_1","subscription":"sub_1","lines":{"data":[{"period":{"start":1732111512,"end":1734703512}}]}}}}`,
+			want: Event{Type: EventSubscriptionRenewed, SaleID: "evt_sub_2", SubscriptionID: "sub_1", PeriodStart: time.Unix(1732111512, 0), PeriodEnd: time.Unix(1734703512, 0)},
+		},
+		{
+			name: "renewal with payment intent",
+			body: `{"id":"evt_sub_5","type":"invoice.paid","data":{"object":{"id":"in_3","subscription":"sub_1","payment_intent":"pi_sub_1","amount_paid":1900,"tax":300,"currency":"EUR","lines":{"data":[{"period":{"start":1732111512,"end":1734703512}}]}}}}`,
+			want: Event{Type: EventSubscriptionRenewed, SaleID: "pi_sub_1", SubscriptionID: "sub_1", PriceMinor: 1900, TaxMinor: 300, Currency: "eur", PeriodStart: time.Unix(1732111512, 0), PeriodEnd: time.Unix(1734703512, 0)},
+		},
+		{
+			name: "payment failed",
+			body: `{"id":"evt_sub_3","type":"invoice.payment_failed","data":{"object":{"id":"in_2","subscription":"sub_1"}}}`,
+			want: Event{Type: EventSubscriptionPastDue, SaleID: "evt_sub_3", SubscriptionID: "sub_1"},
+		},
+		{
+			name: "updated",
+			body: `{"id":"evt_sub_6","type":"customer.subscription.updated","data":{"object":{"id":"sub_1","status":"active","current_period_start":1732111512,"current_period_end":1734703512,"items":{"data":[{"quantity":2,"price":{"unit_amount":950,"currency":"USD"}}]}}}}`,
+			want: Event{Type: EventSubscriptionUpdated, SaleID: "evt_sub_6", SubscriptionID: "sub_1", SubscriptionStatus: models.SubscriptionActive, PriceMinor: 1900, Currency: "usd", PeriodStart: time.Unix(1732111512, 0), PeriodEnd: time.Unix(1734703512, 0)},
+		},
+		{
+			name: "deleted",
+			body: `{"id":"evt_sub_4","type":"customer.subscription.deleted","data":{"object":{"id":"sub_1","status":"canceled","current_period_start":1732111512,"current_period_end":1734703512}}}`,
+			want: Event{Type: EventSubscriptionCanceled, SaleID: "evt_sub_4", SubscriptionID: "sub_1", PeriodStart: time.Unix(1732111512, 0), PeriodEnd: time.Unix(1734703512, 0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := s.ParseWebhook(stripeRequest(tt.body, testNow, testStripeWebhookSecret))
+			if err != nil {
+				t.Fatalf("ParseWebhook: %v", err)
+			}
+
+			tt.want.Provider = ProviderStripe
+			tt.want.Payload = tt.body
+			if *event != tt.want {
+				t.Errorf("event = %+v, want %+v", *event, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripeParseSubscriptionStatuses(t *testing.T) {
+	s := newTestStripe(StripeAPIURL)
+
+	tests := []struct {
+		status     string
+		wantType   string
+		wantStatus string
+	}{
+		{"active", EventSubscriptionUpdated, models.SubscriptionActive},
+		{"trialing", EventSubscriptionUpdated, models.SubscriptionActive},
+		{"past_due", EventSubscriptionPastDue, ""},
+		{"unpaid", EventSubscriptionPastDue, ""},
+		{"canceled", EventSubscriptionCanceled, ""},
+		{"incomplete_expired", EventSubscriptionCanceled, ""},
+		{"incomplete", EventSubscriptionUpdated, models.SubscriptionInactive},
+		{"paused", EventSubscriptionUpdated, models.SubscriptionInactive},
+		{"some_new_status", EventSubscriptionUpdated, models.SubscriptionInactive},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			body := `{"id":"evt_upd","type":"customer.subscription.updated","data":{"object":{"id":"sub_1","status":"` + tt.status + `","current_period_start":1732111512,"current_period_end":1734703512}}}`
+			event, err := s.ParseWebhook(stripeRequest(body, testNow, testStripeWebhookSecret))
+			if err != nil {
+				t.Fatalf("ParseWebhook: %v", err)
+			}
+
+			if event.Type != tt.wantType || event.SubscriptionStatus != tt.wantStatus {
+				t.Errorf("type, status = %q, %q, want %q, %q", event.Type, event.SubscriptionStatus, tt.wantType, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/lib/pq"
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, k *models.APIKey) error
+	// GetByHash returns the unrevoked key with the hash.
+	GetByHash(ctx context.Context, keyHash string) (*models.APIKey, bool, error)
+	// ListActive returns the user's unrevoked keys, newest first.
+	ListActive(ctx context.Context, userID int64) ([]*models.APIKey, error)
+	// Revoke revokes one of the user's keys. It reports whether an unrevoked
+	// key was revoked.
+	Revoke(ctx context.Context, userID, id int64) (bool, error)
+	// RecordUse counts a request made with the key.
+	RecordUse(ctx context.Context, id int64, ip string) error
+}
+
+type apiKeyRepository struct {
+	db *sql.DB
+}
+
+func NewAPIKeyRepository(db *sql.DB) APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, scopes, usage_count, last_used_at, last_used_ip, created_at, revoked_at`
+
+func scanAPIKey(row interface{ Scan(...any) error }, k *models.APIKey) error {
+	return row.Scan(
+		&k.ID,
+		&k.UserID,
+		&k.Name,
+		&k.Prefix,
+		&k.KeyHash,
+		pq.Array(&k.Scopes),
+		&k.UsageCount,
+		&k.LastUsedAt,
+		&k.LastUsedIP,
+		&k.CreatedAt,
+		&k.RevokedAt,
+	)
+}
+
+func (r *apiKeyRepository) Create(ctx context.Context, k *models.APIKey) error {
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + apiKeyColumns
+	err := scanAPIKey(r.db.QueryRowContext(ctx, query, k.UserID, k.Name, k.Prefix, k.KeyHash, pq.Array(k.Scopes)), k)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *apiKeyRepository) GetByHash(ctx context.Context, keyHash string) (*models.APIKey, bool, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL`
+
+	var k models.APIKey
+	err := scanAPIKey(r.db.QueryRowContext(ctx, query, keyHash), &k)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &k, true, nil
+}
+
+func (r *apiKeyRepository) ListActive(ctx context.Context, userID int64) ([]*models.APIKey, error) {
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*models.APIKey
+	for rows.Next() {
+		var k models.APIKey
+		if err := scanAPIKey(rows, &k); err != nil {
+			slog.Info(err.Error())
+			return nil, err
+		}
+		keys = append(keys, &k)
+	}
+	return keys, rows.Err()
+}
+
+func (r *apiKeyRepository) Revoke(ctx context.Context, userID, id int64) (bool, error) {
+	query := `UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *apiKeyRepository) RecordUse(ctx context.Context, id int64, ip string) error {
+	query := `UPDATE api_keys SET usage_count = usage_count + 1, last_used_at = now(), last_used_ip = $2 WHERE id = $1`
+	if _, err := r.db.ExecContext(ctx, query, id, ip); err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
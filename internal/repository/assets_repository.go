@@ -52,7 +52,7 @@ func (r *mediaAssetRepository) Create(ctx context.Context, ma *models.MediaAsset
 
 func (r *mediaAssetRepository) GetByID(ctx context.Context, id int64) (*models.MediaAsset, error) {
 	query := `
-		SELECT id, user_id, post_id, asset_url, created_at, updated_at
+		SELECT id, user_id, file_name, file_type, file_url, created_at
 		FROM media_assets
 		WHERE id = $1
 	`
@@ -64,7 +64,6 @@ func (r *mediaAssetRepository) GetByID(ctx context.Context, id int64) (*models.M
 		&ma.FileName,
 		&ma.FileType,
 		&ma.FileURL,
-		&ma.ThumbnailURL,
 		&ma.CreatedAt,
 	)
 	if err != nil {
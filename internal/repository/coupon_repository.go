@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strconv"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+type CouponRepository interface {
+	Create(ctx context.Context, c *models.Coupon) error
+	GetByCode(ctx context.Context, code string) (*models.Coupon, bool, error)
+	List(ctx context.Context, campaign string) ([]*models.Coupon, error)
+	HasRedeemed(ctx context.Context, couponID, userID int64) (bool, error)
+	Redeem(ctx context.Context, couponID, userID int64, t *models.CreditTransaction) (*models.CouponRedemption, error)
+}
+
+type couponRepository struct {
+	db *sql.DB
+}
+
+func NewCouponRepository(db *sql.DB) CouponRepository {
+	return &couponRepository{db: db}
+}
+
+const couponColumns = `id, code, credits, discount_percent, max_redemptions, redemptions, starts_at, expires_at, campaign, created_at`
+
+func scanCoupon(row interface{ Scan(...any) error }, c *models.Coupon) error {
+	return row.Scan(
+		&c.ID,
+		&c.Code,
+		&c.Credits,
+		&c.DiscountPercent,
+		&c.MaxRedemptions,
+		&c.Redemptions,
+		&c.StartsAt,
+		&c.ExpiresAt,
+		&c.Campaign,
+		&c.CreatedAt,
+	)
+}
+
+func (r *couponRepository) Create(ctx context.Context, c *models.Coupon) error {
+	query := `
+		INSERT INTO coupons (code, credits, discount_percent, max_redemptions, starts_at, expires_at, campaign)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING ` + couponColumns
+
+	err := scanCoupon(r.db.QueryRowContext(ctx, query,
+		c.Code,
+		c.Credits,
+		c.DiscountPercent,
+		c.MaxRedemptions,
+		c.StartsAt,
+		c.ExpiresAt,
+		c.Campaign,
+	), c)
+	if err != nil {
+		if isUniqueViolation(err) {
+			slog.Info(ErrDuplicateCoupon.Error(), "code", c.Code)
+			return ErrDuplicateCoupon
+		}
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *couponRepository) GetByCode(ctx context.Context, code string) (*models.Coupon, bool, error) {
+	query := `SELECT ` + couponColumns + ` FROM coupons WHERE code = $1`
+
+	var c models.Coupon
+	err := scanCoupon(r.db.QueryRowContext(ctx, query, code), &c)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &c, true, nil
+}
+
+// List returns coupons newest first. An empty campaign lists all of them.
+func (r *couponRepository) List(ctx context.Context, campaign string) ([]*models.Coupon, error) {
+	query := `
+		SELECT ` + couponColumns + `
+		FROM coupons
+		WHERE $1 = '' OR campaign = $1
+		ORDER BY id DESC
+	`
+	rows, err := r.db.QueryContext(ctx, query, campaign)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var coupons []*models.Coupon
+	for rows.Next() {
+		var c models.Coupon
+		if err := scanCoupon(rows, &c); err != nil {
+			slog.Info(err.Error())
+			return nil, err
+		}
+		coupons = append(coupons, &c)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	return coupons, nil
+}
+
+func (r *couponRepository) HasRedeemed(ctx context.Context, couponID, userID int64) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM coupon_redemptions WHERE coupon_id = $1 AND user_id = $2)`
+	var exists bool
+	err := r.db.QueryRowContext(ctx, query, couponID, userID).Scan(&exists)
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+	return exists, nil
+}
+
+// Redeem records that userID used the coupon and, when t is not nil, applies
+// t to the user's balance in the same transaction, referencing the
+// redemption. The redemption count and validity window are checked in the
+// update itself so concurrent redemptions cannot exceed the limit.
+func (r *couponRepository) Redeem(ctx context.Context, couponID, userID int64, t *models.CreditTransaction) (*models.CouponRedemption, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE coupons
+		SET redemptions = redemptions + 1
+		WHERE id = $1
+			AND (max_redemptions = 0 OR redemptions < max_redemptions)
+			AND (starts_at IS NULL OR starts_at <= now())
+			AND (expires_at IS NULL OR expires_at > now())
+	`
+	result, err := tx.ExecContext(ctx, query, couponID)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		slog.Info(ErrCouponUnavailable.Error(), "couponID", couponID)
+		return nil, ErrCouponUnavailable
+	}
+
+	redemption := models.CouponRedemption{CouponID: couponID, UserID: userID}
+	query = `INSERT INTO coupon_redemptions (coupon_id, user_id) VALUES ($1, $2) RETURNING id, created_at`
+	err = tx.QueryRowContext(ctx, query, couponID, userID).Scan(&redemption.ID, &redemption.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			slog.Info(ErrCouponAlreadyRedeemed.Error(), "couponID", couponID, "userID", userID)
+			return nil, ErrCouponAlreadyRedeemed
+		}
+		slog.Info(err.Error())
+		return nil, err
+	}
+
+	if t != nil {
+		t.UserID = userID
+		t.ReferenceType = "coupon_redemption"
+		t.ReferenceID = strconv.FormatInt(redemption.ID, 10)
+		if err := applyCreditTransaction(ctx, tx, t); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	return &redemption, nil
+}
@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strconv"
+
+	"github.com/lib/pq"
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+type CreditTransferRepository interface {
+	Create(ctx context.Context, t *models.CreditTransfer, dailyLimit int, out, in *models.CreditTransaction) error
+	RedeemGift(ctx context.Context, code string, recipientID int64, in *models.CreditTransaction) (*models.CreditTransfer, error)
+	ListGifts(ctx context.Context, senderID int64) ([]*models.CreditTransfer, error)
+}
+
+type creditTransferRepository struct {
+	db *sql.DB
+}
+
+func NewCreditTransferRepository(db *sql.DB) CreditTransferRepository {
+	return &creditTransferRepository{db: db}
+}
+
+const creditTransferColumns = `id, sender_id, recipient_id, amount, gift_code, note, expires_at, redeemed_at, created_at`
+
+func scanCreditTransfer(row interface{ Scan(...any) error }, t *models.CreditTransfer) error {
+	return row.Scan(
+		&t.ID,
+		&t.SenderID,
+		&t.RecipientID,
+		&t.Amount,
+		&t.GiftCode,
+		&t.Note,
+		&t.ExpiresAt,
+		&t.RedeemedAt,
+		&t.CreatedAt,
+	)
+}
+
+// Create records a transfer and debits the sender with out. For a direct
+// transfer in credits the recipient in the same transaction; gifts pass a nil
+// in and are credited on redemption. Senders can make at most dailyLimit
+// transfers and gifts in 24 hours.
+func (r *creditTransferRepository) Create(ctx context.Context, t *models.CreditTransfer, dailyLimit int, out, in *models.CreditTransaction) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locking both balances in a fixed order keeps opposite transfers between
+	// the same two users from deadlocking, and serializes the limit check.
+	userIDs := []int64{t.SenderID}
+	if t.RecipientID != nil {
+		userIDs = append(userIDs, *t.RecipientID)
+	}
+	query := `SELECT user_id FROM credits WHERE user_id = ANY($1) ORDER BY user_id FOR UPDATE`
+	rows, err := tx.QueryContext(ctx, query, pq.Array(userIDs))
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	rows.Close()
+
+	var count int
+	query = `SELECT count(*) FROM credit_transfers WHERE sender_id = $1 AND created_at > now() - interval '1 day'`
+	if err := tx.QueryRowContext(ctx, query, t.SenderID).Scan(&count); err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	if count >= dailyLimit {
+		slog.Info(ErrTransferLimit.Error(), "userID", t.SenderID, "transfers", count)
+		return ErrTransferLimit
+	}
+
+	// Promotional credits keep their expiry when they change hands.
+	t.Parts, err = transferParts(ctx, tx, t.SenderID, t.Amount)
+	if err != nil {
+		return err
+	}
+	t.ExpiresAt = t.Parts[0].ExpiresAt
+
+	query = `
+		INSERT INTO credit_transfers (sender_id, recipient_id, amount, gift_code, note, expires_at, redeemed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, CASE WHEN $2::bigint IS NULL THEN NULL ELSE now() END)
+		RETURNING ` + creditTransferColumns
+	err = scanCreditTransfer(tx.QueryRowContext(ctx, query, t.SenderID, t.RecipientID, t.Amount, t.GiftCode, t.Note, t.ExpiresAt), t)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+
+	query = `INSERT INTO credit_transfer_parts (transfer_id, amount, expires_at) VALUES ($1, $2, $3)`
+	for _, part := range t.Parts {
+		if _, err := tx.ExecContext(ctx, query, t.ID, part.Amount, part.ExpiresAt); err != nil {
+			slog.Info(err.Error())
+			return err
+		}
+	}
+
+	reference := strconv.FormatInt(t.ID, 10)
+
+	out.UserID = t.SenderID
+	out.Amount = -t.Amount
+	out.ReferenceType = "credit_transfer"
+	out.ReferenceID = reference
+	if err := applyCreditTransaction(ctx, tx, out); err != nil {
+		return err
+	}
+
+	if in != nil {
+		if err := applyTransferCredit(ctx, tx, t, *t.RecipientID, in); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+// RedeemGift assigns an unredeemed gift to the recipient and credits them
+// with in. Senders can't redeem their own gifts.
+func (r *creditTransferRepository) RedeemGift(ctx context.Context, code string, recipientID int64, in *models.CreditTransaction) (*models.CreditTransfer, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE credit_transfers
+		SET recipient_id = $2, redeemed_at = now()
+		WHERE gift_code = $1 AND redeemed_at IS NULL AND sender_id <> $2
+		RETURNING ` + creditTransferColumns
+
+	var t models.CreditTransfer
+	err = scanCreditTransfer(tx.QueryRowContext(ctx, query, code, recipientID), &t)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			slog.Info(ErrGiftNotAvailable.Error(), "userID", recipientID)
+			return nil, ErrGiftNotAvailable
+		}
+		slog.Info(err.Error())
+		return nil, err
+	}
+
+	query = `
+		SELECT amount, expires_at FROM credit_transfer_parts
+		WHERE transfer_id = $1
+		ORDER BY expires_at NULLS LAST, id
+	`
+	rows, err := tx.QueryContext(ctx, query, t.ID)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	for rows.Next() {
+		var part models.CreditPart
+		if err := rows.Scan(&part.Amount, &part.ExpiresAt); err != nil {
+			rows.Close()
+			slog.Info(err.Error())
+			return nil, err
+		}
+		t.Parts = append(t.Parts, part)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+
+	if err := applyTransferCredit(ctx, tx, &t, recipientID, in); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *creditTransferRepository) ListGifts(ctx context.Context, senderID int64) ([]*models.CreditTransfer, error) {
+	query := `
+		SELECT ` + creditTransferColumns + `
+		FROM credit_transfers
+		WHERE sender_id = $1 AND gift_code IS NOT NULL
+		ORDER BY id DESC
+	`
+	rows, err := r.db.QueryContext(ctx, query, senderID)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var gifts []*models.CreditTransfer
+	for rows.Next() {
+		var t models.CreditTransfer
+		if err := scanCreditTransfer(rows, &t); err != nil {
+			slog.Info(err.Error())
+			return nil, err
+		}
+		gifts = append(gifts, &t)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	return gifts, nil
+}
+
+// transferParts splits a transfer of amount credits by the expiry of the
+// sender's buckets it draws from. Debits draw from the soonest-expiring
+// buckets first, so these are the buckets the transfer will empty.
+func transferParts(ctx context.Context, q querier, senderID, amount int64) ([]models.CreditPart, error) {
+	query := `
+		SELECT expires_at, sum(LEAST(remaining, $2 - before))::bigint
+		FROM (
+			SELECT expires_at, remaining,
+				sum(remaining) OVER (ORDER BY expires_at NULLS LAST, id) - remaining AS before
+			FROM credit_buckets
+			WHERE user_id = $1 AND remaining > 0
+		) buckets
+		WHERE before < $2
+		GROUP BY expires_at
+		ORDER BY expires_at NULLS LAST
+	`
+	rows, err := q.QueryContext(ctx, query, senderID, amount)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var parts []models.CreditPart
+	drawn := int64(0)
+	for rows.Next() {
+		var part models.CreditPart
+		if err := rows.Scan(&part.ExpiresAt, &part.Amount); err != nil {
+			slog.Info(err.Error())
+			return nil, err
+		}
+		parts = append(parts, part)
+		drawn += part.Amount
+	}
+	if err := rows.Err(); err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+
+	// Credits the buckets don't account for never expire.
+	if drawn < amount {
+		if last := len(parts) - 1; last >= 0 && parts[last].ExpiresAt == nil {
+			parts[last].Amount += amount - drawn
+		} else {
+			parts = append(parts, models.CreditPart{Amount: amount - drawn})
+		}
+	}
+	return parts, nil
+}
+
+// applyTransferCredit credits the receiving side of a transfer, each part
+// with its own expiry. Credits whose expiry already passed are still
+// credited and left to the nightly sweep.
+func applyTransferCredit(ctx context.Context, q querier, t *models.CreditTransfer, recipientID int64, in *models.CreditTransaction) error {
+	in.UserID = recipientID
+	in.Amount = t.Amount
+	in.ReferenceType = "credit_transfer"
+	in.ReferenceID = strconv.FormatInt(t.ID, 10)
+	in.ExpiresAt = t.ExpiresAt
+	in.Parts = t.Parts
+	return applyCreditTransaction(ctx, q, in)
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+// fundTransferSender gives a sender 10 credits expiring in a day, 5 expiring
+// in two days and 20 that never expire.
+func fundTransferSender(t *testing.T, db *sql.DB, r CreditsRepository) (int64, time.Time, time.Time) {
+	t.Helper()
+
+	senderID := newTestUser(t, db, "sender@example.com")
+	soon := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	later := soon.Add(24 * time.Hour)
+	fundTestUser(t, r, senderID, 10, 20, soon)
+	if err := r.Apply(context.Background(), &models.CreditTransaction{UserID: senderID, Kind: models.CreditCoupon, Amount: 5, ExpiresAt: &later}); err != nil {
+		t.Fatalf("granting promotional credits: %v", err)
+	}
+	return senderID, soon, later
+}
+
+// transferBuckets lists the buckets a ledger entry opened, soonest-expiring
+// first.
+func transferBuckets(t *testing.T, db *sql.DB, transactionID int64) []models.CreditPart {
+	t.Helper()
+
+	query := `SELECT remaining, expires_at FROM credit_buckets WHERE transaction_id = $1 ORDER BY expires_at NULLS LAST, id`
+	rows, err := db.Query(query, transactionID)
+	if err != nil {
+		t.Fatalf("listing buckets: %v", err)
+	}
+	defer rows.Close()
+
+	var parts []models.CreditPart
+	for rows.Next() {
+		var part models.CreditPart
+		if err := rows.Scan(&part.Amount, &part.ExpiresAt); err != nil {
+			t.Fatalf("scanning bucket: %v", err)
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+func checkTransferBuckets(t *testing.T, got []models.CreditPart, want ...models.CreditPart) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d buckets, want %d", len(got), len(want))
+	}
+	for i := range want {
+		sameExpiry := (got[i].ExpiresAt == nil) == (want[i].ExpiresAt == nil) &&
+			(want[i].ExpiresAt == nil || got[i].ExpiresAt.Equal(*want[i].ExpiresAt))
+		if got[i].Amount != want[i].Amount || !sameExpiry {
+			t.Errorf("bucket %d = %d expiring %v, want %d expiring %v", i, got[i].Amount, got[i].ExpiresAt, want[i].Amount, want[i].ExpiresAt)
+		}
+	}
+}
+
+func TestCreditTransferKeepsExpiryPerBucket(t *testing.T) {
+	db := newTestDB(t)
+	credits := NewCreditsRepository(db)
+	r := NewCreditTransferRepository(db)
+	ctx := context.Background()
+
+	senderID, soon, later := fundTransferSender(t, db, credits)
+	recipientID := newTestUser(t, db, "recipient@example.com")
+
+	transfer := &models.CreditTransfer{SenderID: senderID, RecipientID: &recipientID, Amount: 18}
+	out := &models.CreditTransaction{Kind: models.CreditTransferOut}
+	in := &models.CreditTransaction{Kind: models.CreditTransferIn}
+	if err := r.Create(ctx, transfer, 10, out, in); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if transfer.ExpiresAt == nil || !transfer.ExpiresAt.Equal(soon) {
+		t.Errorf("transfer expires at %v, want %v", transfer.ExpiresAt, soon)
+	}
+	checkTransferBuckets(t, transferBuckets(t, db, in.ID),
+		models.CreditPart{Amount: 10, ExpiresAt: &soon},
+		models.CreditPart{Amount: 5, ExpiresAt: &later},
+		models.CreditPart{Amount: 3},
+	)
+	if got := remainingByTransaction(t, db, senderID); got[out.ID] != 0 {
+		t.Errorf("debit opened a bucket of %d", got[out.ID])
+	}
+}
+
+func TestCreditTransferGiftKeepsExpiryPerBucket(t *testing.T) {
+	db := newTestDB(t)
+	credits := NewCreditsRepository(db)
+	r := NewCreditTransferRepository(db)
+	ctx := context.Background()
+
+	senderID, soon, later := fundTransferSender(t, db, credits)
+	recipientID := newTestUser(t, db, "recipient@example.com")
+
+	// The recipient owes 4 credits, which the soonest-expiring part pays.
+	debt := &models.CreditTransaction{UserID: recipientID, Kind: models.CreditReversal, Amount: -4, AllowNegative: true}
+	if err := credits.Apply(ctx, debt); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	code := "GIFT-TEST"
+	gift := &models.CreditTransfer{SenderID: senderID, Amount: 18, GiftCode: &code}
+	if err := r.Create(ctx, gift, 10, &models.CreditTransaction{Kind: models.CreditTransferOut}, nil); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	in := &models.CreditTransaction{Kind: models.CreditTransferIn}
+	if _, err := r.RedeemGift(ctx, code, recipientID, in); err != nil {
+		t.Fatalf("RedeemGift: %v", err)
+	}
+
+	if in.BalanceAfter != 14 {
+		t.Errorf("balance = %d, want 14", in.BalanceAfter)
+	}
+	checkTransferBuckets(t, transferBuckets(t, db, in.ID),
+		models.CreditPart{Amount: 6, ExpiresAt: &soon},
+		models.CreditPart{Amount: 5, ExpiresAt: &later},
+		models.CreditPart{Amount: 3},
+	)
+}
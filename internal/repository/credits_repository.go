@@ -5,7 +5,6 @@ import (
 	"context"
 	"database/sql"
 	"log/slog"
-	"time"
 
 	"github.com/maheshrc27/postflow/internal/models"
 )
@@ -13,7 +12,17 @@ import (
 type CreditsRepository interface {
 	GetByUserID(ctx context.Context, id int64) (*models.Credits, bool, error)
 	Create(ctx context.Context, credits *models.Credits) (int64, error)
-	UpdateCredits(ctx context.Context, credits, userID int64) error
+	Apply(ctx context.Context, t *models.CreditTransaction) error
+	GetHistory(ctx context.Context, userID int64, limit, offset int) ([]*models.CreditTransaction, error)
+	GetByReference(ctx context.Context, kind, referenceType, referenceID string) (*models.CreditTransaction, bool, error)
+	ListByReferencePrefix(ctx context.Context, kind, referenceType, prefix string) ([]*models.CreditTransaction, error)
+	HasPaidPurchase(ctx context.Context, userID int64) (bool, error)
+	Hold(ctx context.Context, r *models.CreditReservation) error
+	Capture(ctx context.Context, reservationID int64, t *models.CreditTransaction) error
+	Release(ctx context.Context, reservationID int64) error
+	ListExpiring(ctx context.Context, userID int64) ([]*models.CreditBucket, error)
+	ListUsersWithExpiredCredits(ctx context.Context, afterUserID int64, limit int) ([]int64, error)
+	Expire(ctx context.Context, userID int64, referenceID string) (*models.CreditTransaction, error)
 }
 
 type creditsRepository struct {
@@ -26,8 +35,8 @@ func NewCreditsRepository(db *sql.DB) CreditsRepository {
 
 func (r *creditsRepository) GetByUserID(ctx context.Context, id int64) (*models.Credits, bool, error) {
 	var credits models.Credits
-	query := "SELECT user_id, credits FROM credits WHERE user_id = $1"
-	err := r.db.QueryRowContext(ctx, query, id).Scan(&credits.UserID, &credits.Credits)
+	query := "SELECT user_id, credits, reserved FROM credits WHERE user_id = $1"
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&credits.UserID, &credits.Credits, &credits.Reserved)
 	if err != nil {
 		slog.Info(err.Error())
 		return nil, false, err
@@ -35,10 +44,12 @@ func (r *creditsRepository) GetByUserID(ctx context.Context, id int64) (*models.
 	return &credits, true, nil
 }
 
+// Create opens a credits row for a user with a zero balance. Starting
+// credits are granted through Apply so that they show up in the ledger.
 func (r *creditsRepository) Create(ctx context.Context, credits *models.Credits) (int64, error) {
-	query := "INSERT INTO credits (user_id, credits) VALUES ($1, $2) RETURNING user_id"
+	query := "INSERT INTO credits (user_id, credits) VALUES ($1, 0) RETURNING user_id"
 	var id int64
-	err := r.db.QueryRowContext(ctx, query, credits.UserID, credits.Credits).Scan(&id)
+	err := r.db.QueryRowContext(ctx, query, credits.UserID).Scan(&id)
 	if err != nil {
 		slog.Info(err.Error())
 		return 0, err
@@ -46,18 +57,484 @@ func (r *creditsRepository) Create(ctx context.Context, credits *models.Credits)
 	return id, nil
 }
 
-func (r *creditsRepository) UpdateCredits(ctx context.Context, credits, userID int64) error {
+// Apply changes the balance by t.Amount and appends t to the ledger. It
+// returns ErrInsufficientCredits when a debit is larger than the available
+// (unreserved) balance and ErrDuplicateTransaction when the reference was
+// already applied.
+func (r *creditsRepository) Apply(ctx context.Context, t *models.CreditTransaction) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := applyCreditTransaction(ctx, tx, t); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+// Hold reserves r.Amount credits from the available balance. The balance
+// itself is only reduced once the reservation is captured.
+func (r *creditsRepository) Hold(ctx context.Context, res *models.CreditReservation) error {
+	return holdCredits(ctx, r.db, res)
+}
+
+func holdCredits(ctx context.Context, q querier, res *models.CreditReservation) error {
 	query := `
-		UPDATE credits 
-		SET credits = $1,
-			updated_at = $2
-		WHERE user_id = $3
+		WITH updated AS (
+			UPDATE credits
+			SET reserved = reserved + $2,
+				updated_at = now()
+			WHERE user_id = $1
+				AND credits - reserved >= $2
+			RETURNING user_id
+		)
+		INSERT INTO credit_reservations (user_id, amount, status, reason)
+		SELECT user_id, $2, $3::text, $4::text FROM updated
+		RETURNING id, status, created_at
 	`
-	_, err := r.db.ExecContext(ctx, query, credits, time.Now(), userID)
+	err := q.QueryRowContext(ctx, query, res.UserID, res.Amount, models.ReservationHeld, res.Reason).
+		Scan(&res.ID, &res.Status, &res.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return creditsRefused(ctx, q, res.UserID, res.Amount)
+		}
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+// Capture turns a held reservation into a spend. t describes the ledger entry;
+// its user and amount are taken from the reservation.
+func (r *creditsRepository) Capture(ctx context.Context, reservationID int64, t *models.CreditTransaction) error {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		slog.Info(err.Error())
 		return err
 	}
+	defer tx.Rollback()
+
+	amount, err := resolveReservation(ctx, tx, reservationID, models.ReservationCaptured)
+	if err != nil {
+		return err
+	}
+
+	t.Amount = -amount
+	if err := applyCreditTransaction(ctx, tx, t); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+// Release returns the credits held by a reservation to the available balance.
+func (r *creditsRepository) Release(ctx context.Context, reservationID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := resolveReservation(ctx, tx, reservationID, models.ReservationReleased); err != nil {
+		return err
+	}
 
+	if err := tx.Commit(); err != nil {
+		slog.Info(err.Error())
+		return err
+	}
 	return nil
 }
+
+func (r *creditsRepository) GetHistory(ctx context.Context, userID int64, limit, offset int) ([]*models.CreditTransaction, error) {
+	query := `
+		SELECT id, user_id, kind, amount, balance_after, reason, reference_type, reference_id, created_at
+		FROM credit_transactions
+		WHERE user_id = $1
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []*models.CreditTransaction
+	for rows.Next() {
+		var t models.CreditTransaction
+		err := rows.Scan(&t.ID, &t.UserID, &t.Kind, &t.Amount, &t.BalanceAfter, &t.Reason, &t.ReferenceType, &t.ReferenceID, &t.CreatedAt)
+		if err != nil {
+			slog.Info(err.Error())
+			return nil, err
+		}
+		history = append(history, &t)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	return history, nil
+}
+
+// GetByReference returns the entry a referenced event recorded. Entries of a
+// deleted account have no user and come back with a UserID of 0.
+func (r *creditsRepository) GetByReference(ctx context.Context, kind, referenceType, referenceID string) (*models.CreditTransaction, bool, error) {
+	query := `
+		SELECT id, COALESCE(user_id, 0), kind, amount, balance_after, reason, reference_type, reference_id, created_at
+		FROM credit_transactions
+		WHERE kind = $1 AND reference_type = $2 AND reference_id = $3
+	`
+	var t models.CreditTransaction
+	err := r.db.QueryRowContext(ctx, query, kind, referenceType, referenceID).
+		Scan(&t.ID, &t.UserID, &t.Kind, &t.Amount, &t.BalanceAfter, &t.Reason, &t.ReferenceType, &t.ReferenceID, &t.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &t, true, nil
+}
+
+// HasPaidPurchase reports whether the user bought credits in a sale that
+// still stands. Purchases that were refunded or disputed don't count, while a
+// dispute that was won puts its sale back in the processed state.
+func (r *creditsRepository) HasPaidPurchase(ctx context.Context, userID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM credit_transactions t
+			JOIN payment_events e ON e.id::text = t.reference_id
+			WHERE t.user_id = $1
+				AND t.kind = $2
+				AND t.reference_type = 'payment_event'
+				AND e.status = $3
+		)
+	`
+	var exists bool
+	err := r.db.QueryRowContext(ctx, query, userID, models.CreditPurchase, models.PaymentEventProcessed).Scan(&exists)
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+	return exists, nil
+}
+
+// ListByReferencePrefix returns the entries of a kind whose reference ID
+// starts with prefix, oldest first. As with GetByReference, entries of a
+// deleted account have a UserID of 0.
+func (r *creditsRepository) ListByReferencePrefix(ctx context.Context, kind, referenceType, prefix string) ([]*models.CreditTransaction, error) {
+	query := `
+		SELECT id, COALESCE(user_id, 0), kind, amount, balance_after, reason, reference_type, reference_id, created_at
+		FROM credit_transactions
+		WHERE kind = $1 AND reference_type = $2 AND starts_with(reference_id, $3)
+		ORDER BY id
+	`
+	rows, err := r.db.QueryContext(ctx, query, kind, referenceType, prefix)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []*models.CreditTransaction
+	for rows.Next() {
+		var t models.CreditTransaction
+		err := rows.Scan(&t.ID, &t.UserID, &t.Kind, &t.Amount, &t.BalanceAfter, &t.Reason, &t.ReferenceType, &t.ReferenceID, &t.CreatedAt)
+		if err != nil {
+			slog.Info(err.Error())
+			return nil, err
+		}
+		history = append(history, &t)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	return history, nil
+}
+
+// ListExpiring returns the user's unspent credits that have an expiry,
+// soonest first.
+func (r *creditsRepository) ListExpiring(ctx context.Context, userID int64) ([]*models.CreditBucket, error) {
+	query := `
+		SELECT id, user_id, source, amount, remaining, expires_at, transaction_id, created_at
+		FROM credit_buckets
+		WHERE user_id = $1 AND remaining > 0 AND expires_at IS NOT NULL
+		ORDER BY expires_at, id
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []*models.CreditBucket
+	for rows.Next() {
+		var b models.CreditBucket
+		err := rows.Scan(&b.ID, &b.UserID, &b.Source, &b.Amount, &b.Remaining, &b.ExpiresAt, &b.TransactionID, &b.CreatedAt)
+		if err != nil {
+			slog.Info(err.Error())
+			return nil, err
+		}
+		buckets = append(buckets, &b)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	return buckets, nil
+}
+
+// ListUsersWithExpiredCredits pages through the users holding expired
+// credits in user ID order.
+func (r *creditsRepository) ListUsersWithExpiredCredits(ctx context.Context, afterUserID int64, limit int) ([]int64, error) {
+	query := `
+		SELECT DISTINCT user_id
+		FROM credit_buckets
+		WHERE remaining > 0 AND expires_at <= now() AND user_id > $1
+		ORDER BY user_id
+		LIMIT $2
+	`
+	rows, err := r.db.QueryContext(ctx, query, afterUserID, limit)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			slog.Info(err.Error())
+			return nil, err
+		}
+		userIDs = append(userIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	return userIDs, nil
+}
+
+// Expire debits the user's expired credits. Credits held for a running
+// generation are left alone; the capture will draw from the expired bucket
+// and the rest expires on a later run. It returns nil when there was nothing
+// to expire.
+func (r *creditsRepository) Expire(ctx context.Context, userID int64, referenceID string) (*models.CreditTransaction, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT credits.credits - credits.reserved, COALESCE((
+			SELECT sum(remaining) FROM credit_buckets
+			WHERE user_id = $1 AND remaining > 0 AND expires_at <= now()
+		), 0)
+		FROM credits
+		WHERE user_id = $1
+		FOR UPDATE
+	`
+	var available, expired int64
+	if err := tx.QueryRowContext(ctx, query, userID).Scan(&available, &expired); err != nil {
+		if err == sql.ErrNoRows {
+			slog.Error(ErrCreditsNotFound.Error(), "userID", userID)
+			return nil, ErrCreditsNotFound
+		}
+		slog.Info(err.Error())
+		return nil, err
+	}
+
+	amount := min(expired, available)
+	if amount <= 0 {
+		return nil, nil
+	}
+
+	t := models.CreditTransaction{
+		UserID:        userID,
+		Kind:          models.CreditExpiry,
+		Amount:        -amount,
+		Reason:        "promotional credits expired",
+		ReferenceType: "credit_expiry",
+		ReferenceID:   referenceID,
+	}
+	if err := applyCreditTransaction(ctx, tx, &t); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	return &t, nil
+}
+
+// applyCreditTransaction updates the balance and writes the ledger entry in a
+// single statement, so concurrent debits can never spend the same credit.
+// The credit buckets are updated to match; q should be a transaction.
+func applyCreditTransaction(ctx context.Context, q querier, t *models.CreditTransaction) error {
+	query := `
+		WITH updated AS (
+			UPDATE credits
+			SET credits = credits + $2,
+				updated_at = now()
+			WHERE user_id = $1
+				AND ($2 >= 0 OR $7 OR credits - reserved + $2 >= 0)
+			RETURNING user_id, credits
+		)
+		INSERT INTO credit_transactions (user_id, kind, amount, balance_after, reason, reference_type, reference_id)
+		SELECT user_id, $3::text, $2, credits, $4::text, $5::text, $6::text FROM updated
+		RETURNING id, balance_after, created_at
+	`
+	err := q.QueryRowContext(ctx, query, t.UserID, t.Amount, t.Kind, t.Reason, t.ReferenceType, t.ReferenceID, t.AllowNegative).
+		Scan(&t.ID, &t.BalanceAfter, &t.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return creditsRefused(ctx, q, t.UserID, t.Amount)
+		}
+		if isUniqueViolation(err) {
+			slog.Info(ErrDuplicateTransaction.Error(), "reference", t.ReferenceType+":"+t.ReferenceID)
+			return ErrDuplicateTransaction
+		}
+		slog.Info(err.Error())
+		return err
+	}
+	return updateCreditBuckets(ctx, q, t)
+}
+
+// creditsRefused explains why the credits row of a user wasn't updated: either
+// the debit is larger than the available balance, or the row is missing,
+// which is a data problem that must not pass for a lack of credits.
+func creditsRefused(ctx context.Context, q querier, userID, amount int64) error {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM credits WHERE user_id = $1)`
+	if err := q.QueryRowContext(ctx, query, userID).Scan(&exists); err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+
+	if !exists {
+		slog.Error(ErrCreditsNotFound.Error(), "userID", userID)
+		return ErrCreditsNotFound
+	}
+
+	slog.Info(ErrInsufficientCredits.Error(), "userID", userID, "amount", amount)
+	return ErrInsufficientCredits
+}
+
+// updateCreditBuckets opens a bucket for the part of a credit that lifts the
+// balance above zero, or draws a debit from the soonest-expiring buckets. A
+// reversal draws from the bucket of the entry it offsets first, so taking
+// back a purchase doesn't use up promotional credits.
+// The credits row is locked by the ledger update, so the buckets of a user
+// can't change concurrently.
+func updateCreditBuckets(ctx context.Context, q querier, t *models.CreditTransaction) error {
+	if t.Amount > 0 {
+		return openCreditBuckets(ctx, q, t)
+	}
+
+	query := `
+		WITH ordered AS (
+			SELECT id, remaining,
+				sum(remaining) OVER (
+					ORDER BY CASE WHEN transaction_id = $3 THEN 0 ELSE 1 END, expires_at NULLS LAST, id
+				) - remaining AS before
+			FROM credit_buckets
+			WHERE user_id = $1 AND remaining > 0
+		)
+		UPDATE credit_buckets
+		SET remaining = credit_buckets.remaining - LEAST(ordered.remaining, $2 - ordered.before)
+		FROM ordered
+		WHERE credit_buckets.id = ordered.id AND ordered.before < $2
+	`
+	if _, err := q.ExecContext(ctx, query, t.UserID, -t.Amount, t.Offsets); err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+// openCreditBuckets opens a bucket for each part of a credit. The part of a
+// credit that pays off a negative balance gets no bucket; it is taken from
+// the soonest-expiring parts.
+func openCreditBuckets(ctx context.Context, q querier, t *models.CreditTransaction) error {
+	parts := t.Parts
+	if len(parts) == 0 {
+		parts = []models.CreditPart{{Amount: t.Amount, ExpiresAt: t.ExpiresAt}}
+	}
+
+	debt := t.Amount - max(min(t.Amount, t.BalanceAfter), 0)
+	query := `
+		INSERT INTO credit_buckets (user_id, source, amount, remaining, expires_at, transaction_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	for _, part := range parts {
+		paid := min(part.Amount, debt)
+		debt -= paid
+		if part.Amount == paid {
+			continue
+		}
+
+		_, err := q.ExecContext(ctx, query, t.UserID, t.Kind, part.Amount, part.Amount-paid, part.ExpiresAt, t.ID)
+		if err != nil {
+			slog.Info(err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveReservation moves a held reservation to status and removes its amount
+// from the reserved balance. Only held reservations can be resolved, which
+// makes capturing or releasing the same reservation twice an error.
+func resolveReservation(ctx context.Context, q querier, reservationID int64, status string) (int64, error) {
+	query := `
+		WITH resolved AS (
+			UPDATE credit_reservations
+			SET status = $2,
+				resolved_at = now()
+			WHERE id = $1
+				AND status = $3
+			RETURNING user_id, amount
+		)
+		UPDATE credits
+		SET reserved = credits.reserved - resolved.amount,
+			updated_at = now()
+		FROM resolved
+		WHERE credits.user_id = resolved.user_id
+		RETURNING resolved.amount
+	`
+	var amount int64
+	err := q.QueryRowContext(ctx, query, reservationID, status, models.ReservationHeld).Scan(&amount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			slog.Info(ErrReservationNotHeld.Error(), "reservationID", reservationID)
+			return 0, ErrReservationNotHeld
+		}
+		slog.Info(err.Error())
+		return 0, err
+	}
+	return amount, nil
+}
@@ -0,0 +1,254 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+// fundTestUser grants a user promotional credits expiring at expiresAt and
+// purchased credits that never expire.
+func fundTestUser(t *testing.T, r CreditsRepository, userID, promo, purchased int64, expiresAt time.Time) (*models.CreditTransaction, *models.CreditTransaction) {
+	t.Helper()
+	ctx := context.Background()
+
+	coupon := &models.CreditTransaction{UserID: userID, Kind: models.CreditCoupon, Amount: promo, ExpiresAt: &expiresAt}
+	if err := r.Apply(ctx, coupon); err != nil {
+		t.Fatalf("granting promotional credits: %v", err)
+	}
+	purchase := &models.CreditTransaction{UserID: userID, Kind: models.CreditPurchase, Amount: purchased}
+	if err := r.Apply(ctx, purchase); err != nil {
+		t.Fatalf("granting purchased credits: %v", err)
+	}
+	return coupon, purchase
+}
+
+func TestCreditBucketsSpendSoonestExpiringFirst(t *testing.T) {
+	db := newTestDB(t)
+	r := NewCreditsRepository(db)
+	userID := newTestUser(t, db, "spend@example.com")
+
+	coupon, purchase := fundTestUser(t, r, userID, 10, 20, time.Now().Add(24*time.Hour))
+
+	spend := &models.CreditTransaction{UserID: userID, Kind: models.CreditSpend, Amount: -15}
+	if err := r.Apply(context.Background(), spend); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	remaining := remainingByTransaction(t, db, userID)
+	if remaining[coupon.ID] != 0 || remaining[purchase.ID] != 15 {
+		t.Errorf("promo, purchased remaining = %d, %d, want 0, 15", remaining[coupon.ID], remaining[purchase.ID])
+	}
+}
+
+func TestCreditBucketsReversalDrawsFromReversedPurchase(t *testing.T) {
+	db := newTestDB(t)
+	r := NewCreditsRepository(db)
+	ctx := context.Background()
+	userID := newTestUser(t, db, "reversal@example.com")
+
+	coupon, purchase := fundTestUser(t, r, userID, 10, 20, time.Now().Add(24*time.Hour))
+
+	spend := &models.CreditTransaction{UserID: userID, Kind: models.CreditSpend, Amount: -5}
+	if err := r.Apply(ctx, spend); err != nil {
+		t.Fatalf("spending: %v", err)
+	}
+
+	reversal := &models.CreditTransaction{
+		UserID:        userID,
+		Kind:          models.CreditReversal,
+		Amount:        -purchase.Amount,
+		AllowNegative: true,
+		Offsets:       purchase.ID,
+	}
+	if err := r.Apply(ctx, reversal); err != nil {
+		t.Fatalf("reversing: %v", err)
+	}
+
+	if reversal.BalanceAfter != 5 {
+		t.Errorf("balance = %d, want 5", reversal.BalanceAfter)
+	}
+	remaining := remainingByTransaction(t, db, userID)
+	if remaining[coupon.ID] != 5 || remaining[purchase.ID] != 0 {
+		t.Errorf("promo, purchased remaining = %d, %d, want 5, 0", remaining[coupon.ID], remaining[purchase.ID])
+	}
+}
+
+func TestCreditsExpire(t *testing.T) {
+	db := newTestDB(t)
+	r := NewCreditsRepository(db)
+	ctx := context.Background()
+	userID := newTestUser(t, db, "expire@example.com")
+	other := newTestUser(t, db, "unexpired@example.com")
+
+	coupon, purchase := fundTestUser(t, r, userID, 10, 20, time.Now().Add(-time.Hour))
+	fundTestUser(t, r, other, 10, 0, time.Now().Add(time.Hour))
+
+	users, err := r.ListUsersWithExpiredCredits(ctx, 0, 10)
+	if err != nil {
+		t.Fatalf("ListUsersWithExpiredCredits: %v", err)
+	}
+	if len(users) != 1 || users[0] != userID {
+		t.Fatalf("users with expired credits = %v, want [%d]", users, userID)
+	}
+
+	expiry, err := r.Expire(ctx, userID, "day-1")
+	if err != nil {
+		t.Fatalf("Expire: %v", err)
+	}
+	if expiry == nil || expiry.Amount != -10 || expiry.BalanceAfter != 20 {
+		t.Fatalf("expiry = %+v, want -10 leaving 20", expiry)
+	}
+	remaining := remainingByTransaction(t, db, userID)
+	if remaining[coupon.ID] != 0 || remaining[purchase.ID] != 20 {
+		t.Errorf("promo, purchased remaining = %d, %d, want 0, 20", remaining[coupon.ID], remaining[purchase.ID])
+	}
+
+	// Nothing is left to expire on the next run.
+	expiry, err = r.Expire(ctx, userID, "day-2")
+	if err != nil || expiry != nil {
+		t.Errorf("second Expire = %+v, %v, want nothing", expiry, err)
+	}
+	if expiry, err := r.Expire(ctx, other, "day-1"); err != nil || expiry != nil {
+		t.Errorf("Expire of unexpired credits = %+v, %v, want nothing", expiry, err)
+	}
+}
+
+func TestCreditsExpireLeavesHeldCredits(t *testing.T) {
+	db := newTestDB(t)
+	r := NewCreditsRepository(db)
+	ctx := context.Background()
+	userID := newTestUser(t, db, "held@example.com")
+
+	coupon, _ := fundTestUser(t, r, userID, 10, 0, time.Now().Add(-time.Hour))
+	if err := r.Hold(ctx, &models.CreditReservation{UserID: userID, Amount: 4}); err != nil {
+		t.Fatalf("Hold: %v", err)
+	}
+
+	expiry, err := r.Expire(ctx, userID, "day-1")
+	if err != nil {
+		t.Fatalf("Expire: %v", err)
+	}
+	if expiry == nil || expiry.Amount != -6 {
+		t.Fatalf("expiry = %+v, want -6", expiry)
+	}
+	if remaining := remainingByTransaction(t, db, userID); remaining[coupon.ID] != 4 {
+		t.Errorf("promo remaining = %d, want 4", remaining[coupon.ID])
+	}
+}
+
+// checkBalance compares the user's balance and held credits.
+func checkBalance(t *testing.T, r CreditsRepository, userID, credits, reserved int64) {
+	t.Helper()
+
+	balance, _, err := r.GetByUserID(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("GetByUserID: %v", err)
+	}
+	if balance.Credits != credits || balance.Reserved != reserved {
+		t.Errorf("balance = %d with %d reserved, want %d with %d reserved", balance.Credits, balance.Reserved, credits, reserved)
+	}
+}
+
+func TestCreditReservations(t *testing.T) {
+	db := newTestDB(t)
+	r := NewCreditsRepository(db)
+	ctx := context.Background()
+	userID := newTestUser(t, db, "hold@example.com")
+
+	fundTestUser(t, r, userID, 2, 3, time.Now().Add(24*time.Hour))
+
+	captured := &models.CreditReservation{UserID: userID, Amount: 3, Reason: "video"}
+	if err := r.Hold(ctx, captured); err != nil {
+		t.Fatalf("Hold: %v", err)
+	}
+	released := &models.CreditReservation{UserID: userID, Amount: 2, Reason: "video"}
+	if err := r.Hold(ctx, released); err != nil {
+		t.Fatalf("Hold: %v", err)
+	}
+	checkBalance(t, r, userID, 5, 5)
+
+	// Held credits are no longer available, though they are still part of
+	// the balance.
+	if err := r.Hold(ctx, &models.CreditReservation{UserID: userID, Amount: 1}); err != ErrInsufficientCredits {
+		t.Errorf("Hold over the available balance = %v, want %v", err, ErrInsufficientCredits)
+	}
+
+	spend := &models.CreditTransaction{UserID: userID, Kind: models.CreditSpend, Reason: "video"}
+	if err := r.Capture(ctx, captured.ID, spend); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	if spend.Amount != -3 {
+		t.Errorf("captured %d credits, want -3", spend.Amount)
+	}
+	if err := r.Release(ctx, released.ID); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	checkBalance(t, r, userID, 2, 0)
+
+	// A reservation is resolved once.
+	if err := r.Release(ctx, captured.ID); err != ErrReservationNotHeld {
+		t.Errorf("Release of a captured reservation = %v, want %v", err, ErrReservationNotHeld)
+	}
+	if err := r.Capture(ctx, released.ID, &models.CreditTransaction{UserID: userID, Kind: models.CreditSpend}); err != ErrReservationNotHeld {
+		t.Errorf("Capture of a released reservation = %v, want %v", err, ErrReservationNotHeld)
+	}
+	checkBalance(t, r, userID, 2, 0)
+}
+
+func TestCreditLedgerOutlivesAccount(t *testing.T) {
+	db := newTestDB(t)
+	r := NewCreditsRepository(db)
+	ctx := context.Background()
+	userID := newTestUser(t, db, "deleted@example.com")
+
+	purchase := &models.CreditTransaction{UserID: userID, Kind: models.CreditPurchase, Amount: 20, ReferenceType: "payment_event", ReferenceID: "1"}
+	if err := r.Apply(ctx, purchase); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if err := NewUserRepository(db).Remove(ctx, userID); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	got, found, err := r.GetByReference(ctx, models.CreditPurchase, "payment_event", "1")
+	if err != nil || !found {
+		t.Fatalf("GetByReference = %v, %v, want the purchase", found, err)
+	}
+	if got.ID != purchase.ID || got.UserID != 0 || got.Amount != 20 {
+		t.Errorf("purchase = %+v, want entry %d of 20 credits without a user", got, purchase.ID)
+	}
+}
+
+func TestCreditsHasPaidPurchase(t *testing.T) {
+	db := newTestDB(t)
+	r := NewCreditsRepository(db)
+	events := NewPaymentEventRepository(db)
+	ctx := context.Background()
+	userID := newTestUser(t, db, "buyer@example.com")
+
+	sale := &models.PaymentEvent{Provider: "stripe", SaleID: "pi_1"}
+	if _, err := events.Claim(ctx, sale); err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+	purchase := &models.CreditTransaction{UserID: userID, Kind: models.CreditPurchase, Amount: 10, ReferenceType: "payment_event", ReferenceID: strconv.FormatInt(sale.ID, 10)}
+	if err := r.Apply(ctx, purchase); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if err := events.MarkProcessed(ctx, sale.ID, userID); err != nil {
+		t.Fatalf("MarkProcessed: %v", err)
+	}
+	if paid, err := r.HasPaidPurchase(ctx, userID); err != nil || !paid {
+		t.Fatalf("HasPaidPurchase = %v, %v, want true", paid, err)
+	}
+
+	// A refunded purchase no longer counts.
+	if err := events.MarkReversed(ctx, sale.ID, models.PaymentEventRefunded); err != nil {
+		t.Fatalf("MarkReversed: %v", err)
+	}
+	if paid, err := r.HasPaidPurchase(ctx, userID); err != nil || paid {
+		t.Errorf("HasPaidPurchase after a refund = %v, %v, want false", paid, err)
+	}
+}
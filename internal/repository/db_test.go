@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// baselineSchema creates the tables the migrations build on.
+const baselineSchema = `
+	CREATE TABLE users (
+		id              BIGSERIAL PRIMARY KEY,
+		google_id       TEXT NOT NULL DEFAULT '',
+		email           TEXT NOT NULL UNIQUE,
+		name            TEXT NOT NULL DEFAULT '',
+		profile_picture TEXT NOT NULL DEFAULT '',
+		created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+		updated_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	CREATE TABLE credits (
+		user_id    BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+		credits    BIGINT NOT NULL DEFAULT 0,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	CREATE TABLE media_assets (
+		id            BIGSERIAL PRIMARY KEY,
+		user_id       BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		file_name     TEXT NOT NULL DEFAULT '',
+		file_type     TEXT NOT NULL DEFAULT '',
+		file_url      TEXT NOT NULL DEFAULT '',
+		thumbnail_url TEXT NOT NULL DEFAULT '',
+		created_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+`
+
+// newTestDB migrates a fresh schema of the database named by
+// POSTGRES_TEST_URI and drops it when the test ends. Tests that need
+// Postgres are skipped when the variable is unset.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	uri := os.Getenv("POSTGRES_TEST_URI")
+	if uri == "" {
+		t.Skip("POSTGRES_TEST_URI is not set")
+	}
+
+	admin, err := sql.Open("postgres", uri)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	sep := " "
+	if strings.Contains(uri, "://") {
+		sep = "?"
+		if strings.Contains(uri, "?") {
+			sep = "&"
+		}
+	}
+	db, err := sql.Open("postgres", uri+sep+"search_path="+schema)
+	if err != nil {
+		t.Fatalf("opening schema: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(baselineSchema); err != nil {
+		t.Fatalf("creating baseline schema: %v", err)
+	}
+
+	files, err := filepath.Glob("../../migrations/*.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("finding migrations: %v", err)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		migration, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("reading %s: %v", file, err)
+		}
+		if _, err := db.Exec(string(migration)); err != nil {
+			t.Fatalf("applying %s: %v", filepath.Base(file), err)
+		}
+	}
+	return db
+}
+
+// newTestUser creates a user with an empty credits row.
+func newTestUser(t *testing.T, db *sql.DB, email string) int64 {
+	t.Helper()
+
+	var id int64
+	err := db.QueryRow("INSERT INTO users (email, name) VALUES ($1, $1) RETURNING id", email).Scan(&id)
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO credits (user_id) VALUES ($1)", id); err != nil {
+		t.Fatalf("creating credits: %v", err)
+	}
+	return id
+}
+
+// remainingByTransaction maps the ledger entry of each of the user's buckets
+// to what is left in it.
+func remainingByTransaction(t *testing.T, db *sql.DB, userID int64) map[int64]int64 {
+	t.Helper()
+
+	rows, err := db.QueryContext(context.Background(), "SELECT transaction_id, remaining FROM credit_buckets WHERE user_id = $1", userID)
+	if err != nil {
+		t.Fatalf("listing buckets: %v", err)
+	}
+	defer rows.Close()
+
+	remaining := map[int64]int64{}
+	for rows.Next() {
+		var id sql.NullInt64
+		var n int64
+		if err := rows.Scan(&id, &n); err != nil {
+			t.Fatalf("scanning bucket: %v", err)
+		}
+		remaining[id.Int64] = n
+	}
+	return remaining
+}
@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+type EmailClaimRepository interface {
+	Create(ctx context.Context, c *models.EmailClaim) error
+	GetPending(ctx context.Context, userID int64, email string) (*models.EmailClaim, bool, error)
+	CountSince(ctx context.Context, userID int64, since time.Time) (int, error)
+	AddAttempt(ctx context.Context, id int64) error
+	Confirm(ctx context.Context, c *models.EmailClaim) (*models.AccountMerge, error)
+	ListEmails(ctx context.Context, userID int64) ([]*models.UserEmail, error)
+}
+
+type emailClaimRepository struct {
+	db *sql.DB
+}
+
+func NewEmailClaimRepository(db *sql.DB) EmailClaimRepository {
+	return &emailClaimRepository{db: db}
+}
+
+const emailClaimColumns = `id, user_id, email, code_hash, attempts, expires_at, confirmed_at, created_at`
+
+func scanEmailClaim(row interface{ Scan(...any) error }, c *models.EmailClaim) error {
+	return row.Scan(
+		&c.ID,
+		&c.UserID,
+		&c.Email,
+		&c.CodeHash,
+		&c.Attempts,
+		&c.ExpiresAt,
+		&c.ConfirmedAt,
+		&c.CreatedAt,
+	)
+}
+
+func (r *emailClaimRepository) Create(ctx context.Context, c *models.EmailClaim) error {
+	query := `
+		INSERT INTO email_claims (user_id, email, code_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ` + emailClaimColumns
+	err := scanEmailClaim(r.db.QueryRowContext(ctx, query, c.UserID, c.Email, c.CodeHash, c.ExpiresAt), c)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+// GetPending returns the latest unconfirmed, unexpired claim of email by the
+// user. Requesting a new code supersedes earlier ones.
+func (r *emailClaimRepository) GetPending(ctx context.Context, userID int64, email string) (*models.EmailClaim, bool, error) {
+	query := `
+		SELECT ` + emailClaimColumns + `
+		FROM email_claims
+		WHERE user_id = $1 AND email = $2 AND confirmed_at IS NULL AND expires_at > now()
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+	var c models.EmailClaim
+	err := scanEmailClaim(r.db.QueryRowContext(ctx, query, userID, email), &c)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &c, true, nil
+}
+
+func (r *emailClaimRepository) CountSince(ctx context.Context, userID int64, since time.Time) (int, error) {
+	query := `SELECT count(*) FROM email_claims WHERE user_id = $1 AND created_at > $2`
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, userID, since).Scan(&count); err != nil {
+		slog.Info(err.Error())
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *emailClaimRepository) AddAttempt(ctx context.Context, id int64) error {
+	query := `UPDATE email_claims SET attempts = attempts + 1 WHERE id = $1`
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+// Confirm marks the claim confirmed and links its email to the user. An
+// account that was created for purchases under the email, and never signed
+// in, is merged into the user: its balance, credit history, jobs, sales,
+// orders and subscriptions are moved over and the account is deleted.
+func (r *emailClaimRepository) Confirm(ctx context.Context, c *models.EmailClaim) (*models.AccountMerge, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE email_claims SET confirmed_at = now() WHERE id = $1 AND confirmed_at IS NULL RETURNING confirmed_at`
+	if err := tx.QueryRowContext(ctx, query, c.ID).Scan(&c.ConfirmedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrClaimNotPending
+		}
+		slog.Info(err.Error())
+		return nil, err
+	}
+
+	merge := &models.AccountMerge{Email: c.Email}
+
+	var other struct {
+		id      int64
+		signsIn bool
+	}
+	query = `SELECT id, COALESCE(google_id, '') <> '' OR EXISTS (SELECT 1 FROM user_identities WHERE user_id = users.id)
+		FROM users WHERE lower(email) = lower($1) AND id <> $2 FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, c.Email, c.UserID).Scan(&other.id, &other.signsIn)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		slog.Info(err.Error())
+		return nil, err
+	case other.signsIn:
+		slog.Info(ErrEmailInUse.Error(), "userID", c.UserID, "otherUserID", other.id)
+		return nil, ErrEmailInUse
+	default:
+		merge.MergedUserID = &other.id
+		if merge.Credits, err = mergeUser(ctx, tx, other.id, c.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	query = `
+		INSERT INTO user_emails (email, user_id) VALUES ($1, $2)
+		ON CONFLICT (email) DO UPDATE SET verified_at = now()
+		WHERE user_emails.user_id = EXCLUDED.user_id
+	`
+	res, err := tx.ExecContext(ctx, query, c.Email, c.UserID)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		slog.Info(ErrEmailInUse.Error(), "userID", c.UserID)
+		return nil, ErrEmailInUse
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	return merge, nil
+}
+
+// mergeUser moves everything fromID owns to toID and deletes fromID. Ledger
+// entries, buckets and reservations move as they are, so the history stays
+// complete and promotional credits keep their expiry; the balance is added
+// to toID's. It returns the balance that was moved.
+func mergeUser(ctx context.Context, tx *sql.Tx, fromID, toID int64) (int64, error) {
+	query := `SELECT user_id, credits, reserved FROM credits WHERE user_id = ANY($1) ORDER BY user_id FOR UPDATE`
+	rows, err := tx.QueryContext(ctx, query, pq.Array([]int64{fromID, toID}))
+	if err != nil {
+		slog.Info(err.Error())
+		return 0, err
+	}
+	var balance, reserved, toBalance int64
+	for rows.Next() {
+		var userID, credits, held int64
+		if err := rows.Scan(&userID, &credits, &held); err != nil {
+			rows.Close()
+			slog.Info(err.Error())
+			return 0, err
+		}
+		if userID == fromID {
+			balance, reserved = credits, held
+		} else {
+			toBalance = credits
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		slog.Info(err.Error())
+		return 0, err
+	}
+
+	statements := []string{
+		`UPDATE credit_transactions SET user_id = $2 WHERE user_id = $1`,
+		`UPDATE credit_buckets SET user_id = $2 WHERE user_id = $1`,
+		`UPDATE credit_reservations SET user_id = $2 WHERE user_id = $1`,
+		`UPDATE video_jobs SET user_id = $2 WHERE user_id = $1`,
+		`UPDATE media_assets SET user_id = $2 WHERE user_id = $1`,
+		`UPDATE credit_transfers SET sender_id = $2 WHERE sender_id = $1`,
+		`UPDATE credit_transfers SET recipient_id = $2 WHERE recipient_id = $1`,
+		// A user is referred at most once and never by themselves; those
+		// referrals are dropped with fromID.
+		`UPDATE referrals SET referrer_id = $2 WHERE referrer_id = $1 AND referee_id <> $2`,
+		`UPDATE referrals SET referee_id = $2
+			WHERE referee_id = $1 AND referrer_id <> $2
+				AND NOT EXISTS (SELECT 1 FROM referrals WHERE referee_id = $2)`,
+		`UPDATE payment_events SET user_id = $2 WHERE user_id = $1`,
+		`UPDATE orders SET user_id = $2 WHERE user_id = $1`,
+		`UPDATE subscriptions SET user_id = $2 WHERE user_id = $1`,
+		`UPDATE coupon_redemptions SET user_id = $2
+			WHERE user_id = $1
+				AND coupon_id NOT IN (SELECT coupon_id FROM coupon_redemptions WHERE user_id = $2)`,
+	}
+	for _, query := range statements {
+		if _, err := tx.ExecContext(ctx, query, fromID, toID); err != nil {
+			slog.Info(err.Error())
+			return 0, err
+		}
+	}
+
+	query = `UPDATE credits SET credits = credits + $2, reserved = reserved + $3, updated_at = now() WHERE user_id = $1`
+	if _, err := tx.ExecContext(ctx, query, toID, balance, reserved); err != nil {
+		slog.Info(err.Error())
+		return 0, err
+	}
+
+	// Buckets only hold a positive balance. When one of the accounts was in
+	// debt, the debt is paid from the soonest-expiring buckets of the other.
+	if debt := max(balance, 0) + max(toBalance, 0) - max(balance+toBalance, 0); debt > 0 {
+		if err := updateCreditBuckets(ctx, tx, &models.CreditTransaction{UserID: toID, Amount: -debt}); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, fromID); err != nil {
+		slog.Info(err.Error())
+		return 0, err
+	}
+
+	slog.Info("merged account", "fromUserID", fromID, "toUserID", toID, "credits", balance)
+	return balance, nil
+}
+
+func (r *emailClaimRepository) ListEmails(ctx context.Context, userID int64) ([]*models.UserEmail, error) {
+	query := `SELECT email, user_id, verified_at FROM user_emails WHERE user_id = $1 ORDER BY verified_at`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emails []*models.UserEmail
+	for rows.Next() {
+		var e models.UserEmail
+		if err := rows.Scan(&e.Email, &e.UserID, &e.VerifiedAt); err != nil {
+			slog.Info(err.Error())
+			return nil, err
+		}
+		emails = append(emails, &e)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	return emails, nil
+}
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+// confirmTestClaim has the user claim email and confirms the claim.
+func confirmTestClaim(t *testing.T, r EmailClaimRepository, userID int64, email string) *models.AccountMerge {
+	t.Helper()
+	ctx := context.Background()
+
+	claim := &models.EmailClaim{UserID: userID, Email: email, CodeHash: "hash", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := r.Create(ctx, claim); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	merge, err := r.Confirm(ctx, claim)
+	if err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	return merge
+}
+
+// countRows runs a count query.
+func countRows(t *testing.T, db *sql.DB, query string, args ...any) int {
+	t.Helper()
+
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatalf("counting rows: %v", err)
+	}
+	return n
+}
+
+func TestEmailClaimMergesAccount(t *testing.T) {
+	db := newTestDB(t)
+	credits := NewCreditsRepository(db)
+	r := NewEmailClaimRepository(db)
+	ctx := context.Background()
+
+	ownerID := newTestUser(t, db, "owner@example.com")
+	buyerID := newTestUser(t, db, "buyer@example.com")
+	referrerID := newTestUser(t, db, "referrer@example.com")
+	friendID := newTestUser(t, db, "friend@example.com")
+
+	coupon, purchase := fundTestUser(t, credits, buyerID, 10, 20, time.Now().Add(24*time.Hour))
+	hold := &models.CreditReservation{UserID: buyerID, Amount: 5, Reason: "video"}
+	if err := credits.Hold(ctx, hold); err != nil {
+		t.Fatalf("Hold: %v", err)
+	}
+
+	var jobID int64
+	query := `INSERT INTO video_jobs (user_id, payload, reservation_id) VALUES ($1, '{}', $2) RETURNING id`
+	if err := db.QueryRow(query, buyerID, hold.ID).Scan(&jobID); err != nil {
+		t.Fatalf("creating job: %v", err)
+	}
+	for _, referral := range [][2]int64{{referrerID, buyerID}, {buyerID, friendID}} {
+		query := `INSERT INTO referrals (referrer_id, referee_id, status) VALUES ($1, $2, 'pending')`
+		if _, err := db.Exec(query, referral[0], referral[1]); err != nil {
+			t.Fatalf("creating referral: %v", err)
+		}
+	}
+	var transferID int64
+	query = `INSERT INTO credit_transfers (sender_id, recipient_id, amount) VALUES ($1, $2, 3) RETURNING id`
+	if err := db.QueryRow(query, buyerID, friendID).Scan(&transferID); err != nil {
+		t.Fatalf("creating transfer: %v", err)
+	}
+
+	merge := confirmTestClaim(t, r, ownerID, "buyer@example.com")
+
+	if merge.MergedUserID == nil || *merge.MergedUserID != buyerID || merge.Credits != 30 {
+		t.Fatalf("merge = %+v, want %d credits from user %d", merge, 30, buyerID)
+	}
+	balance, _, err := credits.GetByUserID(ctx, ownerID)
+	if err != nil {
+		t.Fatalf("GetByUserID: %v", err)
+	}
+	if balance.Credits != 30 || balance.Reserved != 5 {
+		t.Errorf("balance = %d with %d reserved, want 30 with 5 reserved", balance.Credits, balance.Reserved)
+	}
+
+	// The history, buckets and everything else the account owned move over
+	// as they were.
+	history, err := credits.GetHistory(ctx, ownerID, 10, 0)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != 2 {
+		t.Errorf("got %d ledger entries, want 2", len(history))
+	}
+	if got := remainingByTransaction(t, db, ownerID); got[coupon.ID] != 10 || got[purchase.ID] != 20 {
+		t.Errorf("buckets = %v, want %d in the coupon's and %d in the purchase's", got, 10, 20)
+	}
+	checks := []struct {
+		name  string
+		query string
+		arg   int64
+	}{
+		{"reservation", `SELECT count(*) FROM credit_reservations WHERE user_id = $1`, ownerID},
+		{"job", `SELECT count(*) FROM video_jobs WHERE user_id = $1`, ownerID},
+		{"referral of the account", `SELECT count(*) FROM referrals WHERE referee_id = $1`, ownerID},
+		{"referral by the account", `SELECT count(*) FROM referrals WHERE referrer_id = $1`, ownerID},
+		{"transfer", `SELECT count(*) FROM credit_transfers WHERE sender_id = $1`, ownerID},
+	}
+	for _, c := range checks {
+		if n := countRows(t, db, c.query, c.arg); n != 1 {
+			t.Errorf("%s wasn't moved: got %d rows", c.name, n)
+		}
+	}
+	if n := countRows(t, db, `SELECT count(*) FROM users WHERE id = $1`, buyerID); n != 0 {
+		t.Error("merged account wasn't deleted")
+	}
+}
+
+func TestEmailClaimMergePaysDebt(t *testing.T) {
+	db := newTestDB(t)
+	credits := NewCreditsRepository(db)
+	r := NewEmailClaimRepository(db)
+	ctx := context.Background()
+
+	ownerID := newTestUser(t, db, "owner@example.com")
+	buyerID := newTestUser(t, db, "buyer@example.com")
+
+	coupon, purchase := fundTestUser(t, credits, ownerID, 10, 20, time.Now().Add(24*time.Hour))
+	debt := &models.CreditTransaction{UserID: buyerID, Kind: models.CreditReversal, Amount: -4, AllowNegative: true}
+	if err := credits.Apply(ctx, debt); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	merge := confirmTestClaim(t, r, ownerID, "buyer@example.com")
+
+	if merge.Credits != -4 {
+		t.Errorf("merged %d credits, want -4", merge.Credits)
+	}
+	balance, _, err := credits.GetByUserID(ctx, ownerID)
+	if err != nil {
+		t.Fatalf("GetByUserID: %v", err)
+	}
+	if balance.Credits != 26 {
+		t.Errorf("balance = %d, want 26", balance.Credits)
+	}
+	// The debt is paid from the soonest-expiring credits.
+	if got := remainingByTransaction(t, db, ownerID); got[coupon.ID] != 6 || got[purchase.ID] != 20 {
+		t.Errorf("buckets = %v, want %d in the coupon's and %d in the purchase's", got, 6, 20)
+	}
+}
+
+func TestEmailClaimRejectsAccountThatSignsIn(t *testing.T) {
+	db := newTestDB(t)
+	r := NewEmailClaimRepository(db)
+
+	ownerID := newTestUser(t, db, "owner@example.com")
+	otherID := newTestUser(t, db, "other@example.com")
+	if _, err := db.Exec(`UPDATE users SET google_id = 'google-1' WHERE id = $1`, otherID); err != nil {
+		t.Fatalf("linking Google: %v", err)
+	}
+
+	claim := &models.EmailClaim{UserID: ownerID, Email: "other@example.com", CodeHash: "hash", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := r.Create(context.Background(), claim); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := r.Confirm(context.Background(), claim); err != ErrEmailInUse {
+		t.Fatalf("Confirm = %v, want %v", err, ErrEmailInUse)
+	}
+	if n := countRows(t, db, `SELECT count(*) FROM users WHERE id = $1`, otherID); n != 1 {
+		t.Error("account that signs in was deleted")
+	}
+}
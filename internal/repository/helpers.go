@@ -1 +1,56 @@
 package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrInsufficientCredits  = errors.New("insufficient credits")
+	ErrDuplicateTransaction = errors.New("credit transaction already recorded")
+	ErrReservationNotHeld   = errors.New("credit reservation is not held")
+	// ErrCreditsNotFound means the user has no credits row, which every
+	// account should have.
+	ErrCreditsNotFound = errors.New("user has no credits row")
+
+	ErrCouponUnavailable     = errors.New("coupon is expired or fully redeemed")
+	ErrCouponAlreadyRedeemed = errors.New("coupon already redeemed by user")
+	ErrDuplicateCoupon       = errors.New("coupon code already exists")
+
+	ErrTransferLimit    = errors.New("credit transfer limit reached")
+	ErrGiftNotAvailable = errors.New("gift code does not exist or was already redeemed")
+
+	ErrReferralCapReached = errors.New("referrer reached the referral reward cap")
+
+	ErrClaimNotPending = errors.New("email claim is not pending")
+	ErrEmailInUse      = errors.New("email belongs to another account")
+
+	ErrIdentityLinked = errors.New("identity is already linked to a user")
+
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or its session has ended")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used")
+
+	ErrTwoFactorNotPending = errors.New("two-factor enrollment is not pending")
+
+	// ErrJobLeaseLost means the job was requeued or finished by someone else
+	// since it was claimed.
+	ErrJobLeaseLost = errors.New("video job is no longer running under this attempt")
+	ErrTooManyJobs  = errors.New("too many video jobs queued or running")
+	ErrStorageQuota = errors.New("video storage quota reached")
+)
+
+// querier is satisfied by both *sql.DB and *sql.Tx so that statements can be
+// shared between standalone calls and larger transactions.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+type IdentityRepository interface {
+	GetByProviderSubject(ctx context.Context, provider, subject string) (*models.UserIdentity, bool, error)
+	Create(ctx context.Context, i *models.UserIdentity) error
+	Touch(ctx context.Context, id int64, email string) error
+	ListByUserID(ctx context.Context, userID int64) ([]*models.UserIdentity, error)
+}
+
+type identityRepository struct {
+	db *sql.DB
+}
+
+func NewIdentityRepository(db *sql.DB) IdentityRepository {
+	return &identityRepository{db: db}
+}
+
+const identityColumns = `id, user_id, provider, subject, email, created_at, last_login_at`
+
+func scanIdentity(row interface{ Scan(...any) error }, i *models.UserIdentity) error {
+	return row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Provider,
+		&i.Subject,
+		&i.Email,
+		&i.CreatedAt,
+		&i.LastLoginAt,
+	)
+}
+
+func (r *identityRepository) GetByProviderSubject(ctx context.Context, provider, subject string) (*models.UserIdentity, bool, error) {
+	query := `SELECT ` + identityColumns + ` FROM user_identities WHERE provider = $1 AND subject = $2`
+
+	var i models.UserIdentity
+	err := scanIdentity(r.db.QueryRowContext(ctx, query, provider, subject), &i)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &i, true, nil
+}
+
+// Create links an identity to a user. It returns ErrIdentityLinked when the
+// identity already belongs to a user.
+func (r *identityRepository) Create(ctx context.Context, i *models.UserIdentity) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ` + identityColumns
+	err := scanIdentity(r.db.QueryRowContext(ctx, query, i.UserID, i.Provider, i.Subject, i.Email), i)
+	if err != nil {
+		if isUniqueViolation(err) {
+			slog.Info(ErrIdentityLinked.Error(), "provider", i.Provider)
+			return ErrIdentityLinked
+		}
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+// Touch records a sign-in with the identity and the email the provider
+// reported for it.
+func (r *identityRepository) Touch(ctx context.Context, id int64, email string) error {
+	query := `UPDATE user_identities SET last_login_at = now(), email = $2 WHERE id = $1`
+	if _, err := r.db.ExecContext(ctx, query, id, email); err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *identityRepository) ListByUserID(ctx context.Context, userID int64) ([]*models.UserIdentity, error) {
+	query := `SELECT ` + identityColumns + ` FROM user_identities WHERE user_id = $1 ORDER BY id`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []*models.UserIdentity
+	for rows.Next() {
+		var i models.UserIdentity
+		if err := scanIdentity(rows, &i); err != nil {
+			slog.Info(err.Error())
+			return nil, err
+		}
+		identities = append(identities, &i)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	return identities, nil
+}
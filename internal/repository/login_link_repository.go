@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+type LoginLinkRepository interface {
+	Create(ctx context.Context, l *models.LoginLink) error
+	// CountSince returns how many links were requested for email and from
+	// ip since the time.
+	CountSince(ctx context.Context, email, ip string, since time.Time) (byEmail int, byIP int, err error)
+	// Use marks the unexpired, unused link with the token hash used and
+	// returns it.
+	Use(ctx context.Context, tokenHash string) (*models.LoginLink, bool, error)
+}
+
+type loginLinkRepository struct {
+	db *sql.DB
+}
+
+func NewLoginLinkRepository(db *sql.DB) LoginLinkRepository {
+	return &loginLinkRepository{db: db}
+}
+
+const loginLinkColumns = `id, email, token_hash, ip, return_to, expires_at, used_at, created_at`
+
+func scanLoginLink(row interface{ Scan(...any) error }, l *models.LoginLink) error {
+	return row.Scan(
+		&l.ID,
+		&l.Email,
+		&l.TokenHash,
+		&l.IP,
+		&l.ReturnTo,
+		&l.ExpiresAt,
+		&l.UsedAt,
+		&l.CreatedAt,
+	)
+}
+
+func (r *loginLinkRepository) Create(ctx context.Context, l *models.LoginLink) error {
+	query := `
+		INSERT INTO login_links (email, token_hash, ip, return_to, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + loginLinkColumns
+	err := scanLoginLink(r.db.QueryRowContext(ctx, query, l.Email, l.TokenHash, l.IP, l.ReturnTo, l.ExpiresAt), l)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *loginLinkRepository) CountSince(ctx context.Context, email, ip string, since time.Time) (int, int, error) {
+	query := `
+		SELECT count(*) FILTER (WHERE lower(email) = lower($1)), count(*) FILTER (WHERE ip = $2)
+		FROM login_links
+		WHERE created_at > $3 AND (lower(email) = lower($1) OR ip = $2)
+	`
+	var byEmail, byIP int
+	if err := r.db.QueryRowContext(ctx, query, email, ip, since).Scan(&byEmail, &byIP); err != nil {
+		slog.Info(err.Error())
+		return 0, 0, err
+	}
+	return byEmail, byIP, nil
+}
+
+func (r *loginLinkRepository) Use(ctx context.Context, tokenHash string) (*models.LoginLink, bool, error) {
+	query := `
+		UPDATE login_links SET used_at = now()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+		RETURNING ` + loginLinkColumns
+
+	var l models.LoginLink
+	err := scanLoginLink(r.db.QueryRowContext(ctx, query, tokenHash), &l)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &l, true, nil
+}
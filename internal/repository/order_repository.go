@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+type OrderRepository interface {
+	Create(ctx context.Context, order *models.Order) (bool, error)
+	GetByID(ctx context.Context, id int64) (*models.Order, bool, error)
+	ListByUserID(ctx context.Context, userID int64) ([]*models.Order, error)
+}
+
+type orderRepository struct {
+	db *sql.DB
+}
+
+func NewOrderRepository(db *sql.DB) OrderRepository {
+	return &orderRepository{db: db}
+}
+
+const orderColumns = `id, user_id, payment_event_id, provider, invoice_number, currency, subtotal_minor, tax_minor, total_minor, billing_name, billing_email, billing_address, billing_country, vat_id, created_at`
+
+func scanOrder(row interface{ Scan(...any) error }, o *models.Order) error {
+	return row.Scan(
+		&o.ID,
+		&o.UserID,
+		&o.PaymentEventID,
+		&o.Provider,
+		&o.InvoiceNumber,
+		&o.Currency,
+		&o.SubtotalMinor,
+		&o.TaxMinor,
+		&o.TotalMinor,
+		&o.BillingName,
+		&o.BillingEmail,
+		&o.BillingAddress,
+		&o.BillingCountry,
+		&o.VATID,
+		&o.CreatedAt,
+	)
+}
+
+// Create stores the order with its lines and assigns the next invoice
+// number. It returns false without doing anything when the payment event
+// already has an order.
+func (r *orderRepository) Create(ctx context.Context, order *models.Order) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM orders WHERE payment_event_id = $1)`
+	if err := tx.QueryRowContext(ctx, query, order.PaymentEventID).Scan(&exists); err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	// The counter row stays locked until commit, which serializes numbering.
+	var year int
+	var number int64
+	query = `
+		INSERT INTO invoice_counters (year, last)
+		VALUES (EXTRACT(YEAR FROM now())::int, 1)
+		ON CONFLICT (year) DO UPDATE SET last = invoice_counters.last + 1
+		RETURNING year, last
+	`
+	if err := tx.QueryRowContext(ctx, query).Scan(&year, &number); err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+	order.InvoiceNumber = fmt.Sprintf("%d-%06d", year, number)
+
+	query = `
+		INSERT INTO orders (user_id, payment_event_id, provider, invoice_number, currency, subtotal_minor, tax_minor, total_minor,
+			billing_name, billing_email, billing_address, billing_country, vat_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id, created_at
+	`
+	err = tx.QueryRowContext(ctx, query,
+		order.UserID,
+		order.PaymentEventID,
+		order.Provider,
+		order.InvoiceNumber,
+		order.Currency,
+		order.SubtotalMinor,
+		order.TaxMinor,
+		order.TotalMinor,
+		order.BillingName,
+		order.BillingEmail,
+		order.BillingAddress,
+		order.BillingCountry,
+		order.VATID,
+	).Scan(&order.ID, &order.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return false, nil
+		}
+		slog.Info(err.Error())
+		return false, err
+	}
+
+	query = `
+		INSERT INTO order_lines (order_id, description, quantity, unit_price_minor, amount_minor)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`
+	for _, line := range order.Lines {
+		line.OrderID = order.ID
+		err := tx.QueryRowContext(ctx, query, line.OrderID, line.Description, line.Quantity, line.UnitPriceMinor, line.AmountMinor).
+			Scan(&line.ID)
+		if err != nil {
+			slog.Info(err.Error())
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+	return true, nil
+}
+
+// GetByID returns the order with its lines.
+func (r *orderRepository) GetByID(ctx context.Context, id int64) (*models.Order, bool, error) {
+	query := `SELECT ` + orderColumns + ` FROM orders WHERE id = $1`
+
+	var order models.Order
+	err := scanOrder(r.db.QueryRowContext(ctx, query, id), &order)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+
+	query = `
+		SELECT id, order_id, description, quantity, unit_price_minor, amount_minor
+		FROM order_lines
+		WHERE order_id = $1
+		ORDER BY id
+	`
+	rows, err := r.db.QueryContext(ctx, query, id)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line models.OrderLine
+		if err := rows.Scan(&line.ID, &line.OrderID, &line.Description, &line.Quantity, &line.UnitPriceMinor, &line.AmountMinor); err != nil {
+			slog.Info(err.Error())
+			return nil, false, err
+		}
+		order.Lines = append(order.Lines, &line)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &order, true, nil
+}
+
+// ListByUserID returns the user's orders newest first, without their lines.
+func (r *orderRepository) ListByUserID(ctx context.Context, userID int64) ([]*models.Order, error) {
+	query := `SELECT ` + orderColumns + ` FROM orders WHERE user_id = $1 ORDER BY id DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []*models.Order
+	for rows.Next() {
+		var order models.Order
+		if err := scanOrder(rows, &order); err != nil {
+			slog.Info(err.Error())
+			return nil, err
+		}
+		orders = append(orders, &order)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	return orders, nil
+}
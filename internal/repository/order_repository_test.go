@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+// newTestPaymentEvent records a processed sale for an order to refer to.
+func newTestPaymentEvent(t *testing.T, db *sql.DB, saleID string) int64 {
+	t.Helper()
+
+	var id int64
+	query := `INSERT INTO payment_events (provider, sale_id, status) VALUES ('stripe', $1, 'processed') RETURNING id`
+	if err := db.QueryRow(query, saleID).Scan(&id); err != nil {
+		t.Fatalf("creating payment event: %v", err)
+	}
+	return id
+}
+
+func TestOrderInvoiceNumbers(t *testing.T) {
+	db := newTestDB(t)
+	r := NewOrderRepository(db)
+	ctx := context.Background()
+	userID := newTestUser(t, db, "buyer@example.com")
+
+	newOrder := func(eventID int64) *models.Order {
+		return &models.Order{
+			UserID:         &userID,
+			PaymentEventID: eventID,
+			Provider:       "stripe",
+			Currency:       "usd",
+			SubtotalMinor:  900,
+			TotalMinor:     900,
+			BillingEmail:   "buyer@example.com",
+			Lines:          []*models.OrderLine{{Description: "Creator pack", Quantity: 1, UnitPriceMinor: 900, AmountMinor: 900}},
+		}
+	}
+
+	// Concurrent orders get consecutive numbers without gaps or repeats.
+	const orders = 5
+	var wg sync.WaitGroup
+	numbers := make(chan string, orders)
+	for i := 0; i < orders; i++ {
+		eventID := newTestPaymentEvent(t, db, fmt.Sprintf("pi_%d", i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			order := newOrder(eventID)
+			if created, err := r.Create(ctx, order); err != nil || !created {
+				t.Errorf("Create = %v, %v, want created", created, err)
+				return
+			}
+			numbers <- order.InvoiceNumber
+		}()
+	}
+	wg.Wait()
+	close(numbers)
+
+	year := time.Now().Year()
+	seen := map[string]bool{}
+	for number := range numbers {
+		seen[number] = true
+	}
+	for i := 1; i <= orders; i++ {
+		if number := fmt.Sprintf("%d-%06d", year, i); !seen[number] {
+			t.Errorf("invoice number %s wasn't assigned", number)
+		}
+	}
+
+	// Recording the same payment again neither creates an order nor uses up
+	// a number.
+	again := newOrder(newTestPaymentEvent(t, db, "pi_again"))
+	if created, err := r.Create(ctx, again); err != nil || !created {
+		t.Fatalf("Create = %v, %v, want created", created, err)
+	}
+	if created, err := r.Create(ctx, newOrder(again.PaymentEventID)); err != nil || created {
+		t.Fatalf("Create of a recorded payment = %v, %v, want not created", created, err)
+	}
+	next := newOrder(newTestPaymentEvent(t, db, "pi_next"))
+	if _, err := r.Create(ctx, next); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if want := fmt.Sprintf("%d-%06d", year, orders+2); next.InvoiceNumber != want {
+		t.Errorf("invoice number = %s, want %s", next.InvoiceNumber, want)
+	}
+}
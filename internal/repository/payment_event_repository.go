@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+// stalePaymentEvent is how long an event may stay in processing before
+// another delivery is allowed to take it over.
+const stalePaymentEvent = "10 minutes"
+
+type PaymentEventRepository interface {
+	Claim(ctx context.Context, e *models.PaymentEvent) (bool, error)
+	GetBySaleID(ctx context.Context, provider, saleID string) (*models.PaymentEvent, bool, error)
+	MarkProcessed(ctx context.Context, id, userID int64) error
+	MarkFailed(ctx context.Context, id int64, reason string) error
+	MarkReversed(ctx context.Context, id int64, status string) error
+	MarkRestored(ctx context.Context, id int64) error
+	SetSubscription(ctx context.Context, id int64, sub *models.Subscription) error
+}
+
+type paymentEventRepository struct {
+	db *sql.DB
+}
+
+func NewPaymentEventRepository(db *sql.DB) PaymentEventRepository {
+	return &paymentEventRepository{db: db}
+}
+
+// Claim records e and marks it as processing. It returns false when the sale
+// was already processed or is being processed by another delivery, in which
+// case the caller must not act on it. Failed events can be claimed again.
+func (r *paymentEventRepository) Claim(ctx context.Context, e *models.PaymentEvent) (bool, error) {
+	query := `
+		INSERT INTO payment_events (provider, sale_id, status, email, product_id, price, payload)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (provider, sale_id) DO UPDATE
+		SET status = EXCLUDED.status,
+			email = EXCLUDED.email,
+			product_id = EXCLUDED.product_id,
+			price = EXCLUDED.price,
+			payload = EXCLUDED.payload,
+			error = '',
+			updated_at = now()
+		WHERE payment_events.status = $8
+			OR (payment_events.status = $3 AND payment_events.updated_at < now() - $9::interval)
+		RETURNING id, status, created_at, updated_at
+	`
+	err := r.db.QueryRowContext(ctx, query,
+		e.Provider, e.SaleID, models.PaymentEventProcessing, e.Email, e.ProductID, e.Price, e.Payload,
+		models.PaymentEventFailed, stalePaymentEvent,
+	).Scan(&e.ID, &e.Status, &e.CreatedAt, &e.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		slog.Info(err.Error())
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *paymentEventRepository) GetBySaleID(ctx context.Context, provider, saleID string) (*models.PaymentEvent, bool, error) {
+	query := `
+		SELECT id, provider, sale_id, status, user_id, email, product_id, price, payload, error, created_at, updated_at, processed_at,
+			subscription_id, period_start, period_end
+		FROM payment_events
+		WHERE provider = $1 AND sale_id = $2
+	`
+	var e models.PaymentEvent
+	err := r.db.QueryRowContext(ctx, query, provider, saleID).Scan(
+		&e.ID,
+		&e.Provider,
+		&e.SaleID,
+		&e.Status,
+		&e.UserID,
+		&e.Email,
+		&e.ProductID,
+		&e.Price,
+		&e.Payload,
+		&e.Error,
+		&e.CreatedAt,
+		&e.UpdatedAt,
+		&e.ProcessedAt,
+		&e.SubscriptionID,
+		&e.PeriodStart,
+		&e.PeriodEnd,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &e, true, nil
+}
+
+func (r *paymentEventRepository) MarkProcessed(ctx context.Context, id, userID int64) error {
+	query := `
+		UPDATE payment_events
+		SET status = $1,
+			user_id = $2,
+			processed_at = now(),
+			updated_at = now()
+		WHERE id = $3
+	`
+	_, err := r.db.ExecContext(ctx, query, models.PaymentEventProcessed, userID, id)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *paymentEventRepository) MarkFailed(ctx context.Context, id int64, reason string) error {
+	query := `
+		UPDATE payment_events
+		SET status = $1,
+			error = $2,
+			updated_at = now()
+		WHERE id = $3
+	`
+	_, err := r.db.ExecContext(ctx, query, models.PaymentEventFailed, reason, id)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+// MarkReversed moves a processed purchase to refunded or disputed.
+func (r *paymentEventRepository) MarkReversed(ctx context.Context, id int64, status string) error {
+	query := `
+		UPDATE payment_events
+		SET status = $1,
+			updated_at = now()
+		WHERE id = $2
+	`
+	_, err := r.db.ExecContext(ctx, query, status, id)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+// MarkRestored moves a disputed purchase back to processed once the dispute
+// was won.
+func (r *paymentEventRepository) MarkRestored(ctx context.Context, id int64) error {
+	query := `
+		UPDATE payment_events
+		SET status = $1,
+			updated_at = now()
+		WHERE id = $2
+			AND status = $3
+	`
+	_, err := r.db.ExecContext(ctx, query, models.PaymentEventProcessed, id, models.PaymentEventDisputed)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+// SetSubscription records that the payment paid for the current period of
+// sub.
+func (r *paymentEventRepository) SetSubscription(ctx context.Context, id int64, sub *models.Subscription) error {
+	query := `
+		UPDATE payment_events
+		SET subscription_id = $1,
+			period_start = $2,
+			period_end = $3,
+			updated_at = now()
+		WHERE id = $4
+	`
+	_, err := r.db.ExecContext(ctx, query, sub.ID, sub.CurrentPeriodStart, sub.CurrentPeriodEnd, id)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
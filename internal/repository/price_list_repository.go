@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/lib/pq"
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+type PriceListRepository interface {
+	// GetForCountry returns the price list covering country, falling back
+	// to the default list.
+	GetForCountry(ctx context.Context, country string) (*models.PriceList, error)
+}
+
+type priceListRepository struct {
+	db *sql.DB
+}
+
+func NewPriceListRepository(db *sql.DB) PriceListRepository {
+	return &priceListRepository{db: db}
+}
+
+func (r *priceListRepository) GetForCountry(ctx context.Context, country string) (*models.PriceList, error) {
+	query := `
+		SELECT id, code, name, currency, countries, is_default, created_at
+		FROM price_lists
+		WHERE $1 = ANY(countries) OR is_default
+		ORDER BY is_default
+		LIMIT 1
+	`
+	var l models.PriceList
+	err := r.db.QueryRowContext(ctx, query, country).
+		Scan(&l.ID, &l.Code, &l.Name, &l.Currency, pq.Array(&l.Countries), &l.IsDefault, &l.CreatedAt)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	return &l, nil
+}
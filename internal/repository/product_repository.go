@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+type ProductRepository interface {
+	GetByID(ctx context.Context, id int64) (*models.Product, bool, error)
+	GetPriced(ctx context.Context, id, priceListID int64) (*models.Product, bool, error)
+	GetByProviderPrice(ctx context.Context, provider, productID, currency string, priceMinor int64) (*models.Product, bool, error)
+	GetByIDPrice(ctx context.Context, id int64, currency string, priceMinor int64) (*models.Product, bool, error)
+	ListByProviderProduct(ctx context.Context, provider, productID, currency string) ([]*models.Product, error)
+	ListActive(ctx context.Context, priceListID int64) ([]*models.Product, error)
+}
+
+type productRepository struct {
+	db *sql.DB
+}
+
+func NewProductRepository(db *sql.DB) ProductRepository {
+	return &productRepository{db: db}
+}
+
+const productColumns = `id, provider, product_id, name, price_minor, currency, credits, interval, plan, active, sort_order, created_at, updated_at`
+
+func scanProduct(row interface{ Scan(...any) error }, p *models.Product) error {
+	return row.Scan(
+		&p.ID,
+		&p.Provider,
+		&p.ProductID,
+		&p.Name,
+		&p.PriceMinor,
+		&p.Currency,
+		&p.Credits,
+		&p.Interval,
+		&p.Plan,
+		&p.Active,
+		&p.SortOrder,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+}
+
+func (r *productRepository) GetByID(ctx context.Context, id int64) (*models.Product, bool, error) {
+	query := `SELECT ` + productColumns + ` FROM products WHERE id = $1`
+
+	var p models.Product
+	err := scanProduct(r.db.QueryRowContext(ctx, query, id), &p)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &p, true, nil
+}
+
+// pricedProductColumns select a product with the price, currency and
+// provider ID of one of its product_prices rows, aliased pp.
+const pricedProductColumns = `p.id, p.provider, COALESCE(NULLIF(pp.provider_product_id, ''), p.product_id), p.name, pp.price_minor, pp.currency, p.credits, p.interval, p.plan, p.active AND pp.active, p.sort_order, p.created_at, p.updated_at`
+
+// GetPriced returns the product with its price from the given price list.
+func (r *productRepository) GetPriced(ctx context.Context, id, priceListID int64) (*models.Product, bool, error) {
+	query := `
+		SELECT ` + pricedProductColumns + `
+		FROM products p
+		JOIN product_prices pp ON pp.product_id = p.id
+		WHERE p.id = $1 AND pp.price_list_id = $2
+	`
+
+	var p models.Product
+	err := scanProduct(r.db.QueryRowContext(ctx, query, id, priceListID), &p)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &p, true, nil
+}
+
+// GetByProviderPrice finds the active product a provider sale refers to. The
+// paid amount and currency must match a price in one of the price lists.
+func (r *productRepository) GetByProviderPrice(ctx context.Context, provider, productID, currency string, priceMinor int64) (*models.Product, bool, error) {
+	query := `
+		SELECT ` + pricedProductColumns + `
+		FROM products p
+		JOIN product_prices pp ON pp.product_id = p.id
+		WHERE p.provider = $1
+			AND COALESCE(NULLIF(pp.provider_product_id, ''), p.product_id) = $2
+			AND pp.currency = $3
+			AND pp.price_minor = $4
+			AND p.active AND pp.active
+		LIMIT 1
+	`
+
+	var p models.Product
+	err := scanProduct(r.db.QueryRowContext(ctx, query, provider, productID, currency, priceMinor), &p)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &p, true, nil
+}
+
+// GetByIDPrice returns the product priced at priceMinor in currency by one of
+// its price lists. Prices that are no longer offered still match, so
+// subscriptions started at them keep renewing.
+func (r *productRepository) GetByIDPrice(ctx context.Context, id int64, currency string, priceMinor int64) (*models.Product, bool, error) {
+	query := `
+		SELECT ` + pricedProductColumns + `
+		FROM products p
+		JOIN product_prices pp ON pp.product_id = p.id
+		WHERE p.id = $1 AND pp.currency = $2 AND pp.price_minor = $3
+		LIMIT 1
+	`
+
+	var p models.Product
+	err := scanProduct(r.db.QueryRowContext(ctx, query, id, currency, priceMinor), &p)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &p, true, nil
+}
+
+// ListByProviderProduct returns every active price of the products a
+// provider knows by productID in currency.
+func (r *productRepository) ListByProviderProduct(ctx context.Context, provider, productID, currency string) ([]*models.Product, error) {
+	query := `
+		SELECT ` + pricedProductColumns + `
+		FROM products p
+		JOIN product_prices pp ON pp.product_id = p.id
+		WHERE p.provider = $1
+			AND COALESCE(NULLIF(pp.provider_product_id, ''), p.product_id) = $2
+			AND pp.currency = $3
+			AND p.active AND pp.active
+	`
+	return r.list(ctx, query, provider, productID, currency)
+}
+
+// ListActive returns the catalog priced from the given price list.
+func (r *productRepository) ListActive(ctx context.Context, priceListID int64) ([]*models.Product, error) {
+	query := `
+		SELECT ` + pricedProductColumns + `
+		FROM products p
+		JOIN product_prices pp ON pp.product_id = p.id
+		WHERE pp.price_list_id = $1 AND p.active AND pp.active
+		ORDER BY p.sort_order, pp.price_minor
+	`
+	return r.list(ctx, query, priceListID)
+}
+
+func (r *productRepository) list(ctx context.Context, query string, args ...any) ([]*models.Product, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []*models.Product
+	for rows.Next() {
+		var p models.Product
+		if err := scanProduct(rows, &p); err != nil {
+			slog.Info(err.Error())
+			return nil, err
+		}
+		products = append(products, &p)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	return products, nil
+}
@@ -0,0 +1,313 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+type ReferralRepository interface {
+	GetCode(ctx context.Context, userID int64) (string, error)
+	SetCode(ctx context.Context, userID int64, code string) (bool, error)
+	GetReferrerByCode(ctx context.Context, code string) (*models.User, bool, error)
+	Create(ctx context.Context, referral *models.Referral) error
+	GetByRefereeID(ctx context.Context, refereeID int64) (*models.Referral, bool, error)
+	Reward(ctx context.Context, referral *models.Referral, reward *ReferralReward) (bool, error)
+	ReverseReward(ctx context.Context, paymentEventID int64) (*models.Referral, bool, error)
+	GetStats(ctx context.Context, referrerID int64) (*models.ReferralStats, error)
+}
+
+// ReferralReward is what a referral pays out and the limit that applies.
+type ReferralReward struct {
+	// PaymentEventID is the purchase that earned the reward.
+	PaymentEventID  int64
+	ReferrerCredits int64
+	RefereeCredits  int64
+	ExpiresAt       *time.Time
+	// MaxPerReferrer caps how many referrals a referrer is rewarded for.
+	MaxPerReferrer int
+}
+
+type referralRepository struct {
+	db *sql.DB
+}
+
+func NewReferralRepository(db *sql.DB) ReferralRepository {
+	return &referralRepository{db: db}
+}
+
+const referralColumns = `id, referrer_id, referee_id, status, reject_reason, created_at, resolved_at, payment_event_id`
+
+func scanReferral(row interface{ Scan(...any) error }, r *models.Referral) error {
+	return row.Scan(
+		&r.ID,
+		&r.ReferrerID,
+		&r.RefereeID,
+		&r.Status,
+		&r.RejectReason,
+		&r.CreatedAt,
+		&r.ResolvedAt,
+		&r.PaymentEventID,
+	)
+}
+
+// GetCode returns the user's referral code, or "" if none was assigned yet.
+func (r *referralRepository) GetCode(ctx context.Context, userID int64) (string, error) {
+	query := `SELECT COALESCE(referral_code, '') FROM users WHERE id = $1`
+	var code string
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&code)
+	if err != nil {
+		slog.Info(err.Error())
+		return "", err
+	}
+	return code, nil
+}
+
+// SetCode assigns a referral code to a user who has none. It returns false
+// when the code is already taken by someone else.
+func (r *referralRepository) SetCode(ctx context.Context, userID int64, code string) (bool, error) {
+	query := `UPDATE users SET referral_code = $1 WHERE id = $2 AND referral_code IS NULL`
+	_, err := r.db.ExecContext(ctx, query, code, userID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return false, nil
+		}
+		slog.Info(err.Error())
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *referralRepository) GetReferrerByCode(ctx context.Context, code string) (*models.User, bool, error) {
+	var user models.User
+	query := "SELECT id, email, name FROM users WHERE referral_code = $1"
+	err := r.db.QueryRowContext(ctx, query, code).Scan(&user.ID, &user.Email, &user.Name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &user, true, nil
+}
+
+func (r *referralRepository) Create(ctx context.Context, referral *models.Referral) error {
+	query := `
+		INSERT INTO referrals (referrer_id, referee_id, status, reject_reason, resolved_at)
+		VALUES ($1, $2, $3, $4, CASE WHEN $3 = 'pending' THEN NULL ELSE now() END)
+		RETURNING ` + referralColumns
+
+	err := scanReferral(r.db.QueryRowContext(ctx, query,
+		referral.ReferrerID,
+		referral.RefereeID,
+		referral.Status,
+		referral.RejectReason,
+	), referral)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *referralRepository) GetByRefereeID(ctx context.Context, refereeID int64) (*models.Referral, bool, error) {
+	query := `SELECT ` + referralColumns + ` FROM referrals WHERE referee_id = $1`
+
+	var referral models.Referral
+	err := scanReferral(r.db.QueryRowContext(ctx, query, refereeID), &referral)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &referral, true, nil
+}
+
+// Reward marks a pending referral as rewarded and grants both parties their
+// credits in one transaction. It returns false when the referral was no
+// longer pending. A referrer who reached the cap gets the referral rejected
+// instead, and ErrReferralCapReached. The referrer's user row is locked
+// while the rewarded referrals are counted, so concurrent purchases can't
+// both slip under the cap.
+func (r *referralRepository) Reward(ctx context.Context, referral *models.Referral, reward *ReferralReward) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var rewarded int
+	query := `
+		SELECT (SELECT count(*) FROM referrals WHERE referrer_id = users.id AND status = $2)
+		FROM users
+		WHERE id = $1
+		FOR UPDATE
+	`
+	if err := tx.QueryRowContext(ctx, query, referral.ReferrerID, models.ReferralRewarded).Scan(&rewarded); err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+
+	status, reason := models.ReferralRewarded, ""
+	if rewarded >= reward.MaxPerReferrer {
+		status, reason = models.ReferralRejected, "referrer cap reached"
+	}
+
+	query = `
+		UPDATE referrals
+		SET status = $1, reject_reason = $2, payment_event_id = $3, resolved_at = now()
+		WHERE id = $4 AND status = $5
+	`
+	result, err := tx.ExecContext(ctx, query, status, reason, reward.PaymentEventID, referral.ID, models.ReferralPending)
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	if status == models.ReferralRejected {
+		if err := tx.Commit(); err != nil {
+			slog.Info(err.Error())
+			return false, err
+		}
+		return false, ErrReferralCapReached
+	}
+
+	for _, t := range referralGrants(referral, reward) {
+		if t.Amount <= 0 {
+			continue
+		}
+		if err := applyCreditTransaction(ctx, tx, t); err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+	return true, nil
+}
+
+// ReverseReward takes back the rewards of the referral that was rewarded for
+// the given purchase and marks it reversed. Rewards that were already spent
+// leave the balance negative. It returns false when no rewarded referral
+// belongs to the purchase.
+func (r *referralRepository) ReverseReward(ctx context.Context, paymentEventID int64) (*models.Referral, bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE referrals
+		SET status = $1, resolved_at = now()
+		WHERE payment_event_id = $2 AND status = $3
+		RETURNING ` + referralColumns
+
+	var referral models.Referral
+	err = scanReferral(tx.QueryRowContext(ctx, query, models.ReferralReversed, paymentEventID, models.ReferralRewarded), &referral)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+
+	grants := referralGrants(&referral, &ReferralReward{})
+	for _, grant := range grants {
+		var id, amount int64
+		query := `SELECT id, amount FROM credit_transactions WHERE kind = $1 AND reference_type = $2 AND reference_id = $3`
+		err := tx.QueryRowContext(ctx, query, grant.Kind, grant.ReferenceType, grant.ReferenceID).Scan(&id, &amount)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			slog.Info(err.Error())
+			return nil, false, err
+		}
+
+		err = applyCreditTransaction(ctx, tx, &models.CreditTransaction{
+			UserID:        grant.UserID,
+			Kind:          models.CreditReversal,
+			Amount:        -amount,
+			Reason:        "referral reward reversed",
+			ReferenceType: grant.ReferenceType,
+			ReferenceID:   grant.ReferenceID,
+			AllowNegative: true,
+			Offsets:       id,
+		})
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &referral, true, nil
+}
+
+// referralGrants are the credits a referral pays out, one for each party.
+// Their references identify the grants of a referral.
+func referralGrants(referral *models.Referral, reward *ReferralReward) []*models.CreditTransaction {
+	reference := strconv.FormatInt(referral.ID, 10)
+	return []*models.CreditTransaction{
+		{
+			UserID:        referral.ReferrerID,
+			Kind:          models.CreditReferral,
+			Amount:        reward.ReferrerCredits,
+			Reason:        "referral reward",
+			ReferenceType: "referral",
+			ReferenceID:   reference + ":referrer",
+			ExpiresAt:     reward.ExpiresAt,
+		},
+		{
+			UserID:        referral.RefereeID,
+			Kind:          models.CreditReferral,
+			Amount:        reward.RefereeCredits,
+			Reason:        "referral welcome bonus",
+			ReferenceType: "referral",
+			ReferenceID:   reference + ":referee",
+			ExpiresAt:     reward.ExpiresAt,
+		},
+	}
+}
+
+func (r *referralRepository) GetStats(ctx context.Context, referrerID int64) (*models.ReferralStats, error) {
+	query := `
+		SELECT
+			count(*) FILTER (WHERE status = $2),
+			count(*) FILTER (WHERE status = $3),
+			count(*) FILTER (WHERE status = $4),
+			COALESCE((
+				SELECT sum(amount) FROM credit_transactions
+				WHERE user_id = $1 AND kind IN ($5, $6) AND reference_type = 'referral' AND reference_id LIKE '%:referrer'
+			), 0)
+		FROM referrals
+		WHERE referrer_id = $1
+	`
+	var stats models.ReferralStats
+	err := r.db.QueryRowContext(ctx, query, referrerID,
+		models.ReferralPending, models.ReferralRewarded, models.ReferralRejected, models.CreditReferral, models.CreditReversal,
+	).Scan(&stats.Pending, &stats.Rewarded, &stats.Rejected, &stats.CreditsEarned)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	return &stats, nil
+}
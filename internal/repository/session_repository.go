@@ -0,0 +1,248 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+type SessionRepository interface {
+	Create(ctx context.Context, s *models.Session) error
+	GetByID(ctx context.Context, id string) (*models.Session, bool, error)
+	Touch(ctx context.Context, id, ip string) error
+	// MarkTwoFactor records that a two-factor code was entered on the
+	// session.
+	MarkTwoFactor(ctx context.Context, id string) error
+	// ListActive returns the user's sessions that are neither revoked nor
+	// expired, most recently seen first.
+	ListActive(ctx context.Context, userID int64) ([]*models.Session, error)
+	// Revoke ends one of the user's sessions. It reports whether an active
+	// session was revoked.
+	Revoke(ctx context.Context, userID int64, id string) (bool, error)
+	RevokeAll(ctx context.Context, userID int64) error
+	AddRefreshToken(ctx context.Context, t *models.RefreshToken) error
+	// RotateRefreshToken exchanges the refresh token with the hash for next
+	// and extends its session until expiresAt. A token that was already
+	// rotated is accepted again within reuseGrace, for requests that raced
+	// to refresh, but isn't exchanged a second time: next isn't issued and
+	// the client keeps the token the first exchange handed out. It reports
+	// whether next was issued. Later reuse revokes the session and returns
+	// ErrRefreshTokenReused.
+	RotateRefreshToken(ctx context.Context, tokenHash string, next *models.RefreshToken, expiresAt time.Time, reuseGrace time.Duration) (*models.Session, bool, error)
+}
+
+type sessionRepository struct {
+	db *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+const sessionColumns = `id, user_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at, two_factor_at`
+
+func scanSession(row interface{ Scan(...any) error }, s *models.Session) error {
+	return row.Scan(
+		&s.ID,
+		&s.UserID,
+		&s.UserAgent,
+		&s.IP,
+		&s.CreatedAt,
+		&s.LastSeenAt,
+		&s.ExpiresAt,
+		&s.RevokedAt,
+		&s.TwoFactorAt,
+	)
+}
+
+func (r *sessionRepository) Create(ctx context.Context, s *models.Session) error {
+	query := `
+		INSERT INTO sessions (id, user_id, user_agent, ip, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + sessionColumns
+	err := scanSession(r.db.QueryRowContext(ctx, query, s.ID, s.UserID, s.UserAgent, s.IP, s.ExpiresAt), s)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *sessionRepository) GetByID(ctx context.Context, id string) (*models.Session, bool, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = $1`
+
+	var s models.Session
+	err := scanSession(r.db.QueryRowContext(ctx, query, id), &s)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &s, true, nil
+}
+
+func (r *sessionRepository) Touch(ctx context.Context, id, ip string) error {
+	query := `UPDATE sessions SET last_seen_at = now(), ip = $2 WHERE id = $1`
+	if _, err := r.db.ExecContext(ctx, query, id, ip); err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *sessionRepository) MarkTwoFactor(ctx context.Context, id string) error {
+	query := `UPDATE sessions SET two_factor_at = now() WHERE id = $1`
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *sessionRepository) ListActive(ctx context.Context, userID int64) ([]*models.Session, error) {
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > now()
+		ORDER BY last_seen_at DESC
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*models.Session
+	for rows.Next() {
+		var s models.Session
+		if err := scanSession(rows, &s); err != nil {
+			slog.Info(err.Error())
+			return nil, err
+		}
+		sessions = append(sessions, &s)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *sessionRepository) Revoke(ctx context.Context, userID int64, id string) (bool, error) {
+	query := `UPDATE sessions SET revoked_at = now() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > now()`
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *sessionRepository) RevokeAll(ctx context.Context, userID int64) error {
+	query := `UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`
+	if _, err := r.db.ExecContext(ctx, query, userID); err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *sessionRepository) AddRefreshToken(ctx context.Context, t *models.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (session_id, token_hash)
+		VALUES ($1, $2)
+		RETURNING id, created_at`
+	if err := r.db.QueryRowContext(ctx, query, t.SessionID, t.TokenHash).Scan(&t.ID, &t.CreatedAt); err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *sessionRepository) RotateRefreshToken(ctx context.Context, tokenHash string, next *models.RefreshToken, expiresAt time.Time, reuseGrace time.Duration) (*models.Session, bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	var current models.RefreshToken
+	query := `SELECT id, session_id, used_at FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, tokenHash).Scan(&current.ID, &current.SessionID, &current.UsedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, ErrRefreshTokenInvalid
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+
+	var session models.Session
+	query = `SELECT ` + sessionColumns + ` FROM sessions WHERE id = $1 FOR UPDATE`
+	if err := scanSession(tx.QueryRowContext(ctx, query, current.SessionID), &session); err != nil {
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return nil, false, ErrRefreshTokenInvalid
+	}
+
+	if current.UsedAt != nil {
+		if time.Since(*current.UsedAt) > reuseGrace {
+			query = `UPDATE sessions SET revoked_at = now() WHERE id = $1`
+			if _, err := tx.ExecContext(ctx, query, session.ID); err != nil {
+				slog.Info(err.Error())
+				return nil, false, err
+			}
+			if err := tx.Commit(); err != nil {
+				slog.Info(err.Error())
+				return nil, false, err
+			}
+			slog.Info(ErrRefreshTokenReused.Error(), "sessionID", session.ID, "userID", session.UserID)
+			return nil, false, ErrRefreshTokenReused
+		}
+		// The token was exchanged moments ago. Issuing another one would
+		// fork the family, so the session is only handed back.
+		if err := tx.Commit(); err != nil {
+			slog.Info(err.Error())
+			return nil, false, err
+		}
+		return &session, false, nil
+	}
+
+	query = `UPDATE refresh_tokens SET used_at = now() WHERE id = $1`
+	if _, err := tx.ExecContext(ctx, query, current.ID); err != nil {
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+
+	next.SessionID = session.ID
+	query = `INSERT INTO refresh_tokens (session_id, token_hash) VALUES ($1, $2) RETURNING id, created_at`
+	if err := tx.QueryRowContext(ctx, query, next.SessionID, next.TokenHash).Scan(&next.ID, &next.CreatedAt); err != nil {
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+
+	query = `UPDATE sessions SET expires_at = $2, last_seen_at = now() WHERE id = $1 RETURNING ` + sessionColumns
+	if err := scanSession(tx.QueryRowContext(ctx, query, session.ID, expiresAt), &session); err != nil {
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+
+	return &session, true, nil
+}
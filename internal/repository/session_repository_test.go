@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+func TestRotateRefreshTokenReplay(t *testing.T) {
+	db := newTestDB(t)
+	r := NewSessionRepository(db)
+	ctx := context.Background()
+	userID := newTestUser(t, db, "ada@example.com")
+
+	session := &models.Session{ID: "session-1", UserID: userID, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := r.Create(ctx, session); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := r.AddRefreshToken(ctx, &models.RefreshToken{SessionID: session.ID, TokenHash: "first"}); err != nil {
+		t.Fatalf("AddRefreshToken: %v", err)
+	}
+
+	expiresAt := time.Now().Add(2 * time.Hour)
+	if _, issued, err := r.RotateRefreshToken(ctx, "first", &models.RefreshToken{TokenHash: "second"}, expiresAt, time.Minute); err != nil || !issued {
+		t.Fatalf("RotateRefreshToken = %v, %v, want issued", issued, err)
+	}
+
+	// A replay within the grace period doesn't fork the family.
+	got, issued, err := r.RotateRefreshToken(ctx, "first", &models.RefreshToken{TokenHash: "forked"}, expiresAt, time.Minute)
+	if err != nil || issued || got.ID != session.ID {
+		t.Fatalf("replay within grace = %v, %v, %v, want the session without a new token", got, issued, err)
+	}
+	if n := countRows(t, db, `SELECT count(*) FROM refresh_tokens WHERE session_id = $1`, session.ID); n != 2 {
+		t.Errorf("refresh tokens = %d, want 2", n)
+	}
+	if _, _, err := r.RotateRefreshToken(ctx, "forked", &models.RefreshToken{TokenHash: "third"}, expiresAt, time.Minute); err != ErrRefreshTokenInvalid {
+		t.Errorf("refresh with the replay's token = %v, want %v", err, ErrRefreshTokenInvalid)
+	}
+
+	// Later reuse revokes the session.
+	if _, _, err := r.RotateRefreshToken(ctx, "first", &models.RefreshToken{TokenHash: "late"}, expiresAt, 0); err != ErrRefreshTokenReused {
+		t.Fatalf("late replay = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	if _, _, err := r.RotateRefreshToken(ctx, "second", &models.RefreshToken{TokenHash: "third"}, expiresAt, time.Minute); err != ErrRefreshTokenInvalid {
+		t.Errorf("refresh after revocation = %v, want %v", err, ErrRefreshTokenInvalid)
+	}
+}
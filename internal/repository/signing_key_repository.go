@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+type SigningKeyRepository interface {
+	Create(ctx context.Context, k *models.SigningKey) error
+	// List returns all keys, retired ones included, oldest first.
+	List(ctx context.Context) ([]*models.SigningKey, error)
+	// Activate makes the key sign from now on. It reports whether a key
+	// that isn't retired was activated.
+	Activate(ctx context.Context, kid string) (bool, error)
+	// Retire stops the key from verifying. It reports whether the key was
+	// retired now.
+	Retire(ctx context.Context, kid string) (bool, error)
+}
+
+type signingKeyRepository struct {
+	db *sql.DB
+}
+
+func NewSigningKeyRepository(db *sql.DB) SigningKeyRepository {
+	return &signingKeyRepository{db: db}
+}
+
+const signingKeyColumns = `kid, algorithm, private_key, public_key, created_at, activated_at, retired_at`
+
+func scanSigningKey(row interface{ Scan(...any) error }, k *models.SigningKey) error {
+	return row.Scan(
+		&k.KID,
+		&k.Algorithm,
+		&k.PrivateKey,
+		&k.PublicKey,
+		&k.CreatedAt,
+		&k.ActivatedAt,
+		&k.RetiredAt,
+	)
+}
+
+func (r *signingKeyRepository) Create(ctx context.Context, k *models.SigningKey) error {
+	query := `
+		INSERT INTO signing_keys (kid, algorithm, private_key, public_key, activated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + signingKeyColumns
+	err := scanSigningKey(r.db.QueryRowContext(ctx, query, k.KID, k.Algorithm, k.PrivateKey, k.PublicKey, k.ActivatedAt), k)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *signingKeyRepository) List(ctx context.Context) ([]*models.SigningKey, error) {
+	query := `SELECT ` + signingKeyColumns + ` FROM signing_keys ORDER BY created_at`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*models.SigningKey
+	for rows.Next() {
+		var k models.SigningKey
+		if err := scanSigningKey(rows, &k); err != nil {
+			slog.Info(err.Error())
+			return nil, err
+		}
+		keys = append(keys, &k)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *signingKeyRepository) Activate(ctx context.Context, kid string) (bool, error) {
+	query := `UPDATE signing_keys SET activated_at = now() WHERE kid = $1 AND retired_at IS NULL`
+	return r.exec(ctx, query, kid)
+}
+
+func (r *signingKeyRepository) Retire(ctx context.Context, kid string) (bool, error) {
+	query := `UPDATE signing_keys SET retired_at = now() WHERE kid = $1 AND retired_at IS NULL`
+	return r.exec(ctx, query, kid)
+}
+
+func (r *signingKeyRepository) exec(ctx context.Context, query string, args ...any) (bool, error) {
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+	return n > 0, nil
+}
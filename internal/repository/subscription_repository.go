@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+// grantSlack keeps period boundaries that drift by a few seconds from
+// triggering a second monthly grant inside the same period.
+const grantSlack = "1 day"
+
+type SubscriptionRepository interface {
+	Upsert(ctx context.Context, sub *models.Subscription) error
+	GetByID(ctx context.Context, id int64) (*models.Subscription, bool, error)
+	GetByProviderID(ctx context.Context, provider, providerSubscriptionID string) (*models.Subscription, bool, error)
+	GetCurrentByUserID(ctx context.Context, userID int64) (*models.Subscription, bool, error)
+	Update(ctx context.Context, sub *models.Subscription) error
+	ListDueForGrant(ctx context.Context, limit int) ([]*models.Subscription, error)
+	AdvanceGrant(ctx context.Context, id int64, from, to time.Time) (bool, error)
+}
+
+type subscriptionRepository struct {
+	db *sql.DB
+}
+
+func NewSubscriptionRepository(db *sql.DB) SubscriptionRepository {
+	return &subscriptionRepository{db: db}
+}
+
+const subscriptionColumns = `id, user_id, product_id, provider, provider_subscription_id, status, current_period_start, current_period_end, cancel_at_period_end, next_grant_at, canceled_at, created_at, updated_at`
+
+func scanSubscription(row interface{ Scan(...any) error }, s *models.Subscription) error {
+	return row.Scan(
+		&s.ID,
+		&s.UserID,
+		&s.ProductID,
+		&s.Provider,
+		&s.ProviderSubscriptionID,
+		&s.Status,
+		&s.CurrentPeriodStart,
+		&s.CurrentPeriodEnd,
+		&s.CancelAtPeriodEnd,
+		&s.NextGrantAt,
+		&s.CanceledAt,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+	)
+}
+
+// Upsert creates the subscription, or restarts it when the provider reports a
+// subscription it already knows about as started again. The grant schedule
+// of an existing subscription is kept.
+func (r *subscriptionRepository) Upsert(ctx context.Context, sub *models.Subscription) error {
+	query := `
+		INSERT INTO subscriptions (user_id, product_id, provider, provider_subscription_id, status,
+			current_period_start, current_period_end, cancel_at_period_end, next_grant_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (provider, provider_subscription_id) DO UPDATE
+		SET product_id = EXCLUDED.product_id,
+			status = EXCLUDED.status,
+			current_period_start = EXCLUDED.current_period_start,
+			current_period_end = EXCLUDED.current_period_end,
+			cancel_at_period_end = EXCLUDED.cancel_at_period_end,
+			canceled_at = NULL,
+			updated_at = now()
+		RETURNING ` + subscriptionColumns
+	row := r.db.QueryRowContext(ctx, query,
+		sub.UserID, sub.ProductID, sub.Provider, sub.ProviderSubscriptionID, sub.Status,
+		sub.CurrentPeriodStart, sub.CurrentPeriodEnd, sub.CancelAtPeriodEnd, sub.NextGrantAt,
+	)
+	if err := scanSubscription(row, sub); err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *subscriptionRepository) GetByID(ctx context.Context, id int64) (*models.Subscription, bool, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM subscriptions WHERE id = $1`
+
+	var sub models.Subscription
+	err := scanSubscription(r.db.QueryRowContext(ctx, query, id), &sub)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &sub, true, nil
+}
+
+func (r *subscriptionRepository) GetByProviderID(ctx context.Context, provider, providerSubscriptionID string) (*models.Subscription, bool, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM subscriptions WHERE provider = $1 AND provider_subscription_id = $2`
+
+	var sub models.Subscription
+	err := scanSubscription(r.db.QueryRowContext(ctx, query, provider, providerSubscriptionID), &sub)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &sub, true, nil
+}
+
+// GetCurrentByUserID returns the user's live subscription, or the most recent
+// one if they have all been canceled.
+func (r *subscriptionRepository) GetCurrentByUserID(ctx context.Context, userID int64) (*models.Subscription, bool, error) {
+	query := `
+		SELECT ` + subscriptionColumns + `
+		FROM subscriptions
+		WHERE user_id = $1
+		ORDER BY status = $2, created_at DESC
+		LIMIT 1
+	`
+
+	var sub models.Subscription
+	err := scanSubscription(r.db.QueryRowContext(ctx, query, userID, models.SubscriptionCanceled), &sub)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &sub, true, nil
+}
+
+func (r *subscriptionRepository) Update(ctx context.Context, sub *models.Subscription) error {
+	query := `
+		UPDATE subscriptions
+		SET status = $1,
+			current_period_start = $2,
+			current_period_end = $3,
+			cancel_at_period_end = $4,
+			canceled_at = $5,
+			updated_at = now()
+		WHERE id = $6
+	`
+	_, err := r.db.ExecContext(ctx, query,
+		sub.Status, sub.CurrentPeriodStart, sub.CurrentPeriodEnd, sub.CancelAtPeriodEnd, sub.CanceledAt, sub.ID,
+	)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+// ListDueForGrant returns active subscriptions whose next monthly grant is due
+// and still falls inside the paid period.
+func (r *subscriptionRepository) ListDueForGrant(ctx context.Context, limit int) ([]*models.Subscription, error) {
+	query := `
+		SELECT ` + subscriptionColumns + `
+		FROM subscriptions
+		WHERE status = $1
+			AND next_grant_at <= now()
+			AND next_grant_at < current_period_end - $2::interval
+		ORDER BY next_grant_at
+		LIMIT $3
+	`
+	rows, err := r.db.QueryContext(ctx, query, models.SubscriptionActive, grantSlack, limit)
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []*models.Subscription
+	for rows.Next() {
+		var sub models.Subscription
+		if err := scanSubscription(rows, &sub); err != nil {
+			slog.Info(err.Error())
+			return nil, err
+		}
+		subs = append(subs, &sub)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+	return subs, nil
+}
+
+// AdvanceGrant moves the grant schedule from one grant to the next. It
+// returns false when another scheduler already advanced it.
+func (r *subscriptionRepository) AdvanceGrant(ctx context.Context, id int64, from, to time.Time) (bool, error) {
+	query := `UPDATE subscriptions SET next_grant_at = $1, updated_at = now() WHERE id = $2 AND next_grant_at = $3`
+	res, err := r.db.ExecContext(ctx, query, to, id, from)
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+	return n == 1, nil
+}
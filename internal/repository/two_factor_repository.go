@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+type TwoFactorRepository interface {
+	Get(ctx context.Context, userID int64) (*models.TwoFactor, bool, error)
+	// SetPending starts enrolling an authenticator app with the secret,
+	// replacing an enrollment that wasn't confirmed. It reports false if
+	// the user already has a confirmed one.
+	SetPending(ctx context.Context, userID int64, secret []byte) (bool, error)
+	// Confirm finishes enrolling with a code of step and sets the recovery
+	// codes. It returns ErrTwoFactorNotPending unless an enrollment is
+	// pending.
+	Confirm(ctx context.Context, userID, step int64, codeHashes []string) error
+	// Delete removes the user's authenticator app and recovery codes.
+	Delete(ctx context.Context, userID int64) error
+	// UseStep records that a code of step was entered. It reports false if a
+	// code of the step, or a later one, was already used.
+	UseStep(ctx context.Context, userID, step int64) (bool, error)
+	// UseRecoveryCode marks the user's unused recovery code with the hash
+	// used. It reports whether there was one.
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error)
+	// RecordAttempt counts an attempt to enter a code before the code is
+	// checked, so that concurrent guesses can't get past the limit. It
+	// reports false, without counting, once maxAttempts attempts in a row
+	// were made and the last was within lockout. Using a code resets the
+	// count.
+	RecordAttempt(ctx context.Context, userID int64, maxAttempts int, lockout time.Duration) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error
+	CountRecoveryCodes(ctx context.Context, userID int64) (int, error)
+}
+
+type twoFactorRepository struct {
+	db *sql.DB
+}
+
+func NewTwoFactorRepository(db *sql.DB) TwoFactorRepository {
+	return &twoFactorRepository{db: db}
+}
+
+const twoFactorColumns = `user_id, secret, confirmed_at, last_used_step, failed_attempts, last_failed_at, created_at`
+
+func scanTwoFactor(row interface{ Scan(...any) error }, t *models.TwoFactor) error {
+	return row.Scan(
+		&t.UserID,
+		&t.Secret,
+		&t.ConfirmedAt,
+		&t.LastUsedStep,
+		&t.FailedAttempts,
+		&t.LastFailedAt,
+		&t.CreatedAt,
+	)
+}
+
+func (r *twoFactorRepository) Get(ctx context.Context, userID int64) (*models.TwoFactor, bool, error) {
+	query := `SELECT ` + twoFactorColumns + ` FROM two_factor WHERE user_id = $1`
+
+	var t models.TwoFactor
+	err := scanTwoFactor(r.db.QueryRowContext(ctx, query, userID), &t)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &t, true, nil
+}
+
+func (r *twoFactorRepository) SetPending(ctx context.Context, userID int64, secret []byte) (bool, error) {
+	query := `
+		INSERT INTO two_factor (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, failed_attempts = 0, last_failed_at = NULL, created_at = now()
+		WHERE two_factor.confirmed_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *twoFactorRepository) Confirm(ctx context.Context, userID, step int64, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE two_factor
+		SET confirmed_at = now(), last_used_step = $2, failed_attempts = 0
+		WHERE user_id = $1 AND confirmed_at IS NULL`
+	result, err := tx.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	if n == 0 {
+		return ErrTwoFactorNotPending
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *twoFactorRepository) Delete(ctx context.Context, userID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`DELETE FROM recovery_codes WHERE user_id = $1`,
+		`DELETE FROM two_factor WHERE user_id = $1`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			slog.Info(err.Error())
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *twoFactorRepository) UseStep(ctx context.Context, userID, step int64) (bool, error) {
+	query := `
+		UPDATE two_factor
+		SET last_used_step = $2, failed_attempts = 0
+		WHERE user_id = $1 AND last_used_step < $2`
+	result, err := r.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *twoFactorRepository) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE recovery_codes SET used_at = now() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	result, err := tx.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+	if n == 0 {
+		return false, nil
+	}
+
+	query = `UPDATE two_factor SET failed_attempts = 0 WHERE user_id = $1`
+	if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *twoFactorRepository) RecordAttempt(ctx context.Context, userID int64, maxAttempts int, lockout time.Duration) (bool, error) {
+	query := `
+		UPDATE two_factor
+		SET failed_attempts = failed_attempts + 1, last_failed_at = now()
+		WHERE user_id = $1
+			AND (failed_attempts < $2 OR last_failed_at IS NULL OR last_failed_at < now() - $3 * interval '1 second')`
+	result, err := r.db.ExecContext(ctx, query, userID, maxAttempts, lockout.Seconds())
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		slog.Info(err.Error())
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *twoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *twoFactorRepository) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	query := `SELECT count(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+
+	var n int
+	if err := r.db.QueryRowContext(ctx, query, userID).Scan(&n); err != nil {
+		slog.Info(err.Error())
+		return 0, err
+	}
+	return n, nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, q querier, userID int64, codeHashes []string) error {
+	query := `DELETE FROM recovery_codes WHERE user_id = $1`
+	if _, err := q.ExecContext(ctx, query, userID); err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+
+	query = `INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+	for _, hash := range codeHashes {
+		if _, err := q.ExecContext(ctx, query, userID, hash); err != nil {
+			slog.Info(err.Error())
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTwoFactorRecordAttemptLimitsConcurrentGuesses(t *testing.T) {
+	db := newTestDB(t)
+	r := NewTwoFactorRepository(db)
+	ctx := context.Background()
+	userID := newTestUser(t, db, "ada@example.com")
+
+	if _, err := r.SetPending(ctx, userID, []byte("secret")); err != nil {
+		t.Fatalf("SetPending: %v", err)
+	}
+
+	// Guesses made at once get no more attempts than guesses in a row.
+	const maxAttempts, guesses = 5, 20
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := r.RecordAttempt(ctx, userID, maxAttempts, time.Hour)
+			if err != nil {
+				t.Errorf("RecordAttempt: %v", err)
+			}
+			if ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := allowed.Load(); got != maxAttempts {
+		t.Errorf("allowed %d attempts, want %d", got, maxAttempts)
+	}
+
+	// Once the lockout has passed, attempts are allowed again.
+	if ok, err := r.RecordAttempt(ctx, userID, maxAttempts, 0); err != nil || !ok {
+		t.Errorf("RecordAttempt after the lockout = %v, %v, want allowed", ok, err)
+	}
+}
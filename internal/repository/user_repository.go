@@ -12,8 +12,12 @@ import (
 type UserRepository interface {
 	GetByID(ctx context.Context, id int64) (*models.User, bool, error)
 	GetByEmail(ctx context.Context, email string) (*models.User, bool, error)
+	GetByLinkedEmail(ctx context.Context, email string) (*models.User, bool, error)
 	Create(ctx context.Context, user *models.User) (int64, error)
 	Remove(ctx context.Context, userID int64) error
+	Lock(ctx context.Context, userID int64, reason string) error
+	Unlock(ctx context.Context, userID int64, reason string) error
+	UpdateBilling(ctx context.Context, user *models.User) error
 }
 
 type userRepository struct {
@@ -26,8 +30,12 @@ func NewUserRepository(db *sql.DB) UserRepository {
 
 func (r *userRepository) GetByID(ctx context.Context, id int64) (*models.User, bool, error) {
 	var user models.User
-	query := "SELECT id, name, email, profile_picture FROM users WHERE id = $1"
-	err := r.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Name, &user.Email, &user.ProfilePicture)
+	query := `
+		SELECT id, name, email, profile_picture, locked_at, lock_reason, billing_name, billing_address, billing_country, vat_id
+		FROM users WHERE id = $1
+	`
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Name, &user.Email, &user.ProfilePicture, &user.LockedAt, &user.LockReason,
+		&user.BillingName, &user.BillingAddress, &user.BillingCountry, &user.VATID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, false, nil
@@ -38,9 +46,30 @@ func (r *userRepository) GetByID(ctx context.Context, id int64) (*models.User, b
 	return &user, true, nil
 }
 
+// GetByEmail finds the user whose primary address is email, ignoring case.
 func (r *userRepository) GetByEmail(ctx context.Context, email string) (*models.User, bool, error) {
 	var user models.User
-	query := "SELECT id, google_id, email, name FROM users WHERE email = $1"
+	query := "SELECT id, google_id, email, name FROM users WHERE lower(email) = lower($1)"
+	err := r.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.GoogleID, &user.Email, &user.Name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &user, true, nil
+}
+
+// GetByLinkedEmail finds the user who verified email as an additional
+// address. Like GetByEmail, it ignores case.
+func (r *userRepository) GetByLinkedEmail(ctx context.Context, email string) (*models.User, bool, error) {
+	var user models.User
+	query := `
+		SELECT u.id, u.google_id, u.email, u.name
+		FROM user_emails e JOIN users u ON u.id = e.user_id
+		WHERE lower(e.email) = lower($1)
+	`
 	err := r.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.GoogleID, &user.Email, &user.Name)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -73,3 +102,38 @@ func (r *userRepository) Remove(ctx context.Context, id int64) error {
 	}
 	return nil
 }
+
+func (r *userRepository) Lock(ctx context.Context, userID int64, reason string) error {
+	query := `UPDATE users SET locked_at = now(), lock_reason = $1 WHERE id = $2 AND locked_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, reason, userID)
+
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+// Unlock lifts a lock, but only the one placed for reason, so that lifting it
+// doesn't clear a lock that was placed for something else.
+func (r *userRepository) Unlock(ctx context.Context, userID int64, reason string) error {
+	query := `UPDATE users SET locked_at = NULL, lock_reason = '' WHERE id = $1 AND lock_reason = $2`
+	_, err := r.db.ExecContext(ctx, query, userID, reason)
+
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *userRepository) UpdateBilling(ctx context.Context, user *models.User) error {
+	query := `UPDATE users SET billing_name = $1, billing_address = $2, billing_country = $3, vat_id = $4 WHERE id = $5`
+	_, err := r.db.ExecContext(ctx, query, user.BillingName, user.BillingAddress, user.BillingCountry, user.VATID, user.ID)
+
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
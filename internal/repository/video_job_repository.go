@@ -0,0 +1,329 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+type VideoJobRepository interface {
+	Enqueue(ctx context.Context, job *models.VideoJob, res *models.CreditReservation, limits JobLimits) (int64, error)
+	GetByID(ctx context.Context, id int64) (*models.VideoJob, bool, error)
+	ClaimNext(ctx context.Context) (*models.VideoJob, bool, error)
+	SetVideoID(ctx context.Context, id int64, videoID string) error
+	Complete(ctx context.Context, job *models.VideoJob, ma *models.MediaAsset, t *models.CreditTransaction) (int64, error)
+	MarkFailed(ctx context.Context, job *models.VideoJob, reason string) error
+	RequeueRunning(ctx context.Context, staleAfter time.Duration) (int64, error)
+}
+
+// JobLimits caps the jobs of a user at enqueue time.
+type JobLimits struct {
+	// MaxActive is the number of jobs that can be queued or running at once.
+	MaxActive int
+	// StorageQuota is the number of videos that can be stored, counting those
+	// still being generated.
+	StorageQuota int
+}
+
+type videoJobRepository struct {
+	db *sql.DB
+}
+
+func NewVideoJobRepository(db *sql.DB) VideoJobRepository {
+	return &videoJobRepository{db: db}
+}
+
+// Enqueue holds res and queues job under it in one transaction, so that a job
+// is never queued without its credit and a credit is never held without a job.
+// The user's credits row is locked before the limits are checked, so that
+// concurrent requests of a user are counted one after the other.
+func (r *videoJobRepository) Enqueue(ctx context.Context, job *models.VideoJob, res *models.CreditReservation, limits JobLimits) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Info(err.Error())
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked int64
+	query := `SELECT user_id FROM credits WHERE user_id = $1 FOR UPDATE`
+	if err := tx.QueryRowContext(ctx, query, job.UserID).Scan(&locked); err != nil {
+		if err == sql.ErrNoRows {
+			slog.Error(ErrCreditsNotFound.Error(), "userID", job.UserID)
+			return 0, ErrCreditsNotFound
+		}
+		slog.Info(err.Error())
+		return 0, err
+	}
+
+	var active, stored int
+	query = `
+		SELECT
+			(SELECT count(*) FROM video_jobs WHERE user_id = $1 AND status IN ($2, $3)),
+			(SELECT count(*) FROM media_assets WHERE user_id = $1)
+	`
+	err = tx.QueryRowContext(ctx, query, job.UserID, models.JobStatusQueued, models.JobStatusRunning).Scan(&active, &stored)
+	if err != nil {
+		slog.Info(err.Error())
+		return 0, err
+	}
+	if active >= limits.MaxActive {
+		slog.Info(ErrTooManyJobs.Error(), "userID", job.UserID, "activeJobs", active)
+		return 0, ErrTooManyJobs
+	}
+	if stored+active >= limits.StorageQuota {
+		slog.Info(ErrStorageQuota.Error(), "userID", job.UserID, "storedVideos", stored)
+		return 0, ErrStorageQuota
+	}
+
+	if err := holdCredits(ctx, tx, res); err != nil {
+		return 0, err
+	}
+
+	query = `
+		INSERT INTO video_jobs (user_id, status, payload, reservation_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+	var id int64
+	err = tx.QueryRowContext(ctx, query, job.UserID, models.JobStatusQueued, job.Payload, res.ID).Scan(&id)
+	if err != nil {
+		slog.Info(err.Error())
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Info(err.Error())
+		return 0, err
+	}
+	return id, nil
+}
+
+func (r *videoJobRepository) GetByID(ctx context.Context, id int64) (*models.VideoJob, bool, error) {
+	query := `
+		SELECT id, user_id, status, payload, reservation_id, video_id, media_asset_id, error, attempts, created_at, started_at, finished_at
+		FROM video_jobs
+		WHERE id = $1
+	`
+	var job models.VideoJob
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&job.ID,
+		&job.UserID,
+		&job.Status,
+		&job.Payload,
+		&job.ReservationID,
+		&job.VideoID,
+		&job.MediaAssetID,
+		&job.Error,
+		&job.Attempts,
+		&job.CreatedAt,
+		&job.StartedAt,
+		&job.FinishedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &job, true, nil
+}
+
+// ClaimNext moves the oldest queued job to running and returns it. Rows locked
+// by another worker are skipped so that several workers can poll concurrently.
+func (r *videoJobRepository) ClaimNext(ctx context.Context) (*models.VideoJob, bool, error) {
+	query := `
+		UPDATE video_jobs
+		SET status = $1,
+			attempts = attempts + 1,
+			started_at = now(),
+			updated_at = now()
+		WHERE id = (
+			SELECT id FROM video_jobs
+			WHERE status = $2
+			ORDER BY id
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING id, user_id, status, payload, reservation_id, video_id, attempts, created_at, started_at
+	`
+	var job models.VideoJob
+	err := r.db.QueryRowContext(ctx, query, models.JobStatusRunning, models.JobStatusQueued).Scan(
+		&job.ID,
+		&job.UserID,
+		&job.Status,
+		&job.Payload,
+		&job.ReservationID,
+		&job.VideoID,
+		&job.Attempts,
+		&job.CreatedAt,
+		&job.StartedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		slog.Info(err.Error())
+		return nil, false, err
+	}
+	return &job, true, nil
+}
+
+func (r *videoJobRepository) SetVideoID(ctx context.Context, id int64, videoID string) error {
+	query := `UPDATE video_jobs SET video_id = $1, updated_at = now() WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, videoID, id)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+// Complete records the asset of a finished job, spends its credit and marks it
+// succeeded in one transaction, so a job is either delivered and paid for or
+// left to be retried. The asset is keyed on the job, and the credit is taken
+// from the job's reservation when it has one. If the job is no longer running
+// under the attempt that claimed it, nothing is recorded and ErrJobLeaseLost
+// is returned.
+func (r *videoJobRepository) Complete(ctx context.Context, job *models.VideoJob, ma *models.MediaAsset, t *models.CreditTransaction) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Info(err.Error())
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO media_assets (user_id, file_name, file_type, file_url, video_job_id)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (video_job_id) DO UPDATE
+		SET file_name = EXCLUDED.file_name,
+			file_url = EXCLUDED.file_url
+		RETURNING id
+	`
+	var assetID int64
+	err = tx.QueryRowContext(ctx, query, ma.UserID, ma.FileName, ma.FileType, ma.FileURL, job.ID).Scan(&assetID)
+	if err != nil {
+		slog.Info(err.Error())
+		return 0, err
+	}
+
+	if err := chargeJob(ctx, tx, job, t); err != nil {
+		return 0, err
+	}
+
+	query = `
+		UPDATE video_jobs
+		SET status = $1,
+			media_asset_id = $2,
+			error = '',
+			finished_at = now(),
+			updated_at = now()
+		WHERE id = $3 AND status = $4 AND attempts = $5
+	`
+	res, err := tx.ExecContext(ctx, query, models.JobStatusSucceeded, assetID, job.ID, models.JobStatusRunning, job.Attempts)
+	if err != nil {
+		slog.Info(err.Error())
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		slog.Info(err.Error())
+		return 0, err
+	} else if n == 0 {
+		return 0, ErrJobLeaseLost
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Info(err.Error())
+		return 0, err
+	}
+	return assetID, nil
+}
+
+// chargeJob spends the credit of a job unless an earlier attempt already did:
+// the reservation is no longer held, or the ledger already has an entry for
+// the job. Both are checked up front because a failed statement would abort
+// the surrounding transaction.
+func chargeJob(ctx context.Context, q querier, job *models.VideoJob, t *models.CreditTransaction) error {
+	var charged bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM credit_transactions
+			WHERE kind = $1 AND reference_type = $2 AND reference_id = $3
+		)
+	`
+	if err := q.QueryRowContext(ctx, query, t.Kind, t.ReferenceType, t.ReferenceID).Scan(&charged); err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	if charged {
+		return nil
+	}
+
+	if job.ReservationID == nil {
+		// Jobs queued before reservations existed hold nothing.
+		return applyCreditTransaction(ctx, q, t)
+	}
+
+	amount, err := resolveReservation(ctx, q, *job.ReservationID, models.ReservationCaptured)
+	if err != nil {
+		if errors.Is(err, ErrReservationNotHeld) {
+			return nil
+		}
+		return err
+	}
+	t.Amount = -amount
+	return applyCreditTransaction(ctx, q, t)
+}
+
+// MarkFailed marks a job failed, provided it is still running under the
+// attempt that claimed it. Otherwise it returns ErrJobLeaseLost.
+func (r *videoJobRepository) MarkFailed(ctx context.Context, job *models.VideoJob, reason string) error {
+	query := `
+		UPDATE video_jobs
+		SET status = $1,
+			error = $2,
+			finished_at = now(),
+			updated_at = now()
+		WHERE id = $3 AND status = $4 AND attempts = $5
+	`
+	res, err := r.db.ExecContext(ctx, query, models.JobStatusFailed, reason, job.ID, models.JobStatusRunning, job.Attempts)
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		slog.Info(err.Error())
+		return err
+	}
+	if n == 0 {
+		return ErrJobLeaseLost
+	}
+	return nil
+}
+
+// RequeueRunning puts jobs that have been running for longer than staleAfter
+// back in the queue. A job that still runs that long was abandoned by a worker
+// that stopped or lost its process; jobs of live workers, in this process or
+// another, are left alone.
+func (r *videoJobRepository) RequeueRunning(ctx context.Context, staleAfter time.Duration) (int64, error) {
+	query := `
+		UPDATE video_jobs
+		SET status = $1,
+			started_at = NULL,
+			updated_at = now()
+		WHERE status = $2 AND updated_at < now() - $3 * interval '1 second'
+	`
+	res, err := r.db.ExecContext(ctx, query, models.JobStatusQueued, models.JobStatusRunning, staleAfter.Seconds())
+	if err != nil {
+		slog.Info(err.Error())
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+var testJobLimits = JobLimits{MaxActive: 10, StorageQuota: 100}
+
+func TestVideoJobLease(t *testing.T) {
+	db := newTestDB(t)
+	credits := NewCreditsRepository(db)
+	r := NewVideoJobRepository(db)
+	ctx := context.Background()
+	userID := newTestUser(t, db, "ada@example.com")
+
+	fundTestUser(t, credits, userID, 1, 4, time.Now().Add(24*time.Hour))
+	hold := &models.CreditReservation{UserID: userID, Amount: 1, Reason: "video"}
+	if _, err := r.Enqueue(ctx, &models.VideoJob{UserID: userID, Payload: "{}"}, hold, testJobLimits); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	stale, found, err := r.ClaimNext(ctx)
+	if err != nil || !found {
+		t.Fatalf("ClaimNext = %v, %v, want a job", found, err)
+	}
+
+	// A job that was claimed recently belongs to a live worker.
+	if n, err := r.RequeueRunning(ctx, time.Hour); err != nil || n != 0 {
+		t.Fatalf("RequeueRunning of a fresh job = %d, %v, want 0", n, err)
+	}
+	if _, err := db.Exec(`UPDATE video_jobs SET updated_at = now() - interval '2 hours' WHERE id = $1`, stale.ID); err != nil {
+		t.Fatalf("aging job: %v", err)
+	}
+	if n, err := r.RequeueRunning(ctx, time.Hour); err != nil || n != 1 {
+		t.Fatalf("RequeueRunning of an abandoned job = %d, %v, want 1", n, err)
+	}
+	current, found, err := r.ClaimNext(ctx)
+	if err != nil || !found || current.Attempts != 2 {
+		t.Fatalf("ClaimNext after requeue = %+v, %v, %v, want the second attempt", current, found, err)
+	}
+
+	// The abandoned attempt can no longer finish the job.
+	asset := &models.MediaAsset{UserID: userID, FileName: "video-1", FileType: "video/mp4"}
+	charge := func() *models.CreditTransaction {
+		return &models.CreditTransaction{UserID: userID, Kind: models.CreditSpend, Amount: -1, ReferenceType: "video_job", ReferenceID: strconv.FormatInt(stale.ID, 10)}
+	}
+	if err := r.MarkFailed(ctx, stale, "timeout"); err != ErrJobLeaseLost {
+		t.Errorf("MarkFailed of the abandoned attempt = %v, want %v", err, ErrJobLeaseLost)
+	}
+	if _, err := r.Complete(ctx, stale, asset, charge()); err != ErrJobLeaseLost {
+		t.Fatalf("Complete of the abandoned attempt = %v, want %v", err, ErrJobLeaseLost)
+	}
+	if n := countRows(t, db, `SELECT count(*) FROM credit_transactions WHERE kind = $1`, models.CreditSpend); n != 0 {
+		t.Errorf("abandoned attempt recorded %d charges", n)
+	}
+
+	if _, err := r.Complete(ctx, current, asset, charge()); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	job, _, err := r.GetByID(ctx, current.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if job.Status != models.JobStatusSucceeded || job.MediaAssetID == nil {
+		t.Errorf("job = %s with asset %v, want succeeded with an asset", job.Status, job.MediaAssetID)
+	}
+	checkBalance(t, credits, userID, 4, 0)
+}
+
+func TestVideoJobEnqueueHoldsCredit(t *testing.T) {
+	db := newTestDB(t)
+	credits := NewCreditsRepository(db)
+	r := NewVideoJobRepository(db)
+	ctx := context.Background()
+	userID := newTestUser(t, db, "ada@example.com")
+
+	fundTestUser(t, credits, userID, 0, 1, time.Now().Add(24*time.Hour))
+
+	hold := &models.CreditReservation{UserID: userID, Amount: 1, Reason: "video"}
+	id, err := r.Enqueue(ctx, &models.VideoJob{UserID: userID, Payload: "{}"}, hold, testJobLimits)
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	job, _, err := r.GetByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if job.ReservationID == nil || *job.ReservationID != hold.ID {
+		t.Errorf("job holds reservation %v, want %d", job.ReservationID, hold.ID)
+	}
+	checkBalance(t, credits, userID, 1, 1)
+
+	// Without an available credit, neither a reservation nor a job is made.
+	if _, err := r.Enqueue(ctx, &models.VideoJob{UserID: userID, Payload: "{}"}, &models.CreditReservation{UserID: userID, Amount: 1}, testJobLimits); err != ErrInsufficientCredits {
+		t.Fatalf("Enqueue without credits = %v, want %v", err, ErrInsufficientCredits)
+	}
+	if n := countRows(t, db, `SELECT count(*) FROM video_jobs WHERE user_id = $1`, userID); n != 1 {
+		t.Errorf("got %d jobs, want 1", n)
+	}
+	if n := countRows(t, db, `SELECT count(*) FROM credit_reservations WHERE user_id = $1`, userID); n != 1 {
+		t.Errorf("got %d reservations, want 1", n)
+	}
+}
+
+func TestVideoJobEnqueueLimitsConcurrentRequests(t *testing.T) {
+	db := newTestDB(t)
+	credits := NewCreditsRepository(db)
+	r := NewVideoJobRepository(db)
+	ctx := context.Background()
+	userID := newTestUser(t, db, "ada@example.com")
+
+	fundTestUser(t, credits, userID, 0, 20, time.Now().Add(24*time.Hour))
+
+	// Requests made at once get no more jobs than requests in a row.
+	const maxActive, requests = 2, 10
+	var queued atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hold := &models.CreditReservation{UserID: userID, Amount: 1, Reason: "video"}
+			_, err := r.Enqueue(ctx, &models.VideoJob{UserID: userID, Payload: "{}"}, hold, JobLimits{MaxActive: maxActive, StorageQuota: 100})
+			switch err {
+			case nil:
+				queued.Add(1)
+			case ErrTooManyJobs:
+			default:
+				t.Errorf("Enqueue: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := queued.Load(); got != maxActive {
+		t.Errorf("queued %d jobs, want %d", got, maxActive)
+	}
+	checkBalance(t, credits, userID, 20, maxActive)
+
+	// Stored videos count against the quota along with active jobs.
+	if _, err := db.Exec(`INSERT INTO media_assets (user_id) VALUES ($1)`, userID); err != nil {
+		t.Fatalf("storing video: %v", err)
+	}
+	limits := JobLimits{MaxActive: 10, StorageQuota: maxActive + 1}
+	if _, err := r.Enqueue(ctx, &models.VideoJob{UserID: userID, Payload: "{}"}, &models.CreditReservation{UserID: userID, Amount: 1}, limits); err != ErrStorageQuota {
+		t.Errorf("Enqueue over the storage quota = %v, want %v", err, ErrStorageQuota)
+	}
+}
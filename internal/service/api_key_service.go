@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+const (
+	// apiKeyPrefix starts every API key, so that leaked keys are easy to
+	// recognize.
+	apiKeyPrefix = "pf_"
+	// apiKeyDisplayLength is how much of a key is kept to tell keys apart.
+	apiKeyDisplayLength = len(apiKeyPrefix) + 8
+	maxAPIKeyNameLength = 100
+	maxAPIKeysPerUser   = 20
+)
+
+var (
+	ErrInvalidAPIKey     = errors.New("API key is invalid or revoked")
+	ErrAPIKeyNotFound    = errors.New("API key not found")
+	ErrInvalidAPIKeyName = fmt.Errorf("API key name must be 1 to %d characters", maxAPIKeyNameLength)
+	ErrInvalidScope      = fmt.Errorf("scopes must be one or more of %s", strings.Join(models.APIKeyScopes, ", "))
+	ErrAPIKeyLimit       = fmt.Errorf("you can have at most %d API keys", maxAPIKeysPerUser)
+	ErrMissingScope      = errors.New("API key is missing a required scope")
+)
+
+type APIKeyService interface {
+	// Create makes a key for the user and returns it together with its
+	// secret, which can't be retrieved later.
+	Create(ctx context.Context, userID int64, name string, scopes []string) (*models.APIKey, string, error)
+	List(ctx context.Context, userID int64) ([]*models.APIKey, error)
+	Revoke(ctx context.Context, userID, id int64) error
+	// Authenticate returns the key with the secret if it has all the scopes,
+	// and counts its use.
+	Authenticate(ctx context.Context, secret, ip string, scopes []string) (*models.APIKey, error)
+}
+
+type apiKeyService struct {
+	k repository.APIKeyRepository
+}
+
+func NewAPIKeyService(k repository.APIKeyRepository) APIKeyService {
+	return &apiKeyService{k: k}
+}
+
+func (s *apiKeyService) Create(ctx context.Context, userID int64, name string, scopes []string) (*models.APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxAPIKeyNameLength {
+		return nil, "", ErrInvalidAPIKeyName
+	}
+
+	if len(scopes) == 0 {
+		return nil, "", ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(models.APIKeyScopes, scope) {
+			return nil, "", ErrInvalidScope
+		}
+	}
+	scopes = slices.Compact(slices.Sorted(slices.Values(scopes)))
+
+	existing, err := s.k.ListActive(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(existing) >= maxAPIKeysPerUser {
+		slog.Info(ErrAPIKeyLimit.Error(), "userID", userID)
+		return nil, "", ErrAPIKeyLimit
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	secret := apiKeyPrefix + token
+
+	key := &models.APIKey{
+		UserID:  userID,
+		Name:    name,
+		Prefix:  secret[:apiKeyDisplayLength],
+		KeyHash: hashToken(secret),
+		Scopes:  scopes,
+	}
+	if err := s.k.Create(ctx, key); err != nil {
+		return nil, "", err
+	}
+
+	return key, secret, nil
+}
+
+func (s *apiKeyService) List(ctx context.Context, userID int64) ([]*models.APIKey, error) {
+	keys, err := s.k.ListActive(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if keys == nil {
+		keys = []*models.APIKey{}
+	}
+
+	return keys, nil
+}
+
+func (s *apiKeyService) Revoke(ctx context.Context, userID, id int64) error {
+	revoked, err := s.k.Revoke(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	if !revoked {
+		slog.Info(ErrAPIKeyNotFound.Error(), "userID", userID)
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+func (s *apiKeyService) Authenticate(ctx context.Context, secret, ip string, scopes []string) (*models.APIKey, error) {
+	if !strings.HasPrefix(secret, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, isExist, err := s.k.GetByHash(ctx, hashToken(secret))
+	if err != nil {
+		return nil, err
+	}
+
+	if !isExist {
+		slog.Info(ErrInvalidAPIKey.Error(), "ip", ip)
+		return nil, ErrInvalidAPIKey
+	}
+
+	for _, scope := range scopes {
+		if !key.HasScope(scope) {
+			slog.Info(ErrMissingScope.Error(), "apiKeyID", key.ID, "scope", scope)
+			return nil, fmt.Errorf("%w: %s", ErrMissingScope, scope)
+		}
+	}
+
+	// The counters are informational, so a failure doesn't fail the
+	// request.
+	if err := s.k.RecordUse(ctx, key.ID, ip); err != nil {
+		slog.Error("failed to record API key use", "error", err, "apiKeyID", key.ID)
+	}
+
+	return key, nil
+}
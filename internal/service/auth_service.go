@@ -2,125 +2,271 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
-	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/identity"
+	"github.com/maheshrc27/postflow/internal/mailer"
 	"github.com/maheshrc27/postflow/internal/models"
 	"github.com/maheshrc27/postflow/internal/repository"
-	"github.com/maheshrc27/postflow/internal/transfer"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
+)
+
+const (
+	// EmailLoginProvider is the identity of users who signed in with a login
+	// link. Its subject is the email address.
+	EmailLoginProvider = "email"
+
+	loginLinkTTL = 15 * time.Minute
+	// maxLoginLinksPerEmail and maxLoginLinksPerIP limit how many login
+	// links can be requested per hour.
+	maxLoginLinksPerEmail = 5
+	maxLoginLinksPerIP    = 20
+)
+
+var (
+	ErrUnknownLoginProvider = errors.New("unknown login provider")
+	ErrEmailNotVerified     = errors.New("the identity provider has not verified this email")
+	ErrLoginLinkLimit       = errors.New("too many login links requested, try again later")
+	ErrInvalidLoginLink     = errors.New("login link is invalid or has expired")
 )
 
 type AuthService interface {
-	LoginCallback(ctx context.Context, code string) (err error, userID int64)
+	AuthURL(ctx context.Context, provider, state, verifier, nonce string) (string, error)
+	LoginCallback(ctx context.Context, provider, code, verifier, nonce, referralCode string) (err error, userID int64)
+	// SendLoginLink mails a link that signs in to the account of email,
+	// which is created if needed. returnTo is where the link leads after
+	// signing in.
+	SendLoginLink(ctx context.Context, email, ip, returnTo string) error
+	// UseLoginLink signs in with the token of a login link and returns the
+	// user and the link's returnTo.
+	UseLoginLink(ctx context.Context, token, referralCode string) (userID int64, returnTo string, err error)
 }
 
 type authService struct {
-	cfg config.Config
-	u   repository.UserRepository
-	c   repository.CreditsRepository
+	cfg       config.Config
+	u         repository.UserRepository
+	c         repository.CreditsRepository
+	i         repository.IdentityRepository
+	l         repository.LoginLinkRepository
+	r         ReferralService
+	m         mailer.Mailer
+	providers identity.Registry
 }
 
-func NewAuthService(cfg config.Config, u repository.UserRepository, c repository.CreditsRepository) AuthService {
+func NewAuthService(cfg config.Config, u repository.UserRepository, c repository.CreditsRepository, i repository.IdentityRepository, l repository.LoginLinkRepository, r ReferralService, m mailer.Mailer, providers identity.Registry) AuthService {
 	return &authService{
-		cfg: cfg,
-		u:   u,
-		c:   c,
+		cfg:       cfg,
+		u:         u,
+		c:         c,
+		i:         i,
+		l:         l,
+		r:         r,
+		m:         m,
+		providers: providers,
+	}
+}
+
+// AuthURL returns the consent page of the provider for a login attempt. The
+// callback must present the same state, and the code is only exchanged
+// together with verifier (PKCE) and nonce.
+func (s *authService) AuthURL(ctx context.Context, provider, state, verifier, nonce string) (string, error) {
+	p, err := s.provider(provider)
+	if err != nil {
+		return "", err
 	}
+
+	return p.AuthURL(ctx, state, verifier, nonce)
 }
 
-func (s *authService) LoginCallback(ctx context.Context, code string) (err error, userID int64) {
+// LoginCallback signs the user in with the code the provider redirected back
+// with.
+func (s *authService) LoginCallback(ctx context.Context, provider, code, verifier, nonce, referralCode string) (err error, userID int64) {
 
-	if code == "" {
-		err = errors.New("code or state is empty")
+	if code == "" || verifier == "" {
+		err = errors.New("code or verifier is empty")
 		slog.Info(err.Error())
 		return err, 0
 	}
 
-	oauth2Config := &oauth2.Config{
-		ClientID:     s.cfg.GoogleClientID,
-		ClientSecret: s.cfg.GoogleClientSecret,
-		RedirectURL:  s.cfg.GoogleRedirectURI,
-		Scopes:       []string{"https://www.googleapis.com/auth/userinfo.email", "https://www.googleapis.com/auth/userinfo.profile"},
-		Endpoint:     google.Endpoint,
-	}
-
-	if oauth2Config.ClientID == "" || oauth2Config.ClientSecret == "" || oauth2Config.RedirectURL == "" {
-		err = errors.New("OAuth2 configuration is incomplete")
-		slog.Info(err.Error())
+	p, err := s.provider(provider)
+	if err != nil {
 		return err, 0
 	}
 
-	token, err := oauth2Config.Exchange(context.Background(), code)
+	id, err := p.Exchange(ctx, code, verifier, nonce)
 	if err != nil {
-		slog.Info(err.Error())
 		return err, 0
 	}
 
-	client := oauth2Config.Client(context.Background(), token)
+	userID, err = s.signIn(ctx, id, referralCode)
+	return err, userID
+}
+
+func (s *authService) SendLoginLink(ctx context.Context, email, ip, returnTo string) error {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return err
+	}
 
-	userInfo, err := GetUserInfo(client)
+	byEmail, byIP, err := s.l.CountSince(ctx, email, ip, time.Now().Add(-time.Hour))
 	if err != nil {
-		return err, 0
+		return err
 	}
 
-	user, isExist, err := s.u.GetByEmail(ctx, userInfo.Email)
+	if byEmail >= maxLoginLinksPerEmail || byIP >= maxLoginLinksPerIP {
+		slog.Info(ErrLoginLinkLimit.Error(), "ip", ip)
+		return ErrLoginLinkLimit
+	}
+
+	token, err := randomToken(32)
 	if err != nil {
-		return err, 0
+		return err
+	}
+
+	link := &models.LoginLink{
+		Email:     email,
+		TokenHash: hashToken(token),
+		IP:        ip,
+		ReturnTo:  returnTo,
+		ExpiresAt: time.Now().Add(loginLinkTTL),
+	}
+	if err := s.l.Create(ctx, link); err != nil {
+		return err
+	}
+
+	linkURL := strings.TrimSuffix(s.cfg.BackendURL, "/") + "/login/email/verify?token=" + url.QueryEscape(token)
+	return s.m.Send(ctx, &mailer.Message{
+		To:      email,
+		Subject: "Sign in to Postflow",
+		Body: fmt.Sprintf("Open this link within %d minutes to sign in to Postflow:\n\n%s\n\n"+
+			"The link works once. If you didn't ask for it, you can ignore this email.\n", int(loginLinkTTL.Minutes()), linkURL),
+	})
+}
+
+func (s *authService) UseLoginLink(ctx context.Context, token, referralCode string) (int64, string, error) {
+	if token == "" {
+		return 0, "", ErrInvalidLoginLink
 	}
 
-	fmt.Printf("%v", user)
+	link, isExist, err := s.l.Use(ctx, hashToken(token))
+	if err != nil {
+		return 0, "", err
+	}
 
 	if !isExist {
-		userID, err = s.u.Create(ctx, &models.User{
-			GoogleID:       userInfo.ID,
-			Email:          userInfo.Email,
-			Name:           userInfo.Name,
-			ProfilePicture: userInfo.Picture,
-		})
-
-		credits := models.Credits{
-			UserID:  userID,
-			Credits: 1,
+		slog.Info(ErrInvalidLoginLink.Error())
+		return 0, "", ErrInvalidLoginLink
+	}
+
+	// Opening the link proves the address is the user's.
+	userID, err := s.signIn(ctx, &identity.Identity{
+		Provider:      EmailLoginProvider,
+		Subject:       link.Email,
+		Email:         link.Email,
+		EmailVerified: true,
+	}, referralCode)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return userID, link.ReturnTo, nil
+}
+
+// signIn returns the user of an identity. Identities are matched by provider
+// and subject first; a new identity is linked to the user its verified email
+// belongs to, or gets a new account. referralCode is only used for new
+// accounts.
+func (s *authService) signIn(ctx context.Context, id *identity.Identity, referralCode string) (userID int64, err error) {
+	existing, isExist, err := s.i.GetByProviderSubject(ctx, id.Provider, id.Subject)
+	if err != nil {
+		return 0, err
+	}
+
+	if isExist {
+		if err := s.i.Touch(ctx, existing.ID, id.Email); err != nil {
+			return 0, err
 		}
+		return existing.UserID, nil
+	}
+
+	// Linking by email hands over the account, so only emails the provider
+	// vouches for are trusted.
+	if id.Email == "" || !id.EmailVerified {
+		slog.Info(ErrEmailNotVerified.Error(), "provider", id.Provider)
+		return 0, ErrEmailNotVerified
+	}
 
-		s.c.Create(ctx, &credits)
+	user, isExist, err := s.u.GetByEmail(ctx, id.Email)
+	if err != nil {
+		return 0, err
+	}
 
+	if !isExist {
+		user, isExist, err = s.u.GetByLinkedEmail(ctx, id.Email)
 		if err != nil {
-			return err, 0
+			return 0, err
 		}
-	} else {
+	}
+
+	if isExist {
 		userID = user.ID
+	} else {
+		if userID, err = s.createUser(ctx, id, referralCode); err != nil {
+			return 0, err
+		}
+	}
+
+	err = s.i.Create(ctx, &models.UserIdentity{
+		UserID:   userID,
+		Provider: id.Provider,
+		Subject:  id.Subject,
+		Email:    id.Email,
+	})
+	if err != nil && !errors.Is(err, repository.ErrIdentityLinked) {
+		return 0, err
 	}
 
-	return nil, userID
+	return userID, nil
 }
 
-func GetUserInfo(client *http.Client) (*transfer.GoogleUserInfo, error) {
-	userInfoURL := "https://www.googleapis.com/oauth2/v1/userinfo"
+func (s *authService) createUser(ctx context.Context, id *identity.Identity, referralCode string) (int64, error) {
+	newUser := models.User{
+		Email:          id.Email,
+		Name:           id.Name,
+		ProfilePicture: id.Picture,
+	}
+	if id.Provider == "google" {
+		newUser.GoogleID = id.Subject
+	}
 
-	response, err := client.Get(userInfoURL)
+	userID, err := s.u.Create(ctx, &newUser)
 	if err != nil {
-		slog.Info(err.Error())
-		return nil, fmt.Errorf("error fetching user info: %w", err)
+		return 0, err
 	}
-	defer response.Body.Close()
+	newUser.ID = userID
 
-	if response.StatusCode != http.StatusOK {
-		slog.Info("Unexpected response status")
-		return nil, fmt.Errorf("unexpected response status: %d", response.StatusCode)
+	if err := openCreditsAccount(ctx, s.c, s.cfg.Credits, userID); err != nil {
+		return 0, err
 	}
 
-	var userInfo transfer.GoogleUserInfo
-	if err := json.NewDecoder(response.Body).Decode(&userInfo); err != nil {
-		slog.Info(err.Error())
-		return nil, fmt.Errorf("error decoding user info: %w", err)
+	// A bad referral must not keep the user from signing in.
+	if err := s.r.Attach(ctx, &newUser, referralCode); err != nil {
+		slog.Error("failed to attach referral", "error", err, "userID", userID)
 	}
 
-	return &userInfo, nil
+	return userID, nil
+}
+
+func (s *authService) provider(name string) (identity.Provider, error) {
+	p, err := s.providers.Get(name)
+	if err != nil {
+		slog.Info(ErrUnknownLoginProvider.Error(), "provider", name)
+		return nil, ErrUnknownLoginProvider
+	}
+	return p, nil
 }
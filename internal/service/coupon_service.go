@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+var (
+	ErrCouponNotFound      = errors.New("coupon not found")
+	ErrCouponUnavailable   = errors.New("coupon is not valid at this time")
+	ErrCouponRedeemed      = errors.New("coupon already redeemed")
+	ErrCouponNotApplicable = errors.New("coupon cannot be used this way")
+	ErrInvalidCoupon       = errors.New("invalid coupon")
+)
+
+type CouponService interface {
+	Redeem(ctx context.Context, userID int64, code string) (*models.CreditTransaction, error)
+	// CheckDiscount returns the discount coupon for code if userID may use it
+	// at checkout.
+	CheckDiscount(ctx context.Context, userID int64, code string) (*models.Coupon, error)
+	// GetDiscount returns the discount coupon for code without checking its
+	// limits, for pricing a sale that was already paid.
+	GetDiscount(ctx context.Context, code string) (*models.Coupon, error)
+	RecordDiscount(ctx context.Context, userID int64, coupon *models.Coupon) error
+	Create(ctx context.Context, coupon *models.Coupon) error
+	List(ctx context.Context, campaign string) ([]*models.Coupon, error)
+}
+
+type couponService struct {
+	cfg config.Credits
+	r   repository.CouponRepository
+}
+
+func NewCouponService(cfg config.Credits, r repository.CouponRepository) CouponService {
+	return &couponService{
+		cfg: cfg,
+		r:   r,
+	}
+}
+
+// Redeem grants the credits of a credit coupon. Each user can redeem a coupon
+// once; the grant shows up in the credit history as a coupon entry.
+func (s *couponService) Redeem(ctx context.Context, userID int64, code string) (*models.CreditTransaction, error) {
+	coupon, err := s.get(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if coupon.IsDiscount() {
+		slog.Info(ErrCouponNotApplicable.Error(), "code", coupon.Code)
+		return nil, fmt.Errorf("%w: discount codes are applied at checkout", ErrCouponNotApplicable)
+	}
+
+	t := models.CreditTransaction{
+		Kind:      models.CreditCoupon,
+		Amount:    coupon.Credits,
+		Reason:    fmt.Sprintf("coupon %s", coupon.Code),
+		ExpiresAt: promoExpiry(s.cfg),
+	}
+	if _, err := s.r.Redeem(ctx, coupon.ID, userID, &t); err != nil {
+		return nil, redeemError(err)
+	}
+
+	return &t, nil
+}
+
+func (s *couponService) CheckDiscount(ctx context.Context, userID int64, code string) (*models.Coupon, error) {
+	coupon, err := s.GetDiscount(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if !coupon.ValidAt(time.Now()) || (coupon.MaxRedemptions > 0 && coupon.Redemptions >= coupon.MaxRedemptions) {
+		slog.Info(ErrCouponUnavailable.Error(), "code", coupon.Code)
+		return nil, ErrCouponUnavailable
+	}
+
+	redeemed, err := s.r.HasRedeemed(ctx, coupon.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if redeemed {
+		slog.Info(ErrCouponRedeemed.Error(), "code", coupon.Code, "userID", userID)
+		return nil, ErrCouponRedeemed
+	}
+
+	return coupon, nil
+}
+
+func (s *couponService) GetDiscount(ctx context.Context, code string) (*models.Coupon, error) {
+	coupon, err := s.get(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if !coupon.IsDiscount() {
+		slog.Info(ErrCouponNotApplicable.Error(), "code", coupon.Code)
+		return nil, fmt.Errorf("%w: credit coupons are redeemed, not applied at checkout", ErrCouponNotApplicable)
+	}
+
+	return coupon, nil
+}
+
+// RecordDiscount counts a paid purchase against the coupon's limits.
+func (s *couponService) RecordDiscount(ctx context.Context, userID int64, coupon *models.Coupon) error {
+	if _, err := s.r.Redeem(ctx, coupon.ID, userID, nil); err != nil {
+		return redeemError(err)
+	}
+	return nil
+}
+
+// Create validates and stores a new coupon. A random code is generated when
+// none is given.
+func (s *couponService) Create(ctx context.Context, coupon *models.Coupon) error {
+	if (coupon.Credits > 0) == (coupon.DiscountPercent > 0) {
+		return fmt.Errorf("%w: set either credits or discount_percent", ErrInvalidCoupon)
+	}
+
+	if coupon.Credits < 0 || coupon.DiscountPercent < 0 || coupon.DiscountPercent > 100 || coupon.MaxRedemptions < 0 {
+		return fmt.Errorf("%w: credits, discount_percent and max_redemptions must be in range", ErrInvalidCoupon)
+	}
+
+	if coupon.StartsAt != nil && coupon.ExpiresAt != nil && !coupon.ExpiresAt.After(*coupon.StartsAt) {
+		return fmt.Errorf("%w: expires_at must be after starts_at", ErrInvalidCoupon)
+	}
+
+	coupon.Code = normalizeCouponCode(coupon.Code)
+	if coupon.Code == "" {
+		code, err := generateCouponCode()
+		if err != nil {
+			return err
+		}
+		coupon.Code = code
+	}
+
+	if err := s.r.Create(ctx, coupon); err != nil {
+		if errors.Is(err, repository.ErrDuplicateCoupon) {
+			return fmt.Errorf("%w: code %s already exists", ErrInvalidCoupon, coupon.Code)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *couponService) List(ctx context.Context, campaign string) ([]*models.Coupon, error) {
+	coupons, err := s.r.List(ctx, campaign)
+	if err != nil {
+		return nil, err
+	}
+
+	if coupons == nil {
+		coupons = []*models.Coupon{}
+	}
+
+	return coupons, nil
+}
+
+func (s *couponService) get(ctx context.Context, code string) (*models.Coupon, error) {
+	code = normalizeCouponCode(code)
+	if code == "" {
+		return nil, ErrCouponNotFound
+	}
+
+	coupon, isExist, err := s.r.GetByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isExist {
+		slog.Info(ErrCouponNotFound.Error(), "code", code)
+		return nil, ErrCouponNotFound
+	}
+
+	return coupon, nil
+}
+
+func redeemError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrCouponUnavailable):
+		return ErrCouponUnavailable
+	case errors.Is(err, repository.ErrCouponAlreadyRedeemed):
+		return ErrCouponRedeemed
+	}
+	return err
+}
+
+// normalizeCouponCode makes codes case-insensitive.
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func generateCouponCode() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+type fakeCouponRepository struct {
+	mu          sync.Mutex
+	coupons     map[string]*models.Coupon
+	redemptions map[int64]map[int64]bool
+}
+
+func newFakeCouponRepository() *fakeCouponRepository {
+	return &fakeCouponRepository{
+		coupons:     map[string]*models.Coupon{},
+		redemptions: map[int64]map[int64]bool{},
+	}
+}
+
+func (r *fakeCouponRepository) Create(ctx context.Context, c *models.Coupon) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.coupons[c.Code]; ok {
+		return repository.ErrDuplicateCoupon
+	}
+	c.ID = int64(len(r.coupons) + 1)
+	c.Redemptions = 0
+	c.CreatedAt = time.Now()
+	stored := *c
+	r.coupons[c.Code] = &stored
+	return nil
+}
+
+func (r *fakeCouponRepository) GetByCode(ctx context.Context, code string) (*models.Coupon, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.coupons[code]
+	if !ok {
+		return nil, false, nil
+	}
+	copied := *c
+	return &copied, true, nil
+}
+
+func (r *fakeCouponRepository) List(ctx context.Context, campaign string) ([]*models.Coupon, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var coupons []*models.Coupon
+	for _, c := range r.coupons {
+		if campaign == "" || c.Campaign == campaign {
+			coupons = append(coupons, c)
+		}
+	}
+	return coupons, nil
+}
+
+func (r *fakeCouponRepository) HasRedeemed(ctx context.Context, couponID, userID int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.redemptions[couponID][userID], nil
+}
+
+func (r *fakeCouponRepository) Redeem(ctx context.Context, couponID, userID int64, t *models.CreditTransaction) (*models.CouponRedemption, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var coupon *models.Coupon
+	for _, c := range r.coupons {
+		if c.ID == couponID {
+			coupon = c
+		}
+	}
+	if !coupon.ValidAt(time.Now()) || (coupon.MaxRedemptions > 0 && coupon.Redemptions >= coupon.MaxRedemptions) {
+		return nil, repository.ErrCouponUnavailable
+	}
+	if r.redemptions[couponID][userID] {
+		return nil, repository.ErrCouponAlreadyRedeemed
+	}
+	if r.redemptions[couponID] == nil {
+		r.redemptions[couponID] = map[int64]bool{}
+	}
+	r.redemptions[couponID][userID] = true
+	coupon.Redemptions++
+	if t != nil {
+		t.UserID = userID
+		t.BalanceAfter = t.Amount
+	}
+	return &models.CouponRedemption{CouponID: couponID, UserID: userID}, nil
+}
+
+func newCouponTest(t *testing.T, coupons ...*models.Coupon) CouponService {
+	t.Helper()
+
+	s := NewCouponService(config.Credits{}, newFakeCouponRepository())
+	for _, c := range coupons {
+		if err := s.Create(context.Background(), c); err != nil {
+			t.Fatalf("creating coupon %s: %v", c.Code, err)
+		}
+	}
+	return s
+}
+
+func TestCouponCreateValidates(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		coupon models.Coupon
+	}{
+		{"neither credits nor discount", models.Coupon{Code: "EMPTY"}},
+		{"both credits and discount", models.Coupon{Code: "BOTH", Credits: 5, DiscountPercent: 10}},
+		{"negative credits", models.Coupon{Code: "NEG", Credits: -5}},
+		{"discount over 100", models.Coupon{Code: "FREE", DiscountPercent: 120}},
+		{"negative max redemptions", models.Coupon{Code: "MAX", Credits: 5, MaxRedemptions: -1}},
+		{"expires before start", models.Coupon{Code: "WINDOW", Credits: 5, StartsAt: &future, ExpiresAt: &past}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newCouponTest(t)
+			if err := s.Create(context.Background(), &tt.coupon); !errors.Is(err, ErrInvalidCoupon) {
+				t.Errorf("err = %v, want %v", err, ErrInvalidCoupon)
+			}
+		})
+	}
+}
+
+func TestCouponCreateCodes(t *testing.T) {
+	s := newCouponTest(t)
+	ctx := context.Background()
+
+	named := &models.Coupon{Code: "  launch10 ", DiscountPercent: 10}
+	if err := s.Create(ctx, named); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if named.Code != "LAUNCH10" {
+		t.Errorf("code = %q, want %q", named.Code, "LAUNCH10")
+	}
+
+	generated := &models.Coupon{Credits: 5}
+	if err := s.Create(ctx, generated); err != nil {
+		t.Fatalf("Create without code: %v", err)
+	}
+	if len(generated.Code) != 8 {
+		t.Errorf("generated code = %q, want 8 characters", generated.Code)
+	}
+
+	if err := s.Create(ctx, &models.Coupon{Code: "Launch10", Credits: 5}); !errors.Is(err, ErrInvalidCoupon) {
+		t.Errorf("duplicate code: err = %v, want %v", err, ErrInvalidCoupon)
+	}
+}
+
+func TestCouponRedeem(t *testing.T) {
+	s := newCouponTest(t,
+		&models.Coupon{Code: "WELCOME", Credits: 5, MaxRedemptions: 2},
+		&models.Coupon{Code: "HALF", DiscountPercent: 50},
+	)
+	ctx := context.Background()
+
+	tx, err := s.Redeem(ctx, 1, "welcome")
+	if err != nil {
+		t.Fatalf("Redeem: %v", err)
+	}
+	if tx.Amount != 5 || tx.Kind != models.CreditCoupon {
+		t.Errorf("transaction = %+v, want a coupon entry of 5", tx)
+	}
+
+	if _, err := s.Redeem(ctx, 1, "WELCOME"); !errors.Is(err, ErrCouponRedeemed) {
+		t.Errorf("second redemption: err = %v, want %v", err, ErrCouponRedeemed)
+	}
+	if _, err := s.Redeem(ctx, 2, "WELCOME"); err != nil {
+		t.Fatalf("Redeem by another user: %v", err)
+	}
+	if _, err := s.Redeem(ctx, 3, "WELCOME"); !errors.Is(err, ErrCouponUnavailable) {
+		t.Errorf("redemption over the limit: err = %v, want %v", err, ErrCouponUnavailable)
+	}
+
+	if _, err := s.Redeem(ctx, 1, "HALF"); !errors.Is(err, ErrCouponNotApplicable) {
+		t.Errorf("redeeming a discount: err = %v, want %v", err, ErrCouponNotApplicable)
+	}
+	if _, err := s.Redeem(ctx, 1, "NOPE"); !errors.Is(err, ErrCouponNotFound) {
+		t.Errorf("unknown code: err = %v, want %v", err, ErrCouponNotFound)
+	}
+}
+
+func TestCouponCheckDiscount(t *testing.T) {
+	expired := time.Now().Add(-time.Hour)
+	s := newCouponTest(t,
+		&models.Coupon{Code: "HALF", DiscountPercent: 50, MaxRedemptions: 1},
+		&models.Coupon{Code: "OLD", DiscountPercent: 20, ExpiresAt: &expired},
+		&models.Coupon{Code: "WELCOME", Credits: 5},
+	)
+	ctx := context.Background()
+
+	coupon, err := s.CheckDiscount(ctx, 1, "half")
+	if err != nil {
+		t.Fatalf("CheckDiscount: %v", err)
+	}
+	if got := coupon.DiscountedPrice(999); got != 500 {
+		t.Errorf("discounted price = %d, want 500", got)
+	}
+
+	if err := s.RecordDiscount(ctx, 1, coupon); err != nil {
+		t.Fatalf("RecordDiscount: %v", err)
+	}
+	if _, err := s.CheckDiscount(ctx, 1, "HALF"); !errors.Is(err, ErrCouponUnavailable) {
+		t.Errorf("used up discount: err = %v, want %v", err, ErrCouponUnavailable)
+	}
+
+	if _, err := s.CheckDiscount(ctx, 1, "OLD"); !errors.Is(err, ErrCouponUnavailable) {
+		t.Errorf("expired discount: err = %v, want %v", err, ErrCouponUnavailable)
+	}
+	if _, err := s.CheckDiscount(ctx, 1, "WELCOME"); !errors.Is(err, ErrCouponNotApplicable) {
+		t.Errorf("credit coupon at checkout: err = %v, want %v", err, ErrCouponNotApplicable)
+	}
+}
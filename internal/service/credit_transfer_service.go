@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+var (
+	ErrInvalidAmount       = errors.New("invalid credit amount")
+	ErrRecipientNotFound   = errors.New("recipient not found")
+	ErrSelfTransfer        = errors.New("cannot transfer credits to yourself")
+	ErrTransferLimit       = errors.New("too many transfers, try again later")
+	ErrInsufficientCredits = errors.New("insufficient credits")
+	ErrGiftNotFound        = errors.New("gift code not found or already redeemed")
+)
+
+type CreditTransferService interface {
+	Transfer(ctx context.Context, senderID int64, recipientEmail string, amount int64, note string) (*models.CreditTransfer, error)
+	CreateGift(ctx context.Context, senderID, amount int64, note string) (*models.CreditTransfer, error)
+	RedeemGift(ctx context.Context, userID int64, code string) (*models.CreditTransfer, error)
+	ListGifts(ctx context.Context, senderID int64) ([]*models.CreditTransfer, error)
+}
+
+type creditTransferService struct {
+	cfg config.Transfers
+	u   repository.UserRepository
+	t   repository.CreditTransferRepository
+}
+
+func NewCreditTransferService(cfg config.Transfers, u repository.UserRepository, t repository.CreditTransferRepository) CreditTransferService {
+	return &creditTransferService{
+		cfg: cfg,
+		u:   u,
+		t:   t,
+	}
+}
+
+// Transfer moves credits to the account registered under recipientEmail, or
+// to the account the address was linked to.
+func (s *creditTransferService) Transfer(ctx context.Context, senderID int64, recipientEmail string, amount int64, note string) (*models.CreditTransfer, error) {
+	sender, err := s.checkSender(ctx, senderID, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	recipientEmail = strings.TrimSpace(recipientEmail)
+	recipient, isExist, err := s.u.GetByEmail(ctx, recipientEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isExist {
+		recipient, isExist, err = s.u.GetByLinkedEmail(ctx, recipientEmail)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !isExist {
+		slog.Info(ErrRecipientNotFound.Error(), "userID", senderID)
+		return nil, ErrRecipientNotFound
+	}
+
+	if recipient.ID == senderID {
+		return nil, ErrSelfTransfer
+	}
+
+	t := models.CreditTransfer{
+		SenderID:    senderID,
+		RecipientID: &recipient.ID,
+		Amount:      amount,
+		Note:        note,
+	}
+	out := models.CreditTransaction{
+		Kind:   models.CreditTransferOut,
+		Reason: fmt.Sprintf("transfer to %s", recipient.Email),
+	}
+	in := models.CreditTransaction{
+		Kind:   models.CreditTransferIn,
+		Reason: fmt.Sprintf("transfer from %s", sender.Email),
+	}
+	if err := s.t.Create(ctx, &t, s.cfg.DailyLimit, &out, &in); err != nil {
+		return nil, transferError(err)
+	}
+
+	return &t, nil
+}
+
+// CreateGift converts credits into a single-use gift code anyone else can
+// redeem.
+func (s *creditTransferService) CreateGift(ctx context.Context, senderID, amount int64, note string) (*models.CreditTransfer, error) {
+	if _, err := s.checkSender(ctx, senderID, amount); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	code := "GIFT-" + base32.StdEncoding.EncodeToString(b)
+
+	t := models.CreditTransfer{
+		SenderID: senderID,
+		Amount:   amount,
+		GiftCode: &code,
+		Note:     note,
+	}
+	out := models.CreditTransaction{
+		Kind:   models.CreditTransferOut,
+		Reason: "gift code",
+	}
+	if err := s.t.Create(ctx, &t, s.cfg.DailyLimit, &out, nil); err != nil {
+		return nil, transferError(err)
+	}
+
+	return &t, nil
+}
+
+func (s *creditTransferService) RedeemGift(ctx context.Context, userID int64, code string) (*models.CreditTransfer, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return nil, ErrGiftNotFound
+	}
+
+	in := models.CreditTransaction{
+		Kind:   models.CreditTransferIn,
+		Reason: "gift code",
+	}
+	t, err := s.t.RedeemGift(ctx, code, userID, &in)
+	if err != nil {
+		return nil, transferError(err)
+	}
+
+	return t, nil
+}
+
+func (s *creditTransferService) ListGifts(ctx context.Context, senderID int64) ([]*models.CreditTransfer, error) {
+	gifts, err := s.t.ListGifts(ctx, senderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if gifts == nil {
+		gifts = []*models.CreditTransfer{}
+	}
+
+	return gifts, nil
+}
+
+func (s *creditTransferService) checkSender(ctx context.Context, senderID, amount int64) (*models.User, error) {
+	if amount <= 0 || amount > s.cfg.MaxAmount {
+		return nil, fmt.Errorf("%w: must be between 1 and %d", ErrInvalidAmount, s.cfg.MaxAmount)
+	}
+
+	sender, isExist, err := s.u.GetByID(ctx, senderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isExist {
+		err = errors.New("User not found")
+		slog.Info(err.Error())
+		return nil, err
+	}
+
+	if sender.LockedAt != nil {
+		slog.Info(ErrAccountLocked.Error(), "userID", senderID)
+		return nil, ErrAccountLocked
+	}
+
+	return sender, nil
+}
+
+func transferError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrInsufficientCredits):
+		return ErrInsufficientCredits
+	case errors.Is(err, repository.ErrTransferLimit):
+		return ErrTransferLimit
+	case errors.Is(err, repository.ErrGiftNotAvailable):
+		return ErrGiftNotFound
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+// fakeCreditTransferRepository records the transfers it is asked to make.
+type fakeCreditTransferRepository struct {
+	repository.CreditTransferRepository
+	transfers []*models.CreditTransfer
+}
+
+func (r *fakeCreditTransferRepository) Create(ctx context.Context, t *models.CreditTransfer, dailyLimit int, out, in *models.CreditTransaction) error {
+	t.ID = int64(len(r.transfers) + 1)
+	r.transfers = append(r.transfers, t)
+	return nil
+}
+
+func TestTransferFindsRecipientByLinkedEmail(t *testing.T) {
+	sender := &models.User{ID: 1, Email: "sender@example.com"}
+	recipient := &models.User{ID: 2, Email: "recipient@example.com"}
+	users := &fakeUserRepository{
+		users:  []*models.User{sender, recipient},
+		linked: map[string]*models.User{"work@example.com": recipient},
+	}
+	transfers := &fakeCreditTransferRepository{}
+	s := NewCreditTransferService(config.Transfers{DailyLimit: 5, MaxAmount: 100}, users, transfers)
+	ctx := context.Background()
+
+	for _, email := range []string{"recipient@example.com", " Work@Example.com "} {
+		transfer, err := s.Transfer(ctx, sender.ID, email, 10, "")
+		if err != nil {
+			t.Fatalf("Transfer to %q: %v", email, err)
+		}
+		if transfer.RecipientID == nil || *transfer.RecipientID != recipient.ID {
+			t.Errorf("Transfer to %q went to %v, want user %d", email, transfer.RecipientID, recipient.ID)
+		}
+	}
+
+	if _, err := s.Transfer(ctx, sender.ID, "nobody@example.com", 10, ""); !errors.Is(err, ErrRecipientNotFound) {
+		t.Errorf("Transfer to an unknown address = %v, want %v", err, ErrRecipientNotFound)
+	}
+}
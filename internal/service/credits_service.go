@@ -3,13 +3,30 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"strconv"
+	"time"
 
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/models"
 	"github.com/maheshrc27/postflow/internal/repository"
 )
 
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+const expiryBatchSize = 100
+
 type CreditsService interface {
-	GetCredits(ctx context.Context, id int64) (int64, error)
+	GetCredits(ctx context.Context, id int64) (*models.Credits, error)
+	GetHistory(ctx context.Context, userID int64, limit, offset int) ([]*models.CreditTransaction, error)
+	GetExpiring(ctx context.Context, userID int64) ([]*models.CreditBucket, error)
+	// ExpireCredits removes expired promotional credits from all balances
+	// and returns the number of users affected.
+	ExpireCredits(ctx context.Context) (int, error)
 }
 
 type creditsService struct {
@@ -22,24 +39,116 @@ func NewCreditsService(c repository.CreditsRepository) CreditsService {
 	}
 }
 
-func (s *creditsService) GetCredits(ctx context.Context, id int64) (int64, error) {
+func (s *creditsService) GetCredits(ctx context.Context, id int64) (*models.Credits, error) {
 	credits, isExist, err := s.c.GetByUserID(ctx, id)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	if !isExist {
 		err = errors.New("User not found")
 		slog.Info(err.Error())
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+func (s *creditsService) GetHistory(ctx context.Context, userID int64, limit, offset int) ([]*models.CreditTransaction, error) {
+	if limit <= 0 || limit > maxHistoryLimit {
+		limit = defaultHistoryLimit
+	}
+	if offset < 0 {
+		offset = 0
 	}
 
-	return credits.Credits, nil
+	history, err := s.c.GetHistory(ctx, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if history == nil {
+		history = []*models.CreditTransaction{}
+	}
+
+	return history, nil
 }
 
-func (s *creditsService) UpdateCredits(ctx context.Context, userID, newCredits int64) error {
-	err := s.c.UpdateCredits(ctx, newCredits, userID)
+func (s *creditsService) GetExpiring(ctx context.Context, userID int64) ([]*models.CreditBucket, error) {
+	buckets, err := s.c.ListExpiring(ctx, userID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if buckets == nil {
+		buckets = []*models.CreditBucket{}
+	}
+
+	return buckets, nil
+}
+
+func (s *creditsService) ExpireCredits(ctx context.Context) (int, error) {
+	// One expiry entry per user and day keeps reruns of the sweep harmless.
+	day := time.Now().UTC().Format(time.DateOnly)
+
+	var expired int
+	var after int64
+	for {
+		userIDs, err := s.c.ListUsersWithExpiredCredits(ctx, after, expiryBatchSize)
+		if err != nil {
+			return expired, err
+		}
+
+		for _, userID := range userIDs {
+			t, err := s.c.Expire(ctx, userID, fmt.Sprintf("%d:%s", userID, day))
+			if err != nil && !errors.Is(err, repository.ErrDuplicateTransaction) {
+				slog.Error("failed to expire credits", "error", err, "userID", userID)
+				continue
+			}
+			if t != nil {
+				expired++
+			}
+		}
+
+		if len(userIDs) < expiryBatchSize {
+			return expired, nil
+		}
+		after = userIDs[len(userIDs)-1]
+	}
+}
+
+// promoExpiry is when promotional credits granted now expire, or nil if
+// they don't.
+func promoExpiry(cfg config.Credits) *time.Time {
+	if cfg.PromoExpiryDays <= 0 {
+		return nil
+	}
+	expiresAt := time.Now().AddDate(0, 0, cfg.PromoExpiryDays)
+	return &expiresAt
+}
+
+// openCreditsAccount creates the credits row of a new user and grants the
+// signup bonus.
+func openCreditsAccount(ctx context.Context, c repository.CreditsRepository, cfg config.Credits, userID int64) error {
+	if _, err := c.Create(ctx, &models.Credits{UserID: userID}); err != nil {
+		return fmt.Errorf("creating credits row failed for user %d: %w", userID, err)
+	}
+
+	if cfg.SignupBonus <= 0 {
+		return nil
+	}
+
+	err := c.Apply(ctx, &models.CreditTransaction{
+		UserID:        userID,
+		Kind:          models.CreditGrant,
+		Amount:        cfg.SignupBonus,
+		Reason:        "signup bonus",
+		ReferenceType: "signup",
+		ReferenceID:   strconv.FormatInt(userID, 10),
+		ExpiresAt:     promoExpiry(cfg),
+	})
+	if err != nil && !errors.Is(err, repository.ErrDuplicateTransaction) {
+		return fmt.Errorf("granting signup bonus failed for user %d: %w", userID, err)
 	}
 
 	return nil
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+// fakeExpiryRepository holds expired credits for users 1 to users.
+type fakeExpiryRepository struct {
+	repository.CreditsRepository
+	users     int64
+	expired   map[int64]bool
+	reference map[int64]string
+}
+
+func (r *fakeExpiryRepository) ListUsersWithExpiredCredits(ctx context.Context, afterUserID int64, limit int) ([]int64, error) {
+	var userIDs []int64
+	for id := afterUserID + 1; id <= r.users && len(userIDs) < limit; id++ {
+		if !r.expired[id] {
+			userIDs = append(userIDs, id)
+		}
+	}
+	return userIDs, nil
+}
+
+func (r *fakeExpiryRepository) Expire(ctx context.Context, userID int64, referenceID string) (*models.CreditTransaction, error) {
+	switch userID {
+	case 3:
+		return nil, repository.ErrDuplicateTransaction
+	case 4:
+		return nil, nil
+	}
+	r.expired[userID] = true
+	r.reference[userID] = referenceID
+	return &models.CreditTransaction{UserID: userID, Kind: models.CreditExpiry}, nil
+}
+
+func TestExpireCreditsPagesThroughUsers(t *testing.T) {
+	repo := &fakeExpiryRepository{users: 2*expiryBatchSize + 5, expired: map[int64]bool{}, reference: map[int64]string{}}
+	s := NewCreditsService(repo)
+
+	n, err := s.ExpireCredits(context.Background())
+	if err != nil {
+		t.Fatalf("ExpireCredits: %v", err)
+	}
+	if want := int(repo.users) - 2; n != want {
+		t.Errorf("expired users = %d, want %d", n, want)
+	}
+	if !repo.expired[repo.users] {
+		t.Errorf("user %d on the last page wasn't expired", repo.users)
+	}
+
+	day := time.Now().UTC().Format(time.DateOnly)
+	if got, want := repo.reference[1], fmt.Sprintf("1:%s", day); got != want {
+		t.Errorf("reference = %q, want %q", got, want)
+	}
+}
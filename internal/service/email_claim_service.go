@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/mailer"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+const (
+	emailClaimTTL = 15 * time.Minute
+	// maxEmailClaimAttempts is how many wrong codes a claim tolerates.
+	maxEmailClaimAttempts = 5
+	// maxEmailClaimsPerHour limits how many codes a user can have mailed.
+	maxEmailClaimsPerHour = 5
+)
+
+var (
+	ErrInvalidEmail       = errors.New("invalid email address")
+	ErrEmailOwned         = errors.New("email belongs to another account")
+	ErrEmailClaimLimit    = errors.New("too many verification codes requested, try again later")
+	ErrEmailClaimNotFound = errors.New("no pending verification for this email")
+	ErrInvalidClaimCode   = errors.New("invalid verification code")
+)
+
+type EmailClaimService interface {
+	// Start mails a verification code to an address the user says they
+	// own.
+	Start(ctx context.Context, userID int64, email string) error
+	// Confirm checks the code and links the address to the user, merging
+	// the account purchases under it were credited to.
+	Confirm(ctx context.Context, userID int64, email, code string) (*models.AccountMerge, error)
+	ListEmails(ctx context.Context, userID int64) ([]*models.UserEmail, error)
+}
+
+type emailClaimService struct {
+	cfg config.Config
+	u   repository.UserRepository
+	r   repository.EmailClaimRepository
+	i   repository.IdentityRepository
+	m   mailer.Mailer
+}
+
+func NewEmailClaimService(cfg config.Config, u repository.UserRepository, r repository.EmailClaimRepository, i repository.IdentityRepository, m mailer.Mailer) EmailClaimService {
+	return &emailClaimService{
+		cfg: cfg,
+		u:   u,
+		r:   r,
+		i:   i,
+		m:   m,
+	}
+}
+
+func (s *emailClaimService) Start(ctx context.Context, userID int64, email string) error {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkClaimable(ctx, userID, email); err != nil {
+		return err
+	}
+
+	count, err := s.r.CountSince(ctx, userID, time.Now().Add(-time.Hour))
+	if err != nil {
+		return err
+	}
+
+	if count >= maxEmailClaimsPerHour {
+		slog.Info(ErrEmailClaimLimit.Error(), "userID", userID)
+		return ErrEmailClaimLimit
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	claim := &models.EmailClaim{
+		UserID:    userID,
+		Email:     email,
+		CodeHash:  s.hashCode(userID, email, code),
+		ExpiresAt: time.Now().Add(emailClaimTTL),
+	}
+	if err := s.r.Create(ctx, claim); err != nil {
+		return err
+	}
+
+	return s.m.Send(ctx, &mailer.Message{
+		To:      email,
+		Subject: "Your Postflow verification code",
+		Body: fmt.Sprintf("Your verification code is %s.\n\n"+
+			"Enter it in Postflow within %d minutes to link this address to your account. "+
+			"Purchases made with it will be added to that account.\n\n"+
+			"If you didn't ask for this, you can ignore this email.\n", code, int(emailClaimTTL.Minutes())),
+	})
+}
+
+func (s *emailClaimService) Confirm(ctx context.Context, userID int64, email, code string) (*models.AccountMerge, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
+	claim, isExist, err := s.r.GetPending(ctx, userID, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isExist || claim.Attempts >= maxEmailClaimAttempts {
+		slog.Info(ErrEmailClaimNotFound.Error(), "userID", userID)
+		return nil, ErrEmailClaimNotFound
+	}
+
+	if !hmac.Equal([]byte(s.hashCode(userID, email, strings.TrimSpace(code))), []byte(claim.CodeHash)) {
+		if err := s.r.AddAttempt(ctx, claim.ID); err != nil {
+			return nil, err
+		}
+		slog.Info(ErrInvalidClaimCode.Error(), "userID", userID, "attempts", claim.Attempts+1)
+		return nil, ErrInvalidClaimCode
+	}
+
+	merge, err := s.r.Confirm(ctx, claim)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrEmailInUse):
+			return nil, ErrEmailOwned
+		case errors.Is(err, repository.ErrClaimNotPending):
+			return nil, ErrEmailClaimNotFound
+		}
+		return nil, err
+	}
+
+	return merge, nil
+}
+
+func (s *emailClaimService) ListEmails(ctx context.Context, userID int64) ([]*models.UserEmail, error) {
+	emails, err := s.r.ListEmails(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if emails == nil {
+		emails = []*models.UserEmail{}
+	}
+
+	return emails, nil
+}
+
+// checkClaimable rejects the user's own address and addresses of accounts
+// someone signs in to. Accounts that were only created for purchases can be
+// claimed.
+func (s *emailClaimService) checkClaimable(ctx context.Context, userID int64, email string) error {
+	user, isExist, err := s.u.GetByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	if isExist {
+		if user.ID == userID {
+			slog.Info(ErrEmailOwned.Error(), "userID", userID)
+			return ErrEmailOwned
+		}
+
+		identities, err := s.i.ListByUserID(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		if user.GoogleID != "" || len(identities) > 0 {
+			slog.Info(ErrEmailOwned.Error(), "userID", userID)
+			return ErrEmailOwned
+		}
+	}
+
+	user, isExist, err = s.u.GetByLinkedEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	if isExist && user.ID != userID {
+		slog.Info(ErrEmailOwned.Error(), "userID", userID)
+		return ErrEmailOwned
+	}
+
+	return nil
+}
+
+func (s *emailClaimService) hashCode(userID int64, email, code string) string {
+	mac := hmac.New(sha256.New, []byte(s.cfg.SecretKey))
+	mac.Write([]byte(strconv.FormatInt(userID, 10) + ":" + email + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// normalizeEmail validates a bare address and lowercases it, so that case
+// variants of an address are throttled, claimed and signed in to as one.
+func normalizeEmail(email string) (string, error) {
+	address, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || address.Name != "" {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(address.Address), nil
+}
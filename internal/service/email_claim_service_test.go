@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/mailer"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+type fakeUserRepository struct {
+	repository.UserRepository
+	users   []*models.User
+	linked  map[string]*models.User
+	lockErr error
+}
+
+func (r *fakeUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, bool, error) {
+	for _, u := range r.users {
+		if strings.EqualFold(u.Email, email) {
+			return u, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (r *fakeUserRepository) GetByLinkedEmail(ctx context.Context, email string) (*models.User, bool, error) {
+	u, ok := r.linked[strings.ToLower(email)]
+	return u, ok, nil
+}
+
+func (r *fakeUserRepository) GetByID(ctx context.Context, id int64) (*models.User, bool, error) {
+	for _, u := range r.users {
+		if u.ID == id {
+			return u, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+type fakeIdentityRepository struct {
+	repository.IdentityRepository
+}
+
+func (r fakeIdentityRepository) ListByUserID(ctx context.Context, userID int64) ([]*models.UserIdentity, error) {
+	return nil, nil
+}
+
+// fakeEmailClaimRepository keeps claims in memory. Confirming one merges the
+// account under its email, if there is one.
+type fakeEmailClaimRepository struct {
+	repository.EmailClaimRepository
+	mu     sync.Mutex
+	claims []*models.EmailClaim
+	users  *fakeUserRepository
+}
+
+func (r *fakeEmailClaimRepository) Create(ctx context.Context, c *models.EmailClaim) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c.ID, c.CreatedAt = int64(len(r.claims)+1), time.Now()
+	stored := *c
+	r.claims = append(r.claims, &stored)
+	return nil
+}
+
+func (r *fakeEmailClaimRepository) GetPending(ctx context.Context, userID int64, email string) (*models.EmailClaim, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.claims) - 1; i >= 0; i-- {
+		c := r.claims[i]
+		if c.UserID == userID && c.Email == email && c.ConfirmedAt == nil {
+			copied := *c
+			return &copied, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (r *fakeEmailClaimRepository) CountSince(ctx context.Context, userID int64, since time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	for _, c := range r.claims {
+		if c.UserID == userID && c.CreatedAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *fakeEmailClaimRepository) AddAttempt(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.claims[id-1].Attempts++
+	return nil
+}
+
+func (r *fakeEmailClaimRepository) Confirm(ctx context.Context, c *models.EmailClaim) (*models.AccountMerge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.claims[c.ID-1].ConfirmedAt = &now
+
+	merge := &models.AccountMerge{Email: c.Email}
+	if other, ok, _ := r.users.GetByEmail(ctx, c.Email); ok {
+		merge.MergedUserID = &other.ID
+	}
+	return merge, nil
+}
+
+var emailClaimCode = regexp.MustCompile(`\b\d{6}\b`)
+
+func newEmailClaimTest(users ...*models.User) (EmailClaimService, *fakeEmailClaimRepository, *mailer.Memory) {
+	u := &fakeUserRepository{users: users}
+	claims := &fakeEmailClaimRepository{users: u}
+	m := mailer.NewMemory()
+	s := NewEmailClaimService(config.Config{SecretKey: "secret"}, u, claims, fakeIdentityRepository{}, m)
+	return s, claims, m
+}
+
+func TestEmailClaimConfirmsMailedCode(t *testing.T) {
+	buyer := &models.User{ID: 2, Email: "buyer@example.com"}
+	s, claims, m := newEmailClaimTest(buyer)
+	ctx := context.Background()
+
+	if err := s.Start(ctx, 1, "buyer@example.com"); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	msg := m.Last("buyer@example.com")
+	if msg == nil {
+		t.Fatal("no code was mailed")
+	}
+	code := emailClaimCode.FindString(msg.Body)
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "000001"
+	}
+	if _, err := s.Confirm(ctx, 1, "buyer@example.com", wrong); !errors.Is(err, ErrInvalidClaimCode) {
+		t.Fatalf("Confirm with a wrong code = %v, want %v", err, ErrInvalidClaimCode)
+	}
+	if claims.claims[0].Attempts != 1 {
+		t.Errorf("attempts = %d, want 1", claims.claims[0].Attempts)
+	}
+
+	merge, err := s.Confirm(ctx, 1, "buyer@example.com", code)
+	if err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	if merge.MergedUserID == nil || *merge.MergedUserID != buyer.ID {
+		t.Errorf("merged %v, want user %d", merge.MergedUserID, buyer.ID)
+	}
+	if _, err := s.Confirm(ctx, 1, "buyer@example.com", code); !errors.Is(err, ErrEmailClaimNotFound) {
+		t.Errorf("Confirm of a confirmed claim = %v, want %v", err, ErrEmailClaimNotFound)
+	}
+}
+
+func TestEmailClaimLimits(t *testing.T) {
+	s, claims, _ := newEmailClaimTest(&models.User{ID: 1, Email: "owner@example.com"}, &models.User{ID: 3, Email: "other@example.com", GoogleID: "google-3"})
+	ctx := context.Background()
+
+	if err := s.Start(ctx, 1, "owner@example.com"); !errors.Is(err, ErrEmailOwned) {
+		t.Errorf("Start with the user's own address = %v, want %v", err, ErrEmailOwned)
+	}
+	if err := s.Start(ctx, 1, "Other@Example.com"); !errors.Is(err, ErrEmailOwned) {
+		t.Errorf("Start with the address of an account that signs in = %v, want %v", err, ErrEmailOwned)
+	}
+
+	for i := 0; i < maxEmailClaimsPerHour; i++ {
+		if err := s.Start(ctx, 1, "buyer@example.com"); err != nil {
+			t.Fatalf("Start %d: %v", i+1, err)
+		}
+	}
+	if err := s.Start(ctx, 1, "BUYER@example.com"); !errors.Is(err, ErrEmailClaimLimit) {
+		t.Errorf("Start over the limit = %v, want %v", err, ErrEmailClaimLimit)
+	}
+
+	// A claim stops accepting codes after too many wrong ones.
+	claims.claims[len(claims.claims)-1].Attempts = maxEmailClaimAttempts
+	if _, err := s.Confirm(ctx, 1, "buyer@example.com", "000000"); !errors.Is(err, ErrEmailClaimNotFound) {
+		t.Errorf("Confirm after too many attempts = %v, want %v", err, ErrEmailClaimNotFound)
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		in, want string
+		err      error
+	}{
+		{"ada@example.com", "ada@example.com", nil},
+		{"  Ada@Example.COM ", "ada@example.com", nil},
+		{"<ada@example.com>", "ada@example.com", nil},
+		{"Ada <ada@example.com>", "", ErrInvalidEmail},
+		{"not an email", "", ErrInvalidEmail},
+	}
+	for _, tt := range tests {
+		got, err := normalizeEmail(tt.in)
+		if got != tt.want || err != tt.err {
+			t.Errorf("normalizeEmail(%q) = %q, %v, want %q, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+// plans maps plan codes to their limits. Subscription plans use the plan code
+// of their product; a subscription product with an unknown code gets the
+// pack limits.
+var plans = map[string]models.Entitlements{
+	models.PlanFree: {
+		MaxConcurrentJobs:  1,
+		MaxDurationSeconds: 30,
+		Resolutions:        []string{"720p"},
+		Watermark:          true,
+		StorageQuota:       10,
+	},
+	models.PlanPack: {
+		MaxConcurrentJobs:  2,
+		MaxDurationSeconds: 60,
+		Resolutions:        []string{"720p", "1080p"},
+		Watermark:          false,
+		StorageQuota:       100,
+	},
+	"pro": {
+		MaxConcurrentJobs:  4,
+		MaxDurationSeconds: 180,
+		Resolutions:        []string{"720p", "1080p"},
+		Watermark:          false,
+		StorageQuota:       500,
+	},
+	"business": {
+		MaxConcurrentJobs:  10,
+		MaxDurationSeconds: 600,
+		Resolutions:        []string{"720p", "1080p", "4k"},
+		Watermark:          false,
+		StorageQuota:       5000,
+	},
+}
+
+type EntitlementService interface {
+	GetEntitlements(ctx context.Context, userID int64) (*models.Entitlements, error)
+}
+
+type entitlementService struct {
+	s repository.SubscriptionRepository
+	p repository.ProductRepository
+	c repository.CreditsRepository
+}
+
+func NewEntitlementService(s repository.SubscriptionRepository, p repository.ProductRepository, c repository.CreditsRepository) EntitlementService {
+	return &entitlementService{
+		s: s,
+		p: p,
+		c: c,
+	}
+}
+
+// GetEntitlements resolves the user's plan: an active subscription wins,
+// then any past pack purchase that wasn't refunded or disputed, and everyone
+// else is on the free plan.
+func (s *entitlementService) GetEntitlements(ctx context.Context, userID int64) (*models.Entitlements, error) {
+	plan, err := s.resolvePlan(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	entitlements, ok := plans[plan]
+	if !ok {
+		slog.Info("unknown plan, using pack entitlements", "plan", plan, "userID", userID)
+		entitlements = plans[models.PlanPack]
+	}
+	entitlements.Plan = plan
+
+	return &entitlements, nil
+}
+
+func (s *entitlementService) resolvePlan(ctx context.Context, userID int64) (string, error) {
+	sub, isExist, err := s.s.GetCurrentByUserID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if isExist && sub.Status == models.SubscriptionActive {
+		product, isExist, err := s.p.GetByID(ctx, sub.ProductID)
+		if err != nil {
+			return "", err
+		}
+		if isExist && product.Plan != "" {
+			return product.Plan, nil
+		}
+		return models.PlanPack, nil
+	}
+
+	purchased, err := s.c.HasPaidPurchase(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if purchased {
+		return models.PlanPack, nil
+	}
+
+	return models.PlanFree, nil
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/invoice"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/payment"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+var ErrOrderNotFound = errors.New("order not found")
+
+type OrderService interface {
+	// RecordPurchase stores the order for a processed sale. Recording the
+	// same payment event again does nothing.
+	RecordPurchase(ctx context.Context, userID, eventID int64, product *models.Product, coupon *models.Coupon, event *payment.Event) error
+	ListInvoices(ctx context.Context, userID int64) ([]*models.Order, error)
+	RenderInvoice(ctx context.Context, userID, orderID int64, w io.Writer) error
+}
+
+type orderService struct {
+	cfg config.Invoice
+	u   repository.UserRepository
+	o   repository.OrderRepository
+}
+
+func NewOrderService(cfg config.Invoice, u repository.UserRepository, o repository.OrderRepository) OrderService {
+	return &orderService{
+		cfg: cfg,
+		u:   u,
+		o:   o,
+	}
+}
+
+func (s *orderService) RecordPurchase(ctx context.Context, userID, eventID int64, product *models.Product, coupon *models.Coupon, event *payment.Event) error {
+	user, isExist, err := s.u.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !isExist {
+		err = errors.New("User not found")
+		slog.Info(err.Error())
+		return err
+	}
+
+	currency := event.Currency
+	if currency == "" {
+		currency = product.Currency
+	}
+
+	// The lines are net of tax, so that they add up to the subtotal. With a
+	// coupon, the list price is taken net of tax at the rate of the sale and
+	// the discount is the rest.
+	subtotal := event.PriceMinor - event.TaxMinor
+	listMinor := subtotal
+	if coupon != nil {
+		listMinor = product.PriceMinor
+		if event.PriceMinor > 0 {
+			listMinor = (product.PriceMinor*subtotal + event.PriceMinor/2) / event.PriceMinor
+		}
+	}
+
+	order := models.Order{
+		UserID:         &userID,
+		PaymentEventID: eventID,
+		Provider:       event.Provider,
+		Currency:       currency,
+		SubtotalMinor:  subtotal,
+		TaxMinor:       event.TaxMinor,
+		TotalMinor:     event.PriceMinor,
+		BillingName:    user.BillingName,
+		BillingEmail:   user.Email,
+		BillingAddress: user.BillingAddress,
+		BillingCountry: user.BillingCountry,
+		VATID:          user.VATID,
+		Lines: []*models.OrderLine{
+			{
+				Description:    fmt.Sprintf("%s (%d credits)", product.Name, product.Credits),
+				Quantity:       1,
+				UnitPriceMinor: listMinor,
+				AmountMinor:    listMinor,
+			},
+		},
+	}
+
+	if coupon != nil {
+		discount := subtotal - listMinor
+		order.Lines = append(order.Lines, &models.OrderLine{
+			Description:    fmt.Sprintf("Coupon %s (%d%% off)", coupon.Code, coupon.DiscountPercent),
+			Quantity:       1,
+			UnitPriceMinor: discount,
+			AmountMinor:    discount,
+		})
+	}
+
+	if _, err := s.o.Create(ctx, &order); err != nil {
+		return fmt.Errorf("recording order failed: %w", err)
+	}
+
+	return nil
+}
+
+func (s *orderService) ListInvoices(ctx context.Context, userID int64) ([]*models.Order, error) {
+	orders, err := s.o.ListByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if orders == nil {
+		orders = []*models.Order{}
+	}
+
+	return orders, nil
+}
+
+func (s *orderService) RenderInvoice(ctx context.Context, userID, orderID int64, w io.Writer) error {
+	order, isExist, err := s.o.GetByID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	if !isExist || order.UserID == nil || *order.UserID != userID {
+		slog.Info(ErrOrderNotFound.Error(), "orderID", orderID, "userID", userID)
+		return ErrOrderNotFound
+	}
+
+	seller := invoice.Seller{
+		Name:    s.cfg.SellerName,
+		Address: s.cfg.SellerAddress,
+		VATID:   s.cfg.SellerVATID,
+		Email:   s.cfg.SellerEmail,
+		Country: s.cfg.SellerCountry,
+	}
+	return invoice.Render(w, seller, order)
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/payment"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+// fakeOrderRepository keeps the last order it was asked to create.
+type fakeOrderRepository struct {
+	repository.OrderRepository
+	order *models.Order
+}
+
+func (r *fakeOrderRepository) Create(ctx context.Context, order *models.Order) (bool, error) {
+	r.order = order
+	return true, nil
+}
+
+func TestOrderLinesAddUpToSubtotal(t *testing.T) {
+	product := &models.Product{Name: "Pack", Credits: 100, PriceMinor: 1600, Currency: "eur"}
+	coupon := &models.Coupon{Code: "SPRING", DiscountPercent: 25}
+	tests := []struct {
+		name      string
+		coupon    *models.Coupon
+		event     *payment.Event
+		lines     []int64
+		wantTotal int64
+	}{
+		{"tax included", nil, &payment.Event{PriceMinor: 1600, TaxMinor: 267, Currency: "eur"}, []int64{1333}, 1600},
+		{"no tax", nil, &payment.Event{PriceMinor: 1600, Currency: "eur"}, []int64{1600}, 1600},
+		{"coupon with tax", coupon, &payment.Event{PriceMinor: 1200, TaxMinor: 200, Currency: "eur"}, []int64{1333, -333}, 1200},
+		{"free with coupon", &models.Coupon{Code: "FREE", DiscountPercent: 100}, &payment.Event{Currency: "eur"}, []int64{1600, -1600}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &fakeUserRepository{users: []*models.User{{ID: 1, Email: "buyer@example.com"}}}
+			orders := &fakeOrderRepository{}
+			s := NewOrderService(config.Invoice{}, users, orders)
+
+			if err := s.RecordPurchase(context.Background(), 1, 1, product, tt.coupon, tt.event); err != nil {
+				t.Fatalf("RecordPurchase: %v", err)
+			}
+			order := orders.order
+			if len(order.Lines) != len(tt.lines) {
+				t.Fatalf("got %d lines, want %d", len(order.Lines), len(tt.lines))
+			}
+			var sum int64
+			for i, line := range order.Lines {
+				if line.AmountMinor != tt.lines[i] {
+					t.Errorf("line %d = %d, want %d", i+1, line.AmountMinor, tt.lines[i])
+				}
+				sum += line.AmountMinor
+			}
+			if sum != order.SubtotalMinor || order.SubtotalMinor+order.TaxMinor != order.TotalMinor || order.TotalMinor != tt.wantTotal {
+				t.Errorf("lines add up to %d, subtotal %d + tax %d = total %d, want lines to make up a total of %d", sum, order.SubtotalMinor, order.TaxMinor, order.TotalMinor, tt.wantTotal)
+			}
+		})
+	}
+}
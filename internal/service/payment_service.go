@@ -2,99 +2,593 @@ package service
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log/slog"
 	"strconv"
+	"strings"
 
 	config "github.com/maheshrc27/postflow/configs"
 	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/payment"
 	"github.com/maheshrc27/postflow/internal/repository"
 )
 
 const (
-	productId      = "ehajql"
-	price1         = 500
-	price2         = 900
-	price3         = 1500
-	InitialCredits = 1
-	CreditsPrice1  = 10
-	CreditsPrice2  = 30
-	CreditsPrice3  = 50
+	RefundPolicyNegative = "negative"
+	RefundPolicyLock     = "lock"
+)
+
+var (
+	ErrUnknownProduct       = errors.New("no active product matches the sale")
+	ErrProductNotFound      = errors.New("product not found")
+	ErrOriginalSaleNotFound = errors.New("reversed sale has not been processed")
+	ErrDisputeNotReversed   = errors.New("disputed sale has not been reversed")
 )
 
 type PaymentService interface {
-	HandlePayment(ctx context.Context, email, productID, productPrice string) error
+	HandleWebhook(ctx context.Context, provider string, r *payment.WebhookRequest) error
+	HandleEvent(ctx context.Context, event *payment.Event) error
+	CreateCheckout(ctx context.Context, userID, productID int64, couponCode, country, ip string) (*payment.CheckoutSession, error)
+	ListProducts(ctx context.Context, country, ip string) (*models.PriceList, []*models.Product, error)
 }
 
 type paymentService struct {
-	cfg config.Config
-	u   repository.UserRepository
-	c   repository.CreditsRepository
+	cfg       config.Config
+	u         repository.UserRepository
+	c         repository.CreditsRepository
+	e         repository.PaymentEventRepository
+	p         repository.ProductRepository
+	subs      SubscriptionService
+	coupons   CouponService
+	referrals ReferralService
+	orders    OrderService
+	pricing   PricingService
+	providers payment.Providers
 }
 
-func NewPaymentService(cfg config.Config, u repository.UserRepository, c repository.CreditsRepository) PaymentService {
+func NewPaymentService(cfg config.Config, u repository.UserRepository, c repository.CreditsRepository, e repository.PaymentEventRepository, p repository.ProductRepository, subs SubscriptionService, coupons CouponService, referrals ReferralService, orders OrderService, pricing PricingService, providers payment.Providers) PaymentService {
 	return &paymentService{
-		cfg: cfg,
-		u:   u,
-		c:   c,
+		cfg:       cfg,
+		u:         u,
+		c:         c,
+		e:         e,
+		p:         p,
+		subs:      subs,
+		coupons:   coupons,
+		referrals: referrals,
+		orders:    orders,
+		pricing:   pricing,
+		providers: providers,
 	}
 }
 
-func (s *paymentService) HandlePayment(ctx context.Context, email, productID, productPrice string) error {
+// ListProducts returns the catalog priced for the buyer's country.
+func (s *paymentService) ListProducts(ctx context.Context, country, ip string) (*models.PriceList, []*models.Product, error) {
+	priceList, err := s.pricing.PriceList(ctx, country, ip)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	if productID != productId {
-		err := errors.New("No product exists like this")
-		slog.Info(err.Error())
-		return fmt.Errorf("fetching user by email failed: %w", err)
+	products, err := s.p.ListActive(ctx, priceList.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if products == nil {
+		products = []*models.Product{}
+	}
+
+	return priceList, products, nil
+}
+
+// HandleWebhook authenticates a webhook with the named provider and processes
+// the event it carries. Events the provider reports as irrelevant are
+// acknowledged without doing anything.
+func (s *paymentService) HandleWebhook(ctx context.Context, provider string, r *payment.WebhookRequest) error {
+	p, err := s.providers.Get(provider)
+	if err != nil {
+		slog.Info(err.Error(), "provider", provider)
+		return err
 	}
 
-	price, _ := strconv.Atoi(productPrice)
+	event, err := p.ParseWebhook(r)
+	if err != nil {
+		if errors.Is(err, payment.ErrIgnoredEvent) {
+			return nil
+		}
+		return err
+	}
+
+	return s.HandleEvent(ctx, event)
+}
+
+// HandleEvent records the event and acts on it. An event that was already
+// processed is acknowledged without acting again, so provider retries are
+// safe.
+func (s *paymentService) HandleEvent(ctx context.Context, event *payment.Event) error {
+	record := models.PaymentEvent{
+		Provider:  event.Provider,
+		SaleID:    event.SaleID,
+		Email:     event.Email,
+		ProductID: event.ProductID,
+		Price:     strconv.FormatInt(event.PriceMinor, 10),
+		Payload:   event.Payload,
+	}
 
-	user, isExist, err := s.u.GetByEmail(ctx, email)
+	claimed, err := s.e.Claim(ctx, &record)
 	if err != nil {
-		return fmt.Errorf("fetching user by email failed: %w", err)
+		return fmt.Errorf("recording payment event failed: %w", err)
+	}
+
+	if !claimed {
+		slog.Info("skipping already processed payment event", "provider", event.Provider, "saleID", event.SaleID)
+		return nil
 	}
 
 	var userID int64
+	switch event.Type {
+	case payment.EventRefund, payment.EventDispute:
+		userID, err = s.reversePurchase(ctx, event)
+	case payment.EventDisputeWon:
+		userID, err = s.restorePurchase(ctx, event)
+	case payment.EventSubscriptionStarted:
+		userID, err = s.startSubscription(ctx, record.ID, event)
+	case payment.EventSubscriptionRenewed, payment.EventSubscriptionUpdated,
+		payment.EventSubscriptionPastDue, payment.EventSubscriptionCanceled:
+		userID, err = s.updateSubscription(ctx, record.ID, event)
+	default:
+		userID, err = s.grantPurchase(ctx, record.ID, event)
+	}
+	if err != nil {
+		if markErr := s.e.MarkFailed(ctx, record.ID, err.Error()); markErr != nil {
+			slog.Error("failed to mark payment event as failed", "error", markErr, "eventID", record.ID)
+		}
+		return err
+	}
+
+	return s.e.MarkProcessed(ctx, record.ID, userID)
+}
+
+func (s *paymentService) grantPurchase(ctx context.Context, eventID int64, event *payment.Event) (int64, error) {
+	product, coupon, err := s.resolveProduct(ctx, event)
+	if err != nil {
+		return 0, err
+	}
+
+	userID, err := s.resolveBuyer(ctx, event)
+	if err != nil {
+		return 0, err
+	}
+
+	s.recordCoupon(ctx, userID, coupon)
+
+	// Keyed on the payment event, so a retry after a partial failure cannot
+	// grant the same sale twice.
+	err = s.c.Apply(ctx, &models.CreditTransaction{
+		UserID:        userID,
+		Kind:          models.CreditPurchase,
+		Amount:        product.Credits,
+		Reason:        fmt.Sprintf("purchase of %s", product.Name),
+		ReferenceType: "payment_event",
+		ReferenceID:   strconv.FormatInt(eventID, 10),
+	})
+	if err != nil && !errors.Is(err, repository.ErrDuplicateTransaction) {
+		slog.Error("failed to update credits", "error", err, "userID", userID)
+		return 0, fmt.Errorf("updating credits failed: %w", err)
+	}
+
+	if err := s.orders.RecordPurchase(ctx, userID, eventID, product, coupon, event); err != nil {
+		return 0, err
+	}
+
+	s.rewardReferral(ctx, userID, eventID)
+
+	return userID, nil
+}
+
+func (s *paymentService) startSubscription(ctx context.Context, eventID int64, event *payment.Event) (int64, error) {
+	product, coupon, err := s.resolveProduct(ctx, event)
+	if err != nil {
+		return 0, err
+	}
+
+	if !product.IsSubscription() {
+		return 0, fmt.Errorf("%w: %s is not a subscription plan", ErrUnknownProduct, product.Name)
+	}
+
+	userID, err := s.resolveBuyer(ctx, event)
+	if err != nil {
+		return 0, err
+	}
+
+	sub, err := s.subs.Start(ctx, userID, product, event)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.e.SetSubscription(ctx, eventID, sub); err != nil {
+		return 0, err
+	}
+
+	s.recordCoupon(ctx, userID, coupon)
+
+	if err := s.orders.RecordPurchase(ctx, userID, eventID, product, coupon, event); err != nil {
+		return 0, err
+	}
+
+	s.rewardReferral(ctx, userID, eventID)
+
+	return userID, nil
+}
+
+// updateSubscription applies a subscription event. A renewal is a payment,
+// so the period it paid for is recorded on the event and it is invoiced.
+func (s *paymentService) updateSubscription(ctx context.Context, eventID int64, event *payment.Event) (int64, error) {
+	sub, err := s.subs.HandleEvent(ctx, event)
+	if err != nil {
+		return 0, err
+	}
+
+	if event.Type != payment.EventSubscriptionRenewed {
+		return sub.UserID, nil
+	}
+
+	if err := s.e.SetSubscription(ctx, eventID, sub); err != nil {
+		return 0, err
+	}
+
+	product, isExist, err := s.p.GetByIDPrice(ctx, sub.ProductID, event.Currency, event.PriceMinor)
+	if err != nil {
+		return 0, fmt.Errorf("fetching plan failed: %w", err)
+	}
+
+	if !isExist {
+		return 0, fmt.Errorf("%w: plan %d at %d %s", ErrUnknownProduct, sub.ProductID, event.PriceMinor, event.Currency)
+	}
+
+	if err := s.orders.RecordPurchase(ctx, sub.UserID, eventID, product, nil, event); err != nil {
+		return 0, err
+	}
+
+	return sub.UserID, nil
+}
+
+// resolveProduct finds the active product a sale was made for, along with
+// the discount coupon it was bought with, if any.
+func (s *paymentService) resolveProduct(ctx context.Context, event *payment.Event) (*models.Product, *models.Coupon, error) {
+	if event.CouponCode != "" {
+		return s.resolveDiscountedProduct(ctx, event)
+	}
+
+	product, isExist, err := s.p.GetByProviderPrice(ctx, event.Provider, event.ProductID, event.Currency, event.PriceMinor)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetching product failed: %w", err)
+	}
+
 	if !isExist {
-		userID, err = s.createUserAndCredits(ctx, email)
+		slog.Info(ErrUnknownProduct.Error(), "provider", event.Provider, "productID", event.ProductID, "price", event.PriceMinor, "currency", event.Currency)
+		return nil, nil, fmt.Errorf("%w: %s at %d %s", ErrUnknownProduct, event.ProductID, event.PriceMinor, event.Currency)
+	}
+
+	return product, nil, nil
+}
+
+// resolveDiscountedProduct matches a sale made with a coupon against the
+// discounted prices of the catalog, so that a code can't be used to pay less
+// than the coupon allows.
+func (s *paymentService) resolveDiscountedProduct(ctx context.Context, event *payment.Event) (*models.Product, *models.Coupon, error) {
+	coupon, err := s.coupons.GetDiscount(ctx, event.CouponCode)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: coupon %s: %v", ErrUnknownProduct, event.CouponCode, err)
+	}
+
+	products, err := s.p.ListByProviderProduct(ctx, event.Provider, event.ProductID, event.Currency)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetching products failed: %w", err)
+	}
+
+	for _, product := range products {
+		if coupon.DiscountedPrice(product.PriceMinor) == event.PriceMinor {
+			return product, coupon, nil
+		}
+	}
+
+	slog.Info(ErrUnknownProduct.Error(), "provider", event.Provider, "productID", event.ProductID, "price", event.PriceMinor, "currency", event.Currency, "coupon", coupon.Code)
+	return nil, nil, fmt.Errorf("%w: %s at %d %s with coupon %s", ErrUnknownProduct, event.ProductID, event.PriceMinor, event.Currency, coupon.Code)
+}
+
+// recordCoupon counts a discounted sale against the coupon. The buyer has
+// already paid, so a coupon that ran out in the meantime is only logged.
+func (s *paymentService) recordCoupon(ctx context.Context, userID int64, coupon *models.Coupon) {
+	if coupon == nil {
+		return
+	}
+
+	if err := s.coupons.RecordDiscount(ctx, userID, coupon); err != nil {
+		slog.Error("failed to record coupon redemption", "error", err, "code", coupon.Code, "userID", userID)
+	}
+}
+
+// resolveBuyer returns the user the sale belongs to: the user checkout was
+// started by, else the user the buyer's email belongs to. An account is
+// created for buyers who haven't signed in yet; they can claim it later by
+// verifying the email.
+func (s *paymentService) resolveBuyer(ctx context.Context, event *payment.Event) (int64, error) {
+	if userID, ok := parseAccountToken(s.cfg.SecretKey, event.AccountToken); ok {
+		_, isExist, err := s.u.GetByID(ctx, userID)
 		if err != nil {
-			return err
+			return 0, fmt.Errorf("fetching user failed: %w", err)
+		}
+
+		if isExist {
+			return userID, nil
+		}
+	} else if event.AccountToken != "" {
+		slog.Info("ignoring invalid account token", "provider", event.Provider, "saleID", event.SaleID)
+	}
+
+	user, isExist, err := s.u.GetByEmail(ctx, event.Email)
+	if err != nil {
+		return 0, fmt.Errorf("fetching user by email failed: %w", err)
+	}
+
+	if isExist {
+		return user.ID, nil
+	}
+
+	user, isExist, err = s.u.GetByLinkedEmail(ctx, event.Email)
+	if err != nil {
+		return 0, fmt.Errorf("fetching user by linked email failed: %w", err)
+	}
+
+	if isExist {
+		return user.ID, nil
+	}
+
+	return s.createUserAndCredits(ctx, event.Email)
+}
+
+// reversePurchase takes back the credits granted for the sale a refund or
+// dispute refers to. Credits that were already spent leave the balance
+// negative, which blocks generation until it is paid back.
+func (s *paymentService) reversePurchase(ctx context.Context, event *payment.Event) (int64, error) {
+	original, isExist, err := s.e.GetBySaleID(ctx, event.Provider, event.OriginalSaleID)
+	if err != nil {
+		return 0, fmt.Errorf("fetching reversed sale failed: %w", err)
+	}
+
+	// The purchase may not have been processed yet; failing here makes the
+	// provider retry the reversal later.
+	if !isExist || original.UserID == nil {
+		slog.Info(ErrOriginalSaleNotFound.Error(), "provider", event.Provider, "saleID", event.OriginalSaleID)
+		return 0, fmt.Errorf("%w: %s", ErrOriginalSaleNotFound, event.OriginalSaleID)
+	}
+
+	if original.Status == models.PaymentEventRefunded || original.Status == models.PaymentEventDisputed {
+		slog.Info("sale already reversed", "provider", event.Provider, "saleID", event.OriginalSaleID)
+		return *original.UserID, nil
+	}
+
+	reason := reversalLockReason(event.Type, event.OriginalSaleID)
+	var userID int64
+	if original.SubscriptionID != nil {
+		userID, err = s.subs.ReversePayment(ctx, original, reason)
+	} else {
+		userID, err = s.reverseGrant(ctx, original, event, reason)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Before the sale is marked reversed, so that a failure is retried.
+	if err := s.referrals.ReverseReward(ctx, original.ID); err != nil {
+		return 0, err
+	}
+
+	// Locking leaves an existing lock alone, so a retry can lock again.
+	if s.cfg.RefundPolicy == RefundPolicyLock {
+		if err := s.u.Lock(ctx, userID, reason); err != nil {
+			return 0, err
+		}
+	}
+
+	// Last, because a sale marked reversed isn't reversed again on a retry.
+	status := models.PaymentEventRefunded
+	if event.Type == payment.EventDispute {
+		status = models.PaymentEventDisputed
+	}
+	if err := s.e.MarkReversed(ctx, original.ID, status); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// reverseGrant takes back the credits a one-off purchase granted.
+func (s *paymentService) reverseGrant(ctx context.Context, original *models.PaymentEvent, event *payment.Event, reason string) (int64, error) {
+	reference := strconv.FormatInt(original.ID, 10)
+	grant, isExist, err := s.c.GetByReference(ctx, models.CreditPurchase, "payment_event", reference)
+	if err != nil {
+		return 0, fmt.Errorf("fetching granted credits failed: %w", err)
+	}
+
+	if !isExist {
+		slog.Info(ErrOriginalSaleNotFound.Error(), "provider", event.Provider, "saleID", event.OriginalSaleID)
+		return 0, fmt.Errorf("%w: no credits granted for %s", ErrOriginalSaleNotFound, event.OriginalSaleID)
+	}
+
+	err = s.c.Apply(ctx, &models.CreditTransaction{
+		UserID:        grant.UserID,
+		Kind:          models.CreditReversal,
+		Amount:        -grant.Amount,
+		Reason:        reason,
+		ReferenceType: "payment_event",
+		ReferenceID:   reference,
+		AllowNegative: true,
+		Offsets:       grant.ID,
+	})
+	if err != nil && !errors.Is(err, repository.ErrDuplicateTransaction) {
+		slog.Error("failed to reverse credits", "error", err, "userID", grant.UserID)
+		return 0, fmt.Errorf("reversing credits failed: %w", err)
+	}
+
+	return grant.UserID, nil
+}
+
+// restorePurchase gives back the credits a dispute took when the dispute is
+// won, and lifts the lock the dispute placed on the account.
+func (s *paymentService) restorePurchase(ctx context.Context, event *payment.Event) (int64, error) {
+	original, isExist, err := s.e.GetBySaleID(ctx, event.Provider, event.OriginalSaleID)
+	if err != nil {
+		return 0, fmt.Errorf("fetching disputed sale failed: %w", err)
+	}
+
+	if !isExist || original.UserID == nil {
+		slog.Info(ErrOriginalSaleNotFound.Error(), "provider", event.Provider, "saleID", event.OriginalSaleID)
+		return 0, fmt.Errorf("%w: %s", ErrOriginalSaleNotFound, event.OriginalSaleID)
+	}
+
+	// The dispute may not have been processed yet; failing here makes the
+	// provider retry later. A sale that was refunded meanwhile stays reversed.
+	if original.Status != models.PaymentEventDisputed {
+		if original.Status == models.PaymentEventProcessed {
+			slog.Info(ErrDisputeNotReversed.Error(), "provider", event.Provider, "saleID", event.OriginalSaleID)
+			return 0, fmt.Errorf("%w: %s", ErrDisputeNotReversed, event.OriginalSaleID)
 		}
+		slog.Info("sale not restored", "provider", event.Provider, "saleID", event.OriginalSaleID, "status", original.Status)
+		return *original.UserID, nil
+	}
+
+	reason := fmt.Sprintf("won dispute of sale %s", event.OriginalSaleID)
+	var userID int64
+	if original.SubscriptionID != nil {
+		userID, err = s.subs.RestorePayment(ctx, original, reason)
 	} else {
-		userID = user.ID
+		userID, err = s.restoreGrant(ctx, original, event, reason)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.e.MarkRestored(ctx, original.ID); err != nil {
+		return 0, err
+	}
+
+	if s.cfg.RefundPolicy == RefundPolicyLock {
+		if err := s.u.Unlock(ctx, userID, reversalLockReason(payment.EventDispute, event.OriginalSaleID)); err != nil {
+			return 0, err
+		}
+	}
+
+	return userID, nil
+}
+
+// restoreGrant gives back the credits reverseGrant took.
+func (s *paymentService) restoreGrant(ctx context.Context, original *models.PaymentEvent, event *payment.Event, reason string) (int64, error) {
+	reference := strconv.FormatInt(original.ID, 10)
+	reversal, isExist, err := s.c.GetByReference(ctx, models.CreditReversal, "payment_event", reference)
+	if err != nil {
+		return 0, fmt.Errorf("fetching reversed credits failed: %w", err)
+	}
+
+	if !isExist {
+		slog.Info(ErrDisputeNotReversed.Error(), "provider", event.Provider, "saleID", event.OriginalSaleID)
+		return 0, fmt.Errorf("%w: no credits reversed for %s", ErrDisputeNotReversed, event.OriginalSaleID)
+	}
+
+	err = s.c.Apply(ctx, &models.CreditTransaction{
+		UserID:        reversal.UserID,
+		Kind:          models.CreditRestore,
+		Amount:        -reversal.Amount,
+		Reason:        reason,
+		ReferenceType: "payment_event",
+		ReferenceID:   reference,
+	})
+	if err != nil && !errors.Is(err, repository.ErrDuplicateTransaction) {
+		slog.Error("failed to restore credits", "error", err, "userID", reversal.UserID)
+		return 0, fmt.Errorf("restoring credits failed: %w", err)
+	}
+
+	return reversal.UserID, nil
+}
+
+// reversalLockReason describes a reversal. It is also the lock reason of the
+// account, so that the lock can be found again when the sale is restored.
+func reversalLockReason(eventType, saleID string) string {
+	return fmt.Sprintf("%s of sale %s", eventType, saleID)
+}
+
+// rewardReferral pays out the referral of a buyer on their first purchase.
+// The sale itself is already settled, so failures are only logged.
+func (s *paymentService) rewardReferral(ctx context.Context, userID, eventID int64) {
+	if err := s.referrals.RewardFirstPurchase(ctx, userID, eventID); err != nil {
+		slog.Error("failed to reward referral", "error", err, "userID", userID)
 	}
+}
 
-	credits, isExist, err := s.c.GetByUserID(ctx, userID)
+// CreateCheckout starts a purchase of a product with the provider it is sold
+// through, optionally with a discount coupon. The price comes from the
+// price list of the chosen country, the user's billing country or the
+// country of their IP address, in that order.
+func (s *paymentService) CreateCheckout(ctx context.Context, userID, productID int64, couponCode, country, ip string) (*payment.CheckoutSession, error) {
+	user, isExist, err := s.u.GetByID(ctx, userID)
 	if err != nil {
-		return fmt.Errorf("fetching credits for user %d failed: %w", userID, err)
+		return nil, err
 	}
 
 	if !isExist {
-		err = fmt.Errorf("credits row for user_id %d doesn't exist", userID)
+		err = errors.New("User not found")
 		slog.Info(err.Error())
-		return err
+		return nil, err
 	}
 
-	var newCredits int64
-	switch price {
-	case price1:
-		newCredits = credits.Credits + CreditsPrice1
-	case price2:
-		newCredits = credits.Credits + CreditsPrice2
-	case price3:
-		newCredits = credits.Credits + CreditsPrice3
-	default:
-		return fmt.Errorf("invalid productID: %s", productID)
+	if country == "" {
+		country = user.BillingCountry
 	}
 
-	if err := s.c.UpdateCredits(ctx, newCredits, userID); err != nil {
-		slog.Error("failed to update credits", "error", err, "userID", userID)
-		return fmt.Errorf("updating credits failed: %w", err)
+	priceList, err := s.pricing.PriceList(ctx, country, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	product, isExist, err := s.p.GetPriced(ctx, productID, priceList.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isExist || !product.Active {
+		slog.Info(ErrProductNotFound.Error(), "productID", productID, "priceList", priceList.Code)
+		return nil, ErrProductNotFound
+	}
+
+	provider, err := s.providers.Get(product.Provider)
+	if err != nil {
+		slog.Info(err.Error(), "provider", product.Provider)
+		return nil, err
+	}
+
+	req := &payment.CheckoutRequest{
+		Product:      product,
+		UserID:       userID,
+		Email:        user.Email,
+		AccountToken: accountToken(s.cfg.SecretKey, userID),
+		SuccessURL:   s.cfg.FrontendURL + "/credits?checkout=success",
+		CancelURL:    s.cfg.FrontendURL + "/credits?checkout=canceled",
+	}
+
+	if couponCode != "" {
+		coupon, err := s.coupons.CheckDiscount(ctx, userID, couponCode)
+		if err != nil {
+			return nil, err
+		}
+		req.CouponCode = coupon.Code
 	}
 
-	return nil
+	return provider.CreateCheckout(ctx, req)
 }
 
 func (s *paymentService) createUserAndCredits(ctx context.Context, email string) (int64, error) {
@@ -104,13 +598,35 @@ func (s *paymentService) createUserAndCredits(ctx context.Context, email string)
 		return 0, fmt.Errorf("creating user failed: %w", err)
 	}
 
-	newCredits := models.Credits{
-		UserID:  userID,
-		Credits: InitialCredits,
-	}
-	if _, err = s.c.Create(ctx, &newCredits); err != nil {
-		return 0, fmt.Errorf("creating credits row failed for user %d: %w", userID, err)
+	if err := openCreditsAccount(ctx, s.c, s.cfg.Credits, userID); err != nil {
+		return 0, err
 	}
 
 	return userID, nil
 }
+
+// accountToken identifies userID to a payment provider through checkout. It
+// is signed, as Gumroad checkout links can be edited by the buyer.
+func accountToken(secret string, userID int64) string {
+	id := strconv.FormatInt(userID, 10)
+	return id + "_" + accountTokenSignature(secret, id)
+}
+
+func parseAccountToken(secret, token string) (int64, bool) {
+	id, signature, ok := strings.Cut(token, "_")
+	if !ok || !hmac.Equal([]byte(signature), []byte(accountTokenSignature(secret, id))) {
+		return 0, false
+	}
+
+	userID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return userID, true
+}
+
+func accountTokenSignature(secret, id string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("account:" + id))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
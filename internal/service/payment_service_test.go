@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/payment"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+type fakePaymentEventRepository struct {
+	repository.PaymentEventRepository
+	mu     sync.Mutex
+	events []*models.PaymentEvent
+}
+
+func (r *fakePaymentEventRepository) Claim(ctx context.Context, e *models.PaymentEvent) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.events {
+		if existing.Provider == e.Provider && existing.SaleID == e.SaleID && existing.Status != models.PaymentEventFailed {
+			return false, nil
+		}
+	}
+	e.ID, e.Status = int64(len(r.events)+1), models.PaymentEventProcessing
+	stored := *e
+	r.events = append(r.events, &stored)
+	return true, nil
+}
+
+func (r *fakePaymentEventRepository) GetBySaleID(ctx context.Context, provider, saleID string) (*models.PaymentEvent, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.events {
+		if e.Provider == provider && e.SaleID == saleID {
+			copied := *e
+			return &copied, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (r *fakePaymentEventRepository) MarkReversed(ctx context.Context, id int64, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events[id-1].Status = status
+	return nil
+}
+
+func (r *fakePaymentEventRepository) SetSubscription(ctx context.Context, id int64, sub *models.Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := r.events[id-1]
+	e.SubscriptionID = &sub.ID
+	e.PeriodStart, e.PeriodEnd = &sub.CurrentPeriodStart, &sub.CurrentPeriodEnd
+	return nil
+}
+
+func (r *fakePaymentEventRepository) MarkProcessed(ctx context.Context, id, userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events[id-1].Status, r.events[id-1].UserID = models.PaymentEventProcessed, &userID
+	return nil
+}
+
+func (r *fakePaymentEventRepository) MarkFailed(ctx context.Context, id int64, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events[id-1].Status, r.events[id-1].Error = models.PaymentEventFailed, reason
+	return nil
+}
+
+// fakeOrderService records the purchases it is asked to invoice.
+type fakeOrderService struct {
+	OrderService
+	mu     sync.Mutex
+	orders map[int64]*models.Order
+}
+
+func (s *fakeOrderService) RecordPurchase(ctx context.Context, userID, eventID int64, product *models.Product, coupon *models.Coupon, event *payment.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.orders[eventID]; !ok {
+		s.orders[eventID] = &models.Order{UserID: &userID, PaymentEventID: eventID, Currency: event.Currency, TotalMinor: event.PriceMinor}
+	}
+	return nil
+}
+
+func TestPaymentRenewalIsInvoiced(t *testing.T) {
+	subs, ledger, first := newSubscriptionTest(t, time.Now().AddDate(0, -1, 0).Add(-time.Hour))
+	events := &fakePaymentEventRepository{}
+	orders := &fakeOrderService{orders: map[int64]*models.Order{}}
+	s := NewPaymentService(config.Config{}, nil, ledger, events, fakePlanRepository{plan: testPlan}, subs, nil, nil, orders, nil, payment.Providers{})
+
+	renewal := &payment.Event{
+		Provider:       payment.ProviderStripe,
+		Type:           payment.EventSubscriptionRenewed,
+		SaleID:         "pi_renewal",
+		SubscriptionID: "sub_1",
+		PriceMinor:     testPlan.PriceMinor,
+		Currency:       testPlan.Currency,
+		PeriodStart:    first.CurrentPeriodEnd,
+		PeriodEnd:      first.CurrentPeriodEnd.AddDate(0, 1, 0),
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.HandleEvent(context.Background(), renewal); err != nil {
+			t.Fatalf("HandleEvent %d: %v", i+1, err)
+		}
+	}
+
+	if len(orders.orders) != 1 {
+		t.Fatalf("got %d orders, want 1", len(orders.orders))
+	}
+	order := orders.orders[events.events[0].ID]
+	if order == nil || *order.UserID != testSubscriber || order.TotalMinor != testPlan.PriceMinor {
+		t.Errorf("order = %+v, want %d for user %d", order, testPlan.PriceMinor, testSubscriber)
+	}
+	if got := ledger.balances[testSubscriber]; got != 2*testPlan.Credits {
+		t.Errorf("balance = %d, want %d", got, 2*testPlan.Credits)
+	}
+}
+
+// Lock fails while lockErr is set, and locks the user otherwise.
+func (r *fakeUserRepository) Lock(ctx context.Context, userID int64, reason string) error {
+	if r.lockErr != nil {
+		return r.lockErr
+	}
+	for _, u := range r.users {
+		if u.ID == userID && u.LockedAt == nil {
+			now := time.Now()
+			u.LockedAt, u.LockReason = &now, reason
+		}
+	}
+	return nil
+}
+
+func TestRefundLocksAccountOnRetry(t *testing.T) {
+	buyer := &models.User{ID: 5, Email: "buyer@example.com"}
+	users := &fakeUserRepository{users: []*models.User{buyer}, lockErr: errors.New("database is down")}
+	ledger := newFakeLedger()
+	events := &fakePaymentEventRepository{}
+	referrals, _ := newReferralTest()
+	s := NewPaymentService(config.Config{RefundPolicy: RefundPolicyLock}, users, ledger, events, nil, nil, nil, referrals, nil, nil, payment.Providers{})
+	ctx := context.Background()
+
+	// A purchase that was granted earlier.
+	purchase := &models.PaymentEvent{Provider: payment.ProviderStripe, SaleID: "pi_1"}
+	if _, err := events.Claim(ctx, purchase); err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+	if err := events.MarkProcessed(ctx, purchase.ID, buyer.ID); err != nil {
+		t.Fatalf("MarkProcessed: %v", err)
+	}
+	grant := &models.CreditTransaction{UserID: buyer.ID, Kind: models.CreditPurchase, Amount: 10, ReferenceType: "payment_event", ReferenceID: "1"}
+	if err := ledger.Apply(ctx, grant); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	refund := &payment.Event{Provider: payment.ProviderStripe, Type: payment.EventRefund, SaleID: "re_1", OriginalSaleID: "pi_1"}
+	if err := s.HandleEvent(ctx, refund); err == nil {
+		t.Fatal("HandleEvent succeeded without locking the account")
+	}
+	if events.events[0].Status != models.PaymentEventProcessed {
+		t.Errorf("sale = %s before the account was locked, want it left for the retry", events.events[0].Status)
+	}
+
+	users.lockErr = nil
+	if err := s.HandleEvent(ctx, refund); err != nil {
+		t.Fatalf("HandleEvent retry: %v", err)
+	}
+	if buyer.LockedAt == nil {
+		t.Error("account wasn't locked")
+	}
+	if events.events[0].Status != models.PaymentEventRefunded {
+		t.Errorf("sale = %s, want %s", events.events[0].Status, models.PaymentEventRefunded)
+	}
+	if got := ledger.balances[buyer.ID]; got != 0 {
+		t.Errorf("balance = %d, want the purchase taken back once", got)
+	}
+}
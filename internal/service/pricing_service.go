@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/maheshrc27/postflow/internal/geoip"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+type PricingService interface {
+	// PriceList picks the price list for a buyer. A country the buyer chose
+	// wins over the one derived from their IP address.
+	PriceList(ctx context.Context, country, ip string) (*models.PriceList, error)
+}
+
+type pricingService struct {
+	l   repository.PriceListRepository
+	geo *geoip.DB
+}
+
+// NewPricingService returns the pricing service. geo may be nil, in which
+// case buyers who don't pick a country get the default price list.
+func NewPricingService(l repository.PriceListRepository, geo *geoip.DB) PricingService {
+	return &pricingService{
+		l:   l,
+		geo: geo,
+	}
+}
+
+func (s *pricingService) PriceList(ctx context.Context, country, ip string) (*models.PriceList, error) {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if country == "" {
+		country = s.geo.Country(ip)
+	}
+
+	return s.l.GetForCountry(ctx, country)
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/maheshrc27/postflow/internal/geoip"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+// fakePriceListRepository has a euro list for Germany and France and a
+// default dollar list.
+type fakePriceListRepository struct {
+	repository.PriceListRepository
+}
+
+func (fakePriceListRepository) GetForCountry(ctx context.Context, country string) (*models.PriceList, error) {
+	if country == "DE" || country == "FR" {
+		return &models.PriceList{Code: "eur", Currency: "eur", Countries: []string{"DE", "FR"}}, nil
+	}
+	return &models.PriceList{Code: "default", Currency: "usd", IsDefault: true}, nil
+}
+
+func TestPriceList(t *testing.T) {
+	geo, err := geoip.Load(strings.NewReader("5.0.0.0/8,DE\n5.1.0.0/16,US\n"))
+	if err != nil {
+		t.Fatalf("loading geoip: %v", err)
+	}
+	s := NewPricingService(fakePriceListRepository{}, geo)
+
+	tests := []struct {
+		name, country, ip, want string
+	}{
+		{"country from the IP", "", "5.0.0.1", "eur"},
+		{"chosen country wins", " fr ", "5.1.0.1", "eur"},
+		{"chosen country wins over the IP", "us", "5.0.0.1", "default"},
+		{"nested network", "", "5.1.0.1", "default"},
+		{"unknown IP", "", "192.0.2.1", "default"},
+	}
+	for _, tt := range tests {
+		list, err := s.PriceList(context.Background(), tt.country, tt.ip)
+		if err != nil {
+			t.Fatalf("%s: PriceList: %v", tt.name, err)
+		}
+		if list.Code != tt.want {
+			t.Errorf("%s: got price list %q, want %q", tt.name, list.Code, tt.want)
+		}
+	}
+
+	// Without a database, buyers who don't pick a country get the default.
+	list, err := NewPricingService(fakePriceListRepository{}, nil).PriceList(context.Background(), "", "5.0.0.1")
+	if err != nil || list.Code != "default" {
+		t.Errorf("PriceList without geoip = %+v, %v, want the default list", list, err)
+	}
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/payment"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+type ReconcileService interface {
+	// Reconcile compares the sales of a provider export to the recorded
+	// payment events and credit grants. With apply set, sales that are
+	// missing, failed or lack their grant, and refunds and disputes that
+	// weren't applied, are processed again.
+	Reconcile(ctx context.Context, sales []*payment.Event, apply bool) (*models.ReconcileReport, error)
+}
+
+type reconcileService struct {
+	c        repository.CreditsRepository
+	e        repository.PaymentEventRepository
+	payments PaymentService
+}
+
+func NewReconcileService(c repository.CreditsRepository, e repository.PaymentEventRepository, payments PaymentService) ReconcileService {
+	return &reconcileService{
+		c:        c,
+		e:        e,
+		payments: payments,
+	}
+}
+
+func (s *reconcileService) Reconcile(ctx context.Context, sales []*payment.Event, apply bool) (*models.ReconcileReport, error) {
+	report := &models.ReconcileReport{
+		Mismatches: []*models.ReconcileMismatch{},
+	}
+
+	for _, sale := range sales {
+		mismatch, err := s.check(ctx, sale)
+		if err != nil {
+			return nil, err
+		}
+		report.Checked++
+
+		if mismatch == nil {
+			continue
+		}
+		report.Mismatches = append(report.Mismatches, mismatch)
+
+		if apply && mismatch.Problem != models.ReconcileAmountMismatch {
+			s.reprocess(ctx, sale, mismatch)
+		}
+	}
+
+	return report, nil
+}
+
+// check returns what is wrong with the records of sale, or nil if nothing
+// is.
+func (s *reconcileService) check(ctx context.Context, sale *payment.Event) (*models.ReconcileMismatch, error) {
+	mismatch := &models.ReconcileMismatch{
+		Provider: sale.Provider,
+		SaleID:   sale.SaleID,
+		Email:    sale.Email,
+	}
+
+	if sale.Type == payment.EventRefund || sale.Type == payment.EventDispute {
+		return s.checkReversal(ctx, sale, mismatch)
+	}
+
+	record, isExist, err := s.e.GetBySaleID(ctx, sale.Provider, sale.SaleID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching payment event failed: %w", err)
+	}
+
+	if !isExist {
+		mismatch.Problem = models.ReconcileMissingEvent
+		return mismatch, nil
+	}
+
+	switch record.Status {
+	case models.PaymentEventFailed:
+		mismatch.Problem = models.ReconcileFailedEvent
+		mismatch.Detail = record.Error
+		return mismatch, nil
+	case models.PaymentEventProcessing:
+		mismatch.Problem = models.ReconcileProcessing
+		mismatch.Detail = fmt.Sprintf("since %s", record.UpdatedAt.Format("2006-01-02 15:04:05"))
+		return mismatch, nil
+	}
+
+	if price := strconv.FormatInt(sale.PriceMinor, 10); record.Price != price {
+		mismatch.Problem = models.ReconcileAmountMismatch
+		mismatch.Detail = fmt.Sprintf("recorded %s, export has %s", record.Price, price)
+		return mismatch, nil
+	}
+
+	// Subscriptions grant through their invoices, so only one-off purchases
+	// are expected to have a grant of their own.
+	if sale.Type != payment.EventPurchase {
+		return nil, nil
+	}
+
+	_, isExist, err = s.c.GetByReference(ctx, models.CreditPurchase, "payment_event", strconv.FormatInt(record.ID, 10))
+	if err != nil {
+		return nil, fmt.Errorf("fetching credit grant failed: %w", err)
+	}
+
+	if !isExist {
+		mismatch.Problem = models.ReconcileMissingGrant
+		return mismatch, nil
+	}
+
+	return nil, nil
+}
+
+// checkReversal checks that the sale a refund or dispute refers to was
+// reversed. Whether the sale itself was recorded is checked by the purchase
+// the export lists before it.
+func (s *reconcileService) checkReversal(ctx context.Context, sale *payment.Event, mismatch *models.ReconcileMismatch) (*models.ReconcileMismatch, error) {
+	original, isExist, err := s.e.GetBySaleID(ctx, sale.Provider, sale.OriginalSaleID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching payment event failed: %w", err)
+	}
+
+	if isExist && (original.Status == models.PaymentEventRefunded || original.Status == models.PaymentEventDisputed) {
+		return nil, nil
+	}
+
+	mismatch.Problem = models.ReconcileMissingReversal
+	if isExist {
+		mismatch.Detail = fmt.Sprintf("sale is %s", original.Status)
+	}
+	return mismatch, nil
+}
+
+// reprocess runs sale through the payment service again. Grants are keyed on
+// the payment event, so reprocessing never grants a sale twice.
+func (s *reconcileService) reprocess(ctx context.Context, sale *payment.Event, mismatch *models.ReconcileMismatch) {
+	if mismatch.Problem == models.ReconcileMissingGrant {
+		// A processed event is never claimed again; failing it lets the
+		// payment service pick it up.
+		record, _, err := s.e.GetBySaleID(ctx, sale.Provider, sale.SaleID)
+		if err != nil {
+			mismatch.Error = err.Error()
+			return
+		}
+
+		if err := s.e.MarkFailed(ctx, record.ID, "reconcile: credit grant missing"); err != nil {
+			mismatch.Error = err.Error()
+			return
+		}
+	}
+
+	if err := s.payments.HandleEvent(ctx, sale); err != nil {
+		slog.Info(err.Error(), "provider", sale.Provider, "saleID", sale.SaleID)
+		mismatch.Error = err.Error()
+		return
+	}
+
+	after, err := s.check(ctx, sale)
+	if err != nil {
+		mismatch.Error = err.Error()
+		return
+	}
+
+	if after != nil {
+		mismatch.Error = "still " + after.Problem
+		return
+	}
+
+	mismatch.Applied = true
+}
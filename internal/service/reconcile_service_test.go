@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/payment"
+)
+
+// fakeReconcilePayments stands in for the payment service, recording a
+// purchase with its grant or marking the refunded sale reversed.
+type fakeReconcilePayments struct {
+	PaymentService
+	events  *fakePaymentEventRepository
+	ledger  *fakeLedger
+	handled []string
+}
+
+func (s *fakeReconcilePayments) HandleEvent(ctx context.Context, event *payment.Event) error {
+	s.handled = append(s.handled, event.SaleID)
+
+	if event.Type == payment.EventRefund || event.Type == payment.EventDispute {
+		original, _, _ := s.events.GetBySaleID(ctx, event.Provider, event.OriginalSaleID)
+		return s.events.MarkReversed(ctx, original.ID, models.PaymentEventRefunded)
+	}
+
+	record := &models.PaymentEvent{Provider: event.Provider, SaleID: event.SaleID, Price: strconv.FormatInt(event.PriceMinor, 10)}
+	if _, err := s.events.Claim(ctx, record); err != nil {
+		return err
+	}
+	if err := s.ledger.Apply(ctx, &models.CreditTransaction{
+		UserID:        1,
+		Kind:          models.CreditPurchase,
+		Amount:        10,
+		ReferenceType: "payment_event",
+		ReferenceID:   strconv.FormatInt(record.ID, 10),
+	}); err != nil {
+		return err
+	}
+	return s.events.MarkProcessed(ctx, record.ID, 1)
+}
+
+func TestReconcileReversals(t *testing.T) {
+	events := &fakePaymentEventRepository{}
+	ledger := newFakeLedger()
+	payments := &fakeReconcilePayments{events: events, ledger: ledger}
+	ctx := context.Background()
+
+	// Sales 1 to 3 were processed; only the refund of sale 2 arrived.
+	for _, saleID := range []string{"sale_1", "sale_2", "sale_3"} {
+		if err := payments.HandleEvent(ctx, &payment.Event{Provider: payment.ProviderGumroad, Type: payment.EventPurchase, SaleID: saleID, PriceMinor: 900}); err != nil {
+			t.Fatalf("recording %s: %v", saleID, err)
+		}
+	}
+	if err := payments.HandleEvent(ctx, &payment.Event{Provider: payment.ProviderGumroad, Type: payment.EventRefund, SaleID: "refund:sale_2", OriginalSaleID: "sale_2"}); err != nil {
+		t.Fatalf("refunding sale_2: %v", err)
+	}
+	payments.handled = nil
+
+	export := "sale_id,email,product_id,price,refunded\n" +
+		"sale_1,a@example.com,abcde,900,false\n" +
+		"sale_2,b@example.com,abcde,900,true\n" +
+		"sale_3,c@example.com,abcde,900,true\n" +
+		"sale_4,d@example.com,abcde,900,false\n"
+	sales, err := payment.ReadExport(payment.ProviderGumroad, "csv", strings.NewReader(export))
+	if err != nil {
+		t.Fatalf("ReadExport: %v", err)
+	}
+
+	s := NewReconcileService(ledger, events, payments)
+	report, err := s.Reconcile(ctx, sales, false)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	if report.Checked != 6 {
+		t.Errorf("checked %d sales, want 6", report.Checked)
+	}
+	var problems []string
+	for _, m := range report.Mismatches {
+		problems = append(problems, m.SaleID+" "+m.Problem)
+	}
+	want := []string{"refund:sale_3 " + models.ReconcileMissingReversal, "sale_4 " + models.ReconcileMissingEvent}
+	if strings.Join(problems, ", ") != strings.Join(want, ", ") {
+		t.Fatalf("mismatches = %v, want %v", problems, want)
+	}
+	if len(payments.handled) != 0 {
+		t.Fatalf("dry run processed %v", payments.handled)
+	}
+
+	report, err = s.Reconcile(ctx, sales, true)
+	if err != nil {
+		t.Fatalf("Reconcile with apply: %v", err)
+	}
+	for _, m := range report.Mismatches {
+		if !m.Applied {
+			t.Errorf("%s %s wasn't applied: %s", m.SaleID, m.Problem, m.Error)
+		}
+	}
+	if got := strings.Join(payments.handled, ","); got != "refund:sale_3,sale_4" {
+		t.Errorf("processed %s, want refund:sale_3,sale_4", got)
+	}
+
+	sale3, _, _ := events.GetBySaleID(ctx, payment.ProviderGumroad, "sale_3")
+	if sale3.Status != models.PaymentEventRefunded {
+		t.Errorf("sale_3 status = %s, want %s", sale3.Status, models.PaymentEventRefunded)
+	}
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log/slog"
+	"strings"
+
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+const referralCodeAttempts = 5
+
+// publicEmailDomains are shared by unrelated people, so the same-domain
+// guard does not apply to them.
+var publicEmailDomains = map[string]bool{
+	"gmail.com":      true,
+	"googlemail.com": true,
+	"outlook.com":    true,
+	"hotmail.com":    true,
+	"live.com":       true,
+	"yahoo.com":      true,
+	"icloud.com":     true,
+	"me.com":         true,
+	"proton.me":      true,
+	"protonmail.com": true,
+	"aol.com":        true,
+	"gmx.com":        true,
+}
+
+type ReferralService interface {
+	GetStats(ctx context.Context, userID int64) (*models.ReferralStats, error)
+	// Attach records that a newly created user signed up with code.
+	Attach(ctx context.Context, referee *models.User, code string) error
+	// RewardFirstPurchase grants the referral rewards once the referee has
+	// paid for the first time. It does nothing for users who weren't
+	// referred or were already rewarded.
+	RewardFirstPurchase(ctx context.Context, refereeID, paymentEventID int64) error
+	// ReverseReward takes back the rewards paid out for a purchase that was
+	// refunded or disputed.
+	ReverseReward(ctx context.Context, paymentEventID int64) error
+}
+
+type referralService struct {
+	cfg config.Config
+	r   repository.ReferralRepository
+}
+
+func NewReferralService(cfg config.Config, r repository.ReferralRepository) ReferralService {
+	return &referralService{
+		cfg: cfg,
+		r:   r,
+	}
+}
+
+// GetStats returns the user's referral code and how their referrals went.
+// The code is assigned on first use.
+func (s *referralService) GetStats(ctx context.Context, userID int64) (*models.ReferralStats, error) {
+	code, err := s.ensureCode(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := s.r.GetStats(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	stats.Code = code
+
+	return stats, nil
+}
+
+func (s *referralService) ensureCode(ctx context.Context, userID int64) (string, error) {
+	code, err := s.r.GetCode(ctx, userID)
+	if err != nil || code != "" {
+		return code, err
+	}
+
+	for i := 0; i < referralCodeAttempts; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+
+		ok, err := s.r.SetCode(ctx, userID, base32.StdEncoding.EncodeToString(b))
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return s.r.GetCode(ctx, userID)
+		}
+	}
+
+	return "", errors.New("could not generate a unique referral code")
+}
+
+// Attach links the referee to the owner of code. Referrals that fail the
+// fraud checks are kept as rejected so they show up in the referrer's stats.
+func (s *referralService) Attach(ctx context.Context, referee *models.User, code string) error {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return nil
+	}
+
+	referrer, isExist, err := s.r.GetReferrerByCode(ctx, code)
+	if err != nil {
+		return err
+	}
+
+	if !isExist {
+		slog.Info("unknown referral code", "code", code, "userID", referee.ID)
+		return nil
+	}
+
+	referral := models.Referral{
+		ReferrerID: referrer.ID,
+		RefereeID:  referee.ID,
+		Status:     models.ReferralPending,
+	}
+
+	switch {
+	case referrer.ID == referee.ID || strings.EqualFold(referrer.Email, referee.Email):
+		referral.Status = models.ReferralRejected
+		referral.RejectReason = "self-referral"
+	case sameEmailDomain(referrer.Email, referee.Email):
+		referral.Status = models.ReferralRejected
+		referral.RejectReason = "same email domain"
+	}
+
+	if referral.Status == models.ReferralRejected {
+		slog.Info("referral rejected", "reason", referral.RejectReason, "referrerID", referrer.ID, "refereeID", referee.ID)
+	}
+
+	return s.r.Create(ctx, &referral)
+}
+
+func (s *referralService) RewardFirstPurchase(ctx context.Context, refereeID, paymentEventID int64) error {
+	referral, isExist, err := s.r.GetByRefereeID(ctx, refereeID)
+	if err != nil {
+		return err
+	}
+
+	if !isExist || referral.Status != models.ReferralPending {
+		return nil
+	}
+
+	ok, err := s.r.Reward(ctx, referral, &repository.ReferralReward{
+		PaymentEventID:  paymentEventID,
+		ReferrerCredits: s.cfg.Referral.ReferrerCredits,
+		RefereeCredits:  s.cfg.Referral.RefereeCredits,
+		ExpiresAt:       promoExpiry(s.cfg.Credits),
+		MaxPerReferrer:  s.cfg.Referral.MaxPerReferrer,
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrReferralCapReached) {
+			slog.Info("referral rejected", "reason", "referrer cap reached", "referrerID", referral.ReferrerID, "refereeID", refereeID)
+			return nil
+		}
+		return err
+	}
+
+	if ok {
+		slog.Info("referral rewarded", "referralID", referral.ID, "referrerID", referral.ReferrerID, "refereeID", refereeID)
+	}
+
+	return nil
+}
+
+// ReverseReward keeps buy-and-refund loops from farming referral rewards. The
+// referral is marked reversed, so the referee's next purchase doesn't pay
+// out again.
+func (s *referralService) ReverseReward(ctx context.Context, paymentEventID int64) error {
+	referral, ok, err := s.r.ReverseReward(ctx, paymentEventID)
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		slog.Info("referral reward reversed", "referralID", referral.ID, "referrerID", referral.ReferrerID, "refereeID", referral.RefereeID)
+	}
+
+	return nil
+}
+
+func sameEmailDomain(a, b string) bool {
+	domainA := strings.ToLower(a[strings.LastIndex(a, "@")+1:])
+	domainB := strings.ToLower(b[strings.LastIndex(b, "@")+1:])
+	return domainA == domainB && !publicEmailDomains[domainA]
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+// fakeReferralRepository keeps referrals and the credits they pay out in
+// memory. Reward holds the lock while it checks the cap, like the row lock
+// of the real repository.
+type fakeReferralRepository struct {
+	repository.ReferralRepository
+	mu        sync.Mutex
+	referrals map[int64]*models.Referral
+	balances  map[int64]int64
+}
+
+func newFakeReferralRepository(referrals ...*models.Referral) *fakeReferralRepository {
+	r := &fakeReferralRepository{referrals: map[int64]*models.Referral{}, balances: map[int64]int64{}}
+	for _, referral := range referrals {
+		r.referrals[referral.RefereeID] = referral
+	}
+	return r
+}
+
+func (r *fakeReferralRepository) GetByRefereeID(ctx context.Context, refereeID int64) (*models.Referral, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	referral, ok := r.referrals[refereeID]
+	if !ok {
+		return nil, false, nil
+	}
+	copied := *referral
+	return &copied, true, nil
+}
+
+func (r *fakeReferralRepository) Reward(ctx context.Context, referral *models.Referral, reward *repository.ReferralReward) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := r.referrals[referral.RefereeID]
+	if stored.Status != models.ReferralPending {
+		return false, nil
+	}
+
+	rewarded := 0
+	for _, other := range r.referrals {
+		if other.ReferrerID == referral.ReferrerID && other.Status == models.ReferralRewarded {
+			rewarded++
+		}
+	}
+	if rewarded >= reward.MaxPerReferrer {
+		stored.Status, stored.RejectReason = models.ReferralRejected, "referrer cap reached"
+		return false, repository.ErrReferralCapReached
+	}
+
+	stored.Status = models.ReferralRewarded
+	stored.PaymentEventID = &reward.PaymentEventID
+	r.balances[referral.ReferrerID] += reward.ReferrerCredits
+	r.balances[referral.RefereeID] += reward.RefereeCredits
+	return true, nil
+}
+
+func (r *fakeReferralRepository) ReverseReward(ctx context.Context, paymentEventID int64) (*models.Referral, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, referral := range r.referrals {
+		if referral.Status == models.ReferralRewarded && referral.PaymentEventID != nil && *referral.PaymentEventID == paymentEventID {
+			referral.Status = models.ReferralReversed
+			r.balances[referral.ReferrerID] -= testReferral.ReferrerCredits
+			r.balances[referral.RefereeID] -= testReferral.RefereeCredits
+			return referral, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+var testReferral = config.Referral{ReferrerCredits: 5, RefereeCredits: 3, MaxPerReferrer: 2}
+
+const testReferrer = 1
+
+func newReferralTest(referees ...int64) (ReferralService, *fakeReferralRepository) {
+	var referrals []*models.Referral
+	for i, referee := range referees {
+		referrals = append(referrals, &models.Referral{ID: int64(i + 1), ReferrerID: testReferrer, RefereeID: referee, Status: models.ReferralPending})
+	}
+	repo := newFakeReferralRepository(referrals...)
+	return NewReferralService(config.Config{Referral: testReferral}, repo), repo
+}
+
+func TestReferralRewardFirstPurchase(t *testing.T) {
+	s, repo := newReferralTest(2)
+	ctx := context.Background()
+
+	for eventID := int64(10); eventID < 12; eventID++ {
+		if err := s.RewardFirstPurchase(ctx, 2, eventID); err != nil {
+			t.Fatalf("RewardFirstPurchase for event %d: %v", eventID, err)
+		}
+	}
+
+	if got := repo.balances[testReferrer]; got != testReferral.ReferrerCredits {
+		t.Errorf("referrer balance = %d, want %d", got, testReferral.ReferrerCredits)
+	}
+	if got := repo.balances[2]; got != testReferral.RefereeCredits {
+		t.Errorf("referee balance = %d, want %d", got, testReferral.RefereeCredits)
+	}
+	if got := repo.referrals[2].PaymentEventID; got == nil || *got != 10 {
+		t.Errorf("rewarded for event %v, want 10", got)
+	}
+
+	// Users who weren't referred are left alone.
+	if err := s.RewardFirstPurchase(ctx, 9, 12); err != nil {
+		t.Errorf("RewardFirstPurchase for an unreferred user: %v", err)
+	}
+}
+
+func TestReferralRewardCap(t *testing.T) {
+	s, repo := newReferralTest(2, 3, 4, 5)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for referee := int64(2); referee <= 5; referee++ {
+		wg.Add(1)
+		go func(referee int64) {
+			defer wg.Done()
+			if err := s.RewardFirstPurchase(ctx, referee, referee*10); err != nil {
+				t.Errorf("RewardFirstPurchase for %d: %v", referee, err)
+			}
+		}(referee)
+	}
+	wg.Wait()
+
+	rewarded, rejected := 0, 0
+	for _, referral := range repo.referrals {
+		switch referral.Status {
+		case models.ReferralRewarded:
+			rewarded++
+		case models.ReferralRejected:
+			rejected++
+		}
+	}
+	if rewarded != testReferral.MaxPerReferrer || rejected != 4-testReferral.MaxPerReferrer {
+		t.Errorf("rewarded, rejected = %d, %d, want %d, %d", rewarded, rejected, testReferral.MaxPerReferrer, 4-testReferral.MaxPerReferrer)
+	}
+	if got, want := repo.balances[testReferrer], int64(testReferral.MaxPerReferrer)*testReferral.ReferrerCredits; got != want {
+		t.Errorf("referrer balance = %d, want %d", got, want)
+	}
+}
+
+func TestReferralRefundReversesReward(t *testing.T) {
+	s, repo := newReferralTest(2)
+	ctx := context.Background()
+
+	if err := s.RewardFirstPurchase(ctx, 2, 10); err != nil {
+		t.Fatalf("RewardFirstPurchase: %v", err)
+	}
+
+	// A refund of another purchase leaves the reward alone.
+	if err := s.ReverseReward(ctx, 11); err != nil {
+		t.Fatalf("ReverseReward of another purchase: %v", err)
+	}
+	if got := repo.referrals[2].Status; got != models.ReferralRewarded {
+		t.Fatalf("status after refunding another purchase = %q, want %q", got, models.ReferralRewarded)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := s.ReverseReward(ctx, 10); err != nil {
+			t.Fatalf("ReverseReward %d: %v", i+1, err)
+		}
+	}
+	if repo.balances[testReferrer] != 0 || repo.balances[2] != 0 {
+		t.Errorf("balances after refund = %d, %d, want 0, 0", repo.balances[testReferrer], repo.balances[2])
+	}
+
+	// Buying again after the refund doesn't pay out a second time.
+	if err := s.RewardFirstPurchase(ctx, 2, 12); err != nil {
+		t.Fatalf("RewardFirstPurchase after refund: %v", err)
+	}
+	if got := repo.referrals[2].Status; got != models.ReferralReversed {
+		t.Errorf("status = %q, want %q", got, models.ReferralReversed)
+	}
+	if repo.balances[testReferrer] != 0 {
+		t.Errorf("referrer balance after buying again = %d, want 0", repo.balances[testReferrer])
+	}
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/keyring"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+	"github.com/maheshrc27/postflow/pkg/utils"
+)
+
+const (
+	// maxUserAgentLength caps the user agent kept to show a session's
+	// device.
+	maxUserAgentLength = 512
+	// sessionTouchInterval limits how often requests update a session's
+	// last seen time.
+	sessionTouchInterval = time.Minute
+)
+
+var (
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrInvalidRefreshToken = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenReused  = errors.New("refresh token was reused, the session has been ended")
+)
+
+type SessionService interface {
+	// Create starts a session for a user who just signed in.
+	Create(ctx context.Context, userID int64, userAgent, ip string) (*models.SessionTokens, error)
+	// Refresh rotates a refresh token and issues a new access token for its
+	// session, which is extended.
+	Refresh(ctx context.Context, refreshToken, ip string) (*models.SessionTokens, error)
+	// Validate returns the session an access token names, if it is still
+	// active and belongs to the user.
+	Validate(ctx context.Context, userID int64, sessionID, ip string) (*models.Session, error)
+	// List returns the user's active sessions, marking currentID as the
+	// current one.
+	List(ctx context.Context, userID int64, currentID string) ([]*models.Session, error)
+	Revoke(ctx context.Context, userID int64, id string) error
+	RevokeAll(ctx context.Context, userID int64) error
+}
+
+type sessionService struct {
+	cfg  config.Config
+	s    repository.SessionRepository
+	keys *keyring.Keyring
+}
+
+func NewSessionService(cfg config.Config, s repository.SessionRepository, keys *keyring.Keyring) SessionService {
+	return &sessionService{
+		cfg:  cfg,
+		s:    s,
+		keys: keys,
+	}
+}
+
+func (s *sessionService) Create(ctx context.Context, userID int64, userAgent, ip string) (*models.SessionTokens, error) {
+	id, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	session := &models.Session{
+		ID:        id,
+		UserID:    userID,
+		UserAgent: userAgent,
+		IP:        ip,
+		ExpiresAt: time.Now().Add(s.cfg.Sessions.RefreshTokenTTL),
+	}
+	if err := s.s.Create(ctx, session); err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.s.AddRefreshToken(ctx, &models.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: hashToken(refreshToken),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.tokens(ctx, session, refreshToken)
+}
+
+func (s *sessionService) Refresh(ctx context.Context, refreshToken, ip string) (*models.SessionTokens, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	next, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	session, issued, err := s.s.RotateRefreshToken(ctx, hashToken(refreshToken),
+		&models.RefreshToken{TokenHash: hashToken(next)},
+		time.Now().Add(s.cfg.Sessions.RefreshTokenTTL),
+		s.cfg.Sessions.ReuseGrace,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRefreshTokenInvalid):
+			slog.Info(ErrInvalidRefreshToken.Error(), "ip", ip)
+			return nil, ErrInvalidRefreshToken
+		case errors.Is(err, repository.ErrRefreshTokenReused):
+			return nil, ErrRefreshTokenReused
+		}
+		return nil, err
+	}
+
+	if session.IP != ip {
+		if err := s.s.Touch(ctx, session.ID, ip); err != nil {
+			return nil, err
+		}
+		session.IP = ip
+	}
+
+	// A replay within the grace period keeps the refresh token the first
+	// refresh handed out.
+	if !issued {
+		next = ""
+	}
+
+	return s.tokens(ctx, session, next)
+}
+
+func (s *sessionService) Validate(ctx context.Context, userID int64, sessionID, ip string) (*models.Session, error) {
+	session, isExist, err := s.s.GetByID(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isExist || session.UserID != userID || session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		slog.Info(ErrSessionNotFound.Error(), "userID", userID)
+		return nil, ErrSessionNotFound
+	}
+
+	if time.Since(session.LastSeenAt) > sessionTouchInterval || session.IP != ip {
+		// Only the device listing depends on it, so a failure doesn't fail
+		// the request.
+		if err := s.s.Touch(ctx, session.ID, ip); err != nil {
+			slog.Error("failed to update session", "error", err, "sessionID", session.ID)
+		}
+	}
+
+	return session, nil
+}
+
+func (s *sessionService) List(ctx context.Context, userID int64, currentID string) ([]*models.Session, error) {
+	sessions, err := s.s.ListActive(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if sessions == nil {
+		sessions = []*models.Session{}
+	}
+
+	for _, session := range sessions {
+		session.Current = session.ID == currentID
+	}
+
+	return sessions, nil
+}
+
+func (s *sessionService) Revoke(ctx context.Context, userID int64, id string) error {
+	revoked, err := s.s.Revoke(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	if !revoked {
+		slog.Info(ErrSessionNotFound.Error(), "userID", userID)
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (s *sessionService) RevokeAll(ctx context.Context, userID int64) error {
+	return s.s.RevokeAll(ctx, userID)
+}
+
+func (s *sessionService) tokens(ctx context.Context, session *models.Session, refreshToken string) (*models.SessionTokens, error) {
+	ttl := s.cfg.Sessions.AccessTokenTTL
+	accessToken, err := utils.GenerateToken(ctx, s.keys, strconv.FormatInt(session.UserID, 10), session.ID, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SessionTokens{
+		Session:         session,
+		AccessToken:     accessToken,
+		AccessExpiresAt: time.Now().Add(ttl),
+		RefreshToken:    refreshToken,
+	}, nil
+}
@@ -0,0 +1,370 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/payment"
+	"github.com/maheshrc27/postflow/internal/repository"
+	"github.com/maheshrc27/postflow/internal/transfer"
+)
+
+const grantBatchSize = 100
+
+var (
+	ErrNoSubscription       = errors.New("no active subscription")
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+)
+
+type SubscriptionService interface {
+	GetSubscription(ctx context.Context, userID int64) (*transfer.SubscriptionTransfer, error)
+	Cancel(ctx context.Context, userID int64) error
+	Start(ctx context.Context, userID int64, product *models.Product, event *payment.Event) (*models.Subscription, error)
+	HandleEvent(ctx context.Context, event *payment.Event) (*models.Subscription, error)
+	ReversePayment(ctx context.Context, e *models.PaymentEvent, reason string) (int64, error)
+	RestorePayment(ctx context.Context, e *models.PaymentEvent, reason string) (int64, error)
+	GrantDue(ctx context.Context) (int, error)
+}
+
+type subscriptionService struct {
+	s         repository.SubscriptionRepository
+	p         repository.ProductRepository
+	c         repository.CreditsRepository
+	providers payment.Providers
+}
+
+func NewSubscriptionService(s repository.SubscriptionRepository, p repository.ProductRepository, c repository.CreditsRepository, providers payment.Providers) SubscriptionService {
+	return &subscriptionService{
+		s:         s,
+		p:         p,
+		c:         c,
+		providers: providers,
+	}
+}
+
+func (s *subscriptionService) GetSubscription(ctx context.Context, userID int64) (*transfer.SubscriptionTransfer, error) {
+	sub, isExist, err := s.s.GetCurrentByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isExist {
+		return nil, ErrNoSubscription
+	}
+
+	plan, _, err := s.p.GetByID(ctx, sub.ProductID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &transfer.SubscriptionTransfer{Subscription: sub, Plan: plan}, nil
+}
+
+// Cancel asks the provider to end the subscription when the current period
+// runs out. Credits already granted are kept.
+func (s *subscriptionService) Cancel(ctx context.Context, userID int64) error {
+	sub, isExist, err := s.s.GetCurrentByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !isExist || sub.Status == models.SubscriptionCanceled {
+		slog.Info(ErrNoSubscription.Error(), "userID", userID)
+		return ErrNoSubscription
+	}
+
+	provider, err := s.providers.Get(sub.Provider)
+	if err != nil {
+		return err
+	}
+
+	if err := provider.CancelSubscription(ctx, sub.ProviderSubscriptionID); err != nil {
+		return err
+	}
+
+	sub.CancelAtPeriodEnd = true
+	return s.s.Update(ctx, sub)
+}
+
+// Start records a new subscription and grants its first month of credits.
+func (s *subscriptionService) Start(ctx context.Context, userID int64, product *models.Product, event *payment.Event) (*models.Subscription, error) {
+	start, end := event.PeriodStart, event.PeriodEnd
+	if start.IsZero() {
+		start = time.Now()
+	}
+	if end.IsZero() {
+		end = addInterval(start, product.Interval)
+	}
+
+	sub := models.Subscription{
+		UserID:                 userID,
+		ProductID:              product.ID,
+		Provider:               event.Provider,
+		ProviderSubscriptionID: event.SubscriptionID,
+		Status:                 models.SubscriptionActive,
+		CurrentPeriodStart:     start,
+		CurrentPeriodEnd:       end,
+		NextGrantAt:            start,
+	}
+	if err := s.s.Upsert(ctx, &sub); err != nil {
+		return nil, err
+	}
+
+	if err := s.grantDue(ctx, &sub, product); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// HandleEvent applies a renewal, status change or cancellation reported by
+// the provider and returns the subscription.
+func (s *subscriptionService) HandleEvent(ctx context.Context, event *payment.Event) (*models.Subscription, error) {
+	sub, isExist, err := s.s.GetByProviderID(ctx, event.Provider, event.SubscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The start event may still be on its way; failing makes the provider
+	// deliver this one again later.
+	if !isExist {
+		slog.Info(ErrSubscriptionNotFound.Error(), "provider", event.Provider, "subscriptionID", event.SubscriptionID)
+		return nil, fmt.Errorf("%w: %s", ErrSubscriptionNotFound, event.SubscriptionID)
+	}
+
+	product, isExist, err := s.p.GetByID(ctx, sub.ProductID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isExist {
+		return nil, fmt.Errorf("%w: plan %d", ErrProductNotFound, sub.ProductID)
+	}
+
+	grant, err := s.checkPrice(ctx, sub, event)
+	if err != nil {
+		return nil, err
+	}
+
+	switch event.Type {
+	case payment.EventSubscriptionRenewed:
+		sub.Status = models.SubscriptionActive
+		if !event.PeriodEnd.IsZero() {
+			sub.CurrentPeriodStart, sub.CurrentPeriodEnd = event.PeriodStart, event.PeriodEnd
+		} else {
+			sub.CurrentPeriodStart = sub.CurrentPeriodEnd
+			sub.CurrentPeriodEnd = addInterval(sub.CurrentPeriodStart, product.Interval)
+		}
+	case payment.EventSubscriptionUpdated:
+		if event.SubscriptionStatus != "" {
+			sub.Status = event.SubscriptionStatus
+		}
+		if !event.PeriodEnd.IsZero() {
+			sub.CurrentPeriodStart, sub.CurrentPeriodEnd = event.PeriodStart, event.PeriodEnd
+		}
+		sub.CancelAtPeriodEnd = event.CancelAtPeriodEnd
+	case payment.EventSubscriptionPastDue:
+		sub.Status = models.SubscriptionPastDue
+	case payment.EventSubscriptionCanceled:
+		now := time.Now()
+		sub.Status = models.SubscriptionCanceled
+		sub.CancelAtPeriodEnd = false
+		sub.CanceledAt = &now
+	}
+
+	if err := s.s.Update(ctx, sub); err != nil {
+		return nil, err
+	}
+
+	if !grant {
+		return sub, nil
+	}
+
+	if err := s.grantDue(ctx, sub, product); err != nil {
+		return nil, err
+	}
+
+	return sub, nil
+}
+
+// checkPrice matches the price a renewal was paid at, or the price an update
+// puts the subscription on, against the plan's prices, like the price of a
+// one-off purchase. It reports whether the event may grant credits: updates
+// that report no price, like a cancellation notice, can't be checked and
+// leave the grants to a renewal.
+func (s *subscriptionService) checkPrice(ctx context.Context, sub *models.Subscription, event *payment.Event) (bool, error) {
+	switch event.Type {
+	case payment.EventSubscriptionRenewed:
+	case payment.EventSubscriptionUpdated:
+		if event.Currency == "" {
+			return false, nil
+		}
+	default:
+		return true, nil
+	}
+
+	_, isExist, err := s.p.GetByIDPrice(ctx, sub.ProductID, event.Currency, event.PriceMinor)
+	if err != nil {
+		return false, fmt.Errorf("fetching plan price failed: %w", err)
+	}
+
+	if !isExist {
+		slog.Info(ErrUnknownProduct.Error(), "subscriptionID", sub.ID, "productID", sub.ProductID, "price", event.PriceMinor, "currency", event.Currency)
+		return false, fmt.Errorf("%w: plan %d at %d %s", ErrUnknownProduct, sub.ProductID, event.PriceMinor, event.Currency)
+	}
+
+	return true, nil
+}
+
+// ReversePayment takes back the monthly credits granted for the period a
+// refunded or disputed subscription payment paid for. Grants are reversed
+// under their own reference, so a retried reversal takes nothing twice.
+func (s *subscriptionService) ReversePayment(ctx context.Context, e *models.PaymentEvent, reason string) (int64, error) {
+	return s.movePeriodGrants(ctx, e, models.CreditGrant, models.CreditReversal, reason)
+}
+
+// RestorePayment gives back the credits ReversePayment took once a dispute of
+// the payment is won.
+func (s *subscriptionService) RestorePayment(ctx context.Context, e *models.PaymentEvent, reason string) (int64, error) {
+	return s.movePeriodGrants(ctx, e, models.CreditReversal, models.CreditRestore, reason)
+}
+
+// movePeriodGrants offsets every subscription entry of kind from that falls in
+// the period paid for by e with an entry of kind to.
+func (s *subscriptionService) movePeriodGrants(ctx context.Context, e *models.PaymentEvent, from, to, reason string) (int64, error) {
+	if e.SubscriptionID == nil || e.PeriodStart == nil || e.PeriodEnd == nil {
+		return 0, fmt.Errorf("%w: payment %d paid for no subscription period", ErrSubscriptionNotFound, e.ID)
+	}
+
+	sub, isExist, err := s.s.GetByID(ctx, *e.SubscriptionID)
+	if err != nil {
+		return 0, err
+	}
+
+	if !isExist {
+		slog.Info(ErrSubscriptionNotFound.Error(), "subscriptionID", *e.SubscriptionID)
+		return 0, fmt.Errorf("%w: %d", ErrSubscriptionNotFound, *e.SubscriptionID)
+	}
+
+	entries, err := s.c.ListByReferencePrefix(ctx, from, "subscription", fmt.Sprintf("%d:", sub.ID))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		grantedAt, ok := grantDate(entry.ReferenceID)
+		if !ok || grantedAt.Before(*e.PeriodStart) || !grantedAt.Before(*e.PeriodEnd) {
+			continue
+		}
+
+		err := s.c.Apply(ctx, &models.CreditTransaction{
+			UserID:        entry.UserID,
+			Kind:          to,
+			Amount:        -entry.Amount,
+			Reason:        reason,
+			ReferenceType: entry.ReferenceType,
+			ReferenceID:   entry.ReferenceID,
+			AllowNegative: true,
+			Offsets:       entry.ID,
+		})
+		if err != nil && !errors.Is(err, repository.ErrDuplicateTransaction) {
+			slog.Error("failed to move subscription credits", "error", err, "userID", entry.UserID, "kind", to)
+			return 0, fmt.Errorf("moving subscription credits failed: %w", err)
+		}
+	}
+
+	return sub.UserID, nil
+}
+
+// GrantDue grants the monthly credits of every subscription that is due. It
+// is run periodically by the subscription scheduler.
+func (s *subscriptionService) GrantDue(ctx context.Context) (int, error) {
+	granted := 0
+	for {
+		subs, err := s.s.ListDueForGrant(ctx, grantBatchSize)
+		if err != nil {
+			return granted, err
+		}
+
+		for _, sub := range subs {
+			product, isExist, err := s.p.GetByID(ctx, sub.ProductID)
+			if err != nil {
+				return granted, err
+			}
+			if !isExist {
+				slog.Error("subscription plan not found", "subscriptionID", sub.ID, "productID", sub.ProductID)
+				continue
+			}
+
+			if err := s.grantDue(ctx, sub, product); err != nil {
+				return granted, err
+			}
+			granted++
+		}
+
+		if len(subs) < grantBatchSize {
+			return granted, nil
+		}
+	}
+}
+
+// grantDue grants every monthly allowance of sub that is due and inside the
+// paid period. Each grant is keyed on the subscription and its date, and the
+// schedule only advances if nobody else advanced it first, so concurrent
+// schedulers cannot grant a month twice.
+func (s *subscriptionService) grantDue(ctx context.Context, sub *models.Subscription, product *models.Product) error {
+	now := time.Now()
+	for sub.Status == models.SubscriptionActive &&
+		!sub.NextGrantAt.After(now) &&
+		sub.NextGrantAt.Before(sub.CurrentPeriodEnd.Add(-24*time.Hour)) {
+
+		err := s.c.Apply(ctx, &models.CreditTransaction{
+			UserID:        sub.UserID,
+			Kind:          models.CreditGrant,
+			Amount:        product.Credits,
+			Reason:        fmt.Sprintf("%s monthly credits", product.Name),
+			ReferenceType: "subscription",
+			ReferenceID:   fmt.Sprintf("%d:%d", sub.ID, sub.NextGrantAt.Unix()),
+		})
+		if err != nil && !errors.Is(err, repository.ErrDuplicateTransaction) {
+			return err
+		}
+
+		next := sub.NextGrantAt.AddDate(0, 1, 0)
+		advanced, err := s.s.AdvanceGrant(ctx, sub.ID, sub.NextGrantAt, next)
+		if err != nil {
+			return err
+		}
+		if !advanced {
+			return nil
+		}
+		sub.NextGrantAt = next
+	}
+	return nil
+}
+
+// grantDate reads the date of a monthly grant back from its reference, which
+// grantDue builds from the subscription ID and the grant date.
+func grantDate(referenceID string) (time.Time, bool) {
+	_, date, ok := strings.Cut(referenceID, ":")
+	if !ok {
+		return time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(date, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(unix, 0), true
+}
+
+func addInterval(t time.Time, interval string) time.Time {
+	if interval == models.IntervalYear {
+		return t.AddDate(1, 0, 0)
+	}
+	return t.AddDate(0, 1, 0)
+}
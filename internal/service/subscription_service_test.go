@@ -0,0 +1,325 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/payment"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+// fakeLedger keeps the credits ledger of the service tests in memory.
+// Methods the tests don't reach are left to the embedded interface and
+// panic if called.
+type fakeLedger struct {
+	repository.CreditsRepository
+	mu           sync.Mutex
+	balances     map[int64]int64
+	transactions []*models.CreditTransaction
+}
+
+func newFakeLedger() *fakeLedger {
+	return &fakeLedger{balances: map[int64]int64{}}
+}
+
+func (l *fakeLedger) Apply(ctx context.Context, t *models.CreditTransaction) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, existing := range l.transactions {
+		if t.ReferenceID != "" && existing.Kind == t.Kind && existing.ReferenceType == t.ReferenceType && existing.ReferenceID == t.ReferenceID {
+			return repository.ErrDuplicateTransaction
+		}
+	}
+	if t.Amount < 0 && !t.AllowNegative && l.balances[t.UserID]+t.Amount < 0 {
+		return repository.ErrInsufficientCredits
+	}
+	l.balances[t.UserID] += t.Amount
+	t.ID, t.BalanceAfter = int64(len(l.transactions)+1), l.balances[t.UserID]
+	l.transactions = append(l.transactions, t)
+	return nil
+}
+
+func (l *fakeLedger) GetByReference(ctx context.Context, kind, referenceType, referenceID string) (*models.CreditTransaction, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, t := range l.transactions {
+		if t.Kind == kind && t.ReferenceType == referenceType && t.ReferenceID == referenceID {
+			return t, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (l *fakeLedger) ListByReferencePrefix(ctx context.Context, kind, referenceType, prefix string) ([]*models.CreditTransaction, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var found []*models.CreditTransaction
+	for _, t := range l.transactions {
+		if t.Kind == kind && t.ReferenceType == referenceType && strings.HasPrefix(t.ReferenceID, prefix) {
+			found = append(found, t)
+		}
+	}
+	return found, nil
+}
+
+type fakeSubscriptionRepository struct {
+	repository.SubscriptionRepository
+	mu   sync.Mutex
+	subs map[int64]*models.Subscription
+}
+
+func (r *fakeSubscriptionRepository) Upsert(ctx context.Context, sub *models.Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.subs {
+		if existing.Provider == sub.Provider && existing.ProviderSubscriptionID == sub.ProviderSubscriptionID {
+			sub.ID, sub.NextGrantAt = existing.ID, existing.NextGrantAt
+		}
+	}
+	if sub.ID == 0 {
+		sub.ID = int64(len(r.subs) + 1)
+	}
+	stored := *sub
+	r.subs[sub.ID] = &stored
+	return nil
+}
+
+func (r *fakeSubscriptionRepository) GetByID(ctx context.Context, id int64) (*models.Subscription, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sub, ok := r.subs[id]
+	if !ok {
+		return nil, false, nil
+	}
+	copied := *sub
+	return &copied, true, nil
+}
+
+func (r *fakeSubscriptionRepository) GetByProviderID(ctx context.Context, provider, providerSubscriptionID string) (*models.Subscription, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, sub := range r.subs {
+		if sub.Provider == provider && sub.ProviderSubscriptionID == providerSubscriptionID {
+			copied := *sub
+			return &copied, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (r *fakeSubscriptionRepository) Update(ctx context.Context, sub *models.Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := r.subs[sub.ID]
+	next := stored.NextGrantAt
+	*stored = *sub
+	stored.NextGrantAt = next
+	return nil
+}
+
+func (r *fakeSubscriptionRepository) AdvanceGrant(ctx context.Context, id int64, from, to time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sub := r.subs[id]
+	if !sub.NextGrantAt.Equal(from) {
+		return false, nil
+	}
+	sub.NextGrantAt = to
+	return true, nil
+}
+
+type fakePlanRepository struct {
+	repository.ProductRepository
+	plan *models.Product
+}
+
+func (r fakePlanRepository) GetByID(ctx context.Context, id int64) (*models.Product, bool, error) {
+	return r.plan, r.plan.ID == id, nil
+}
+
+func (r fakePlanRepository) GetByIDPrice(ctx context.Context, id int64, currency string, priceMinor int64) (*models.Product, bool, error) {
+	return r.plan, r.plan.ID == id && r.plan.Currency == currency && r.plan.PriceMinor == priceMinor, nil
+}
+
+const testSubscriber = 7
+
+var testPlan = &models.Product{ID: 4, Provider: payment.ProviderStripe, ProductID: "price_pro", Name: "Pro", PriceMinor: 1900, Currency: "usd", Credits: 40, Interval: models.IntervalMonth}
+
+// newSubscriptionTest starts a monthly subscription whose first period began
+// at start, which grants its first month.
+func newSubscriptionTest(t *testing.T, start time.Time) (SubscriptionService, *fakeLedger, *models.Subscription) {
+	t.Helper()
+
+	ledger := newFakeLedger()
+	subs := &fakeSubscriptionRepository{subs: map[int64]*models.Subscription{}}
+	s := NewSubscriptionService(subs, fakePlanRepository{plan: testPlan}, ledger, payment.Providers{})
+
+	start = start.Truncate(time.Second)
+	sub, err := s.Start(context.Background(), testSubscriber, testPlan, &payment.Event{
+		Provider:       payment.ProviderStripe,
+		SubscriptionID: "sub_1",
+		PeriodStart:    start,
+		PeriodEnd:      start.AddDate(0, 1, 0),
+	})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if got := ledger.balances[testSubscriber]; got != testPlan.Credits {
+		t.Fatalf("balance after start = %d, want %d", got, testPlan.Credits)
+	}
+	return s, ledger, sub
+}
+
+func TestSubscriptionUpdateMapsStatus(t *testing.T) {
+	tests := []struct {
+		status      string
+		wantStatus  string
+		wantCredits int64
+	}{
+		{models.SubscriptionActive, models.SubscriptionActive, 2 * testPlan.Credits},
+		{models.SubscriptionInactive, models.SubscriptionInactive, testPlan.Credits},
+		// Updates that report no status, like a scheduled cancellation,
+		// leave it as it is.
+		{"", models.SubscriptionActive, 2 * testPlan.Credits},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			// The first month is over, so the second one is due as soon as
+			// the update reports the next period.
+			s, ledger, first := newSubscriptionTest(t, time.Now().AddDate(0, -1, 0).Add(-time.Hour))
+
+			sub, err := s.HandleEvent(context.Background(), &payment.Event{
+				Provider:           payment.ProviderStripe,
+				Type:               payment.EventSubscriptionUpdated,
+				SubscriptionID:     "sub_1",
+				PeriodStart:        first.CurrentPeriodEnd,
+				PeriodEnd:          first.CurrentPeriodEnd.AddDate(0, 1, 0),
+				PriceMinor:         testPlan.PriceMinor,
+				Currency:           testPlan.Currency,
+				SubscriptionStatus: tt.status,
+			})
+			if err != nil {
+				t.Fatalf("HandleEvent: %v", err)
+			}
+			if sub.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", sub.Status, tt.wantStatus)
+			}
+			if got := ledger.balances[testSubscriber]; got != tt.wantCredits {
+				t.Errorf("balance = %d, want %d", got, tt.wantCredits)
+			}
+		})
+	}
+}
+
+func TestSubscriptionChecksPrice(t *testing.T) {
+	tests := []struct {
+		name        string
+		eventType   string
+		price       int64
+		currency    string
+		wantErr     bool
+		wantCredits int64
+	}{
+		{"renewal", payment.EventSubscriptionRenewed, testPlan.PriceMinor, testPlan.Currency, false, 2 * testPlan.Credits},
+		{"underpaid renewal", payment.EventSubscriptionRenewed, 100, testPlan.Currency, true, testPlan.Credits},
+		{"renewal in another currency", payment.EventSubscriptionRenewed, testPlan.PriceMinor, "jpy", true, testPlan.Credits},
+		{"renewal without price", payment.EventSubscriptionRenewed, 0, "", true, testPlan.Credits},
+		{"update to another price", payment.EventSubscriptionUpdated, 100, testPlan.Currency, true, testPlan.Credits},
+		// Updates without a price are applied, but the new period is only
+		// granted once it is paid.
+		{"update without price", payment.EventSubscriptionUpdated, 0, "", false, testPlan.Credits},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ledger, first := newSubscriptionTest(t, time.Now().AddDate(0, -1, 0).Add(-time.Hour))
+
+			sub, err := s.HandleEvent(context.Background(), &payment.Event{
+				Provider:       payment.ProviderStripe,
+				Type:           tt.eventType,
+				SubscriptionID: "sub_1",
+				PeriodStart:    first.CurrentPeriodEnd,
+				PeriodEnd:      first.CurrentPeriodEnd.AddDate(0, 1, 0),
+				PriceMinor:     tt.price,
+				Currency:       tt.currency,
+			})
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnknownProduct) {
+					t.Errorf("HandleEvent error = %v, want %v", err, ErrUnknownProduct)
+				}
+			} else if err != nil {
+				t.Fatalf("HandleEvent: %v", err)
+			} else if !sub.CurrentPeriodEnd.Equal(first.CurrentPeriodEnd.AddDate(0, 1, 0)) {
+				t.Errorf("period ends %v, want the next period", sub.CurrentPeriodEnd)
+			}
+
+			if got := ledger.balances[testSubscriber]; got != tt.wantCredits {
+				t.Errorf("balance = %d, want %d", got, tt.wantCredits)
+			}
+		})
+	}
+}
+
+func TestSubscriptionReverseAndRestorePayment(t *testing.T) {
+	s, ledger, sub := newSubscriptionTest(t, time.Now().Add(-time.Hour))
+	ctx := context.Background()
+
+	paid := &models.PaymentEvent{
+		ID:             3,
+		SubscriptionID: &sub.ID,
+		PeriodStart:    &sub.CurrentPeriodStart,
+		PeriodEnd:      &sub.CurrentPeriodEnd,
+	}
+
+	for i := 0; i < 2; i++ {
+		userID, err := s.ReversePayment(ctx, paid, "refund of sale pi_1")
+		if err != nil {
+			t.Fatalf("ReversePayment %d: %v", i+1, err)
+		}
+		if userID != testSubscriber {
+			t.Errorf("user = %d, want %d", userID, testSubscriber)
+		}
+	}
+	if got := ledger.balances[testSubscriber]; got != 0 {
+		t.Fatalf("balance after reversal = %d, want 0", got)
+	}
+	// The reversal comes out of the bucket of the grant it takes back.
+	for _, entry := range ledger.transactions {
+		if entry.Kind == models.CreditReversal && (entry.Offsets == 0 || ledger.transactions[entry.Offsets-1].Kind != models.CreditGrant) {
+			t.Errorf("reversal offsets entry %d, want the grant", entry.Offsets)
+		}
+	}
+
+	// A payment for an earlier period doesn't touch this period's grant.
+	earlierEnd := sub.CurrentPeriodStart
+	earlierStart := earlierEnd.AddDate(0, -1, 0)
+	earlier := &models.PaymentEvent{ID: 2, SubscriptionID: &sub.ID, PeriodStart: &earlierStart, PeriodEnd: &earlierEnd}
+	if _, err := s.RestorePayment(ctx, earlier, "won dispute of sale pi_0"); err != nil {
+		t.Fatalf("RestorePayment of earlier period: %v", err)
+	}
+	if got := ledger.balances[testSubscriber]; got != 0 {
+		t.Fatalf("balance after restoring another period = %d, want 0", got)
+	}
+
+	if _, err := s.RestorePayment(ctx, paid, "won dispute of sale pi_1"); err != nil {
+		t.Fatalf("RestorePayment: %v", err)
+	}
+	if got := ledger.balances[testSubscriber]; got != testPlan.Credits {
+		t.Errorf("balance after restore = %d, want %d", got, testPlan.Credits)
+	}
+}
+
+func TestSubscriptionReverseNeedsPeriod(t *testing.T) {
+	s, _, _ := newSubscriptionTest(t, time.Now().Add(-time.Hour))
+
+	_, err := s.ReversePayment(context.Background(), &models.PaymentEvent{ID: 3}, "refund of sale pi_1")
+	if err == nil {
+		t.Fatal("reversed a payment that paid for no subscription period")
+	}
+}
@@ -0,0 +1,338 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+	"github.com/maheshrc27/postflow/internal/totp"
+)
+
+const (
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+	// maxTwoFactorFailures invalid codes in a row lock out further attempts
+	// for twoFactorLockout.
+	maxTwoFactorFailures = 5
+	twoFactorLockout     = 15 * time.Minute
+)
+
+var (
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotSetUp    = errors.New("set up two-factor authentication first")
+	ErrInvalidTwoFactorCode = errors.New("two-factor code is invalid")
+	ErrTwoFactorLocked      = errors.New("too many invalid two-factor codes, try again later")
+	ErrTwoFactorRequired    = errors.New("enter a two-factor code to continue")
+)
+
+// recoveryCodeEncoding spells recovery codes in lowercase letters and digits.
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+type TwoFactorService interface {
+	Status(ctx context.Context, userID int64) (*models.TwoFactorStatus, error)
+	Enabled(ctx context.Context, userID int64) (bool, error)
+	// Setup starts enrolling an authenticator app. It doesn't protect the
+	// account until Enable confirms a code from the app.
+	Setup(ctx context.Context, userID int64) (*models.TwoFactorSetup, error)
+	// Enable finishes enrolling with a code from the app and returns the
+	// recovery codes, which can't be retrieved later.
+	Enable(ctx context.Context, userID int64, code string) ([]string, error)
+	Disable(ctx context.Context, userID int64) error
+	// RegenerateRecoveryCodes replaces the user's recovery codes.
+	RegenerateRecoveryCodes(ctx context.Context, userID int64) ([]string, error)
+	// Verify checks a code from the user's app, or one of their recovery
+	// codes. Each code works once.
+	Verify(ctx context.Context, userID int64, code string) error
+	// MarkSession allows sensitive actions on the session for a while, after
+	// a code was verified on it.
+	MarkSession(ctx context.Context, sessionID string) error
+	// CheckSession returns ErrTwoFactorRequired if the user has two-factor
+	// authentication and hasn't entered a code on the session recently.
+	CheckSession(ctx context.Context, userID int64, sessionID string) error
+}
+
+type twoFactorService struct {
+	cfg config.Config
+	u   repository.UserRepository
+	t   repository.TwoFactorRepository
+	s   repository.SessionRepository
+}
+
+func NewTwoFactorService(cfg config.Config, u repository.UserRepository, t repository.TwoFactorRepository, s repository.SessionRepository) TwoFactorService {
+	return &twoFactorService{
+		cfg: cfg,
+		u:   u,
+		t:   t,
+		s:   s,
+	}
+}
+
+func (s *twoFactorService) Status(ctx context.Context, userID int64) (*models.TwoFactorStatus, error) {
+	enabled, err := s.Enabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &models.TwoFactorStatus{Enabled: enabled}
+	if enabled {
+		if status.RecoveryCodesLeft, err = s.t.CountRecoveryCodes(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	return status, nil
+}
+
+func (s *twoFactorService) Enabled(ctx context.Context, userID int64) (bool, error) {
+	tf, isExist, err := s.t.Get(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return isExist && tf.ConfirmedAt != nil, nil
+}
+
+func (s *twoFactorService) Setup(ctx context.Context, userID int64) (*models.TwoFactorSetup, error) {
+	user, isExist, err := s.u.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isExist {
+		return nil, errors.New("user not found")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := totp.Seal(s.cfg.KeyEncryptionKey, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := s.t.SetPending(ctx, userID, sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	if !pending {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	return &models.TwoFactorSetup{
+		Secret: secret,
+		URI:    totp.URI(s.cfg.TwoFactor.Issuer, user.Email, secret),
+	}, nil
+}
+
+func (s *twoFactorService) Enable(ctx context.Context, userID int64, code string) ([]string, error) {
+	tf, isExist, err := s.t.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isExist {
+		return nil, ErrTwoFactorNotSetUp
+	}
+
+	if tf.ConfirmedAt != nil {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	if err := s.attempt(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	secret, err := totp.Open(s.cfg.KeyEncryptionKey, tf.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	step, ok := totp.Validate(secret, normalizeTwoFactorCode(code), time.Now())
+	if !ok {
+		return nil, s.fail(userID)
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.t.Confirm(ctx, userID, step, hashes); err != nil {
+		if errors.Is(err, repository.ErrTwoFactorNotPending) {
+			return nil, ErrTwoFactorEnabled
+		}
+		return nil, err
+	}
+
+	slog.Info("two-factor authentication enabled", "userID", userID)
+	return codes, nil
+}
+
+func (s *twoFactorService) Disable(ctx context.Context, userID int64) error {
+	enabled, err := s.Enabled(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !enabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if err := s.t.Delete(ctx, userID); err != nil {
+		return err
+	}
+
+	slog.Info("two-factor authentication disabled", "userID", userID)
+	return nil
+}
+
+func (s *twoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID int64) ([]string, error) {
+	enabled, err := s.Enabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !enabled {
+		return nil, ErrTwoFactorNotEnabled
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.t.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (s *twoFactorService) Verify(ctx context.Context, userID int64, code string) error {
+	tf, isExist, err := s.t.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !isExist || tf.ConfirmedAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if err := s.attempt(ctx, userID); err != nil {
+		return err
+	}
+
+	code = normalizeTwoFactorCode(code)
+
+	var used bool
+	if len(code) == totp.Digits {
+		secret, err := totp.Open(s.cfg.KeyEncryptionKey, tf.Secret)
+		if err != nil {
+			return err
+		}
+
+		if step, ok := totp.Validate(secret, code, time.Now()); ok {
+			if used, err = s.t.UseStep(ctx, userID, step); err != nil {
+				return err
+			}
+		}
+	} else if len(code) == recoveryCodeLength {
+		if used, err = s.t.UseRecoveryCode(ctx, userID, hashToken(code)); err != nil {
+			return err
+		}
+		if used {
+			slog.Info("recovery code used", "userID", userID)
+		}
+	}
+
+	if !used {
+		return s.fail(userID)
+	}
+
+	return nil
+}
+
+func (s *twoFactorService) MarkSession(ctx context.Context, sessionID string) error {
+	return s.s.MarkTwoFactor(ctx, sessionID)
+}
+
+func (s *twoFactorService) CheckSession(ctx context.Context, userID int64, sessionID string) error {
+	enabled, err := s.Enabled(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !enabled {
+		return nil
+	}
+
+	session, isExist, err := s.s.GetByID(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if !isExist || session.UserID != userID || session.TwoFactorAt == nil ||
+		time.Since(*session.TwoFactorAt) > s.cfg.TwoFactor.StepUpTTL {
+		return ErrTwoFactorRequired
+	}
+
+	return nil
+}
+
+// attempt counts an attempt to enter a code towards the lockout. It is
+// counted before the code is checked, in one statement with the lockout
+// check, so that concurrent guesses can't get past the limit; a valid code
+// resets the count.
+func (s *twoFactorService) attempt(ctx context.Context, userID int64) error {
+	allowed, err := s.t.RecordAttempt(ctx, userID, maxTwoFactorFailures, twoFactorLockout)
+	if err != nil {
+		return err
+	}
+
+	if !allowed {
+		slog.Info(ErrTwoFactorLocked.Error(), "userID", userID)
+		return ErrTwoFactorLocked
+	}
+
+	return nil
+}
+
+// fail rejects an invalid code. attempt already counted it.
+func (s *twoFactorService) fail(userID int64) error {
+	slog.Info(ErrInvalidTwoFactorCode.Error(), "userID", userID)
+	return ErrInvalidTwoFactorCode
+}
+
+// normalizeTwoFactorCode drops the separators users type or paste along
+// with codes.
+func normalizeTwoFactorCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+// newRecoveryCodes returns recovery codes as shown to the user, and their
+// hashes as stored.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := recoveryCodeEncoding.EncodeToString(b)[:recoveryCodeLength]
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashToken(code)
+	}
+	return codes, hashes, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"strings"
 
 	"github.com/maheshrc27/postflow/internal/models"
 	"github.com/maheshrc27/postflow/internal/repository"
@@ -12,6 +13,7 @@ import (
 type UserService interface {
 	GetUserInfo(ctx context.Context, id int64) (*models.User, error)
 	RemoveUser(ctx context.Context, userID int64) error
+	UpdateBilling(ctx context.Context, userID int64, billing *models.User) (*models.User, error)
 }
 
 type userService struct {
@@ -45,3 +47,28 @@ func (s *userService) RemoveUser(ctx context.Context, userID int64) error {
 	}
 	return nil
 }
+
+// UpdateBilling replaces the billing details printed on future invoices.
+func (s *userService) UpdateBilling(ctx context.Context, userID int64, billing *models.User) (*models.User, error) {
+	user, isExist, err := s.u.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isExist {
+		err = errors.New("User not found")
+		slog.Info(err.Error())
+		return nil, err
+	}
+
+	user.BillingName = strings.TrimSpace(billing.BillingName)
+	user.BillingAddress = strings.TrimSpace(billing.BillingAddress)
+	user.BillingCountry = strings.ToUpper(strings.TrimSpace(billing.BillingCountry))
+	user.VATID = strings.ToUpper(strings.ReplaceAll(billing.VATID, " ", ""))
+
+	if err := s.u.UpdateBilling(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
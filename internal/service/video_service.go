@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
 
 	config "github.com/maheshrc27/postflow/configs"
 	"github.com/maheshrc27/postflow/internal/models"
@@ -15,22 +16,40 @@ import (
 	"github.com/maheshrc27/postflow/internal/transfer"
 )
 
+var (
+	ErrJobNotFound        = errors.New("job not found")
+	ErrAccountLocked      = errors.New("account is locked")
+	ErrOutstandingBalance = errors.New("account has an outstanding negative balance")
+	ErrNotEntitled        = errors.New("not available on the current plan")
+	ErrInvalidVideo       = errors.New("invalid video request")
+)
+
 type VideoService interface {
 	GetVideos(ctx context.Context, userID int64) ([]*models.MediaAsset, error)
-	RequestVideo(ctx context.Context, userID int64, jsonData string) (string, error)
+	RequestVideo(ctx context.Context, userID int64, jsonData string) (int64, error)
+	GetJob(ctx context.Context, userID, jobID int64) (*transfer.VideoJobTransfer, error)
+	ProcessJob(ctx context.Context, job *models.VideoJob) error
 }
 
 type videoService struct {
-	c   repository.CreditsRepository
-	a   repository.MediaAssetRepository
-	cfg config.Config
+	u      repository.UserRepository
+	c      repository.CreditsRepository
+	a      repository.MediaAssetRepository
+	j      repository.VideoJobRepository
+	e      EntitlementService
+	cfg    config.Config
+	client *http.Client
 }
 
-func NewVideoService(c repository.CreditsRepository, a repository.MediaAssetRepository, cfg config.Config) VideoService {
+func NewVideoService(u repository.UserRepository, c repository.CreditsRepository, a repository.MediaAssetRepository, j repository.VideoJobRepository, e EntitlementService, cfg config.Config) VideoService {
 	return &videoService{
-		c:   c,
-		a:   a,
-		cfg: cfg,
+		u:      u,
+		c:      c,
+		a:      a,
+		j:      j,
+		e:      e,
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.FlaskTimeout},
 	}
 }
 
@@ -43,26 +62,246 @@ func (s *videoService) GetVideos(ctx context.Context, userID int64) ([]*models.M
 	return videos, nil
 }
 
-func (s *videoService) RequestVideo(ctx context.Context, userID int64, jsonData string) (string, error) {
-	credits, isExist, err := s.c.GetByUserID(ctx, userID)
+// RequestVideo holds a credit for the generation and queues a job for the
+// worker pool. The returned job ID can be polled through GetJob.
+func (s *videoService) RequestVideo(ctx context.Context, userID int64, jsonData string) (int64, error) {
+	if err := s.checkStanding(ctx, userID); err != nil {
+		return 0, err
+	}
+
+	jsonData, entitlements, err := s.applyEntitlements(ctx, userID, jsonData)
 	if err != nil {
-		return "", err
+		return 0, err
+	}
+
+	job := &models.VideoJob{
+		UserID:  userID,
+		Payload: jsonData,
+	}
+	reservation := &models.CreditReservation{
+		UserID: userID,
+		Amount: 1,
+		Reason: "video generation",
+	}
+	limits := repository.JobLimits{
+		MaxActive:    entitlements.MaxConcurrentJobs,
+		StorageQuota: entitlements.StorageQuota,
+	}
+
+	jobID, err := s.j.Enqueue(ctx, job, reservation, limits)
+	switch {
+	case errors.Is(err, repository.ErrTooManyJobs):
+		return 0, fmt.Errorf("%w: at most %d videos can be generated at once", ErrNotEntitled, limits.MaxActive)
+	case errors.Is(err, repository.ErrStorageQuota):
+		return 0, fmt.Errorf("%w: storage is limited to %d videos", ErrNotEntitled, limits.StorageQuota)
+	case err != nil:
+		return 0, err
+	}
+
+	return jobID, nil
+}
+
+// applyEntitlements checks the request against the user's plan and returns
+// the payload to send to the generator, with the plan's default resolution
+// and watermark setting filled in, along with the plan's entitlements. The
+// job limits are left to the enqueueing transaction, where they can't race.
+func (s *videoService) applyEntitlements(ctx context.Context, userID int64, jsonData string) (string, *models.Entitlements, error) {
+	var video transfer.VideoTransfer
+	var payload map[string]any
+	if err := json.Unmarshal([]byte(jsonData), &payload); err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrInvalidVideo, err)
+	}
+	// A null body unmarshals into a nil map without an error.
+	if payload == nil {
+		return "", nil, fmt.Errorf("%w: request body must be a JSON object", ErrInvalidVideo)
+	}
+	if err := json.Unmarshal([]byte(jsonData), &video); err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrInvalidVideo, err)
+	}
+
+	if video.Duration <= 0 {
+		return "", nil, fmt.Errorf("%w: duration must be positive", ErrInvalidVideo)
+	}
+
+	entitlements, err := s.e.GetEntitlements(ctx, userID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if video.Duration > entitlements.MaxDurationSeconds {
+		slog.Info(ErrNotEntitled.Error(), "userID", userID, "duration", video.Duration)
+		return "", nil, fmt.Errorf("%w: videos are limited to %d seconds", ErrNotEntitled, entitlements.MaxDurationSeconds)
+	}
+
+	if video.Resolution == "" {
+		video.Resolution = entitlements.Resolutions[0]
+	}
+
+	if !entitlements.AllowsResolution(video.Resolution) {
+		slog.Info(ErrNotEntitled.Error(), "userID", userID, "resolution", video.Resolution)
+		return "", nil, fmt.Errorf("%w: %s resolution", ErrNotEntitled, video.Resolution)
+	}
+
+	payload["resolution"] = video.Resolution
+	payload["watermark"] = entitlements.Watermark
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return string(data), entitlements, nil
+}
+
+// checkStanding refuses generation for locked accounts and for accounts whose
+// balance went negative after a refund or chargeback.
+func (s *videoService) checkStanding(ctx context.Context, userID int64) error {
+	user, isExist, err := s.u.GetByID(ctx, userID)
+	if err != nil {
+		return err
 	}
 
 	if !isExist {
-		err = errors.New("Credits doesn't exist")
+		err = errors.New("User not found")
 		slog.Info(err.Error())
-		return "", err
+		return err
+	}
+
+	if user.LockedAt != nil {
+		slog.Info(ErrAccountLocked.Error(), "userID", userID)
+		return ErrAccountLocked
+	}
+
+	credits, _, err := s.c.GetByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if credits.Credits < 0 {
+		slog.Info(ErrOutstandingBalance.Error(), "userID", userID, "credits", credits.Credits)
+		return ErrOutstandingBalance
+	}
+
+	return nil
+}
+
+func (s *videoService) GetJob(ctx context.Context, userID, jobID int64) (*transfer.VideoJobTransfer, error) {
+	job, isExist, err := s.j.GetByID(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isExist || job.UserID != userID {
+		slog.Info(ErrJobNotFound.Error(), "jobID", jobID, "userID", userID)
+		return nil, ErrJobNotFound
+	}
+
+	result := &transfer.VideoJobTransfer{
+		ID:         job.ID,
+		Status:     job.Status,
+		Error:      job.Error,
+		CreatedAt:  job.CreatedAt,
+		StartedAt:  job.StartedAt,
+		FinishedAt: job.FinishedAt,
+	}
+
+	if job.MediaAssetID != nil {
+		asset, err := s.a.GetByID(ctx, *job.MediaAssetID)
+		if err != nil {
+			return nil, err
+		}
+		result.Asset = asset
+	}
+
+	return result, nil
+}
+
+// ProcessJob runs a claimed job to completion and records the outcome on the
+// job row. The returned error is informational; the job is already marked
+// failed when it is non-nil, unless it was requeued in the meantime, in which
+// case the attempt that claimed it again owns the job and its reservation.
+func (s *videoService) ProcessJob(ctx context.Context, job *models.VideoJob) error {
+	err := s.runJob(ctx, job)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, repository.ErrJobLeaseLost) {
+		slog.Info(err.Error(), "jobID", job.ID, "attempt", job.Attempts)
+		return err
 	}
 
-	if credits.Credits < 1 {
-		err = errors.New("Not enought credits")
+	// The reservation is only released once the job is known to be failed,
+	// so that it is never released under a job that is still running.
+	if markErr := s.j.MarkFailed(ctx, job, err.Error()); markErr != nil {
+		if errors.Is(markErr, repository.ErrJobLeaseLost) {
+			slog.Info(markErr.Error(), "jobID", job.ID, "attempt", job.Attempts)
+		} else {
+			slog.Error("failed to mark job as failed", "error", markErr, "jobID", job.ID)
+		}
+		return err
+	}
+	if job.ReservationID != nil {
+		s.release(ctx, *job.ReservationID)
+	}
+	return err
+}
+
+func (s *videoService) runJob(ctx context.Context, job *models.VideoJob) error {
+	// A job requeued after a crash may already have a generated video. Skip
+	// straight to recording it instead of generating a second one.
+	if job.VideoID == "" {
+		videoID, err := s.generate(ctx, job.Payload)
+		if err != nil {
+			return err
+		}
+
+		if err := s.j.SetVideoID(ctx, job.ID, videoID); err != nil {
+			return err
+		}
+		job.VideoID = videoID
+	}
+
+	videoURL := fmt.Sprintf("https://assets.postflow.org/%s.mp4", job.VideoID)
+
+	asset := models.MediaAsset{
+		UserID:   job.UserID,
+		FileName: job.VideoID,
+		FileType: "video/mp4",
+		FileURL:  videoURL,
+	}
+
+	// The job ID is the ledger reference, so a requeued job that was already
+	// charged is not charged again.
+	charge := &models.CreditTransaction{
+		UserID:        job.UserID,
+		Kind:          models.CreditSpend,
+		Amount:        -1,
+		Reason:        "video generation",
+		ReferenceType: "video_job",
+		ReferenceID:   strconv.FormatInt(job.ID, 10),
+	}
+
+	_, err := s.j.Complete(ctx, job, &asset, charge)
+	return err
+}
+
+func (s *videoService) release(ctx context.Context, reservationID int64) {
+	err := s.c.Release(ctx, reservationID)
+	if err != nil && !errors.Is(err, repository.ErrReservationNotHeld) {
+		slog.Error("failed to release credit reservation", "error", err, "reservationID", reservationID)
+	}
+}
+
+func (s *videoService) generate(ctx context.Context, jsonData string) (string, error) {
+	url := fmt.Sprintf("%s/generate", s.cfg.FlaskURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBufferString(jsonData))
+	if err != nil {
 		slog.Info(err.Error())
 		return "", err
 	}
+	req.Header.Set("Content-Type", "application/json")
 
-	url := fmt.Sprintf("%s/generate", s.cfg.FlaskURL)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer([]byte(jsonData)))
+	resp, err := s.client.Do(req)
 	if err != nil {
 		slog.Info(err.Error())
 		return "", err
@@ -70,7 +309,7 @@ func (s *videoService) RequestVideo(ctx context.Context, userID int64, jsonData
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		err = errors.New("Non-OK HTTP status")
+		err = fmt.Errorf("generator returned status %d", resp.StatusCode)
 		slog.Info(err.Error())
 		return "", err
 	}
@@ -82,27 +321,11 @@ func (s *videoService) RequestVideo(ctx context.Context, userID int64, jsonData
 		return "", err
 	}
 
-	oldCredits := credits.Credits
-	newCredits := oldCredits - 1
-
-	err = s.c.UpdateCredits(ctx, newCredits, userID)
-	if err != nil {
-		return "", err
-	}
-
-	videoURL := fmt.Sprintf("https://assets.postflow.org/%s.mp4", response.VideoID)
-
-	asset := models.MediaAsset{
-		UserID:   userID,
-		FileName: response.VideoID,
-		FileType: "video/mp4",
-		FileURL:  videoURL,
-	}
-
-	_, err = s.a.Create(ctx, &asset)
-	if err != nil {
+	if response.VideoID == "" {
+		err = errors.New("generator returned an empty video_id")
+		slog.Info(err.Error())
 		return "", err
 	}
 
-	return videoURL, nil
+	return response.VideoID, nil
 }
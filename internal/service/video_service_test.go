@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	config "github.com/maheshrc27/postflow/configs"
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+)
+
+// fakeVideoJobRepository keeps jobs in memory and guards completion and
+// failure on the attempt that claimed the job, like the real repository.
+type fakeVideoJobRepository struct {
+	repository.VideoJobRepository
+	mu      sync.Mutex
+	jobs    []*models.VideoJob
+	charges []*models.CreditTransaction
+}
+
+func (r *fakeVideoJobRepository) Enqueue(ctx context.Context, job *models.VideoJob, res *models.CreditReservation, limits repository.JobLimits) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *job
+	stored.ID, stored.Status = int64(len(r.jobs)+1), models.JobStatusQueued
+	res.ID = 100 + stored.ID
+	stored.ReservationID = &res.ID
+	r.jobs = append(r.jobs, &stored)
+	return stored.ID, nil
+}
+
+func (r *fakeVideoJobRepository) ClaimNext(ctx context.Context) (*models.VideoJob, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, job := range r.jobs {
+		if job.Status == models.JobStatusQueued {
+			job.Status = models.JobStatusRunning
+			job.Attempts++
+			claimed := *job
+			return &claimed, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (r *fakeVideoJobRepository) SetVideoID(ctx context.Context, id int64, videoID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs[id-1].VideoID = videoID
+	return nil
+}
+
+// running returns the stored job if it still runs under the given attempt.
+func (r *fakeVideoJobRepository) running(job *models.VideoJob) (*models.VideoJob, bool) {
+	stored := r.jobs[job.ID-1]
+	return stored, stored.Status == models.JobStatusRunning && stored.Attempts == job.Attempts
+}
+
+func (r *fakeVideoJobRepository) Complete(ctx context.Context, job *models.VideoJob, ma *models.MediaAsset, t *models.CreditTransaction) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.running(job)
+	if !ok {
+		return 0, repository.ErrJobLeaseLost
+	}
+	assetID := job.ID
+	stored.Status, stored.MediaAssetID = models.JobStatusSucceeded, &assetID
+	r.charges = append(r.charges, t)
+	return assetID, nil
+}
+
+func (r *fakeVideoJobRepository) MarkFailed(ctx context.Context, job *models.VideoJob, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.running(job)
+	if !ok {
+		return repository.ErrJobLeaseLost
+	}
+	stored.Status, stored.Error = models.JobStatusFailed, reason
+	return nil
+}
+
+func (r *fakeVideoJobRepository) RequeueRunning(ctx context.Context, staleAfter time.Duration) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for _, job := range r.jobs {
+		if job.Status == models.JobStatusRunning {
+			job.Status = models.JobStatusQueued
+			n++
+		}
+	}
+	return n, nil
+}
+
+type fakeCreditsRepository struct {
+	repository.CreditsRepository
+	mu       sync.Mutex
+	released []int64
+}
+
+func (r *fakeCreditsRepository) Release(ctx context.Context, reservationID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.released = append(r.released, reservationID)
+	return nil
+}
+
+// newVideoTest returns a video service whose generator answers with status,
+// and a queued job.
+func newVideoTest(t *testing.T, status int) (VideoService, *fakeVideoJobRepository, *fakeCreditsRepository) {
+	generator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(`{"video_id": "video-1"}`))
+	}))
+	t.Cleanup(generator.Close)
+
+	jobs := &fakeVideoJobRepository{}
+	credits := &fakeCreditsRepository{}
+	cfg := config.Config{FlaskURL: generator.URL, FlaskTimeout: time.Second}
+	s := NewVideoService(nil, credits, nil, jobs, nil, cfg)
+
+	if _, err := jobs.Enqueue(context.Background(), &models.VideoJob{UserID: 1, Payload: "{}"}, &models.CreditReservation{UserID: 1, Amount: 1}, repository.JobLimits{MaxActive: 1, StorageQuota: 1}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	return s, jobs, credits
+}
+
+func claimJob(t *testing.T, jobs *fakeVideoJobRepository) *models.VideoJob {
+	t.Helper()
+	job, found, err := jobs.ClaimNext(context.Background())
+	if err != nil || !found {
+		t.Fatalf("ClaimNext = %v, %v, want a job", found, err)
+	}
+	return job
+}
+
+func TestProcessJobCompletes(t *testing.T) {
+	s, jobs, credits := newVideoTest(t, http.StatusOK)
+
+	if err := s.ProcessJob(context.Background(), claimJob(t, jobs)); err != nil {
+		t.Fatalf("ProcessJob: %v", err)
+	}
+	job := jobs.jobs[0]
+	if job.Status != models.JobStatusSucceeded || job.VideoID != "video-1" {
+		t.Errorf("job = %s with video %q, want succeeded with video-1", job.Status, job.VideoID)
+	}
+	if len(jobs.charges) != 1 || jobs.charges[0].ReferenceType != "video_job" || jobs.charges[0].ReferenceID != "1" {
+		t.Errorf("charges = %+v, want one for job 1", jobs.charges)
+	}
+	if len(credits.released) != 0 {
+		t.Errorf("released %v, want the reservation captured", credits.released)
+	}
+}
+
+func TestProcessJobFailureReleasesReservation(t *testing.T) {
+	s, jobs, credits := newVideoTest(t, http.StatusInternalServerError)
+
+	if err := s.ProcessJob(context.Background(), claimJob(t, jobs)); err == nil {
+		t.Fatal("ProcessJob succeeded with a failing generator")
+	}
+	if job := jobs.jobs[0]; job.Status != models.JobStatusFailed || job.Error == "" {
+		t.Errorf("job = %s with error %q, want failed with a reason", job.Status, job.Error)
+	}
+	if want := *jobs.jobs[0].ReservationID; len(credits.released) != 1 || credits.released[0] != want {
+		t.Errorf("released %v, want reservation %d", credits.released, want)
+	}
+}
+
+func TestProcessJobAfterRequeue(t *testing.T) {
+	ctx := context.Background()
+
+	// A failed attempt that was requeued neither fails the job nor releases
+	// the reservation that the next attempt holds.
+	s, jobs, credits := newVideoTest(t, http.StatusInternalServerError)
+	stale := claimJob(t, jobs)
+	if _, err := jobs.RequeueRunning(ctx, 0); err != nil {
+		t.Fatalf("RequeueRunning: %v", err)
+	}
+	claimJob(t, jobs)
+	if err := s.ProcessJob(ctx, stale); err == nil {
+		t.Fatal("ProcessJob of the stale attempt succeeded with a failing generator")
+	}
+	if job := jobs.jobs[0]; job.Status != models.JobStatusRunning {
+		t.Errorf("job = %s, want still running", job.Status)
+	}
+	if len(credits.released) != 0 {
+		t.Errorf("released %v under a running job", credits.released)
+	}
+
+	// A stale attempt that succeeds doesn't record anything either, and the
+	// current one still completes.
+	s, jobs, _ = newVideoTest(t, http.StatusOK)
+	stale = claimJob(t, jobs)
+	if _, err := jobs.RequeueRunning(ctx, 0); err != nil {
+		t.Fatalf("RequeueRunning: %v", err)
+	}
+	current := claimJob(t, jobs)
+	if err := s.ProcessJob(ctx, stale); !errors.Is(err, repository.ErrJobLeaseLost) {
+		t.Fatalf("ProcessJob of the stale attempt = %v, want %v", err, repository.ErrJobLeaseLost)
+	}
+	if err := s.ProcessJob(ctx, current); err != nil {
+		t.Fatalf("ProcessJob of the current attempt: %v", err)
+	}
+	if job := jobs.jobs[0]; job.Status != models.JobStatusSucceeded || len(jobs.charges) != 1 {
+		t.Errorf("job = %s with %d charges, want succeeded with one", job.Status, len(jobs.charges))
+	}
+}
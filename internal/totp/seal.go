@@ -0,0 +1,54 @@
+package totp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+)
+
+var ErrDecryptSecret = errors.New("unable to decrypt TOTP secret")
+
+// Seal encrypts a secret for storage with AES-GCM under a key derived from
+// key, so that a database leak doesn't leak usable secrets.
+func Seal(key, secret string) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, []byte(secret), nil), nil
+}
+
+// Open decrypts a secret encrypted with Seal.
+func Open(key string, sealed []byte) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return "", ErrDecryptSecret
+	}
+
+	secret, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", ErrDecryptSecret
+	}
+	return string(secret), nil
+}
+
+func newAEAD(key string) (cipher.AEAD, error) {
+	sum := sha256.Sum256([]byte("totp-secrets:" + key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,100 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 secret of the RFC 6238 test vectors,
+// "12345678901234567890", base32 encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeMatchesRFCVectors(t *testing.T) {
+	// The RFC lists eight-digit codes; six-digit codes are their last six
+	// digits.
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code: %v", err)
+		}
+		if code != tt.code {
+			t.Errorf("code at %d = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestValidateAllowsOneStepOfSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	for _, offset := range []time.Duration{-Period, 0, Period} {
+		code, _ := Code(rfcSecret, Step(now.Add(offset)))
+		step, ok := Validate(rfcSecret, code, now)
+		if !ok || step != Step(now.Add(offset)) {
+			t.Errorf("code of %v offset: step %d, ok %v, want step %d", offset, step, ok, Step(now.Add(offset)))
+		}
+	}
+
+	code, _ := Code(rfcSecret, Step(now.Add(2*Period)))
+	if _, ok := Validate(rfcSecret, code, now); ok {
+		t.Error("code two steps ahead was accepted")
+	}
+	if _, ok := Validate(rfcSecret, "12345", now); ok {
+		t.Error("short code was accepted")
+	}
+}
+
+func TestGeneratedSecretWorks(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+
+	now := time.Now()
+	code, err := Code(secret, Step(now))
+	if err != nil {
+		t.Fatalf("Code: %v", err)
+	}
+	if _, ok := Validate(secret, code, now); !ok {
+		t.Error("code of generated secret was rejected")
+	}
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("Postflow", "ada@example.com", rfcSecret))
+	if err != nil {
+		t.Fatalf("parsing URI: %v", err)
+	}
+
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Postflow:ada@example.com" {
+		t.Errorf("URI = %s, want an otpauth totp URI for Postflow:ada@example.com", u)
+	}
+	if q := u.Query(); q.Get("secret") != rfcSecret || q.Get("issuer") != "Postflow" || q.Get("digits") != "6" {
+		t.Errorf("URI parameters = %v", q)
+	}
+}
+
+func TestSealRoundTrip(t *testing.T) {
+	sealed, err := Seal("key", rfcSecret)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+
+	if secret, err := Open("key", sealed); err != nil || secret != rfcSecret {
+		t.Errorf("Open = %q, %v, want %q", secret, err, rfcSecret)
+	}
+	if _, err := Open("other key", sealed); err != ErrDecryptSecret {
+		t.Errorf("Open with other key error = %v, want %v", err, ErrDecryptSecret)
+	}
+}
@@ -0,0 +1,32 @@
+package transfer
+
+import (
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
+// CouponCreate is what an admin may set on a new coupon. The ID, the
+// redemption count and the creation time are left to the database.
+type CouponCreate struct {
+	Code            string     `json:"code"`
+	Credits         int64      `json:"credits"`
+	DiscountPercent int        `json:"discount_percent"`
+	MaxRedemptions  int        `json:"max_redemptions"`
+	StartsAt        *time.Time `json:"starts_at"`
+	ExpiresAt       *time.Time `json:"expires_at"`
+	Campaign        string     `json:"campaign"`
+}
+
+// Coupon returns the coupon to create from the request.
+func (c *CouponCreate) Coupon() *models.Coupon {
+	return &models.Coupon{
+		Code:            c.Code,
+		Credits:         c.Credits,
+		DiscountPercent: c.DiscountPercent,
+		MaxRedemptions:  c.MaxRedemptions,
+		StartsAt:        c.StartsAt,
+		ExpiresAt:       c.ExpiresAt,
+		Campaign:        c.Campaign,
+	}
+}
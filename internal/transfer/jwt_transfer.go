@@ -5,5 +5,25 @@ import "github.com/golang-jwt/jwt/v5"
 type CustomClaims struct {
 	UserID string `json:"user_id"`
 	Email  string `json:"email"`
+	// SessionID names the server-side session the token belongs to.
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// LoginStateClaims carry a login attempt from /login to the OAuth callback.
+type LoginStateClaims struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+	ReturnTo string `json:"return_to,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// TwoFactorClaims carry a login that passed its first step to the page
+// asking for the user's two-factor code.
+type TwoFactorClaims struct {
+	UserID   int64  `json:"user_id"`
+	ReturnTo string `json:"return_to,omitempty"`
 	jwt.RegisteredClaims
 }
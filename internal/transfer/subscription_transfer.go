@@ -0,0 +1,8 @@
+package transfer
+
+import "github.com/maheshrc27/postflow/internal/models"
+
+type SubscriptionTransfer struct {
+	*models.Subscription
+	Plan *models.Product `json:"plan"`
+}
@@ -1,9 +1,27 @@
 package transfer
 
+import (
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+)
+
 type VideoTransfer struct {
 	Category    string `json:"category"`
 	Description string `json:"description"`
+	Duration    int    `json:"duration"`
+	Resolution  string `json:"resolution"`
 }
 type VideoResponseTransfer struct {
 	VideoID string `json:"video_id"`
 }
+
+type VideoJobTransfer struct {
+	ID         int64              `json:"id"`
+	Status     string             `json:"status"`
+	Error      string             `json:"error,omitempty"`
+	Asset      *models.MediaAsset `json:"asset,omitempty"`
+	CreatedAt  time.Time          `json:"created_at"`
+	StartedAt  *time.Time         `json:"started_at,omitempty"`
+	FinishedAt *time.Time         `json:"finished_at,omitempty"`
+}
@@ -0,0 +1,57 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/service"
+)
+
+// CreditExpirySweeper removes expired promotional credits every night at
+// midnight UTC, and once at startup to catch up on missed nights.
+type CreditExpirySweeper struct {
+	s      service.CreditsService
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewCreditExpirySweeper(s service.CreditsService) *CreditExpirySweeper {
+	return &CreditExpirySweeper{s: s}
+}
+
+func (p *CreditExpirySweeper) Start(ctx context.Context) {
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.wg.Add(1)
+	go p.run(ctx)
+}
+
+func (p *CreditExpirySweeper) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.wg.Wait()
+}
+
+func (p *CreditExpirySweeper) run(ctx context.Context) {
+	defer p.wg.Done()
+
+	for {
+		if n, err := p.s.ExpireCredits(ctx); err != nil {
+			slog.Error("expiring credits failed", "error", err)
+		} else if n > 0 {
+			slog.Info("expired promotional credits", "users", n)
+		}
+
+		now := time.Now().UTC()
+		timer := time.NewTimer(now.Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/service"
+)
+
+type fakeCreditsService struct {
+	service.CreditsService
+	runs chan struct{}
+}
+
+func (s *fakeCreditsService) ExpireCredits(ctx context.Context) (int, error) {
+	s.runs <- struct{}{}
+	return 0, errors.New("database is down")
+}
+
+func TestCreditExpirySweeperRunsAtStartup(t *testing.T) {
+	s := &fakeCreditsService{runs: make(chan struct{}, 1)}
+	sweeper := NewCreditExpirySweeper(s)
+	sweeper.Start(context.Background())
+
+	select {
+	case <-s.runs:
+	case <-time.After(time.Second):
+		t.Fatal("sweeper didn't expire credits at startup")
+	}
+
+	// A failed run waits for the next night instead of retrying in a loop,
+	// and Stop doesn't wait for it.
+	stopped := make(chan struct{})
+	go func() {
+		sweeper.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop didn't return")
+	}
+
+	select {
+	case <-s.runs:
+		t.Error("sweeper ran again before midnight")
+	default:
+	}
+}
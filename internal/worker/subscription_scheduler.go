@@ -0,0 +1,60 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/service"
+)
+
+const grantInterval = time.Hour
+
+// SubscriptionScheduler periodically grants the monthly credits of active
+// subscriptions. Grants triggered by webhooks happen immediately; the
+// scheduler covers months inside yearly periods and anything a webhook
+// missed.
+type SubscriptionScheduler struct {
+	s      service.SubscriptionService
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewSubscriptionScheduler(s service.SubscriptionService) *SubscriptionScheduler {
+	return &SubscriptionScheduler{s: s}
+}
+
+func (p *SubscriptionScheduler) Start(ctx context.Context) {
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.wg.Add(1)
+	go p.run(ctx)
+}
+
+func (p *SubscriptionScheduler) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.wg.Wait()
+}
+
+func (p *SubscriptionScheduler) run(ctx context.Context) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(grantInterval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := p.s.GrantDue(ctx); err != nil {
+			slog.Error("granting subscription credits failed", "error", err)
+		} else if n > 0 {
+			slog.Info("granted subscription credits", "subscriptions", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/repository"
+	"github.com/maheshrc27/postflow/internal/service"
+)
+
+const (
+	pollInterval    = 2 * time.Second
+	requeueInterval = time.Minute
+	// staleJobMargin is added to the job timeout to cover recording the
+	// result after the generator returns.
+	staleJobMargin = time.Minute
+)
+
+// VideoWorkerPool claims queued video jobs from the database and hands them to
+// the video service. Each worker polls independently; row locking in
+// ClaimNext keeps two workers from picking up the same job.
+type VideoWorkerPool struct {
+	j          repository.VideoJobRepository
+	v          service.VideoService
+	size       int
+	staleAfter time.Duration
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewVideoWorkerPool returns a pool of size workers. jobTimeout is the longest
+// a job can run, so a job running for longer than that is taken to be
+// abandoned.
+func NewVideoWorkerPool(j repository.VideoJobRepository, v service.VideoService, size int, jobTimeout time.Duration) *VideoWorkerPool {
+	if size < 1 {
+		size = 1
+	}
+	return &VideoWorkerPool{
+		j:          j,
+		v:          v,
+		size:       size,
+		staleAfter: jobTimeout + staleJobMargin,
+	}
+}
+
+// Start launches the workers, along with a loop that requeues jobs abandoned
+// by a worker that stopped, in this process or another. It returns
+// immediately.
+func (p *VideoWorkerPool) Start(ctx context.Context) {
+	p.requeue(ctx)
+
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.wg.Add(1)
+	go p.runRequeue(ctx)
+	for i := 0; i < p.size; i++ {
+		p.wg.Add(1)
+		go p.run(ctx)
+	}
+}
+
+// Stop stops claiming new jobs and waits for jobs in progress to finish.
+func (p *VideoWorkerPool) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.wg.Wait()
+}
+
+func (p *VideoWorkerPool) run(ctx context.Context) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain the queue before going back to sleep.
+		for ctx.Err() == nil && p.processNext(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *VideoWorkerPool) runRequeue(ctx context.Context) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(requeueInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.requeue(ctx)
+		}
+	}
+}
+
+func (p *VideoWorkerPool) requeue(ctx context.Context) {
+	if n, err := p.j.RequeueRunning(ctx, p.staleAfter); err != nil {
+		slog.Error("failed to requeue abandoned jobs", "error", err)
+	} else if n > 0 {
+		slog.Info("requeued abandoned video jobs", "count", n)
+	}
+}
+
+func (p *VideoWorkerPool) processNext(ctx context.Context) bool {
+	job, found, err := p.j.ClaimNext(ctx)
+	if err != nil || !found {
+		return false
+	}
+
+	// Once claimed, a job runs to completion even if the pool is stopping,
+	// otherwise it would be left in the running state until the next start.
+	if err := p.v.ProcessJob(context.WithoutCancel(ctx), job); err != nil {
+		slog.Error("video job failed", "error", err, "jobID", job.ID, "userID", job.UserID)
+	}
+	return true
+}
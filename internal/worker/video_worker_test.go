@@ -0,0 +1,76 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maheshrc27/postflow/internal/models"
+	"github.com/maheshrc27/postflow/internal/repository"
+	"github.com/maheshrc27/postflow/internal/service"
+)
+
+// fakeVideoJobRepository holds one job that an earlier process left running.
+type fakeVideoJobRepository struct {
+	repository.VideoJobRepository
+	mu         sync.Mutex
+	job        models.VideoJob
+	staleAfter time.Duration
+}
+
+func (r *fakeVideoJobRepository) RequeueRunning(ctx context.Context, staleAfter time.Duration) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.staleAfter = staleAfter
+	if r.job.Status != models.JobStatusRunning {
+		return 0, nil
+	}
+	r.job.Status = models.JobStatusQueued
+	return 1, nil
+}
+
+func (r *fakeVideoJobRepository) ClaimNext(ctx context.Context) (*models.VideoJob, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.job.Status != models.JobStatusQueued {
+		return nil, false, nil
+	}
+	r.job.Status = models.JobStatusRunning
+	r.job.Attempts++
+	claimed := r.job
+	return &claimed, true, nil
+}
+
+type fakeVideoService struct {
+	service.VideoService
+	processed chan *models.VideoJob
+}
+
+func (s *fakeVideoService) ProcessJob(ctx context.Context, job *models.VideoJob) error {
+	s.processed <- job
+	return nil
+}
+
+func TestVideoWorkerPoolRecoversAbandonedJob(t *testing.T) {
+	j := &fakeVideoJobRepository{job: models.VideoJob{ID: 1, Status: models.JobStatusRunning, Attempts: 1}}
+	v := &fakeVideoService{processed: make(chan *models.VideoJob, 1)}
+	pool := NewVideoWorkerPool(j, v, 1, 10*time.Minute)
+	pool.Start(context.Background())
+	defer pool.Stop()
+
+	select {
+	case job := <-v.processed:
+		if job.ID != 1 || job.Attempts != 2 {
+			t.Errorf("processed job %d attempt %d, want job 1 attempt 2", job.ID, job.Attempts)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("abandoned job wasn't processed")
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if want := 10*time.Minute + staleJobMargin; j.staleAfter != want {
+		t.Errorf("requeued jobs running for %v, want %v", j.staleAfter, want)
+	}
+}
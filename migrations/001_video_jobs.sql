@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS video_jobs (
+    id             BIGSERIAL PRIMARY KEY,
+    user_id        BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status         TEXT NOT NULL DEFAULT 'queued',
+    payload        TEXT NOT NULL,
+    video_id       TEXT NOT NULL DEFAULT '',
+    media_asset_id BIGINT REFERENCES media_assets(id) ON DELETE SET NULL,
+    error          TEXT NOT NULL DEFAULT '',
+    attempts       INT NOT NULL DEFAULT 0,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    started_at     TIMESTAMPTZ,
+    finished_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS video_jobs_queued_idx ON video_jobs (id) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS video_jobs_user_id_idx ON video_jobs (user_id);
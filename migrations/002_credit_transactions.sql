@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS credit_transactions (
+    id             BIGSERIAL PRIMARY KEY,
+    user_id        BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind           TEXT NOT NULL,
+    amount         BIGINT NOT NULL,
+    balance_after  BIGINT NOT NULL,
+    reason         TEXT NOT NULL DEFAULT '',
+    reference_type TEXT NOT NULL DEFAULT '',
+    reference_id   TEXT NOT NULL DEFAULT '',
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS credit_transactions_user_id_idx ON credit_transactions (user_id, id DESC);
+
+-- A referenced event (a sale, a video job, ...) can only move credits once per kind.
+CREATE UNIQUE INDEX IF NOT EXISTS credit_transactions_reference_idx
+    ON credit_transactions (kind, reference_type, reference_id)
+    WHERE reference_id <> '';
@@ -0,0 +1,15 @@
+ALTER TABLE credits ADD COLUMN IF NOT EXISTS reserved BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS credit_reservations (
+    id             BIGSERIAL PRIMARY KEY,
+    user_id        BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    amount         BIGINT NOT NULL CHECK (amount > 0),
+    status         TEXT NOT NULL DEFAULT 'held',
+    reason         TEXT NOT NULL DEFAULT '',
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    resolved_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS credit_reservations_held_idx ON credit_reservations (user_id) WHERE status = 'held';
+
+ALTER TABLE video_jobs ADD COLUMN IF NOT EXISTS reservation_id BIGINT REFERENCES credit_reservations(id);
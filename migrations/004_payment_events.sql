@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS payment_events (
+    id           BIGSERIAL PRIMARY KEY,
+    provider     TEXT NOT NULL,
+    sale_id      TEXT NOT NULL,
+    status       TEXT NOT NULL DEFAULT 'processing',
+    user_id      BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    email        TEXT NOT NULL DEFAULT '',
+    product_id   TEXT NOT NULL DEFAULT '',
+    price        TEXT NOT NULL DEFAULT '',
+    payload      TEXT NOT NULL DEFAULT '',
+    error        TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    processed_at TIMESTAMPTZ,
+    UNIQUE (provider, sale_id)
+);
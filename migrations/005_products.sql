@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS products (
+    id          BIGSERIAL PRIMARY KEY,
+    provider    TEXT NOT NULL,
+    product_id  TEXT NOT NULL,
+    name        TEXT NOT NULL,
+    price_minor BIGINT NOT NULL CHECK (price_minor >= 0),
+    currency    TEXT NOT NULL DEFAULT 'usd',
+    credits     BIGINT NOT NULL CHECK (credits > 0),
+    active      BOOLEAN NOT NULL DEFAULT true,
+    sort_order  INT NOT NULL DEFAULT 0,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Gumroad variants share a product ID and are told apart by price.
+CREATE UNIQUE INDEX IF NOT EXISTS products_provider_price_idx
+    ON products (provider, product_id, price_minor)
+    WHERE active;
+
+INSERT INTO products (provider, product_id, name, price_minor, currency, credits, sort_order) VALUES
+    ('gumroad', 'ehajql', 'Starter pack', 500, 'usd', 10, 1),
+    ('gumroad', 'ehajql', 'Creator pack', 900, 'usd', 30, 2),
+    ('gumroad', 'ehajql', 'Studio pack', 1500, 'usd', 50, 3);
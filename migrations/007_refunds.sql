@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS lock_reason TEXT NOT NULL DEFAULT '';
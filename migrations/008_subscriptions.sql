@@ -0,0 +1,22 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS interval TEXT NOT NULL DEFAULT '';
+ALTER TABLE products ADD COLUMN IF NOT EXISTS plan TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id                       BIGSERIAL PRIMARY KEY,
+    user_id                  BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    product_id               BIGINT NOT NULL REFERENCES products(id),
+    provider                 TEXT NOT NULL,
+    provider_subscription_id TEXT NOT NULL,
+    status                   TEXT NOT NULL,
+    current_period_start     TIMESTAMPTZ NOT NULL,
+    current_period_end       TIMESTAMPTZ NOT NULL,
+    cancel_at_period_end     BOOLEAN NOT NULL DEFAULT false,
+    next_grant_at            TIMESTAMPTZ NOT NULL,
+    canceled_at              TIMESTAMPTZ,
+    created_at               TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at               TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (provider, provider_subscription_id)
+);
+
+CREATE INDEX IF NOT EXISTS subscriptions_user_id_idx ON subscriptions (user_id);
+CREATE INDEX IF NOT EXISTS subscriptions_next_grant_idx ON subscriptions (next_grant_at) WHERE status = 'active';
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS coupons (
+    id               BIGSERIAL PRIMARY KEY,
+    code             TEXT NOT NULL UNIQUE,
+    credits          BIGINT NOT NULL DEFAULT 0 CHECK (credits >= 0),
+    discount_percent INT NOT NULL DEFAULT 0 CHECK (discount_percent BETWEEN 0 AND 100),
+    max_redemptions  INT NOT NULL DEFAULT 0,
+    redemptions      INT NOT NULL DEFAULT 0,
+    starts_at        TIMESTAMPTZ,
+    expires_at       TIMESTAMPTZ,
+    campaign         TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- A coupon either grants credits or discounts a purchase, never both.
+    CHECK ((credits > 0) <> (discount_percent > 0))
+);
+
+CREATE INDEX IF NOT EXISTS coupons_campaign_idx ON coupons (campaign);
+
+CREATE TABLE IF NOT EXISTS coupon_redemptions (
+    id         BIGSERIAL PRIMARY KEY,
+    coupon_id  BIGINT NOT NULL REFERENCES coupons(id),
+    user_id    BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (coupon_id, user_id)
+);
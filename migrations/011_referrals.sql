@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS referral_code TEXT UNIQUE;
+
+CREATE TABLE IF NOT EXISTS referrals (
+    id            BIGSERIAL PRIMARY KEY,
+    referrer_id   BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- A user can only ever be referred once.
+    referee_id    BIGINT NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    status        TEXT NOT NULL,
+    reject_reason TEXT NOT NULL DEFAULT '',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    resolved_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS referrals_referrer_id_idx ON referrals (referrer_id);
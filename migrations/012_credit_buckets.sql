@@ -0,0 +1,26 @@
+-- Buckets record where the positive part of a balance came from and when it
+-- expires. Debits draw from the soonest-expiring buckets first.
+CREATE TABLE IF NOT EXISTS credit_buckets (
+    id             BIGSERIAL PRIMARY KEY,
+    user_id        BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source         TEXT NOT NULL,
+    amount         BIGINT NOT NULL,
+    remaining      BIGINT NOT NULL CHECK (remaining >= 0),
+    expires_at     TIMESTAMPTZ,
+    transaction_id BIGINT REFERENCES credit_transactions(id),
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS credit_buckets_user_id_idx
+    ON credit_buckets (user_id, expires_at NULLS LAST, id)
+    WHERE remaining > 0;
+CREATE INDEX IF NOT EXISTS credit_buckets_expires_at_idx
+    ON credit_buckets (expires_at)
+    WHERE remaining > 0 AND expires_at IS NOT NULL;
+
+-- Existing balances never expire.
+INSERT INTO credit_buckets (user_id, source, amount, remaining)
+SELECT user_id, 'legacy', credits, credits
+FROM credits
+WHERE credits > 0
+    AND NOT EXISTS (SELECT 1 FROM credit_buckets b WHERE b.user_id = credits.user_id);
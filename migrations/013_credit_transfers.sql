@@ -0,0 +1,16 @@
+-- A transfer moves credits between two accounts. A gift is a transfer whose
+-- recipient is only known once someone redeems its code.
+CREATE TABLE IF NOT EXISTS credit_transfers (
+    id           BIGSERIAL PRIMARY KEY,
+    sender_id    BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    recipient_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    amount       BIGINT NOT NULL CHECK (amount > 0),
+    gift_code    TEXT UNIQUE,
+    note         TEXT NOT NULL DEFAULT '',
+    -- Expiry carried over from promotional credits of the sender.
+    expires_at   TIMESTAMPTZ,
+    redeemed_at  TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS credit_transfers_sender_id_idx ON credit_transfers (sender_id, created_at DESC);
@@ -0,0 +1,40 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS billing_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS billing_address TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS billing_country TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS vat_id TEXT NOT NULL DEFAULT '';
+
+-- Invoice numbers are taken from a per-year counter inside the order
+-- transaction, so they have no gaps.
+CREATE TABLE IF NOT EXISTS invoice_counters (
+    year INT PRIMARY KEY,
+    last BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id               BIGSERIAL PRIMARY KEY,
+    user_id          BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    payment_event_id BIGINT NOT NULL UNIQUE REFERENCES payment_events(id),
+    provider         TEXT NOT NULL,
+    invoice_number   TEXT NOT NULL UNIQUE,
+    currency         TEXT NOT NULL,
+    subtotal_minor   BIGINT NOT NULL,
+    tax_minor        BIGINT NOT NULL DEFAULT 0,
+    total_minor      BIGINT NOT NULL,
+    billing_name     TEXT NOT NULL DEFAULT '',
+    billing_email    TEXT NOT NULL,
+    billing_address  TEXT NOT NULL DEFAULT '',
+    billing_country  TEXT NOT NULL DEFAULT '',
+    vat_id           TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS orders_user_id_idx ON orders (user_id, id DESC);
+
+CREATE TABLE IF NOT EXISTS order_lines (
+    id               BIGSERIAL PRIMARY KEY,
+    order_id         BIGINT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    description      TEXT NOT NULL,
+    quantity         BIGINT NOT NULL,
+    unit_price_minor BIGINT NOT NULL,
+    amount_minor     BIGINT NOT NULL
+);
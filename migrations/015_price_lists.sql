@@ -0,0 +1,36 @@
+-- Each price list prices the catalog for a set of countries in one
+-- currency. The default list applies to countries no other list names.
+CREATE TABLE IF NOT EXISTS price_lists (
+    id         BIGSERIAL PRIMARY KEY,
+    code       TEXT NOT NULL UNIQUE,
+    name       TEXT NOT NULL,
+    currency   TEXT NOT NULL,
+    countries  TEXT[] NOT NULL DEFAULT '{}',
+    is_default BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS price_lists_default_idx ON price_lists (is_default) WHERE is_default;
+
+-- provider_product_id is the ID the provider knows this price by, e.g. a
+-- Stripe price in the list's currency. Empty means the product's own ID.
+CREATE TABLE IF NOT EXISTS product_prices (
+    id                  BIGSERIAL PRIMARY KEY,
+    product_id          BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    price_list_id       BIGINT NOT NULL REFERENCES price_lists(id) ON DELETE CASCADE,
+    provider_product_id TEXT NOT NULL DEFAULT '',
+    price_minor         BIGINT NOT NULL CHECK (price_minor >= 0),
+    currency            TEXT NOT NULL,
+    active              BOOLEAN NOT NULL DEFAULT true,
+    UNIQUE (product_id, price_list_id)
+);
+
+INSERT INTO price_lists (code, name, currency, is_default)
+VALUES ('default', 'Default', 'usd', true)
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO product_prices (product_id, price_list_id, price_minor, currency)
+SELECT p.id, l.id, p.price_minor, p.currency
+FROM products p, price_lists l
+WHERE l.code = 'default'
+ON CONFLICT (product_id, price_list_id) DO NOTHING;
@@ -0,0 +1,24 @@
+-- Additional addresses a user proved they own. Purchases made under one of
+-- them are credited to the user.
+CREATE TABLE IF NOT EXISTS user_emails (
+    email       TEXT PRIMARY KEY,
+    user_id     BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    verified_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS user_emails_user_id_idx ON user_emails (user_id);
+
+-- A claim is a pending proof of ownership: a code mailed to the address that
+-- the user has to enter back.
+CREATE TABLE IF NOT EXISTS email_claims (
+    id           BIGSERIAL PRIMARY KEY,
+    user_id      BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email        TEXT NOT NULL,
+    code_hash    TEXT NOT NULL,
+    attempts     INT NOT NULL DEFAULT 0,
+    expires_at   TIMESTAMPTZ NOT NULL,
+    confirmed_at TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS email_claims_user_id_idx ON email_claims (user_id, email, created_at DESC);
@@ -0,0 +1,21 @@
+-- An identity is a user's account at an identity provider. A user can sign
+-- in with any of their identities.
+CREATE TABLE IF NOT EXISTS user_identities (
+    id            BIGSERIAL PRIMARY KEY,
+    user_id       BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider      TEXT NOT NULL,
+    subject       TEXT NOT NULL,
+    email         TEXT NOT NULL DEFAULT '',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_login_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities (user_id);
+
+-- Google sign-ins so far are kept on the users row.
+INSERT INTO user_identities (user_id, provider, subject, email)
+SELECT id, 'google', google_id, email
+FROM users
+WHERE COALESCE(google_id, '') <> ''
+ON CONFLICT (provider, subject) DO NOTHING;
@@ -0,0 +1,15 @@
+-- A login link signs in whoever opens it. Only a hash of its token is kept,
+-- and it can be used once.
+CREATE TABLE IF NOT EXISTS login_links (
+    id         BIGSERIAL PRIMARY KEY,
+    email      TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    ip         TEXT NOT NULL DEFAULT '',
+    return_to  TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS login_links_email_idx ON login_links (email, created_at);
+CREATE INDEX IF NOT EXISTS login_links_ip_idx ON login_links (ip, created_at);
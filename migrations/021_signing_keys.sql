@@ -0,0 +1,12 @@
+-- Keys session tokens are signed with. Every key that isn't retired is
+-- published at /.well-known/jwks.json and verifies tokens; the most recently
+-- activated one signs. Private keys are encrypted with KEY_ENCRYPTION_KEY.
+CREATE TABLE IF NOT EXISTS signing_keys (
+    kid          TEXT PRIMARY KEY,
+    algorithm    TEXT NOT NULL,
+    private_key  BYTEA NOT NULL,
+    public_key   BYTEA NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    activated_at TIMESTAMPTZ,
+    retired_at   TIMESTAMPTZ
+);
@@ -0,0 +1,29 @@
+-- Two-factor authentication with an authenticator app. The TOTP secret is
+-- encrypted; codes are only accepted once a first code confirmed the
+-- enrollment. last_used_step keeps a code from being used twice, and
+-- failed_attempts locks out guessing.
+CREATE TABLE IF NOT EXISTS two_factor (
+    user_id         BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret          BYTEA NOT NULL,
+    confirmed_at    TIMESTAMPTZ,
+    last_used_step  BIGINT NOT NULL DEFAULT 0,
+    failed_attempts INT NOT NULL DEFAULT 0,
+    last_failed_at  TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Recovery codes sign in when the authenticator app is lost. Only their
+-- hashes are stored, and each works once.
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash  TEXT NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS recovery_codes_user_id_idx ON recovery_codes (user_id);
+
+-- When a two-factor code was last entered on the session. Sensitive actions
+-- require a recent one.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS two_factor_at TIMESTAMPTZ;
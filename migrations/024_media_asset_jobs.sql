@@ -0,0 +1,5 @@
+-- A video job produces at most one asset, so a requeued job finds the asset
+-- of an earlier attempt instead of creating a second one.
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS video_job_id BIGINT REFERENCES video_jobs(id) ON DELETE SET NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS media_assets_video_job_id_idx ON media_assets (video_job_id);
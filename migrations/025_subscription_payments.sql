@@ -0,0 +1,5 @@
+-- The subscription period a payment paid for, so that a refund or dispute of
+-- the payment can find the monthly credits granted for that period.
+ALTER TABLE payment_events ADD COLUMN IF NOT EXISTS subscription_id BIGINT REFERENCES subscriptions(id) ON DELETE SET NULL;
+ALTER TABLE payment_events ADD COLUMN IF NOT EXISTS period_start TIMESTAMPTZ;
+ALTER TABLE payment_events ADD COLUMN IF NOT EXISTS period_end TIMESTAMPTZ;
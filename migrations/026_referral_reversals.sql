@@ -0,0 +1,5 @@
+-- The purchase a referral was rewarded for, so that refunding it takes the
+-- rewards back.
+ALTER TABLE referrals ADD COLUMN IF NOT EXISTS payment_event_id BIGINT REFERENCES payment_events(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS referrals_payment_event_id_idx ON referrals (payment_event_id) WHERE payment_event_id IS NOT NULL;
@@ -0,0 +1,11 @@
+-- A transfer drawn from buckets with different expiries is credited in one
+-- part per expiry, so each keeps the expiry it had on the sender's side.
+-- Transfers without parts are credited as a whole at their expires_at.
+CREATE TABLE IF NOT EXISTS credit_transfer_parts (
+    id          BIGSERIAL PRIMARY KEY,
+    transfer_id BIGINT NOT NULL REFERENCES credit_transfers(id) ON DELETE CASCADE,
+    amount      BIGINT NOT NULL CHECK (amount > 0),
+    expires_at  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS credit_transfer_parts_transfer_id_idx ON credit_transfer_parts (transfer_id);
@@ -0,0 +1,7 @@
+-- Addresses are looked up ignoring case, so that case variants of an address
+-- neither get accounts of their own nor escape the login link throttle.
+CREATE INDEX IF NOT EXISTS users_email_lower_idx ON users (lower(email));
+CREATE INDEX IF NOT EXISTS user_emails_email_lower_idx ON user_emails (lower(email));
+
+DROP INDEX IF EXISTS login_links_email_idx;
+CREATE INDEX IF NOT EXISTS login_links_email_lower_idx ON login_links (lower(email), created_at);
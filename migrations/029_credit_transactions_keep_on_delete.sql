@@ -0,0 +1,7 @@
+-- The ledger outlives the accounts it records, so that the purchases, refunds
+-- and chargebacks of a deleted account can still be accounted for. Entries of
+-- a deleted account keep everything but the user.
+ALTER TABLE credit_transactions ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE credit_transactions DROP CONSTRAINT IF EXISTS credit_transactions_user_id_fkey;
+ALTER TABLE credit_transactions ADD CONSTRAINT credit_transactions_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
@@ -1,19 +1,22 @@
 package utils
 
 import (
+	"context"
 	"errors"
-	"log"
 	"log/slog"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/maheshrc27/postflow/internal/keyring"
 	"github.com/maheshrc27/postflow/internal/transfer"
 )
 
-func GenerateToken(secretKey, userID string, tokenDuration time.Duration) (string, error) {
-	log.Println("generate user id", userID)
+// GenerateToken returns a session access token signed with the keyring's
+// current key.
+func GenerateToken(ctx context.Context, keys *keyring.Keyring, userID, sessionID string, tokenDuration time.Duration) (string, error) {
 	claims := transfer.CustomClaims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenDuration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -21,11 +24,88 @@ func GenerateToken(secretKey, userID string, tokenDuration time.Duration) (strin
 		},
 	}
 
-	log.Printf("%v", claims)
+	signedToken, err := keys.Sign(ctx, claims)
+	if err != nil {
+		slog.Info(err.Error())
+		return "", err
+	}
+
+	return signedToken, nil
+}
+
+// ValidateToken verifies a session access token against the keyring.
+func ValidateToken(ctx context.Context, keys *keyring.Keyring, tokenString string) (*transfer.CustomClaims, error) {
+	token, err := keys.Parse(ctx, tokenString, &transfer.CustomClaims{}, jwt.WithIssuer("postflow"))
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*transfer.CustomClaims); ok && token.Valid {
+		return claims, nil
+	}
+
+	return nil, errors.New("invalid token")
+}
+
+// loginStateKey derives the key login state is signed with, so that it can't
+// be passed off as a session token or the other way around.
+func loginStateKey(secretKey string) []byte {
+	return []byte("login-state:" + secretKey)
+}
+
+func GenerateLoginState(secretKey string, claims *transfer.LoginStateClaims, duration time.Duration) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		Issuer:    "postflow",
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte(secretKey))
+	signedToken, err := token.SignedString(loginStateKey(secretKey))
+	if err != nil {
+		slog.Info(err.Error())
+		return "", err
+	}
+
+	return signedToken, nil
+}
+
+func ValidateLoginState(secretKey, tokenString string) (*transfer.LoginStateClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &transfer.LoginStateClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("invalid token signing method")
+		}
+		return loginStateKey(secretKey), nil
+	})
+
+	if err != nil {
+		slog.Info(err.Error())
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*transfer.LoginStateClaims); ok && token.Valid {
+		return claims, nil
+	}
 
+	return nil, errors.New("invalid login state")
+}
+
+// twoFactorKey derives the key two-factor challenges are signed with, so
+// that they can't be passed off as other tokens.
+func twoFactorKey(secretKey string) []byte {
+	return []byte("two-factor:" + secretKey)
+}
+
+func GenerateTwoFactorChallenge(secretKey string, claims *transfer.TwoFactorClaims, duration time.Duration) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		Issuer:    "postflow",
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signedToken, err := token.SignedString(twoFactorKey(secretKey))
 	if err != nil {
 		slog.Info(err.Error())
 		return "", err
@@ -34,12 +114,12 @@ func GenerateToken(secretKey, userID string, tokenDuration time.Duration) (strin
 	return signedToken, nil
 }
 
-func ValidateToken(secretKey, tokenString string) (*transfer.CustomClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &transfer.CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
+func ValidateTwoFactorChallenge(secretKey, tokenString string) (*transfer.TwoFactorClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &transfer.TwoFactorClaims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("invalid token signing method")
 		}
-		return []byte(secretKey), nil
+		return twoFactorKey(secretKey), nil
 	})
 
 	if err != nil {
@@ -47,9 +127,9 @@ func ValidateToken(secretKey, tokenString string) (*transfer.CustomClaims, error
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*transfer.CustomClaims); ok && token.Valid {
+	if claims, ok := token.Claims.(*transfer.TwoFactorClaims); ok && token.Valid {
 		return claims, nil
 	}
 
-	return nil, errors.New("invalid token")
+	return nil, errors.New("invalid two-factor challenge")
 }